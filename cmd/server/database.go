@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+
+	"go-backend-starter/internal/config"
+	"go-backend-starter/internal/db/migrate"
+	"go-backend-starter/internal/db/migrations"
+	"go-backend-starter/internal/db/postgres"
+	"go-backend-starter/internal/db/sqlite"
+	"go-backend-starter/internal/metrics"
+	"go-backend-starter/internal/repository"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// database is an open connection to the configured database
+type database struct {
+	repo      repository.Repository
+	migrator  *migrate.Migrator
+	collector prometheus.Collector // connection pool metrics
+	close     func()
+}
+
+// openDatabase connects to the database of the configured driver
+func openDatabase(cfg *config.DatabaseConfig) (*database, error) {
+	switch cfg.Driver {
+	case "", "postgres":
+		db, err := postgres.NewPostgresDB(cfg)
+		if err != nil {
+			return nil, err
+		}
+		migrator, err := migrate.NewMigrator(db.Pool, migrations.FS)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		return &database{
+			repo:      repository.NewPostgresRepository(db.Pool),
+			migrator:  migrator,
+			collector: metrics.NewPoolCollector(db.Pool),
+			close:     db.Close,
+		}, nil
+
+	case "sqlite":
+		db, err := sqlite.NewSQLiteDB(cfg)
+		if err != nil {
+			return nil, err
+		}
+		migrator, err := migrate.NewSQLiteMigrator(db.DB, migrations.SQLiteFS)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		return &database{
+			repo:      repository.NewSQLiteRepository(db.DB),
+			migrator:  migrator,
+			collector: collectors.NewDBStatsCollector(db.DB, "sqlite"),
+			close:     db.Close,
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", cfg.Driver)
+	}
+}
@@ -3,24 +3,36 @@ package main
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"go-backend-starter/internal/api/handlers"
+	"go-backend-starter/internal/api/middleware"
 	"go-backend-starter/internal/api/routes"
 	"go-backend-starter/internal/config"
-	"go-backend-starter/internal/db/postgres"
+	"go-backend-starter/internal/mailer"
+	"go-backend-starter/internal/metrics"
 	"go-backend-starter/internal/repository"
 	"go-backend-starter/internal/service"
 	"go-backend-starter/internal/utils"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog/log"
 )
 
+// mailQueueSize is the number of emails that can wait for delivery
+const mailQueueSize = 100
+
+// metricsReadHeaderTimeout limits how long the metrics server waits for the
+// headers of a request, so idle connections cannot pile up
+const metricsReadHeaderTimeout = 5 * time.Second
+
 func main() {
 	// Load configuration
 	cfg, err := config.LoadConfig(".")
@@ -35,22 +47,67 @@ func main() {
 	log.Info().Msg("Configuration loaded successfully")
 	log.Info().Str("environment", cfg.Server.Environment).
 		Int("port", cfg.Server.Port).
+		Str("db_driver", cfg.Database.Driver).
 		Str("db_host", cfg.Database.Host).
 		Int("db_port", cfg.Database.Port).
 		Msg("Application configuration")
 
 	// Set up database connection
 	log.Info().Msg("Connecting to database...")
-	db, err := postgres.NewPostgresDB(&cfg.Database)
+	db, err := openDatabase(&cfg.Database)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to connect to database")
 	}
-	defer db.Close()
+	defer db.close()
 	log.Info().Msg("Database connection established")
 
+	// Run the migrate subcommand instead of the server when requested
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(context.Background(), db.migrator, os.Args[2:]); err != nil {
+			log.Fatal().Err(err).Msg("Migration failed")
+		}
+		return
+	}
+
+	if cfg.Database.AutoMigrate {
+		log.Info().Msg("Applying database migrations...")
+		if err := autoMigrate(context.Background(), db.migrator); err != nil {
+			log.Fatal().Err(err).Msg("Failed to apply database migrations")
+		}
+	}
+
+	// Load JWT signing keys
+	jwtKeys, err := utils.LoadKeySet(&cfg.JWT)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load JWT keys")
+	}
+
+	// Set up password hashing
+	hasher, err := utils.NewPasswordHasher(&cfg.Password)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid password hashing configuration")
+	}
+
+	// Load the password policy and its blocklist
+	passwordPolicy, err := service.NewPasswordPolicy(&cfg.Password)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load password policy")
+	}
+
+	// Set up outgoing email, delivered in the background
+	mailDriver, err := mailer.New(&cfg.Mailer, cfg.Server.Environment)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to set up mailer")
+	}
+	mail := mailer.NewAsyncMailer(mailDriver, mailQueueSize)
+
+	// Units of work run with the configured isolation level
+	if _, err := repository.ParseIsolationLevel(cfg.Database.IsolationLevel); err != nil {
+		log.Fatal().Err(err).Msg("Invalid database configuration")
+	}
+
 	// Initialize layers
-	repo := repository.NewPostgresRepository(db.Pool)
-	srvc := service.NewService(repo, cfg.JWT.Secret, cfg.JWT.Expiration)
+	srvc := service.NewService(db.repo, cfg, jwtKeys, hasher, passwordPolicy, mail)
 	handler := handlers.NewHandler(srvc)
 
 	// Set up Gin router
@@ -58,11 +115,41 @@ func main() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 	router := gin.New()
-	router.Use(gin.Recovery())
+	router.Use(middleware.RecoveryMiddleware())
+
+	// Client IPs feed login throttling, so only trust X-Forwarded-For from known proxies
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatal().Err(err).Msg("Invalid trusted proxies")
+	}
 
 	// Set up routes
 	routes.Setup(router, handler, srvc)
 
+	// Serve metrics on a port of their own, which need not be reachable from
+	// outside: the endpoint is not authenticated
+	var metricsSrv *http.Server
+	if cfg.Metrics.Enabled {
+		if cfg.Metrics.Port == 0 || cfg.Metrics.Port == cfg.Server.Port {
+			log.Fatal().Int("port", cfg.Metrics.Port).Msg("Metrics need a port other than the server port")
+		}
+		prometheus.MustRegister(db.collector)
+
+		mux := http.NewServeMux()
+		mux.Handle(metrics.Path, metrics.Handler())
+		metricsSrv = &http.Server{
+			Addr:              net.JoinHostPort(cfg.Metrics.Host, strconv.Itoa(cfg.Metrics.Port)),
+			Handler:           mux,
+			ReadHeaderTimeout: metricsReadHeaderTimeout,
+		}
+
+		go func() {
+			log.Info().Str("addr", metricsSrv.Addr).Msg("Starting metrics server")
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatal().Err(err).Msg("Failed to start metrics server")
+			}
+		}()
+	}
+
 	// Create server
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%d", cfg.Server.Port),
@@ -92,6 +179,14 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatal().Err(err).Msg("Server forced to shutdown")
 	}
+	if metricsSrv != nil {
+		if err := metricsSrv.Shutdown(ctx); err != nil {
+			log.Error().Err(err).Msg("Metrics server forced to shutdown")
+		}
+	}
+	if err := mail.Close(ctx); err != nil {
+		log.Error().Err(err).Msg("Queued emails were not delivered")
+	}
 
 	log.Info().Msg("Server exiting")
 }
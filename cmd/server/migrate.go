@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"go-backend-starter/internal/db/migrate"
+
+	"github.com/rs/zerolog/log"
+)
+
+const migrateUsage = `usage: server migrate <command>
+
+commands:
+  up          apply all pending migrations
+  down [N]    revert the last N applied migrations (default 1)
+  to N        migrate up or down to version N (0 reverts everything)
+  status      list migrations and when they were applied`
+
+// runMigrate handles the "migrate" subcommand
+func runMigrate(ctx context.Context, migrator *migrate.Migrator, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing migrate command\n%s", migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		if err := baseline(ctx, migrator); err != nil {
+			return err
+		}
+		applied, err := migrator.Up(ctx)
+		logMigrations("Applied migration", applied)
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		logMigrations("Reverted migration", reverted)
+		return err
+
+	case "to":
+		if len(args) < 2 {
+			return fmt.Errorf("missing target version\n%s", migrateUsage)
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil || version < 0 {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		if err := baseline(ctx, migrator); err != nil {
+			return err
+		}
+		changed, err := migrator.To(ctx, version)
+		logMigrations("Migrated", changed)
+		return err
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Local().Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Fprintf(w, "%03d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		return w.Flush()
+
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", args[0], migrateUsage)
+	}
+}
+
+// autoMigrate applies pending migrations during server startup
+func autoMigrate(ctx context.Context, migrator *migrate.Migrator) error {
+	if err := baseline(ctx, migrator); err != nil {
+		return err
+	}
+	applied, err := migrator.Up(ctx)
+	logMigrations("Applied migration", applied)
+	return err
+}
+
+// baseline records a schema created by hand before migrations were tracked
+// as migrated, so that its first migration is not run against it again
+func baseline(ctx context.Context, migrator *migrate.Migrator) error {
+	adopted, err := migrator.Baseline(ctx)
+	if adopted != nil {
+		log.Info().Int("version", adopted.Version).Str("name", adopted.Name).Msg("Recorded existing schema as migrated")
+	}
+	return err
+}
+
+func logMigrations(msg string, changed []migrate.Migration) {
+	for _, m := range changed {
+		log.Info().Int("version", m.Version).Str("name", m.Name).Msg(msg)
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"go-backend-starter/internal/api/problem"
+	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateAPIKey creates an API key for the current user
+func (h *Handler) CreateAPIKey(c *gin.Context) {
+	claims, exists := c.Get("claims")
+	if !exists {
+		problem.Abort(c, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	var input models.CreateAPIKeyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.Write(c, problem.FromBindError(c, err))
+		return
+	}
+
+	jwtClaims := claims.(*utils.JWTClaims)
+	key, err := h.service.CreateAPIKey(c.Request.Context(), jwtClaims.UserID, jwtClaims.HasAMR("mfa"), &input)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, key)
+}
+
+// ListAPIKeys lists the current user's API keys
+func (h *Handler) ListAPIKeys(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		problem.Abort(c, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	keys, err := h.service.ListAPIKeys(c.Request.Context(), userID.(int))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// RevokeAPIKey deletes one of the current user's API keys
+func (h *Handler) RevokeAPIKey(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		problem.Abort(c, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		problem.Abort(c, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+
+	if err := h.service.RevokeAPIKey(c.Request.Context(), userID.(int), id); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+}
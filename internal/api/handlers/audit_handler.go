@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+
+	"go-backend-starter/internal/api/problem"
+	"go-backend-starter/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListAuditEvents retrieves a page of audit events with filtering
+func (h *Handler) ListAuditEvents(c *gin.Context) {
+	var input models.ListAuditEventsInput
+	if err := c.ShouldBindQuery(&input); err != nil {
+		problem.Write(c, problem.FromBindError(c, err))
+		return
+	}
+
+	page, err := h.service.ListAuditEvents(c.Request.Context(), &input)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
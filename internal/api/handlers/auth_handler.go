@@ -1,7 +1,12 @@
 package handlers
 
 import (
+	"errors"
+	"go-backend-starter/internal/api/problem"
 	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/service"
+	"go-backend-starter/internal/utils"
+	"io"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -12,16 +17,187 @@ import (
 func (h *Handler) Login(c *gin.Context) {
 	var input models.LoginInput
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		problem.Write(c, problem.FromBindError(c, err))
 		return
 	}
 
-	token, err := h.service.Login(c.Request.Context(), &input)
+	tokens, challenge, err := h.service.Login(c.Request.Context(), &input, c.ClientIP())
 	if err != nil {
 		log.Error().Err(err).Str("username", input.Username).Msg("Login failed")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	if challenge != nil {
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// LoginMFA completes a login with a second factor
+func (h *Handler) LoginMFA(c *gin.Context) {
+	var input models.MFALoginInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.Write(c, problem.FromBindError(c, err))
+		return
+	}
+
+	tokens, err := h.service.LoginMFA(c.Request.Context(), &input, c.ClientIP())
+	if err != nil {
+		log.Error().Err(err).Str("ip", c.ClientIP()).Msg("MFA login failed")
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Register handles self-service sign up
+func (h *Handler) Register(c *gin.Context) {
+	var input models.RegisterInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.Write(c, problem.FromBindError(c, err))
+		return
+	}
+
+	if err := h.service.Register(c.Request.Context(), &input); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Check your email to finish signing up"})
+}
+
+// VerifyEmail confirms a user's email address with the token that was mailed to them
+func (h *Handler) VerifyEmail(c *gin.Context) {
+	var input models.VerifyEmailInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.Write(c, problem.FromBindError(c, err))
+		return
+	}
+
+	if err := h.service.VerifyEmail(c.Request.Context(), input.Token); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email address verified"})
+}
+
+// ResendVerification sends a new verification email. The response is the
+// same whether or not an unverified account uses the email address.
+func (h *Handler) ResendVerification(c *gin.Context) {
+	var input models.ResendVerificationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.Write(c, problem.FromBindError(c, err))
+		return
+	}
+
+	if err := h.service.ResendVerificationEmail(c.Request.Context(), input.Email); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If an unverified account uses this email address, a verification link has been sent to it"})
+}
+
+// ForgotPassword sends a password reset link. The response is the same
+// whether or not an account uses the email address.
+func (h *Handler) ForgotPassword(c *gin.Context) {
+	var input models.ForgotPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.Write(c, problem.FromBindError(c, err))
+		return
+	}
+
+	if err := h.service.ForgotPassword(c.Request.Context(), input.Email); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If an account uses this email address, a password reset link has been sent to it"})
+}
+
+// ResetPassword sets a new password with a token from a reset email
+func (h *Handler) ResetPassword(c *gin.Context) {
+	var input models.ResetPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.Write(c, problem.FromBindError(c, err))
+		return
+	}
+
+	if err := h.service.ResetPassword(c.Request.Context(), &input); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
+
+// Refresh exchanges a refresh token for a new token pair
+func (h *Handler) Refresh(c *gin.Context) {
+	var input models.RefreshTokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.Write(c, problem.FromBindError(c, err))
+		return
+	}
+
+	tokens, err := h.service.Refresh(c.Request.Context(), input.RefreshToken)
+	if err != nil {
+		if errors.Is(err, service.ErrRefreshTokenReused) {
+			log.Warn().Err(err).Str("ip", c.ClientIP()).Msg("Refresh token reuse, token family revoked")
+		}
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout revokes the current access token and, optionally, its refresh token
+func (h *Handler) Logout(c *gin.Context) {
+	claims, exists := c.Get("claims")
+	if !exists {
+		problem.Abort(c, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	// The body is optional
+	var input models.LogoutInput
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		problem.Write(c, problem.FromBindError(c, err))
+		return
+	}
+
+	jwtClaims := claims.(*utils.JWTClaims)
+	if err := h.service.Logout(c.Request.Context(), jwtClaims, input.RefreshToken); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// JWKS publishes the public keys used to verify access tokens
+func (h *Handler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.service.JWKS())
+}
+
+// EndImpersonation revokes the current impersonation token
+func (h *Handler) EndImpersonation(c *gin.Context) {
+	claims, exists := c.Get("claims")
+	if !exists {
+		problem.Abort(c, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	if err := h.service.EndImpersonation(c.Request.Context(), claims.(*utils.JWTClaims)); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Impersonation ended successfully"})
 }
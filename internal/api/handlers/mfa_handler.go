@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"go-backend-starter/internal/api/problem"
+	"go-backend-starter/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EnrollTOTP starts TOTP enrollment for the current user
+func (h *Handler) EnrollTOTP(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		problem.Abort(c, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	enrollment, err := h.service.EnrollTOTP(c.Request.Context(), userID.(int))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// ConfirmTOTP enables TOTP for the current user and returns their recovery codes
+func (h *Handler) ConfirmTOTP(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		problem.Abort(c, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	var input models.ConfirmTOTPInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.Write(c, problem.FromBindError(c, err))
+		return
+	}
+
+	codes, err := h.service.ConfirmTOTP(c.Request.Context(), userID.(int), input.Code)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, codes)
+}
+
+// ResetUserMFA turns off MFA for a user
+func (h *Handler) ResetUserMFA(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		problem.Abort(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if err := h.service.ResetMFA(c.Request.Context(), id); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Multi-factor authentication reset successfully"})
+}
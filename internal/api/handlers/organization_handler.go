@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"go-backend-starter/internal/api/problem"
+	"go-backend-starter/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateOrganization creates an organization with the current user as its admin
+func (h *Handler) CreateOrganization(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		problem.Abort(c, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	var input models.CreateOrganizationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.Write(c, problem.FromBindError(c, err))
+		return
+	}
+
+	org, err := h.service.CreateOrganization(c.Request.Context(), userID.(int), &input)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, org)
+}
+
+// ListMyOrganizations lists the organizations the current user belongs to
+func (h *Handler) ListMyOrganizations(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		problem.Abort(c, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	memberships, err := h.service.ListUserOrganizations(c.Request.Context(), userID.(int))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, memberships)
+}
+
+// InviteOrganizationMember invites an existing user to the current organization
+func (h *Handler) InviteOrganizationMember(c *gin.Context) {
+	var input models.InviteMemberInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.Write(c, problem.FromBindError(c, err))
+		return
+	}
+
+	invitation, err := h.service.InviteOrganizationMember(c.Request.Context(), &input)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, invitation)
+}
+
+// ListOrganizationInvitations lists the pending invitations to the current organization
+func (h *Handler) ListOrganizationInvitations(c *gin.Context) {
+	invitations, err := h.service.ListOrganizationInvitations(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, invitations)
+}
+
+// CancelInvitation withdraws an invitation to the current organization
+func (h *Handler) CancelInvitation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		problem.Abort(c, http.StatusBadRequest, "Invalid invitation ID")
+		return
+	}
+
+	if err := h.service.CancelInvitation(c.Request.Context(), id); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation cancelled successfully"})
+}
+
+// ListMyInvitations lists the pending invitations of the current user
+func (h *Handler) ListMyInvitations(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		problem.Abort(c, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	invitations, err := h.service.ListUserInvitations(c.Request.Context(), userID.(int))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, invitations)
+}
+
+// AcceptInvitation makes the current user a member of the organization they were invited to
+func (h *Handler) AcceptInvitation(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		problem.Abort(c, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		problem.Abort(c, http.StatusBadRequest, "Invalid invitation ID")
+		return
+	}
+
+	membership, err := h.service.AcceptInvitation(c.Request.Context(), userID.(int), id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, membership)
+}
+
+// DeclineInvitation deletes an invitation of the current user
+func (h *Handler) DeclineInvitation(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		problem.Abort(c, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		problem.Abort(c, http.StatusBadRequest, "Invalid invitation ID")
+		return
+	}
+
+	if err := h.service.DeclineInvitation(c.Request.Context(), userID.(int), id); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation declined successfully"})
+}
+
+// RemoveOrganizationMember removes a user from the current organization
+func (h *Handler) RemoveOrganizationMember(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		problem.Abort(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if err := h.service.RemoveOrganizationMember(c.Request.Context(), id); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"net/http"
+
+	"go-backend-starter/internal/api/problem"
+	"go-backend-starter/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListRoles lists every role with its permissions
+func (h *Handler) ListRoles(c *gin.Context) {
+	roles, err := h.service.ListRoles(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// GetRole gets a role by name
+func (h *Handler) GetRole(c *gin.Context) {
+	role, err := h.service.GetRole(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, role)
+}
+
+// CreateRole creates a custom role
+func (h *Handler) CreateRole(c *gin.Context) {
+	var input models.CreateRoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.Write(c, problem.FromBindError(c, err))
+		return
+	}
+
+	role, err := h.service.CreateRole(c.Request.Context(), &input)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, role)
+}
+
+// UpdateRole replaces a role's description and permissions
+func (h *Handler) UpdateRole(c *gin.Context) {
+	var input models.UpdateRoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		problem.Write(c, problem.FromBindError(c, err))
+		return
+	}
+
+	role, err := h.service.UpdateRole(c.Request.Context(), c.Param("name"), &input)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole deletes a custom role
+func (h *Handler) DeleteRole(c *gin.Context) {
+	if err := h.service.DeleteRole(c.Request.Context(), c.Param("name")); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully"})
+}
+
+// ListPermissions lists every permission a role can grant
+func (h *Handler) ListPermissions(c *gin.Context) {
+	permissions, err := h.service.ListPermissions(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, permissions)
+}
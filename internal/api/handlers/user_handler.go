@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"go-backend-starter/internal/api/problem"
 	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/utils"
 	"net/http"
 	"strconv"
 
@@ -14,19 +16,13 @@ func (h *Handler) GetUser(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		problem.Abort(c, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 
 	user, err := h.service.GetUserByID(c.Request.Context(), id)
 	if err != nil {
-		log.Error().Err(err).Int("id", id).Msg("Get user failed")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
-		return
-	}
-
-	if user == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		c.Error(err)
 		return
 	}
 
@@ -37,14 +33,13 @@ func (h *Handler) GetUser(c *gin.Context) {
 func (h *Handler) CreateUser(c *gin.Context) {
 	var input models.CreateUserInput
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		problem.Write(c, problem.FromBindError(c, err))
 		return
 	}
 
 	user, err := h.service.CreateUser(c.Request.Context(), &input)
 	if err != nil {
-		log.Error().Err(err).Interface("input", input).Msg("Create user failed")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
@@ -56,91 +51,168 @@ func (h *Handler) UpdateUser(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		problem.Abort(c, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 
 	var input models.UpdateUserInput
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		problem.Write(c, problem.FromBindError(c, err))
 		return
 	}
 
 	user, err := h.service.UpdateUser(c.Request.Context(), id, &input)
 	if err != nil {
-		log.Error().Err(err).Int("id", id).Interface("input", input).Msg("Update user failed")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusOK, user)
 }
 
-// DeleteUser deletes a user
+// DeleteUser soft deletes a user
 func (h *Handler) DeleteUser(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		problem.Abort(c, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 
 	if err := h.service.DeleteUser(c.Request.Context(), id); err != nil {
-		log.Error().Err(err).Int("id", id).Msg("Delete user failed")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
 
-// ListUsers retrieves a list of users with pagination
+// ListUsers retrieves a page of users with filtering and sorting
 func (h *Handler) ListUsers(c *gin.Context) {
-	// Default pagination values
-	offset := 0
-	limit := 10
+	var input models.ListUsersInput
+	if err := c.ShouldBindQuery(&input); err != nil {
+		problem.Write(c, problem.FromBindError(c, err))
+		return
+	}
 
-	// Parse offset and limit from query parameters
-	offsetStr := c.DefaultQuery("offset", "0")
-	limitStr := c.DefaultQuery("limit", "10")
+	page, err := h.service.ListUsers(c.Request.Context(), &input)
+	if err != nil {
+		c.Error(err)
+		return
+	}
 
-	if o, err := strconv.Atoi(offsetStr); err == nil {
-		offset = o
+	c.JSON(http.StatusOK, page)
+}
+
+// ListDeletedUsers retrieves a page of soft deleted users
+func (h *Handler) ListDeletedUsers(c *gin.Context) {
+	var input models.ListUsersInput
+	if err := c.ShouldBindQuery(&input); err != nil {
+		problem.Write(c, problem.FromBindError(c, err))
+		return
+	}
+
+	page, err := h.service.ListDeletedUsers(c.Request.Context(), &input)
+	if err != nil {
+		c.Error(err)
+		return
 	}
 
-	if l, err := strconv.Atoi(limitStr); err == nil {
-		limit = l
+	c.JSON(http.StatusOK, page)
+}
+
+// RestoreUser restores a soft deleted user
+func (h *Handler) RestoreUser(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		problem.Abort(c, http.StatusBadRequest, "Invalid user ID")
+		return
 	}
 
-	users, err := h.service.ListUsers(c.Request.Context(), offset, limit)
+	user, err := h.service.RestoreUser(c.Request.Context(), id)
 	if err != nil {
-		log.Error().Err(err).Int("offset", offset).Int("limit", limit).Msg("List users failed")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list users"})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, users)
+	c.JSON(http.StatusOK, user)
+}
+
+// PurgeUser permanently deletes a user
+func (h *Handler) PurgeUser(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		problem.Abort(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if err := h.service.PurgeUser(c.Request.Context(), id); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User purged successfully"})
+}
+
+// UnlockUser lifts a user's login lockout
+func (h *Handler) UnlockUser(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		problem.Abort(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if err := h.service.UnlockUser(c.Request.Context(), id); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked successfully"})
 }
 
 // GetCurrentUser retrieves the current authenticated user
 func (h *Handler) GetCurrentUser(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		problem.Abort(c, http.StatusUnauthorized, "Not authenticated")
 		return
 	}
 
 	user, err := h.service.GetUserByID(c.Request.Context(), userID.(int))
 	if err != nil {
-		log.Error().Err(err).Interface("userID", userID).Msg("Get current user failed")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		c.Error(err)
 		return
 	}
 
-	if user == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	c.JSON(http.StatusOK, user)
+}
+
+// ImpersonateUser issues a short-lived token for acting as a user
+func (h *Handler) ImpersonateUser(c *gin.Context) {
+	claims, exists := c.Get("claims")
+	if !exists {
+		problem.Abort(c, http.StatusUnauthorized, "Not authenticated")
 		return
 	}
 
-	c.JSON(http.StatusOK, user)
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		problem.Abort(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	actor := claims.(*utils.JWTClaims)
+	token, err := h.service.Impersonate(c.Request.Context(), actor, id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	log.Info().Int("actor_id", actor.UserID).Str("actor", actor.Username).Int("target_id", id).
+		Str("ip", c.ClientIP()).Msg("Impersonation started")
+
+	c.JSON(http.StatusOK, token)
 }
@@ -2,42 +2,171 @@ package middleware
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
 
+	"go-backend-starter/internal/api/problem"
+	"go-backend-starter/internal/audit"
+	"go-backend-starter/internal/models"
 	"go-backend-starter/internal/service"
+	"go-backend-starter/internal/tenant"
+	"go-backend-starter/internal/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
 )
 
+// OrganizationHeader selects the organization a request acts in
+const OrganizationHeader = "X-Organization-ID"
+
 func AuthMiddleware(service *service.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
+			problem.Abort(c, http.StatusUnauthorized, "Authorization header is required")
 			return
 		}
 
 		// Check if the authorization header has the right format
 		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header format must be Bearer {token}"})
+		if len(parts) != 2 || (parts[0] != "Bearer" && parts[0] != "ApiKey") {
+			problem.Abort(c, http.StatusUnauthorized, "Authorization header format must be Bearer {token} or ApiKey {key}")
+			return
+		}
+
+		var claims *utils.JWTClaims
+		if parts[0] == "ApiKey" {
+			var key *models.APIKey
+			var err error
+			claims, key, err = service.AuthenticateAPIKey(c.Request.Context(), parts[1], c.ClientIP())
+			if err != nil {
+				c.Error(err)
+				c.Abort()
+				return
+			}
+
+			// Read-only keys may look but not touch
+			if !key.HasScope(models.APIKeyScopeWrite) && !isSafeMethod(c.Request.Method) {
+				problem.Abort(c, http.StatusForbidden, "API key does not have the write scope")
+				return
+			}
+			c.Set("apiKey", key)
+		} else {
+			// Validate token
+			tokenString := parts[1]
+			var err error
+			claims, err = service.ValidateToken(c.Request.Context(), tokenString)
+			if err != nil {
+				// Rejected tokens become a 401, lookup failures a 500
+				log.Error().Err(err).Str("token", tokenString).Msg("Invalid token")
+				c.Error(err)
+				c.Abort()
+				return
+			}
+		}
+
+		// Requests act in the organization named by the header, or else the
+		// user's default organization from the token
+		orgID, fromHeader := claims.OrgID, false
+		if header := c.GetHeader(OrganizationHeader); header != "" {
+			id, err := strconv.Atoi(header)
+			if err != nil || id <= 0 {
+				problem.Abort(c, http.StatusBadRequest, "Invalid "+OrganizationHeader+" header")
+				return
+			}
+			orgID, fromHeader = id, true
+		}
+
+		// Impersonation is limited to the organization it was started from
+		if claims.Act != nil && orgID != claims.OrgID {
+			problem.Abort(c, http.StatusForbidden, "Impersonation tokens cannot switch organizations")
 			return
 		}
 
-		// Validate token
-		tokenString := parts[1]
-		claims, err := service.ValidateToken(tokenString)
+		role := claims.Role
+		if orgID != 0 {
+			member, err := service.GetMembership(c.Request.Context(), orgID, claims.UserID)
+			if err != nil {
+				c.Error(err)
+				c.Abort()
+				return
+			}
+
+			switch {
+			case member != nil:
+				// Inside an organization the user has their role there
+				role = member.Role
+				c.Request = c.Request.WithContext(tenant.WithOrganization(c.Request.Context(), orgID))
+				c.Set("organizationID", orgID)
+			case fromHeader || claims.Act != nil:
+				problem.Abort(c, http.StatusForbidden, "Not a member of this organization")
+				return
+			}
+			// A default organization the user has since left is ignored
+		}
+
+		// Permissions are resolved from the role on every request, so role
+		// changes apply without new tokens
+		permissions, err := service.RolePermissions(c.Request.Context(), role)
 		if err != nil {
-			log.Error().Err(err).Str("token", tokenString).Msg("Invalid token")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.Error(err)
+			c.Abort()
 			return
 		}
 
+		// Audit events name the user, and the admin behind an impersonation
+		source := audit.SourceFrom(c.Request.Context())
+		source.ActorID, source.ActorUsername = &claims.UserID, &claims.Username
+		if claims.Act != nil {
+			source.ImpersonatorID = &claims.Act.UserID
+		}
+		c.Request = c.Request.WithContext(audit.WithSource(c.Request.Context(), source))
+
 		// Set user info in context
 		c.Set("userID", claims.UserID)
 		c.Set("username", claims.Username)
-		c.Set("role", claims.Role)
+		c.Set("role", role)
+		c.Set("claims", claims)
+		c.Set("permissions", permissions)
+
+		c.Next()
+	}
+}
+
+// RequireSession rejects requests made with an API key or under
+// impersonation, for routes that manage the user's credentials
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, isAPIKey := c.Get("apiKey"); isAPIKey {
+			problem.Abort(c, http.StatusForbidden, "This endpoint cannot be used with an API key")
+			return
+		}
+		if claims, exists := c.Get("claims"); exists && claims.(*utils.JWTClaims).Act != nil {
+			problem.Abort(c, http.StatusForbidden, "This endpoint cannot be used while impersonating")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// RequirePermission rejects users whose role does not grant the permission
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		permissions, exists := c.Get("permissions")
+		if !exists {
+			problem.Abort(c, http.StatusUnauthorized, "Not authenticated")
+			return
+		}
+
+		if !permissions.(models.PermissionSet).Has(permission) {
+			problem.Abort(c, http.StatusForbidden, "Insufficient permissions")
+			return
+		}
 
 		c.Next()
 	}
@@ -47,7 +176,7 @@ func RequireRole(roles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		role, exists := c.Get("role")
 		if !exists {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			problem.Abort(c, http.StatusUnauthorized, "Not authenticated")
 			return
 		}
 
@@ -61,7 +190,26 @@ func RequireRole(roles ...string) gin.HandlerFunc {
 		}
 
 		if !authorized {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			problem.Abort(c, http.StatusForbidden, "Insufficient permissions")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireMFA rejects users whose role requires MFA until they have enrolled
+// and logged in with their second factor
+func RequireMFA(service *service.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, exists := c.Get("claims")
+		if !exists {
+			problem.Abort(c, http.StatusUnauthorized, "Not authenticated")
+			return
+		}
+
+		if service.MFARequired(claims.(*utils.JWTClaims)) {
+			problem.Abort(c, http.StatusForbidden, "Multi-factor authentication is required for your role")
 			return
 		}
 
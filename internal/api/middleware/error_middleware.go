@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"go-backend-starter/internal/api/problem"
+	"go-backend-starter/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrorHandler turns errors attached with c.Error into problem+json responses.
+// Domain errors from the service layer are mapped to their HTTP status with
+// their safe message; anything else becomes a generic 500 so internal details
+// never reach the client.
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		err := c.Errors.Last().Err
+		status := errorStatus(err)
+
+		p := problem.New(c, status, "")
+		var domainErr *service.Error
+		if status != http.StatusInternalServerError && errors.As(err, &domainErr) {
+			p.Detail = domainErr.Message
+			for _, fe := range domainErr.Fields {
+				p.Errors = append(p.Errors, problem.FieldError{Field: fe.Field, Rule: fe.Rule, Message: fe.Message})
+			}
+			if domainErr.RetryAfter > 0 {
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(domainErr.RetryAfter.Seconds()))))
+			}
+		} else {
+			log.Error().Err(err).
+				Str("request_id", c.GetString("requestID")).
+				Str("method", c.Request.Method).
+				Str("path", c.Request.URL.Path).
+				Msg("Unhandled error")
+		}
+
+		problem.Write(c, p)
+	}
+}
+
+// errorStatus maps an error kind to its HTTP status code
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrValidation):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, service.ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, service.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrTooManyRequests):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-backend-starter/internal/api/problem"
+	"go-backend-starter/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// serveError runs a request through ErrorHandler to a handler failing with err
+func serveError(t *testing.T, err error) (*httptest.ResponseRecorder, *problem.Problem) {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestIDMiddleware(), ErrorHandler())
+	router.GET("/fail", func(c *gin.Context) { _ = c.Error(err) })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/fail", nil))
+
+	if ct := w.Header().Get("Content-Type"); ct != problem.ContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, problem.ContentType)
+	}
+	var p problem.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("invalid problem %q: %v", w.Body.String(), err)
+	}
+	return w, &p
+}
+
+func TestErrorHandler(t *testing.T) {
+	for _, tt := range []struct {
+		err    error
+		status int
+	}{
+		{service.NotFound("user not found"), http.StatusNotFound},
+		{service.Conflict("username already exists"), http.StatusConflict},
+		{service.Validation("password is too short"), http.StatusUnprocessableEntity},
+		{service.Unauthorized("invalid credentials"), http.StatusUnauthorized},
+		{service.Forbidden("insufficient permissions"), http.StatusForbidden},
+	} {
+		w, p := serveError(t, tt.err)
+		if w.Code != tt.status || p.Status != tt.status {
+			t.Errorf("%v: status %d, problem status %d; want %d", tt.err, w.Code, p.Status, tt.status)
+		}
+		if p.Detail != tt.err.Error() || p.Instance != "/fail" || p.RequestID == "" {
+			t.Errorf("%v: problem = %+v", tt.err, p)
+		}
+	}
+}
+
+func TestErrorHandlerFields(t *testing.T) {
+	_, p := serveError(t, service.InvalidFields("password is too short",
+		service.FieldError{Field: "password", Rule: "min_length", Message: "must be at least 8 characters long"},
+	))
+
+	if len(p.Errors) != 1 || p.Errors[0].Field != "password" || p.Errors[0].Rule != "min_length" {
+		t.Errorf("errors = %+v", p.Errors)
+	}
+}
+
+func TestErrorHandlerRetryAfter(t *testing.T) {
+	w, _ := serveError(t, service.TooManyRequests("too many attempts", 1500*time.Millisecond))
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want the delay rounded up to 2", got)
+	}
+}
+
+func TestErrorHandlerHidesInternalErrors(t *testing.T) {
+	defer zerolog.SetGlobalLevel(zerolog.GlobalLevel())
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	// Including domain errors of no known kind, whose cause may be sensitive
+	for _, err := range []error{
+		errors.New("pq: password authentication failed"),
+		&service.Error{Kind: errors.New("other"), Message: "secret detail"},
+	} {
+		w, p := serveError(t, err)
+		if w.Code != http.StatusInternalServerError || p.Detail != "" {
+			t.Errorf("%v: status %d, detail %q; want 500 without detail", err, w.Code, p.Detail)
+		}
+	}
+}
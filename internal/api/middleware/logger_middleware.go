@@ -3,6 +3,8 @@ package middleware
 import (
 	"time"
 
+	"go-backend-starter/internal/utils"
+
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
 )
@@ -34,10 +36,22 @@ func LoggerMiddleware() gin.HandlerFunc {
 				Str("error", c.Errors.String())
 		}
 
+		// Requests made under impersonation name the real actor
+		if value, exists := c.Get("claims"); exists {
+			if claims := value.(*utils.JWTClaims); claims.Act != nil {
+				logEvent = logEvent.
+					Bool("impersonated", true).
+					Int("user_id", claims.UserID).
+					Int("actor_id", claims.Act.UserID).
+					Str("actor", claims.Act.Username)
+			}
+		}
+
 		logEvent.
 			Str("method", method).
 			Str("path", path).
 			Str("ip", clientIP).
+			Str("request_id", c.GetString("requestID")).
 			Int("status", statusCode).
 			Dur("latency", latency).
 			Msg("Request")
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"runtime/debug"
+
+	"go-backend-starter/internal/api/problem"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// RecoveryMiddleware recovers from panics and responds with a 500 problem
+func RecoveryMiddleware() gin.HandlerFunc {
+	// Log through zerolog instead of gin's own panic writer
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, err any) {
+		log.Error().Interface("panic", err).
+			Str("request_id", c.GetString("requestID")).
+			Str("method", c.Request.Method).
+			Str("path", c.Request.URL.Path).
+			Bytes("stack", debug.Stack()).
+			Msg("Recovered from panic")
+		problem.Abort(c, http.StatusInternalServerError, "")
+	})
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"go-backend-starter/internal/audit"
+	"go-backend-starter/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader carries the request ID in both directions
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDMiddleware assigns every request an ID, reusing a sane incoming
+// X-Request-ID so calls can be traced across services
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			generated, err := utils.GenerateRandomToken(12)
+			if err != nil {
+				c.Next()
+				return
+			}
+			requestID = generated
+		}
+
+		c.Set("requestID", requestID)
+		c.Header(RequestIDHeader, requestID)
+
+		// Audit events name the request they come from
+		c.Request = c.Request.WithContext(audit.WithSource(c.Request.Context(), audit.Source{
+			IP:        c.ClientIP(),
+			RequestID: requestID,
+		}))
+
+		c.Next()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,224 @@
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go-backend-starter/internal/api/middleware"
+	"go-backend-starter/internal/api/problem"
+
+	"github.com/gin-gonic/gin"
+	"github.com/swaggest/swgui/v5emb"
+)
+
+const (
+	// SpecPath serves the OpenAPI document
+	SpecPath = "/openapi.json"
+	// DocsPath serves the interactive documentation
+	DocsPath = "/docs/"
+)
+
+const (
+	bearerScheme = "bearerAuth"
+	apiKeyScheme = "apiKeyAuth"
+)
+
+var pathParamPattern = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// Register builds the document from every route registered so far and
+// serves it together with the Swagger UI. Call it after all API routes.
+func Register(router *gin.Engine) {
+	doc := Build(router.Routes())
+
+	router.GET(SpecPath, func(c *gin.Context) {
+		c.JSON(http.StatusOK, doc)
+	})
+	router.GET(DocsPath+"*any", gin.WrapH(v5emb.New(doc.Info.Title, SpecPath, DocsPath)))
+}
+
+// Build creates the OpenAPI document for the given routes
+func Build(routes gin.RoutesInfo) *Document {
+	registry := newSchemaRegistry()
+	problemSchema := registry.schemaOf(problem.Problem{})
+
+	doc := &Document{
+		OpenAPI: "3.1.0",
+		Info: Info{
+			Title:   "Go Backend Starter API",
+			Version: "1.0.0",
+		},
+		Paths: make(map[string]*PathItem),
+		Components: Components{
+			SecuritySchemes: map[string]*SecurityScheme{
+				bearerScheme: {
+					Type:         "http",
+					Scheme:       "bearer",
+					BearerFormat: "JWT",
+					Description:  "Access token from POST /api/auth/login",
+				},
+				apiKeyScheme: {
+					Type:        "apiKey",
+					Name:        "Authorization",
+					In:          "header",
+					Description: "Personal API key from POST /api/me/api-keys, sent as `ApiKey <key>`",
+				},
+			},
+		},
+		Tags: tags,
+	}
+
+	for _, route := range routes {
+		op, ok := operations[routeKey(route.Method, route.Path)]
+		if !ok {
+			continue
+		}
+
+		path := pathParamPattern.ReplaceAllString(route.Path, "{$1}")
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = &PathItem{}
+			doc.Paths[path] = item
+		}
+		(*item)[strings.ToLower(route.Method)] = buildOperation(registry, problemSchema, route.Path, op)
+	}
+
+	doc.Components.Schemas = registry.schemas
+	return doc
+}
+
+// Check reports routes without documentation and documented operations
+// without a route
+func Check(routes gin.RoutesInfo) error {
+	registered := make(map[string]bool)
+	var undocumented []string
+	for _, route := range routes {
+		key := routeKey(route.Method, route.Path)
+		registered[key] = true
+		if _, ok := operations[key]; !ok && !isDocsRoute(route.Path) {
+			undocumented = append(undocumented, key)
+		}
+	}
+
+	var stale []string
+	for key := range operations {
+		if !registered[key] {
+			stale = append(stale, key)
+		}
+	}
+
+	if len(undocumented) == 0 && len(stale) == 0 {
+		return nil
+	}
+
+	sort.Strings(undocumented)
+	sort.Strings(stale)
+	return fmt.Errorf("openapi spec out of sync with routes: undocumented routes %v, documented but unregistered %v", undocumented, stale)
+}
+
+func buildOperation(registry *schemaRegistry, problemSchema *Schema, ginPath string, op Operation) *OperationObject {
+	obj := &OperationObject{
+		OperationID: op.ID,
+		Summary:     op.Summary,
+		Description: op.Description,
+		Responses:   make(map[string]*Response),
+	}
+	if op.Tag != "" {
+		obj.Tags = []string{op.Tag}
+	}
+
+	errorStatuses := append([]int{}, op.Errors...)
+
+	// Path parameters are numeric IDs, except for resources addressed by name
+	for _, match := range pathParamPattern.FindAllStringSubmatch(ginPath, -1) {
+		schema := &Schema{Type: "integer"}
+		if match[1] == "name" {
+			schema = &Schema{Type: "string"}
+		}
+		obj.Parameters = append(obj.Parameters, ParameterObject{
+			Name:     match[1],
+			In:       "path",
+			Required: true,
+			Schema:   schema,
+		})
+		errorStatuses = append(errorStatuses, http.StatusBadRequest, http.StatusNotFound)
+	}
+
+	if op.Query != nil {
+		obj.Parameters = append(obj.Parameters, registry.queryParameters(op.Query)...)
+		errorStatuses = append(errorStatuses, http.StatusBadRequest, http.StatusUnprocessableEntity)
+	}
+
+	if op.Request != nil {
+		obj.RequestBody = &RequestBody{
+			Required: !op.RequestOptional,
+			Content: map[string]MediaType{
+				"application/json": {Schema: registry.schemaOf(op.Request)},
+			},
+		}
+		errorStatuses = append(errorStatuses, http.StatusBadRequest, http.StatusUnprocessableEntity)
+	}
+
+	if op.Auth {
+		obj.Parameters = append(obj.Parameters, ParameterObject{
+			Name:        middleware.OrganizationHeader,
+			In:          "header",
+			Description: "Organization to act in, defaults to the first organization the user joined",
+			Schema:      &Schema{Type: "integer"},
+		})
+		obj.Security = []SecurityRequirement{{bearerScheme: {}}}
+		if op.SessionOnly {
+			errorStatuses = append(errorStatuses, http.StatusForbidden)
+		} else {
+			obj.Security = append(obj.Security, SecurityRequirement{apiKeyScheme: {}})
+		}
+		errorStatuses = append(errorStatuses, http.StatusUnauthorized)
+	}
+	if op.Permission != "" {
+		obj.Description = strings.TrimSpace(obj.Description + "\n\nRequires permission: " + op.Permission)
+		errorStatuses = append(errorStatuses, http.StatusForbidden)
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := &Response{Description: http.StatusText(status)}
+	if op.Response != nil {
+		schema := &Schema{}
+		if alternatives, ok := op.Response.(OneOf); ok {
+			for _, alt := range alternatives {
+				schema.OneOf = append(schema.OneOf, registry.schemaOf(alt))
+			}
+		} else {
+			schema = registry.schemaOf(op.Response)
+		}
+		success.Content = map[string]MediaType{
+			"application/json": {Schema: schema},
+		}
+	}
+	obj.Responses[strconv.Itoa(status)] = success
+
+	errorStatuses = append(errorStatuses, http.StatusInternalServerError)
+	for _, code := range errorStatuses {
+		obj.Responses[strconv.Itoa(code)] = &Response{
+			Description: http.StatusText(code),
+			Content: map[string]MediaType{
+				problem.ContentType: {Schema: problemSchema},
+			},
+		}
+	}
+
+	return obj
+}
+
+func routeKey(method, path string) string {
+	return method + " " + path
+}
+
+func isDocsRoute(path string) bool {
+	return path == SpecPath || strings.HasPrefix(path, DocsPath)
+}
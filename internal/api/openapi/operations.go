@@ -0,0 +1,476 @@
+package openapi
+
+import (
+	"net/http"
+
+	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/utils"
+)
+
+// Operation documents a single route. Every route registered in
+// routes.Setup needs an entry in operations; the routes tests fail otherwise.
+type Operation struct {
+	ID              string
+	Summary         string
+	Description     string
+	Tag             string
+	Request         interface{} // request body model, nil if the route takes no body
+	RequestOptional bool        // the request body may be omitted
+	Response        interface{} // success response model, a OneOf of models, or nil if the response has no body
+	Status          int         // success status, defaults to 200
+	Query           interface{} // query parameter model, bound from its form tags
+	Auth            bool        // requires a bearer token or an API key
+	SessionOnly     bool        // with Auth, API keys are not accepted
+	Permission      string      // permission required to call the route, empty for any authenticated user
+	Errors          []int       // error statuses beyond those implied by the fields above
+}
+
+// OneOf documents a response that takes one of several shapes
+type OneOf []interface{}
+
+// MessageResponse is the body of routes that only confirm an action
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// HealthResponse is the body of the health check
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+var operations = map[string]Operation{
+	"GET /healthz": {
+		ID:       "healthCheck",
+		Summary:  "Health check",
+		Tag:      "health",
+		Response: HealthResponse{},
+	},
+	"GET /.well-known/jwks.json": {
+		ID:          "getJWKS",
+		Summary:     "Token verification keys",
+		Description: "Public keys for verifying access tokens. Empty when tokens are signed with a shared HS256 secret.",
+		Tag:         "auth",
+		Response:    utils.JWKS{},
+	},
+	"POST /api/auth/login": {
+		ID:      "login",
+		Summary: "Log in",
+		Description: "Authenticates with username and password and returns an access token and a refresh token. " +
+			"Users with MFA enabled get an MFA challenge instead, to be completed at /api/auth/login/mfa.",
+		Tag:      "auth",
+		Request:  models.LoginInput{},
+		Response: OneOf{models.AuthTokens{}, models.MFAChallengeResponse{}},
+		Errors:   []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests},
+	},
+	"POST /api/auth/login/mfa": {
+		ID:          "loginMFA",
+		Summary:     "Complete an MFA login",
+		Description: "Exchanges the mfa_token from /api/auth/login and a TOTP code or a recovery code for a token pair.",
+		Tag:         "auth",
+		Request:     models.MFALoginInput{},
+		Response:    models.AuthTokens{},
+		Errors:      []int{http.StatusUnauthorized},
+	},
+	"POST /api/auth/refresh": {
+		ID:          "refreshToken",
+		Summary:     "Refresh tokens",
+		Description: "Exchanges a refresh token for a new token pair. Replaying a used refresh token revokes its whole family.",
+		Tag:         "auth",
+		Request:     models.RefreshTokenInput{},
+		Response:    models.AuthTokens{},
+		Errors:      []int{http.StatusUnauthorized},
+	},
+	"POST /api/auth/register": {
+		ID:          "register",
+		Summary:     "Register",
+		Description: "Creates an account with the user role and emails a verification link, which can be resent. Responds identically when the address already has an account, whose owner is emailed a notice instead. Fails with 409 when the username is taken and 403 when registration is disabled.",
+		Tag:         "auth",
+		Request:     models.RegisterInput{},
+		Response:    MessageResponse{},
+		Status:      http.StatusAccepted,
+		Errors:      []int{http.StatusForbidden, http.StatusConflict},
+	},
+	"POST /api/auth/verify-email": {
+		ID:          "verifyEmail",
+		Summary:     "Verify an email address",
+		Description: "Redeems the single-use token from the verification email.",
+		Tag:         "auth",
+		Request:     models.VerifyEmailInput{},
+		Response:    MessageResponse{},
+	},
+	"POST /api/auth/verify-email/resend": {
+		ID:          "resendVerification",
+		Summary:     "Resend the verification email",
+		Description: "Emails a new verification link to an unverified account. Responds identically whether or not such an account uses the address.",
+		Tag:         "auth",
+		Request:     models.ResendVerificationInput{},
+		Response:    MessageResponse{},
+		Status:      http.StatusAccepted,
+	},
+	"POST /api/auth/password/forgot": {
+		ID:          "forgotPassword",
+		Summary:     "Request a password reset",
+		Description: "Emails a single-use password reset link. Responds identically whether or not an account uses the address.",
+		Tag:         "auth",
+		Request:     models.ForgotPasswordInput{},
+		Response:    MessageResponse{},
+		Status:      http.StatusAccepted,
+	},
+	"POST /api/auth/password/reset": {
+		ID:          "resetPassword",
+		Summary:     "Reset a password",
+		Description: "Sets a new password with the token from a reset email and revokes all of the user's tokens.",
+		Tag:         "auth",
+		Request:     models.ResetPasswordInput{},
+		Response:    MessageResponse{},
+	},
+	"POST /api/auth/logout": {
+		ID:              "logout",
+		Summary:         "Log out",
+		Description:     "Revokes the current access token and, when given, the refresh token family.",
+		Tag:             "auth",
+		Request:         models.LogoutInput{},
+		RequestOptional: true,
+		Response:        MessageResponse{},
+		Auth:            true,
+		SessionOnly:     true,
+	},
+	"POST /api/auth/impersonation/end": {
+		ID:          "endImpersonation",
+		Summary:     "End an impersonation",
+		Description: "Revokes the impersonation token used for the request. Fails with 422 for other tokens.",
+		Tag:         "auth",
+		Response:    MessageResponse{},
+		Auth:        true,
+		Errors:      []int{http.StatusUnprocessableEntity},
+	},
+	"GET /api/me": {
+		ID:       "getCurrentUser",
+		Summary:  "Get the current user",
+		Tag:      "users",
+		Response: models.User{},
+		Auth:     true,
+		Errors:   []int{http.StatusNotFound},
+	},
+	"POST /api/me/mfa/totp": {
+		ID:          "enrollTOTP",
+		Summary:     "Start TOTP enrollment",
+		Description: "Generates a TOTP secret and its otpauth:// URI for an authenticator app. MFA is enabled once a code is confirmed.",
+		Tag:         "mfa",
+		Response:    models.TOTPEnrollment{},
+		Auth:        true,
+		SessionOnly: true,
+		Errors:      []int{http.StatusConflict},
+	},
+	"POST /api/me/mfa/totp/confirm": {
+		ID:          "confirmTOTP",
+		Summary:     "Confirm TOTP enrollment",
+		Description: "Enables MFA with a code from the authenticator app and returns one-time recovery codes, which are only shown once.",
+		Tag:         "mfa",
+		Request:     models.ConfirmTOTPInput{},
+		Response:    models.RecoveryCodes{},
+		Auth:        true,
+		SessionOnly: true,
+		Errors:      []int{http.StatusConflict},
+	},
+	"POST /api/me/api-keys": {
+		ID:          "createAPIKey",
+		Summary:     "Create an API key",
+		Description: "Creates a personal API key for scripts and other machine clients. The key is only shown in this response.",
+		Tag:         "api-keys",
+		Request:     models.CreateAPIKeyInput{},
+		Response:    models.CreatedAPIKey{},
+		Status:      http.StatusCreated,
+		Auth:        true,
+		SessionOnly: true,
+	},
+	"GET /api/me/api-keys": {
+		ID:          "listAPIKeys",
+		Summary:     "List API keys",
+		Tag:         "api-keys",
+		Response:    []models.APIKey{},
+		Auth:        true,
+		SessionOnly: true,
+	},
+	"DELETE /api/me/api-keys/:id": {
+		ID:          "revokeAPIKey",
+		Summary:     "Revoke an API key",
+		Tag:         "api-keys",
+		Response:    MessageResponse{},
+		Auth:        true,
+		SessionOnly: true,
+		Errors:      []int{http.StatusNotFound},
+	},
+	"POST /api/users/:id/impersonate": {
+		ID:      "impersonateUser",
+		Summary: "Impersonate a user",
+		Description: "Issues a short-lived access token for acting as the user, e.g. to see what they see from /api/me. " +
+			"The token carries the actor in its act claim, cannot be refreshed and stays in the current organization. " +
+			"Admins, users who may impersonate and users with permissions the actor lacks cannot be impersonated.",
+		Tag:         "users",
+		Response:    models.ImpersonationToken{},
+		Auth:        true,
+		SessionOnly: true,
+		Permission:  models.PermissionUsersImpersonate,
+	},
+	"GET /api/me/organizations": {
+		ID:       "listMyOrganizations",
+		Summary:  "List my organizations",
+		Tag:      "organizations",
+		Response: []models.Membership{},
+		Auth:     true,
+	},
+	"POST /api/organizations": {
+		ID:          "createOrganization",
+		Summary:     "Create an organization",
+		Description: "Creates an organization with the current user as its admin.",
+		Tag:         "organizations",
+		Request:     models.CreateOrganizationInput{},
+		Response:    models.Organization{},
+		Status:      http.StatusCreated,
+		Auth:        true,
+		Permission:  models.PermissionOrgsWrite,
+		Errors:      []int{http.StatusConflict},
+	},
+	"DELETE /api/organization/members/:id": {
+		ID:          "removeOrganizationMember",
+		Summary:     "Remove an organization member",
+		Description: "Removes a user from the current organization. Their account is kept.",
+		Tag:         "organizations",
+		Response:    MessageResponse{},
+		Auth:        true,
+		Permission:  models.PermissionOrgsWrite,
+		Errors:      []int{http.StatusNotFound},
+	},
+	"POST /api/organization/invitations": {
+		ID:      "inviteOrganizationMember",
+		Summary: "Invite an organization member",
+		Description: "Invites an existing user, found by email, to the current organization with the given role. " +
+			"They become a member once they accept. Inviting them again replaces the invitation.",
+		Tag:        "organizations",
+		Request:    models.InviteMemberInput{},
+		Response:   models.Invitation{},
+		Status:     http.StatusCreated,
+		Auth:       true,
+		Permission: models.PermissionOrgsWrite,
+		Errors:     []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict},
+	},
+	"GET /api/organization/invitations": {
+		ID:         "listOrganizationInvitations",
+		Summary:    "List pending invitations",
+		Tag:        "organizations",
+		Response:   []models.Invitation{},
+		Auth:       true,
+		Permission: models.PermissionOrgsWrite,
+	},
+	"DELETE /api/organization/invitations/:id": {
+		ID:         "cancelInvitation",
+		Summary:    "Cancel an invitation",
+		Tag:        "organizations",
+		Response:   MessageResponse{},
+		Auth:       true,
+		Permission: models.PermissionOrgsWrite,
+		Errors:     []int{http.StatusNotFound},
+	},
+	"GET /api/me/invitations": {
+		ID:          "listMyInvitations",
+		Summary:     "List my invitations",
+		Tag:         "organizations",
+		Response:    []models.Invitation{},
+		Auth:        true,
+		SessionOnly: true,
+	},
+	"POST /api/me/invitations/:id/accept": {
+		ID:          "acceptInvitation",
+		Summary:     "Accept an invitation",
+		Description: "Makes the current user a member of the organization with the role of the invitation.",
+		Tag:         "organizations",
+		Response:    models.Membership{},
+		Auth:        true,
+		SessionOnly: true,
+		Errors:      []int{http.StatusNotFound, http.StatusConflict},
+	},
+	"DELETE /api/me/invitations/:id": {
+		ID:          "declineInvitation",
+		Summary:     "Decline an invitation",
+		Tag:         "organizations",
+		Response:    MessageResponse{},
+		Auth:        true,
+		SessionOnly: true,
+		Errors:      []int{http.StatusNotFound},
+	},
+	"GET /api/roles": {
+		ID:         "listRoles",
+		Summary:    "List roles",
+		Tag:        "roles",
+		Response:   []models.Role{},
+		Auth:       true,
+		Permission: models.PermissionRolesRead,
+	},
+	"POST /api/roles": {
+		ID:          "createRole",
+		Summary:     "Create a role",
+		Description: "Creates a custom role granting the given permissions. Needs roles:write from the global role; a role in an organization is not enough.",
+		Tag:         "roles",
+		Request:     models.CreateRoleInput{},
+		Response:    models.Role{},
+		Status:      http.StatusCreated,
+		Auth:        true,
+		Permission:  models.PermissionRolesWrite,
+		Errors:      []int{http.StatusConflict},
+	},
+	"GET /api/roles/:name": {
+		ID:         "getRole",
+		Summary:    "Get a role",
+		Tag:        "roles",
+		Response:   models.Role{},
+		Auth:       true,
+		Permission: models.PermissionRolesRead,
+		Errors:     []int{http.StatusNotFound},
+	},
+	"PUT /api/roles/:name": {
+		ID:          "updateRole",
+		Summary:     "Update a role",
+		Description: "Replaces the role's description and permissions. Takes effect on the next request of each user with the role. The admin role cannot be changed. Needs roles:write from the global role; a role in an organization is not enough.",
+		Tag:         "roles",
+		Request:     models.UpdateRoleInput{},
+		Response:    models.Role{},
+		Auth:        true,
+		Permission:  models.PermissionRolesWrite,
+		Errors:      []int{http.StatusNotFound},
+	},
+	"DELETE /api/roles/:name": {
+		ID:          "deleteRole",
+		Summary:     "Delete a role",
+		Description: "Deletes a custom role. Built-in roles and roles still assigned to users cannot be deleted. Needs roles:write from the global role; a role in an organization is not enough.",
+		Tag:         "roles",
+		Response:    MessageResponse{},
+		Auth:        true,
+		Permission:  models.PermissionRolesWrite,
+		Errors:      []int{http.StatusNotFound, http.StatusConflict},
+	},
+	"GET /api/permissions": {
+		ID:         "listPermissions",
+		Summary:    "List permissions",
+		Tag:        "roles",
+		Response:   []models.Permission{},
+		Auth:       true,
+		Permission: models.PermissionRolesRead,
+	},
+	"GET /api/audit-events": {
+		ID:      "listAuditEvents",
+		Summary: "List audit events",
+		Description: "Returns a page of the audit log, newest first. Follow next_cursor for older events. " +
+			"before and after hold only the changed fields, with passwords redacted. " +
+			"Inside an organization only its events are listed.",
+		Tag:        "audit",
+		Response:   models.AuditEventPage{},
+		Query:      models.ListAuditEventsInput{},
+		Auth:       true,
+		Permission: models.PermissionAuditRead,
+	},
+	"DELETE /api/users/:id/mfa": {
+		ID:          "resetUserMFA",
+		Summary:     "Reset a user's MFA",
+		Description: "Turns off MFA and deletes the recovery codes, e.g. for a user who lost their device.",
+		Tag:         "mfa",
+		Response:    MessageResponse{},
+		Auth:        true,
+		Permission:  models.PermissionUsersSecurity,
+	},
+	"POST /api/users": {
+		ID:         "createUser",
+		Summary:    "Create a user",
+		Tag:        "users",
+		Request:    models.CreateUserInput{},
+		Response:   models.User{},
+		Status:     http.StatusCreated,
+		Auth:       true,
+		Permission: models.PermissionUsersWrite,
+		Errors:     []int{http.StatusConflict},
+	},
+	"GET /api/users": {
+		ID:      "listUsers",
+		Summary: "List users",
+		Description: "Returns a page of users. Follow next_cursor / prev_cursor to move between pages; " +
+			"sort takes a field name, prefixed with - for descending order.",
+		Tag:        "users",
+		Response:   models.UserPage{},
+		Query:      models.ListUsersInput{},
+		Auth:       true,
+		Permission: models.PermissionUsersRead,
+	},
+	"GET /api/users/:id": {
+		ID:         "getUser",
+		Summary:    "Get a user",
+		Tag:        "users",
+		Response:   models.User{},
+		Auth:       true,
+		Permission: models.PermissionUsersRead,
+	},
+	"PUT /api/users/:id": {
+		ID:         "updateUser",
+		Summary:    "Update a user",
+		Tag:        "users",
+		Request:    models.UpdateUserInput{},
+		Response:   models.User{},
+		Auth:       true,
+		Permission: models.PermissionUsersWrite,
+		Errors:     []int{http.StatusConflict},
+	},
+	"DELETE /api/users/:id": {
+		ID:          "deleteUser",
+		Summary:     "Delete a user",
+		Description: "Soft deletes the user and revokes their tokens. Deleted users can be restored until purged.",
+		Tag:         "users",
+		Response:    MessageResponse{},
+		Auth:        true,
+		Permission:  models.PermissionUsersDelete,
+	},
+	"GET /api/users/deleted": {
+		ID:         "listDeletedUsers",
+		Summary:    "List deleted users",
+		Tag:        "users",
+		Response:   models.UserPage{},
+		Query:      models.ListUsersInput{},
+		Auth:       true,
+		Permission: models.PermissionUsersRead,
+	},
+	"POST /api/users/:id/restore": {
+		ID:         "restoreUser",
+		Summary:    "Restore a deleted user",
+		Tag:        "users",
+		Response:   models.User{},
+		Auth:       true,
+		Permission: models.PermissionUsersDelete,
+	},
+	"DELETE /api/users/:id/purge": {
+		ID:          "purgeUser",
+		Summary:     "Permanently delete a user",
+		Description: "Removes the user and all of their data. This cannot be undone.",
+		Tag:         "users",
+		Response:    MessageResponse{},
+		Auth:        true,
+		Permission:  models.PermissionUsersDelete,
+	},
+	"POST /api/users/:id/unlock": {
+		ID:          "unlockUser",
+		Summary:     "Unlock a user",
+		Description: "Lifts a login lockout caused by failed login attempts and resets the failure count.",
+		Tag:         "users",
+		Response:    MessageResponse{},
+		Auth:        true,
+		Permission:  models.PermissionUsersSecurity,
+	},
+}
+
+var tags = []Tag{
+	{Name: "auth", Description: "Authentication and tokens"},
+	{Name: "users", Description: "User management"},
+	{Name: "mfa", Description: "Two-factor authentication"},
+	{Name: "api-keys", Description: "Personal API keys"},
+	{Name: "roles", Description: "Roles and permissions"},
+	{Name: "organizations", Description: "Organizations and their members"},
+	{Name: "audit", Description: "Audit log of administrative actions"},
+	{Name: "health", Description: "Service health"},
+}
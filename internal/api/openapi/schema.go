@@ -0,0 +1,202 @@
+package openapi
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaRegistry turns Go types into JSON schemas, collecting named struct
+// types as reusable components
+type schemaRegistry struct {
+	schemas map[string]*Schema
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{schemas: make(map[string]*Schema)}
+}
+
+// schemaOf returns the schema of the value's type, or nil for a nil value
+func (r *schemaRegistry) schemaOf(v interface{}) *Schema {
+	if v == nil {
+		return nil
+	}
+	return r.schemaFor(reflect.TypeOf(v))
+}
+
+func (r *schemaRegistry) schemaFor(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Pointer {
+		return r.schemaFor(t.Elem())
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		if _, ok := r.schemas[t.Name()]; !ok {
+			// Reserve the name first so recursive types terminate
+			r.schemas[t.Name()] = &Schema{}
+			*r.schemas[t.Name()] = *r.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + t.Name()}
+	case t.Kind() == reflect.Struct:
+		return r.structSchema(t)
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Int8, reflect.Int16:
+		return &Schema{Type: "integer"}
+	case reflect.Uint, reflect.Uint32, reflect.Uint64, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: "integer", Minimum: float(0)}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: r.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: r.schemaFor(t.Elem())}
+	default:
+		return &Schema{}
+	}
+}
+
+// structSchema describes a struct from its json and binding tags
+func (r *schemaRegistry) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, skip := jsonName(field)
+		if skip {
+			continue
+		}
+
+		// Embedded structs without a json name are flattened, like encoding/json does
+		if field.Anonymous && field.Tag.Get("json") == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				inner := r.structSchema(embedded)
+				for k, v := range inner.Properties {
+					schema.Properties[k] = v
+				}
+				schema.Required = append(schema.Required, inner.Required...)
+				continue
+			}
+		}
+
+		prop := r.schemaFor(field.Type)
+		if field.Type.Kind() == reflect.Pointer && prop.Ref == "" {
+			prop.Type = []interface{}{prop.Type, "null"}
+		}
+
+		if required := applyBindingRules(prop, field); required {
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = prop
+	}
+
+	return schema
+}
+
+// applyBindingRules translates validator rules into schema keywords and
+// reports whether the field is required
+func applyBindingRules(schema *Schema, field reflect.StructField) bool {
+	required := false
+	isString := field.Type.Kind() == reflect.String
+
+	for _, rule := range strings.Split(field.Tag.Get("binding"), ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = true
+		case "email":
+			schema.Format = "email"
+		case "oneof":
+			for _, v := range strings.Fields(param) {
+				schema.Enum = append(schema.Enum, v)
+			}
+		case "len":
+			n, err := strconv.Atoi(param)
+			if err != nil || !isString {
+				continue
+			}
+			schema.MinLength = &n
+			schema.MaxLength = &n
+		case "min", "max":
+			n, err := strconv.Atoi(param)
+			if err != nil {
+				continue
+			}
+			switch {
+			case isString && name == "min":
+				schema.MinLength = &n
+			case isString && name == "max":
+				schema.MaxLength = &n
+			case name == "min":
+				schema.Minimum = float(float64(n))
+			default:
+				schema.Maximum = float(float64(n))
+			}
+		}
+	}
+
+	if strings.Contains(strings.ToLower(field.Name), "password") {
+		schema.WriteOnly = true
+	}
+
+	return required
+}
+
+func jsonName(field reflect.StructField) (name string, skip bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	name, _, _ = strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+	return name, false
+}
+
+func float(f float64) *float64 {
+	return &f
+}
+
+// queryParameters describes each field of a query model by its form tag
+func (r *schemaRegistry) queryParameters(v interface{}) []ParameterObject {
+	t := reflect.TypeOf(v)
+	var params []ParameterObject
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("form"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		schema := r.schemaFor(field.Type)
+		required := applyBindingRules(schema, field)
+		params = append(params, ParameterObject{
+			Name:     name,
+			In:       "query",
+			Required: required,
+			Schema:   schema,
+		})
+	}
+
+	return params
+}
@@ -0,0 +1,108 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type bindInput struct {
+	Username string  `json:"username" binding:"required,min=3"`
+	Email    string  `json:"email" binding:"required,email"`
+	Role     string  `json:"role" binding:"omitempty,oneof=admin user"`
+	Age      int     `json:"age" binding:"omitempty,max=150"`
+	Address  address `json:"address"`
+}
+
+type address struct {
+	City string `json:"city" binding:"required"`
+}
+
+// bind binds body to a bindInput and returns the problem for its error
+func bind(t *testing.T, body string) *Problem {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	RegisterValidatorTagNames()
+
+	var p *Problem
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("requestID", "req-1") })
+	router.POST("/users", func(c *gin.Context) {
+		var input bindInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			p = FromBindError(c, err)
+			Write(c, p)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body)))
+	if p == nil {
+		t.Fatalf("%s was bound", body)
+	}
+
+	if ct := w.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, ContentType)
+	}
+	var written Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &written); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != p.Status || written.Status != p.Status || written.RequestID != "req-1" || written.Instance != "/users" {
+		t.Errorf("response %d %+v does not match problem %+v", w.Code, written, p)
+	}
+	return p
+}
+
+func TestFromBindErrorValidation(t *testing.T) {
+	p := bind(t, `{"username": "al", "email": "nope", "role": "root", "age": 200, "address": {}}`)
+
+	if p.Status != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422", p.Status)
+	}
+	want := map[string]FieldError{
+		"username":     {Field: "username", Rule: "min", Message: "must be at least 3 characters long"},
+		"email":        {Field: "email", Rule: "email", Message: "must be a valid email address"},
+		"role":         {Field: "role", Rule: "oneof", Message: "must be one of: admin, user"},
+		"age":          {Field: "age", Rule: "max", Message: "must be at most 150"},
+		"address.city": {Field: "address.city", Rule: "required", Message: "is required"},
+	}
+	if len(p.Errors) != len(want) {
+		t.Errorf("errors = %+v, want %d entries", p.Errors, len(want))
+	}
+	for _, fe := range p.Errors {
+		if fe != want[fe.Field] {
+			t.Errorf("error = %+v, want %+v", fe, want[fe.Field])
+		}
+	}
+}
+
+func TestFromBindErrorMalformed(t *testing.T) {
+	for _, tt := range []struct {
+		body   string
+		status int
+		detail string
+	}{
+		{``, http.StatusBadRequest, "The request body is required"},
+		{`{"username": `, http.StatusBadRequest, "The request body is not valid JSON"},
+		{`{"username": }`, http.StatusBadRequest, "The request body is not valid JSON"},
+		{`{"username": 42}`, http.StatusUnprocessableEntity, "The request failed validation"},
+	} {
+		p := bind(t, tt.body)
+		if p.Status != tt.status || p.Detail != tt.detail {
+			t.Errorf("%q: problem = %d %q, want %d %q", tt.body, p.Status, p.Detail, tt.status, tt.detail)
+		}
+	}
+
+	p := bind(t, `{"username": 42}`)
+	if len(p.Errors) != 1 || p.Errors[0] != (FieldError{Field: "username", Rule: "type", Message: "must be of type string"}) {
+		t.Errorf("errors = %+v", p.Errors)
+	}
+}
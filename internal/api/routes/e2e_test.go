@@ -0,0 +1,667 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"go-backend-starter/internal/api/handlers"
+	"go-backend-starter/internal/api/middleware"
+	"go-backend-starter/internal/api/problem"
+	"go-backend-starter/internal/config"
+	"go-backend-starter/internal/mailer"
+	"go-backend-starter/internal/metrics"
+	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/repository"
+	"go-backend-starter/internal/service"
+	"go-backend-starter/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+)
+
+const (
+	testSecret   = "test-secret"
+	testPassword = "correct horse battery"
+)
+
+func TestMain(m *testing.M) {
+	// Every request and rejected token is logged; keep test output readable
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	os.Exit(m.Run())
+}
+
+// testAPI is the real router and service over an in-memory repository
+type testAPI struct {
+	t       testing.TB
+	router  *gin.Engine
+	service *service.Service
+	repo    *repository.MemoryRepository
+	hasher  utils.PasswordHasher
+}
+
+func newTestAPI(t testing.TB) *testAPI {
+	t.Helper()
+
+	cfg := &config.Config{
+		JWT:      config.JWTConfig{Expiration: 60, RefreshExpiration: 60},
+		Auth:     config.AuthConfig{ImpersonationExpiration: 15},
+		Password: config.PasswordConfig{MinLength: 8, MaxLength: 128},
+	}
+	policy, err := service.NewPasswordPolicy(&cfg.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &testAPI{
+		t:      t,
+		repo:   repository.NewMemoryRepository(),
+		hasher: &utils.BcryptHasher{Cost: 4},
+	}
+	a.service = service.NewService(a.repo, cfg, utils.NewHMACKeySet(testSecret), a.hasher, policy, mailer.NewLogMailer())
+
+	gin.SetMode(gin.TestMode)
+	a.router = gin.New()
+	Setup(a.router, handlers.NewHandler(a.service), a.service)
+
+	// The seeded admin gets a password the tests know
+	hash, err := a.hasher.Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.repo.UpdateUserPasswordHash(context.Background(), 1, hash); err != nil {
+		t.Fatal(err)
+	}
+
+	return a
+}
+
+// do sends a request with an optional bearer token and JSON body
+func (a *testAPI) do(method, path, token string, body any) *httptest.ResponseRecorder {
+	a.t.Helper()
+
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = bytes.NewBufferString(b)
+	case []byte:
+		reader = bytes.NewReader(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			a.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if reader != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	a.router.ServeHTTP(w, req)
+	return w
+}
+
+// login returns an access token for the user
+func (a *testAPI) login(username string) string {
+	a.t.Helper()
+
+	w := a.do(http.MethodPost, "/api/auth/login", "", models.LoginInput{Username: username, Password: testPassword})
+	if w.Code != http.StatusOK {
+		a.t.Fatalf("login as %s: status %d: %s", username, w.Code, w.Body)
+	}
+	var tokens models.AuthTokens
+	decode(a.t, w, &tokens)
+	return tokens.Token
+}
+
+// createUser creates a user with the test password through the API
+func (a *testAPI) createUser(adminToken, username, role string) *models.User {
+	a.t.Helper()
+
+	w := a.do(http.MethodPost, "/api/users", adminToken, models.CreateUserInput{
+		Username: username,
+		Password: testPassword,
+		Email:    username + "@example.com",
+		Role:     role,
+	})
+	if w.Code != http.StatusCreated {
+		a.t.Fatalf("create user %s: status %d: %s", username, w.Code, w.Body)
+	}
+	var user models.User
+	decode(a.t, w, &user)
+	return &user
+}
+
+func decode(t testing.TB, w *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("invalid response %q: %v", w.Body, err)
+	}
+}
+
+// expectProblem checks that a response is a problem with the given status
+func expectProblem(t *testing.T, w *httptest.ResponseRecorder, status int) *problem.Problem {
+	t.Helper()
+
+	if w.Code != status {
+		t.Fatalf("status %d, want %d: %s", w.Code, status, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != problem.ContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, problem.ContentType)
+	}
+	var p problem.Problem
+	decode(t, w, &p)
+	if p.Status != status {
+		t.Errorf("problem status = %d, want %d", p.Status, status)
+	}
+	return &p
+}
+
+func TestLogin(t *testing.T) {
+	a := newTestAPI(t)
+
+	t.Run("success", func(t *testing.T) {
+		w := a.do(http.MethodPost, "/api/auth/login", "", models.LoginInput{Username: "admin", Password: testPassword})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		var tokens models.AuthTokens
+		decode(t, w, &tokens)
+		if tokens.Token == "" || tokens.RefreshToken == "" {
+			t.Errorf("tokens = %+v, want access and refresh token", tokens)
+		}
+		if tokens.ExpiresIn != 3600 {
+			t.Errorf("expires_in = %d, want 3600", tokens.ExpiresIn)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		body   any
+		status int
+	}{
+		{"wrong password", models.LoginInput{Username: "admin", Password: "wrong password"}, http.StatusUnauthorized},
+		{"unknown user", models.LoginInput{Username: "nobody", Password: testPassword}, http.StatusUnauthorized},
+		{"missing password", map[string]string{"username": "admin"}, http.StatusUnprocessableEntity},
+		{"wrong type", map[string]any{"username": 1, "password": testPassword}, http.StatusUnprocessableEntity},
+		{"invalid JSON", `{"username":`, http.StatusBadRequest},
+		{"no body", nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectProblem(t, a.do(http.MethodPost, "/api/auth/login", "", tt.body), tt.status)
+		})
+	}
+
+	t.Run("failures do not reveal the account", func(t *testing.T) {
+		wrong := expectProblem(t, a.do(http.MethodPost, "/api/auth/login", "", models.LoginInput{Username: "admin", Password: "nope nope"}), http.StatusUnauthorized)
+		unknown := expectProblem(t, a.do(http.MethodPost, "/api/auth/login", "", models.LoginInput{Username: "nobody", Password: "nope nope"}), http.StatusUnauthorized)
+		if wrong.Detail != unknown.Detail {
+			t.Errorf("details differ: %q and %q", wrong.Detail, unknown.Detail)
+		}
+	})
+}
+
+func TestTokenValidation(t *testing.T) {
+	a := newTestAPI(t)
+	token := a.login("admin")
+
+	sign := func(keys *utils.KeySet, expMinutes int) string {
+		t.Helper()
+		signed, err := utils.GenerateJWT(utils.JWTClaims{UserID: 1, Username: "admin", Role: models.RoleAdmin, AMR: []string{"pwd"}}, keys, expMinutes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	// A correctly signed token without an ID cannot be revoked
+	noID, err := jwt.NewWithClaims(jwt.SigningMethodHS256, utils.JWTClaims{
+		UserID: 1, Username: "admin", Role: models.RoleAdmin,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{"missing header", ""},
+		{"wrong scheme", "Basic " + token},
+		{"no token", "Bearer"},
+		{"extra parts", "Bearer " + token + " extra"},
+		{"malformed token", "Bearer not-a-jwt"},
+		{"wrong key", "Bearer " + sign(utils.NewHMACKeySet("other-secret"), 60)},
+		{"expired", "Bearer " + sign(utils.NewHMACKeySet(testSecret), -1)},
+		{"tampered", "Bearer " + token[:len(token)-2] + "xx"},
+		{"missing token ID", "Bearer " + noID},
+		{"unknown API key", "ApiKey gbs_000000000000_secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			a.router.ServeHTTP(w, req)
+			expectProblem(t, w, http.StatusUnauthorized)
+		})
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		if w := a.do(http.MethodGet, "/api/me", sign(utils.NewHMACKeySet(testSecret), 60), nil); w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("revoked by logout", func(t *testing.T) {
+		token := a.login("admin")
+		if w := a.do(http.MethodPost, "/api/auth/logout", token, nil); w.Code != http.StatusOK {
+			t.Fatalf("logout: status %d: %s", w.Code, w.Body)
+		}
+		expectProblem(t, a.do(http.MethodGet, "/api/me", token, nil), http.StatusUnauthorized)
+	})
+
+	t.Run("revoked by deleting the user", func(t *testing.T) {
+		admin := a.login("admin")
+		user := a.createUser(admin, "revoked", models.RoleUser)
+		token := a.login("revoked")
+
+		if w := a.do(http.MethodDelete, "/api/users/"+strconv.Itoa(user.ID), admin, nil); w.Code != http.StatusOK {
+			t.Fatalf("delete: status %d: %s", w.Code, w.Body)
+		}
+		expectProblem(t, a.do(http.MethodGet, "/api/me", token, nil), http.StatusUnauthorized)
+	})
+}
+
+func TestRequireRole(t *testing.T) {
+	a := newTestAPI(t)
+	admin := a.login("admin")
+	a.createUser(admin, "plain", models.RoleUser)
+	user := a.login("plain")
+
+	ok := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"role": c.GetString("role")}) }
+	a.router.GET("/test/admin", middleware.AuthMiddleware(a.service), middleware.RequireRole(models.RoleAdmin), ok)
+	a.router.GET("/test/any", middleware.AuthMiddleware(a.service), middleware.RequireRole(models.RoleAdmin, models.RoleUser), ok)
+	a.router.GET("/test/anonymous", middleware.RequireRole(models.RoleAdmin), ok)
+
+	tests := []struct {
+		name   string
+		path   string
+		token  string
+		status int
+	}{
+		{"admin on admin route", "/test/admin", admin, http.StatusOK},
+		{"user on admin route", "/test/admin", user, http.StatusForbidden},
+		{"admin on shared route", "/test/any", admin, http.StatusOK},
+		{"user on shared route", "/test/any", user, http.StatusOK},
+		{"without token", "/test/admin", "", http.StatusUnauthorized},
+		{"without authentication", "/test/anonymous", admin, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := a.do(http.MethodGet, tt.path, tt.token, nil)
+			if tt.status != http.StatusOK {
+				expectProblem(t, w, tt.status)
+			} else if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestUserEndpointsRequirePermissions(t *testing.T) {
+	a := newTestAPI(t)
+	admin := a.login("admin")
+	target := a.createUser(admin, "target", models.RoleUser)
+	a.createUser(admin, "plain", models.RoleUser)
+	user := a.login("plain")
+	id := strconv.Itoa(target.ID)
+
+	routes := []struct {
+		method, path string
+		body         any
+	}{
+		{http.MethodPost, "/api/users", models.CreateUserInput{Username: "x", Password: testPassword, Email: "x@example.com", Role: models.RoleUser}},
+		{http.MethodGet, "/api/users", nil},
+		{http.MethodGet, "/api/users/" + id, nil},
+		{http.MethodPut, "/api/users/" + id, models.UpdateUserInput{Username: "renamed"}},
+		{http.MethodDelete, "/api/users/" + id, nil},
+		{http.MethodGet, "/api/users/deleted", nil},
+		{http.MethodPost, "/api/users/" + id + "/restore", nil},
+		{http.MethodDelete, "/api/users/" + id + "/purge", nil},
+		{http.MethodDelete, "/api/users/" + id + "/mfa", nil},
+		{http.MethodPost, "/api/users/" + id + "/unlock", nil},
+		{http.MethodPost, "/api/users/" + id + "/impersonate", nil},
+	}
+	for _, r := range routes {
+		t.Run(r.method+" "+r.path, func(t *testing.T) {
+			expectProblem(t, a.do(r.method, r.path, "", r.body), http.StatusUnauthorized)
+			expectProblem(t, a.do(r.method, r.path, user, r.body), http.StatusForbidden)
+		})
+	}
+
+	// Nothing the plain user tried went through
+	w := a.do(http.MethodGet, "/api/users/"+id, admin, nil)
+	var got models.User
+	decode(t, w, &got)
+	if w.Code != http.StatusOK || got.Username != "target" {
+		t.Errorf("target after denied requests: status %d, %+v", w.Code, got)
+	}
+}
+
+func TestUserEndpoints(t *testing.T) {
+	a := newTestAPI(t)
+	admin := a.login("admin")
+
+	var alice models.User
+	t.Run("create", func(t *testing.T) {
+		alice = *a.createUser(admin, "alice", models.RoleUser)
+		if alice.ID == 0 || alice.Email != "alice@example.com" || alice.Role != models.RoleUser {
+			t.Errorf("created user = %+v", alice)
+		}
+		// Users created by an admin need not verify their email
+		if alice.EmailVerifiedAt == nil {
+			t.Error("email_verified_at not set")
+		}
+		if bytes.Contains(a.do(http.MethodGet, "/api/users/"+strconv.Itoa(alice.ID), admin, nil).Body.Bytes(), []byte("password")) {
+			t.Error("response exposes the password")
+		}
+	})
+
+	t.Run("create errors", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			body   any
+			status int
+		}{
+			{"duplicate username", models.CreateUserInput{Username: "alice", Password: testPassword, Email: "other@example.com", Role: models.RoleUser}, http.StatusConflict},
+			{"duplicate email", models.CreateUserInput{Username: "other", Password: testPassword, Email: "alice@example.com", Role: models.RoleUser}, http.StatusConflict},
+			{"unknown role", models.CreateUserInput{Username: "other", Password: testPassword, Email: "other@example.com", Role: "wizard"}, http.StatusUnprocessableEntity},
+			{"invalid email", models.CreateUserInput{Username: "other", Password: testPassword, Email: "not-an-email", Role: models.RoleUser}, http.StatusUnprocessableEntity},
+			{"short password", models.CreateUserInput{Username: "other", Password: "short", Email: "other@example.com", Role: models.RoleUser}, http.StatusUnprocessableEntity},
+			{"missing fields", map[string]string{"username": "other"}, http.StatusUnprocessableEntity},
+			{"invalid JSON", `{"username": "other"`, http.StatusBadRequest},
+			{"no body", nil, http.StatusBadRequest},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				expectProblem(t, a.do(http.MethodPost, "/api/users", admin, tt.body), tt.status)
+			})
+		}
+	})
+
+	id := func(user models.User) string { return strconv.Itoa(user.ID) }
+
+	t.Run("get", func(t *testing.T) {
+		w := a.do(http.MethodGet, "/api/users/"+id(alice), admin, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		var got models.User
+		decode(t, w, &got)
+		if got.ID != alice.ID || got.Username != "alice" {
+			t.Errorf("got %+v, want alice", got)
+		}
+
+		expectProblem(t, a.do(http.MethodGet, "/api/users/999999", admin, nil), http.StatusNotFound)
+		expectProblem(t, a.do(http.MethodGet, "/api/users/abc", admin, nil), http.StatusBadRequest)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		w := a.do(http.MethodPut, "/api/users/"+id(alice), admin, models.UpdateUserInput{Username: "alicia", Email: "alicia@example.com"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		var got models.User
+		decode(t, w, &got)
+		if got.Username != "alicia" || got.Email != "alicia@example.com" || got.Role != models.RoleUser {
+			t.Errorf("updated user = %+v", got)
+		}
+
+		// The new password works
+		w = a.do(http.MethodPut, "/api/users/"+id(alice), admin, models.UpdateUserInput{Password: "another good password"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("password change: status %d: %s", w.Code, w.Body)
+		}
+		if w := a.do(http.MethodPost, "/api/auth/login", "", models.LoginInput{Username: "alicia", Password: "another good password"}); w.Code != http.StatusOK {
+			t.Errorf("login with new password: status %d: %s", w.Code, w.Body)
+		}
+
+		a.createUser(admin, "bob", models.RoleUser)
+		tests := []struct {
+			name   string
+			path   string
+			body   any
+			status int
+		}{
+			{"missing user", "/api/users/999999", models.UpdateUserInput{Username: "ghost"}, http.StatusNotFound},
+			{"invalid ID", "/api/users/abc", models.UpdateUserInput{Username: "ghost"}, http.StatusBadRequest},
+			{"taken username", "/api/users/" + id(alice), models.UpdateUserInput{Username: "bob"}, http.StatusConflict},
+			{"taken email", "/api/users/" + id(alice), models.UpdateUserInput{Email: "bob@example.com"}, http.StatusConflict},
+			{"invalid email", "/api/users/" + id(alice), models.UpdateUserInput{Email: "nope"}, http.StatusUnprocessableEntity},
+			{"unknown role", "/api/users/" + id(alice), models.UpdateUserInput{Role: "wizard"}, http.StatusUnprocessableEntity},
+			{"invalid JSON", "/api/users/" + id(alice), `{`, http.StatusBadRequest},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				expectProblem(t, a.do(http.MethodPut, tt.path, admin, tt.body), tt.status)
+			})
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		for _, name := range []string{"carol", "dave", "erin"} {
+			a.createUser(admin, name, models.RoleUser)
+		}
+
+		var page models.UserPage
+		w := a.do(http.MethodGet, "/api/users?limit=2&sort=username", admin, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		decode(t, w, &page)
+		if len(page.Data) != 2 || page.Data[0].Username != "admin" || page.Data[1].Username != "alicia" {
+			t.Fatalf("first page = %+v", page.Data)
+		}
+		if page.NextCursor == nil {
+			t.Fatal("next_cursor missing")
+		}
+
+		w = a.do(http.MethodGet, "/api/users?limit=2&sort=username&cursor="+*page.NextCursor, admin, nil)
+		page = models.UserPage{}
+		decode(t, w, &page)
+		if len(page.Data) != 2 || page.Data[0].Username != "bob" || page.Data[1].Username != "carol" {
+			t.Errorf("second page = %+v", page.Data)
+		}
+
+		w = a.do(http.MethodGet, "/api/users?q=DAV&include_total=true", admin, nil)
+		page = models.UserPage{}
+		decode(t, w, &page)
+		if len(page.Data) != 1 || page.Data[0].Username != "dave" || page.Total == nil || *page.Total != 1 {
+			t.Errorf("search = %+v, total %v", page.Data, page.Total)
+		}
+
+		for _, query := range []string{"limit=-1", "limit=101", "limit=x", "sort=password", "created_after=yesterday"} {
+			t.Run(query, func(t *testing.T) {
+				w := a.do(http.MethodGet, "/api/users?"+query, admin, nil)
+				if w.Code != http.StatusBadRequest && w.Code != http.StatusUnprocessableEntity {
+					t.Errorf("status %d, want 400 or 422: %s", w.Code, w.Body)
+				}
+			})
+		}
+		expectProblem(t, a.do(http.MethodGet, "/api/users?cursor=garbage", admin, nil), http.StatusUnprocessableEntity)
+	})
+
+	t.Run("delete, restore and purge", func(t *testing.T) {
+		if w := a.do(http.MethodDelete, "/api/users/"+id(alice), admin, nil); w.Code != http.StatusOK {
+			t.Fatalf("delete: status %d: %s", w.Code, w.Body)
+		}
+		expectProblem(t, a.do(http.MethodDelete, "/api/users/"+id(alice), admin, nil), http.StatusNotFound)
+		expectProblem(t, a.do(http.MethodGet, "/api/users/"+id(alice), admin, nil), http.StatusNotFound)
+		expectProblem(t, a.do(http.MethodPost, "/api/auth/login", "", models.LoginInput{Username: "alicia", Password: "another good password"}), http.StatusUnauthorized)
+
+		var page models.UserPage
+		decode(t, a.do(http.MethodGet, "/api/users/deleted", admin, nil), &page)
+		if len(page.Data) != 1 || page.Data[0].ID != alice.ID || page.Data[0].DeletedAt == nil {
+			t.Errorf("deleted users = %+v", page.Data)
+		}
+
+		w := a.do(http.MethodPost, "/api/users/"+id(alice)+"/restore", admin, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("restore: status %d: %s", w.Code, w.Body)
+		}
+		var restored models.User
+		decode(t, w, &restored)
+		if restored.ID != alice.ID || restored.DeletedAt != nil {
+			t.Errorf("restored user = %+v", restored)
+		}
+		expectProblem(t, a.do(http.MethodPost, "/api/users/"+id(alice)+"/restore", admin, nil), http.StatusNotFound)
+
+		if w := a.do(http.MethodDelete, "/api/users/"+id(alice)+"/purge", admin, nil); w.Code != http.StatusOK {
+			t.Fatalf("purge: status %d: %s", w.Code, w.Body)
+		}
+		expectProblem(t, a.do(http.MethodDelete, "/api/users/"+id(alice)+"/purge", admin, nil), http.StatusNotFound)
+		expectProblem(t, a.do(http.MethodPost, "/api/users/"+id(alice)+"/restore", admin, nil), http.StatusNotFound)
+
+		for _, path := range []string{"/api/users/abc", "/api/users/abc/restore", "/api/users/abc/purge"} {
+			method := http.MethodDelete
+			if path == "/api/users/abc/restore" {
+				method = http.MethodPost
+			}
+			expectProblem(t, a.do(method, path, admin, nil), http.StatusBadRequest)
+		}
+	})
+
+	t.Run("security", func(t *testing.T) {
+		frank := a.createUser(admin, "frank", models.RoleUser)
+
+		for _, path := range []string{"/api/users/" + id(*frank) + "/mfa", "/api/users/" + id(*frank) + "/unlock"} {
+			method := http.MethodPost
+			if path == "/api/users/"+id(*frank)+"/mfa" {
+				method = http.MethodDelete
+			}
+			if w := a.do(method, path, admin, nil); w.Code != http.StatusOK {
+				t.Errorf("%s %s: status %d: %s", method, path, w.Code, w.Body)
+			}
+		}
+		expectProblem(t, a.do(http.MethodDelete, "/api/users/999999/mfa", admin, nil), http.StatusNotFound)
+		expectProblem(t, a.do(http.MethodPost, "/api/users/999999/unlock", admin, nil), http.StatusNotFound)
+		expectProblem(t, a.do(http.MethodPost, "/api/users/abc/unlock", admin, nil), http.StatusBadRequest)
+	})
+
+	t.Run("impersonate", func(t *testing.T) {
+		grace := a.createUser(admin, "grace", models.RoleUser)
+
+		w := a.do(http.MethodPost, "/api/users/"+id(*grace)+"/impersonate", admin, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		var token models.ImpersonationToken
+		decode(t, w, &token)
+
+		var me models.User
+		decode(t, a.do(http.MethodGet, "/api/me", token.Token, nil), &me)
+		if me.ID != grace.ID {
+			t.Errorf("impersonated /api/me = %+v, want grace", me)
+		}
+
+		expectProblem(t, a.do(http.MethodPost, "/api/users/1/impersonate", admin, nil), http.StatusUnprocessableEntity)
+		expectProblem(t, a.do(http.MethodPost, "/api/users/999999/impersonate", admin, nil), http.StatusNotFound)
+		expectProblem(t, a.do(http.MethodPost, "/api/users/abc/impersonate", admin, nil), http.StatusBadRequest)
+		// Impersonation tokens cannot start another impersonation
+		expectProblem(t, a.do(http.MethodPost, "/api/users/"+id(*grace)+"/impersonate", token.Token, nil), http.StatusForbidden)
+	})
+}
+
+func TestCurrentUser(t *testing.T) {
+	a := newTestAPI(t)
+	admin := a.login("admin")
+	created := a.createUser(admin, "henry", models.RoleUser)
+
+	for _, tt := range []struct {
+		username string
+		id       int
+		role     string
+	}{
+		{"admin", 1, models.RoleAdmin},
+		{"henry", created.ID, models.RoleUser},
+	} {
+		t.Run(tt.username, func(t *testing.T) {
+			w := a.do(http.MethodGet, "/api/me", a.login(tt.username), nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			var me models.User
+			decode(t, w, &me)
+			if me.ID != tt.id || me.Username != tt.username || me.Role != tt.role {
+				t.Errorf("/api/me = %+v", me)
+			}
+			if bytes.Contains(w.Body.Bytes(), []byte("password")) || bytes.Contains(w.Body.Bytes(), []byte("mfa_secret")) {
+				t.Errorf("/api/me exposes secrets: %s", w.Body)
+			}
+		})
+	}
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		expectProblem(t, a.do(http.MethodGet, "/api/me", "", nil), http.StatusUnauthorized)
+	})
+}
+
+func TestRequestMetrics(t *testing.T) {
+	a := newTestAPI(t)
+	admin := a.login("admin")
+
+	requests := metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/api/users/:id", "404")
+	unmatched := metrics.HTTPRequests.WithLabelValues(http.MethodGet, "unmatched", "404")
+	failures := metrics.Logins.WithLabelValues(metrics.LoginFailure)
+	before := []float64{testutil.ToFloat64(requests), testutil.ToFloat64(unmatched), testutil.ToFloat64(failures)}
+
+	// Different IDs share the series of their route
+	a.do(http.MethodGet, "/api/users/1001", admin, nil)
+	a.do(http.MethodGet, "/api/users/1002", admin, nil)
+	a.do(http.MethodGet, "/no/such/route", "", nil)
+	a.do(http.MethodPost, "/api/auth/login", "", models.LoginInput{Username: "admin", Password: "wrong password"})
+
+	for i, tt := range []struct {
+		name   string
+		metric float64
+		want   float64
+	}{
+		{"route requests", testutil.ToFloat64(requests), 2},
+		{"unmatched requests", testutil.ToFloat64(unmatched), 1},
+		{"login failures", testutil.ToFloat64(failures), 1},
+	} {
+		if got := tt.metric - before[i]; got != tt.want {
+			t.Errorf("%s increased by %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if n := testutil.CollectAndCount(metrics.HTTPRequests); n == 0 {
+		t.Error("no request series collected")
+	}
+	if v := testutil.ToFloat64(metrics.HTTPRequestsInFlight); v != 0 {
+		t.Errorf("requests in flight = %v after all requests finished", v)
+	}
+}
@@ -0,0 +1,111 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go-backend-starter/internal/models"
+)
+
+// checkResponse fails on server errors and on bodies that are not JSON.
+// Whatever the input, the handlers must answer with a result or a problem.
+func checkResponse(t *testing.T, w *httptest.ResponseRecorder, allowed ...int) {
+	t.Helper()
+
+	if w.Code >= 300 && w.Code < 400 {
+		return // trailing slash redirects carry no JSON
+	}
+	if !json.Valid(w.Body.Bytes()) {
+		t.Fatalf("status %d with invalid JSON body %q", w.Code, w.Body)
+	}
+	for _, status := range allowed {
+		if w.Code == status {
+			return
+		}
+	}
+	t.Fatalf("unexpected status %d: %s", w.Code, w.Body)
+}
+
+func FuzzCreateUser(f *testing.F) {
+	f.Add([]byte(`{"username":"fuzz","password":"correct horse battery","email":"fuzz@example.com","role":"user"}`))
+	f.Add([]byte(`{"username":"admin","password":"correct horse battery","email":"admin@example.com","role":"user"}`))
+	f.Add([]byte(`{"username":"","password":"","email":"","role":""}`))
+	f.Add([]byte(`{"username":1,"password":true,"email":null,"role":[]}`))
+	f.Add([]byte(`{"username":"x","password":"` + strings.Repeat("long", 50) + `","email":"x@example.com","role":"admin"}`))
+	f.Add([]byte(`{"username":"\u0000","password":"pässwörd-ünïcode","email":"a@b.c","role":"ghost"}`))
+	f.Add([]byte(`[]`))
+	f.Add([]byte(`{`))
+	f.Add([]byte(``))
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		a := newTestAPI(t)
+		admin := a.login("admin")
+		w := a.do(http.MethodPost, "/api/users", admin, body)
+		checkResponse(t, w, http.StatusCreated, http.StatusBadRequest, http.StatusConflict, http.StatusUnprocessableEntity)
+
+		if w.Code == http.StatusCreated {
+			var user models.User
+			decode(t, w, &user)
+			if user.ID == 0 || user.Username == "" {
+				t.Fatalf("created user = %+v", user)
+			}
+		}
+	})
+}
+
+func FuzzUpdateUser(f *testing.F) {
+	f.Add("2", []byte(`{"username":"renamed"}`))
+	f.Add("2", []byte(`{"email":"renamed@example.com","role":"admin"}`))
+	f.Add("2", []byte(`{"password":"another good password"}`))
+	f.Add("2", []byte(`{"username":"admin"}`))
+	f.Add("2", []byte(`{"email":"nope","role":"ghost"}`))
+	f.Add("1", []byte(`{}`))
+	f.Add("0", []byte(`{"username":"x"}`))
+	f.Add("-1", []byte(`null`))
+	f.Add("99999999999999999999", []byte(`{"username":"x"}`))
+	f.Add("abc", []byte(`{`))
+	f.Add("", []byte(``))
+
+	// Every input gets a fresh API, since updating the admin can lock them out
+	f.Fuzz(func(t *testing.T, id string, body []byte) {
+		a := newTestAPI(t)
+		admin := a.login("admin")
+		a.createUser(admin, "target", models.RoleUser)
+
+		w := a.do(http.MethodPut, "/api/users/"+url.PathEscape(id), admin, body)
+		checkResponse(t, w, http.StatusOK, http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity)
+	})
+}
+
+func FuzzUserID(f *testing.F) {
+	for _, id := range []string{"1", "2", "0", "-1", "+2", "02", "1e3", "0x10", " 2", "9223372036854775808", "deleted", "..", "a/b", "%", ""} {
+		f.Add(id)
+	}
+
+	requests := []struct{ method, suffix string }{
+		{http.MethodGet, ""},
+		{http.MethodPut, ""},
+		{http.MethodDelete, ""},
+		{http.MethodPost, "/restore"},
+		{http.MethodDelete, "/purge"},
+		{http.MethodDelete, "/mfa"},
+		{http.MethodPost, "/unlock"},
+		{http.MethodPost, "/impersonate"},
+	}
+
+	f.Fuzz(func(t *testing.T, id string) {
+		// Each request gets a fresh API, since deleting the admin locks them out
+		for _, r := range requests {
+			a := newTestAPI(t)
+			admin := a.login("admin")
+			a.createUser(admin, "target", models.RoleUser)
+
+			w := a.do(r.method, "/api/users/"+url.PathEscape(id)+r.suffix, admin, nil)
+			checkResponse(t, w, http.StatusOK, http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity)
+		}
+	})
+}
@@ -1,8 +1,13 @@
 package routes
 
 import (
+	"net/http"
+
 	"go-backend-starter/internal/api/handlers"
 	"go-backend-starter/internal/api/middleware"
+	"go-backend-starter/internal/api/openapi"
+	"go-backend-starter/internal/api/problem"
+	"go-backend-starter/internal/models"
 	"go-backend-starter/internal/service"
 
 	"github.com/gin-gonic/gin"
@@ -10,38 +15,125 @@ import (
 
 // Setup configures all API routes
 func Setup(router *gin.Engine, handler *handlers.Handler, service *service.Service) {
+	// Report validation errors with JSON field names
+	problem.RegisterValidatorTagNames()
+
 	// Apply global middleware
+	router.Use(middleware.RequestIDMiddleware())
+	router.Use(middleware.MetricsMiddleware())
 	router.Use(middleware.LoggerMiddleware())
 	router.Use(middleware.CorsMiddleware())
+	router.Use(middleware.ErrorHandler())
+
+	// Unknown routes get a problem response too
+	router.NoRoute(func(c *gin.Context) {
+		problem.Abort(c, http.StatusNotFound, "The requested resource does not exist")
+	})
 
 	// Health check
 	router.GET("/healthz", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
+	// Token verification keys
+	router.GET("/.well-known/jwks.json", handler.JWKS)
+
 	// Public routes
 	api := router.Group("/api")
 	{
 		// Auth routes
 		api.POST("/auth/login", handler.Login)
+		api.POST("/auth/login/mfa", handler.LoginMFA)
+		api.POST("/auth/refresh", handler.Refresh)
+		api.POST("/auth/register", handler.Register)
+		api.POST("/auth/verify-email", handler.VerifyEmail)
+		api.POST("/auth/verify-email/resend", handler.ResendVerification)
+		api.POST("/auth/password/forgot", handler.ForgotPassword)
+		api.POST("/auth/password/reset", handler.ResetPassword)
 	}
 
 	// Protected routes
 	protected := api.Group("")
 	protected.Use(middleware.AuthMiddleware(service))
 	{
-		// User routes - admin only
-		users := protected.Group("/users")
-		users.Use(middleware.RequireRole("admin"))
+		// Current user routes, also available to users who still have to set up MFA
+		protected.GET("/me", handler.GetCurrentUser)
+		protected.POST("/auth/impersonation/end", handler.EndImpersonation)
+
+		// Credential routes cannot be used with an API key
+		session := protected.Group("")
+		session.Use(middleware.RequireSession())
 		{
-			users.POST("", handler.CreateUser)
-			users.GET("", handler.ListUsers)
-			users.GET("/:id", handler.GetUser)
-			users.PUT("/:id", handler.UpdateUser)
-			users.DELETE("/:id", handler.DeleteUser)
+			session.POST("/me/mfa/totp", handler.EnrollTOTP)
+			session.POST("/me/mfa/totp/confirm", handler.ConfirmTOTP)
+			session.POST("/auth/logout", handler.Logout)
 		}
 
-		// Current user route - for any authenticated user
-		protected.GET("/me", handler.GetCurrentUser)
+		// Routes below need MFA when the user's role requires it
+		enforced := protected.Group("")
+		enforced.Use(middleware.RequireMFA(service))
+
+		// API key routes
+		apiKeys := enforced.Group("/me/api-keys")
+		apiKeys.Use(middleware.RequireSession())
+		{
+			apiKeys.POST("", handler.CreateAPIKey)
+			apiKeys.GET("", handler.ListAPIKeys)
+			apiKeys.DELETE("/:id", handler.RevokeAPIKey)
+		}
+
+		// User routes
+		users := enforced.Group("/users")
+		{
+			users.POST("", middleware.RequirePermission(models.PermissionUsersWrite), handler.CreateUser)
+			users.GET("", middleware.RequirePermission(models.PermissionUsersRead), handler.ListUsers)
+			users.GET("/:id", middleware.RequirePermission(models.PermissionUsersRead), handler.GetUser)
+			users.PUT("/:id", middleware.RequirePermission(models.PermissionUsersWrite), handler.UpdateUser)
+			users.DELETE("/:id", middleware.RequirePermission(models.PermissionUsersDelete), handler.DeleteUser)
+			users.GET("/deleted", middleware.RequirePermission(models.PermissionUsersRead), handler.ListDeletedUsers)
+			users.POST("/:id/restore", middleware.RequirePermission(models.PermissionUsersDelete), handler.RestoreUser)
+			users.DELETE("/:id/purge", middleware.RequirePermission(models.PermissionUsersDelete), handler.PurgeUser)
+			users.DELETE("/:id/mfa", middleware.RequirePermission(models.PermissionUsersSecurity), handler.ResetUserMFA)
+			users.POST("/:id/unlock", middleware.RequirePermission(models.PermissionUsersSecurity), handler.UnlockUser)
+			users.POST("/:id/impersonate", middleware.RequireSession(), middleware.RequirePermission(models.PermissionUsersImpersonate), handler.ImpersonateUser)
+		}
+
+		// Organization routes. Member routes act on the organization selected
+		// by the X-Organization-ID header or the token.
+		enforced.GET("/me/organizations", handler.ListMyOrganizations)
+		enforced.POST("/organizations", middleware.RequirePermission(models.PermissionOrgsWrite), handler.CreateOrganization)
+		enforced.DELETE("/organization/members/:id", middleware.RequirePermission(models.PermissionOrgsWrite), handler.RemoveOrganizationMember)
+		invitations := enforced.Group("/organization/invitations")
+		{
+			invitations.POST("", middleware.RequirePermission(models.PermissionOrgsWrite), handler.InviteOrganizationMember)
+			invitations.GET("", middleware.RequirePermission(models.PermissionOrgsWrite), handler.ListOrganizationInvitations)
+			invitations.DELETE("/:id", middleware.RequirePermission(models.PermissionOrgsWrite), handler.CancelInvitation)
+		}
+
+		// Users join organizations by accepting invitations themselves
+		myInvitations := enforced.Group("/me/invitations")
+		myInvitations.Use(middleware.RequireSession())
+		{
+			myInvitations.GET("", handler.ListMyInvitations)
+			myInvitations.POST("/:id/accept", handler.AcceptInvitation)
+			myInvitations.DELETE("/:id", handler.DeclineInvitation)
+		}
+
+		// Role routes
+		roles := enforced.Group("/roles")
+		{
+			roles.GET("", middleware.RequirePermission(models.PermissionRolesRead), handler.ListRoles)
+			roles.POST("", middleware.RequirePermission(models.PermissionRolesWrite), handler.CreateRole)
+			roles.GET("/:name", middleware.RequirePermission(models.PermissionRolesRead), handler.GetRole)
+			roles.PUT("/:name", middleware.RequirePermission(models.PermissionRolesWrite), handler.UpdateRole)
+			roles.DELETE("/:name", middleware.RequirePermission(models.PermissionRolesWrite), handler.DeleteRole)
+		}
+		enforced.GET("/permissions", middleware.RequirePermission(models.PermissionRolesRead), handler.ListPermissions)
+
+		// Audit log
+		enforced.GET("/audit-events", middleware.RequirePermission(models.PermissionAuditRead), handler.ListAuditEvents)
 	}
+
+	// API documentation, built from the routes registered above
+	openapi.Register(router)
 }
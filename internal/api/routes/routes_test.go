@@ -0,0 +1,73 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-backend-starter/internal/api/handlers"
+	"go-backend-starter/internal/api/openapi"
+	"go-backend-starter/internal/config"
+	"go-backend-starter/internal/mailer"
+	"go-backend-starter/internal/service"
+	"go-backend-starter/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	srvc := service.NewService(nil, &config.Config{}, utils.NewHMACKeySet("test-secret"), &utils.BcryptHasher{Cost: 4}, &service.PasswordPolicy{}, mailer.NewLogMailer())
+	Setup(router, handlers.NewHandler(srvc), srvc)
+	return router
+}
+
+// TestRoutesMatchOpenAPISpec fails when a route is added without documenting
+// it in the openapi package, or a documented operation loses its route
+func TestRoutesMatchOpenAPISpec(t *testing.T) {
+	router := newTestRouter()
+
+	if err := openapi.Check(router.Routes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenAPISpecIsServed(t *testing.T) {
+	router := newTestRouter()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, openapi.SpecPath, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d", openapi.SpecPath, w.Code)
+	}
+
+	var doc openapi.Document
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid spec: %v", err)
+	}
+	if doc.OpenAPI != "3.1.0" {
+		t.Errorf("openapi version = %q, want 3.1.0", doc.OpenAPI)
+	}
+
+	// Binding rules of the models must show up in the schemas
+	input := doc.Components.Schemas["CreateUserInput"]
+	if input == nil {
+		t.Fatal("CreateUserInput schema missing")
+	}
+	if e := input.Properties["email"]; e == nil || e.Format != "email" {
+		t.Errorf("email schema = %+v, want format email", e)
+	}
+	if p := input.Properties["password"]; p == nil || !p.WriteOnly {
+		t.Errorf("password schema = %+v, want writeOnly", p)
+	}
+	if r := input.Properties["role"]; r == nil || r.MaxLength == nil || *r.MaxLength != 50 {
+		t.Errorf("role schema = %+v, want maxLength 50", r)
+	}
+
+	create := (*doc.Paths["/api/users"])["post"]
+	if create == nil || len(create.Security) == 0 {
+		t.Error("POST /api/users must require the bearer security scheme")
+	}
+}
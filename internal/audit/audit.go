@@ -0,0 +1,88 @@
+// Package audit carries who is behind a request, for the audit events the
+// repository records in the same transaction as administrative changes, and
+// computes the redacted before/after diff of an event.
+package audit
+
+import "context"
+
+// Redacted replaces the value of sensitive fields in a diff
+const Redacted = "[REDACTED]"
+
+// sensitiveFields are only ever reported as changed, never with their value
+var sensitiveFields = map[string]bool{
+	"password":      true,
+	"password_hash": true,
+	"mfa_secret":    true,
+}
+
+// Source describes where a change comes from. The actor fields are empty for
+// unauthenticated requests such as self-registration.
+type Source struct {
+	ActorID        *int
+	ActorUsername  *string
+	ImpersonatorID *int // the admin acting as the actor, if any
+	IP             string
+	RequestID      string
+}
+
+type contextKey struct{}
+
+// WithSource returns a context carrying the source of a request
+func WithSource(ctx context.Context, source Source) context.Context {
+	return context.WithValue(ctx, contextKey{}, source)
+}
+
+// SourceFrom returns the source a context carries, or an empty one
+func SourceFrom(ctx context.Context) Source {
+	source, _ := ctx.Value(contextKey{}).(Source)
+	return source
+}
+
+// Diff returns the fields that differ between two snapshots, as they were
+// before and after. A nil snapshot stands for a record that did not exist, so
+// every field of the other one is reported. Values must be comparable.
+func Diff(before, after map[string]any) (map[string]any, map[string]any) {
+	var changedBefore, changedAfter map[string]any
+
+	switch {
+	case before == nil && after == nil:
+		return nil, nil
+	case before == nil:
+		changedAfter = make(map[string]any, len(after))
+		for field, value := range after {
+			changedAfter[field] = value
+		}
+	case after == nil:
+		changedBefore = make(map[string]any, len(before))
+		for field, value := range before {
+			changedBefore[field] = value
+		}
+	default:
+		changedBefore, changedAfter = map[string]any{}, map[string]any{}
+		for field, value := range after {
+			if before[field] != value {
+				changedBefore[field] = before[field]
+				changedAfter[field] = value
+			}
+		}
+		for field, value := range before {
+			if _, ok := after[field]; !ok {
+				changedBefore[field] = value
+				changedAfter[field] = nil
+			}
+		}
+	}
+
+	redact(changedBefore)
+	redact(changedAfter)
+	return changedBefore, changedAfter
+}
+
+// redact hides the value of sensitive fields that are set
+func redact(snapshot map[string]any) {
+	for field, value := range snapshot {
+		if sensitiveFields[field] && value != nil && value != "" {
+			snapshot[field] = Redacted
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package audit
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	user := map[string]any{"username": "alice", "role": "user", "password": "hash1", "mfa_secret": nil}
+
+	for name, tc := range map[string]struct {
+		before, after         map[string]any
+		wantBefore, wantAfter map[string]any
+	}{
+		"created": {
+			after:     user,
+			wantAfter: map[string]any{"username": "alice", "role": "user", "password": Redacted, "mfa_secret": nil},
+		},
+		"deleted": {
+			before:     user,
+			wantBefore: map[string]any{"username": "alice", "role": "user", "password": Redacted, "mfa_secret": nil},
+		},
+		"changed": {
+			before:     user,
+			after:      map[string]any{"username": "alice", "role": "admin", "password": "hash2", "mfa_secret": "secret"},
+			wantBefore: map[string]any{"role": "user", "password": Redacted, "mfa_secret": nil},
+			wantAfter:  map[string]any{"role": "admin", "password": Redacted, "mfa_secret": Redacted},
+		},
+		"unchanged": {
+			before:     user,
+			after:      maps.Clone(user),
+			wantBefore: map[string]any{},
+			wantAfter:  map[string]any{},
+		},
+		"field dropped": {
+			before:     map[string]any{"name": "ci", "password_hash": "hash"},
+			after:      map[string]any{"name": "ci"},
+			wantBefore: map[string]any{"password_hash": Redacted},
+			wantAfter:  map[string]any{"password_hash": nil},
+		},
+		"neither": {},
+	} {
+		t.Run(name, func(t *testing.T) {
+			before, after := Diff(tc.before, tc.after)
+			if !maps.Equal(before, tc.wantBefore) || (before == nil) != (tc.wantBefore == nil) {
+				t.Errorf("before = %v, want %v", before, tc.wantBefore)
+			}
+			if !maps.Equal(after, tc.wantAfter) || (after == nil) != (tc.wantAfter == nil) {
+				t.Errorf("after = %v, want %v", after, tc.wantAfter)
+			}
+		})
+	}
+
+	// The snapshots passed in are left alone
+	if user["password"] != "hash1" {
+		t.Errorf("Diff modified its input: %v", user)
+	}
+}
@@ -10,25 +10,106 @@ type Config struct {
 	Server   ServerConfig
 	Database DatabaseConfig
 	JWT      JWTConfig
+	Auth     AuthConfig
+	Password PasswordConfig
+	Mailer   MailerConfig
+	Metrics  MetricsConfig
 }
 
 type ServerConfig struct {
-	Port        int
-	Environment string
+	Port           int
+	Environment    string
+	TrustedProxies []string `mapstructure:"trusted_proxies"` // proxies whose X-Forwarded-For is believed
 }
 
 type DatabaseConfig struct {
-	Host     string
-	Port     int
-	User     string
-	Password string
-	DBName   string
-	SSLMode  string
+	Driver      string // postgres or sqlite
+	Path        string // database file of the sqlite driver
+	Host        string
+	Port        int
+	User        string
+	Password    string
+	DBName      string
+	SSLMode     string
+	AutoMigrate bool `mapstructure:"auto_migrate"` // apply pending migrations on startup
+
+	// Units of work that check before they write
+	IsolationLevel string `mapstructure:"isolation_level"` // read committed, repeatable read or serializable
+	TxMaxRetries   int    `mapstructure:"tx_max_retries"`  // reruns after serialization failures
 }
 
 type JWTConfig struct {
-	Secret     string
-	Expiration int // in minutes
+	Secret             string
+	Expiration         int // in minutes
+	RefreshExpiration  int `mapstructure:"refresh_expiration"`   // in minutes
+	RevocationCacheTTL int `mapstructure:"revocation_cache_ttl"` // in seconds
+
+	// Asymmetric signing. When Keys is empty, tokens are signed with HS256 using Secret.
+	SigningKeyID string `mapstructure:"signing_key_id"`
+	Keys         []JWTKeyConfig
+}
+
+// JWTKeyConfig describes a PEM encoded key. Keys with only a public key are
+// accepted for verification, which allows rotating the signing key without
+// invalidating tokens issued with the previous one.
+type JWTKeyConfig struct {
+	ID             string
+	Algorithm      string // RS256, ES256 or EdDSA
+	PrivateKeyFile string `mapstructure:"private_key_file"`
+	PublicKeyFile  string `mapstructure:"public_key_file"`
+}
+
+type AuthConfig struct {
+	RegistrationEnabled          bool     `mapstructure:"registration_enabled"`
+	RequireEmailVerification     bool     `mapstructure:"require_email_verification"`
+	VerificationTokenExpiration  int      `mapstructure:"verification_token_expiration"`   // in minutes
+	VerifyEmailURL               string   `mapstructure:"verify_email_url"`                // {token} is replaced with the token
+	PasswordResetTokenExpiration int      `mapstructure:"password_reset_token_expiration"` // in minutes
+	ResetPasswordURL             string   `mapstructure:"reset_password_url"`              // {token} is replaced with the token
+	MFAIssuer                    string   `mapstructure:"mfa_issuer"`                      // shown in authenticator apps
+	MFAChallengeExpiration       int      `mapstructure:"mfa_challenge_expiration"`        // in minutes
+	MFARequiredRoles             []string `mapstructure:"mfa_required_roles"`              // roles that must enroll in MFA
+	LoginBackoffBase             int      `mapstructure:"login_backoff_base"`              // in seconds, doubled with every failure
+	LockoutThreshold             int      `mapstructure:"lockout_threshold"`               // failures per account before a lockout, 0 disables
+	IPLockoutThreshold           int      `mapstructure:"ip_lockout_threshold"`            // failures per client IP before a lockout, 0 disables
+	LockoutDuration              int      `mapstructure:"lockout_duration"`                // in minutes, also how long failures are counted
+	ImpersonationExpiration      int      `mapstructure:"impersonation_expiration"`        // in minutes
+	PermissionCacheTTL           int      `mapstructure:"permission_cache_ttl"`            // in seconds
+}
+
+type PasswordConfig struct {
+	Algorithm         string // argon2id or bcrypt
+	Argon2Memory      uint32 `mapstructure:"argon2_memory"` // in KiB
+	Argon2Time        uint32 `mapstructure:"argon2_time"`   // number of passes
+	Argon2Parallelism uint8  `mapstructure:"argon2_parallelism"`
+	BcryptCost        int    `mapstructure:"bcrypt_cost"`
+
+	// Policy for new passwords
+	MinLength        int    `mapstructure:"min_length"`
+	MaxLength        int    `mapstructure:"max_length"`
+	RequireUppercase bool   `mapstructure:"require_uppercase"`
+	RequireLowercase bool   `mapstructure:"require_lowercase"`
+	RequireDigit     bool   `mapstructure:"require_digit"`
+	RequireSymbol    bool   `mapstructure:"require_symbol"`
+	DisallowUserInfo bool   `mapstructure:"disallow_user_info"` // reject passwords containing the username or email
+	History          int    // number of previous passwords that cannot be reused, 0 disables
+	BlocklistFile    string `mapstructure:"blocklist_file"` // SHA-1 hashes of forbidden passwords, empty disables
+}
+
+type MailerConfig struct {
+	Driver       string // log, file or smtp
+	From         string
+	Dir          string // output directory for the file driver
+	SMTPHost     string `mapstructure:"smtp_host"`
+	SMTPPort     int    `mapstructure:"smtp_port"`
+	SMTPUsername string `mapstructure:"smtp_username"`
+	SMTPPassword string `mapstructure:"smtp_password"`
+}
+
+type MetricsConfig struct {
+	Enabled bool   // serve Prometheus metrics at /metrics
+	Host    string // address the metrics port listens on
+	Port    int    // port of the metrics, other than the server port
 }
 
 func LoadConfig(path string) (*Config, error) {
@@ -45,14 +126,62 @@ func LoadConfig(path string) (*Config, error) {
 	viper.SetEnvPrefix("APP")
 	viper.BindEnv("server.port", "SERVER_PORT")
 	viper.BindEnv("server.environment", "SERVER_ENVIRONMENT")
+	viper.BindEnv("server.trusted_proxies", "SERVER_TRUSTED_PROXIES")
+	viper.BindEnv("database.driver", "DATABASE_DRIVER")
+	viper.BindEnv("database.path", "DATABASE_PATH")
 	viper.BindEnv("database.host", "DATABASE_HOST")
 	viper.BindEnv("database.port", "DATABASE_PORT")
 	viper.BindEnv("database.user", "DATABASE_USER")
 	viper.BindEnv("database.password", "DATABASE_PASSWORD")
 	viper.BindEnv("database.dbname", "DATABASE_DBNAME")
 	viper.BindEnv("database.sslmode", "DATABASE_SSLMODE")
+	viper.BindEnv("database.auto_migrate", "DATABASE_AUTO_MIGRATE")
+	viper.BindEnv("database.isolation_level", "DATABASE_ISOLATION_LEVEL")
+	viper.BindEnv("database.tx_max_retries", "DATABASE_TX_MAX_RETRIES")
 	viper.BindEnv("jwt.secret", "JWT_SECRET")
 	viper.BindEnv("jwt.expiration", "JWT_EXPIRATION")
+	viper.BindEnv("jwt.refresh_expiration", "JWT_REFRESH_EXPIRATION")
+	viper.BindEnv("jwt.revocation_cache_ttl", "JWT_REVOCATION_CACHE_TTL")
+	viper.BindEnv("jwt.signing_key_id", "JWT_SIGNING_KEY_ID")
+	viper.BindEnv("auth.registration_enabled", "AUTH_REGISTRATION_ENABLED")
+	viper.BindEnv("auth.require_email_verification", "AUTH_REQUIRE_EMAIL_VERIFICATION")
+	viper.BindEnv("auth.verification_token_expiration", "AUTH_VERIFICATION_TOKEN_EXPIRATION")
+	viper.BindEnv("auth.verify_email_url", "AUTH_VERIFY_EMAIL_URL")
+	viper.BindEnv("auth.password_reset_token_expiration", "AUTH_PASSWORD_RESET_TOKEN_EXPIRATION")
+	viper.BindEnv("auth.reset_password_url", "AUTH_RESET_PASSWORD_URL")
+	viper.BindEnv("auth.mfa_issuer", "AUTH_MFA_ISSUER")
+	viper.BindEnv("auth.mfa_challenge_expiration", "AUTH_MFA_CHALLENGE_EXPIRATION")
+	viper.BindEnv("auth.mfa_required_roles", "AUTH_MFA_REQUIRED_ROLES")
+	viper.BindEnv("auth.login_backoff_base", "AUTH_LOGIN_BACKOFF_BASE")
+	viper.BindEnv("auth.lockout_threshold", "AUTH_LOCKOUT_THRESHOLD")
+	viper.BindEnv("auth.ip_lockout_threshold", "AUTH_IP_LOCKOUT_THRESHOLD")
+	viper.BindEnv("auth.lockout_duration", "AUTH_LOCKOUT_DURATION")
+	viper.BindEnv("auth.permission_cache_ttl", "AUTH_PERMISSION_CACHE_TTL")
+	viper.BindEnv("auth.impersonation_expiration", "AUTH_IMPERSONATION_EXPIRATION")
+	viper.BindEnv("password.algorithm", "PASSWORD_ALGORITHM")
+	viper.BindEnv("password.argon2_memory", "PASSWORD_ARGON2_MEMORY")
+	viper.BindEnv("password.argon2_time", "PASSWORD_ARGON2_TIME")
+	viper.BindEnv("password.argon2_parallelism", "PASSWORD_ARGON2_PARALLELISM")
+	viper.BindEnv("password.bcrypt_cost", "PASSWORD_BCRYPT_COST")
+	viper.BindEnv("password.min_length", "PASSWORD_MIN_LENGTH")
+	viper.BindEnv("password.max_length", "PASSWORD_MAX_LENGTH")
+	viper.BindEnv("password.require_uppercase", "PASSWORD_REQUIRE_UPPERCASE")
+	viper.BindEnv("password.require_lowercase", "PASSWORD_REQUIRE_LOWERCASE")
+	viper.BindEnv("password.require_digit", "PASSWORD_REQUIRE_DIGIT")
+	viper.BindEnv("password.require_symbol", "PASSWORD_REQUIRE_SYMBOL")
+	viper.BindEnv("password.disallow_user_info", "PASSWORD_DISALLOW_USER_INFO")
+	viper.BindEnv("password.history", "PASSWORD_HISTORY")
+	viper.BindEnv("password.blocklist_file", "PASSWORD_BLOCKLIST_FILE")
+	viper.BindEnv("mailer.driver", "MAILER_DRIVER")
+	viper.BindEnv("mailer.from", "MAILER_FROM")
+	viper.BindEnv("mailer.dir", "MAILER_DIR")
+	viper.BindEnv("mailer.smtp_host", "MAILER_SMTP_HOST")
+	viper.BindEnv("mailer.smtp_port", "MAILER_SMTP_PORT")
+	viper.BindEnv("mailer.smtp_username", "MAILER_SMTP_USERNAME")
+	viper.BindEnv("mailer.smtp_password", "MAILER_SMTP_PASSWORD")
+	viper.BindEnv("metrics.enabled", "METRICS_ENABLED")
+	viper.BindEnv("metrics.host", "METRICS_HOST")
+	viper.BindEnv("metrics.port", "METRICS_PORT")
 
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
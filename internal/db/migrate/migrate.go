@@ -0,0 +1,259 @@
+// Package migrate applies the embedded SQL migrations and records them in a
+// schema_migrations table.
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration is a single versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes whether a migration has been applied
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// store is a database migrations are applied to
+type store interface {
+	// withLock runs fn on a session that other migrators wait for, after
+	// creating the schema_migrations table if needed
+	withLock(ctx context.Context, fn func(s session) error) error
+}
+
+// session applies migrations on a single connection
+type session interface {
+	appliedVersions(ctx context.Context) (map[int]time.Time, error)
+	hasTable(ctx context.Context, name string) (bool, error)
+	apply(ctx context.Context, migration Migration) error  // run an up script and record it
+	record(ctx context.Context, migration Migration) error // record a migration without running it
+	revert(ctx context.Context, migration Migration) error // run a down script and remove its record
+}
+
+// baselineTable is created by the first migration. Schemas created by hand
+// from that script, before migrations were recorded, already have it.
+const baselineTable = "users"
+
+// Migrator applies migrations to a database
+type Migrator struct {
+	store      store
+	migrations []Migration
+}
+
+func newMigrator(store store, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{store: store, migrations: migrations}, nil
+}
+
+// Load reads NNN_name.up.sql / NNN_name.down.sql pairs from fsys, ordered by version
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", entry.Name(), err)
+		}
+
+		contents, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("conflicting names for migration %d: %s and %s", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(contents)
+		} else {
+			m.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Up applies every pending migration
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	return m.To(ctx, m.latestVersion())
+}
+
+// Baseline adopts a schema created by hand: when no migration is recorded
+// but the tables of the first one exist, the first migration is recorded as
+// applied without running it, and returned. Otherwise it does nothing.
+func (m *Migrator) Baseline(ctx context.Context) (*Migration, error) {
+	if len(m.migrations) == 0 {
+		return nil, nil
+	}
+
+	var adopted *Migration
+	err := m.store.withLock(ctx, func(s session) error {
+		applied, err := s.appliedVersions(ctx)
+		if err != nil || len(applied) > 0 {
+			return err
+		}
+
+		exists, err := s.hasTable(ctx, baselineTable)
+		if err != nil || !exists {
+			return err
+		}
+
+		if err := s.record(ctx, m.migrations[0]); err != nil {
+			return err
+		}
+		adopted = &m.migrations[0]
+		return nil
+	})
+	return adopted, err
+}
+
+// Down reverts the given number of most recently applied migrations
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.store.withLock(ctx, func(s session) error {
+		applied, err := s.appliedVersions(ctx)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if err := revert(ctx, s, migration); err != nil {
+				return err
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// To migrates up or down until version is the latest applied migration.
+// Version 0 reverts every migration.
+func (m *Migrator) To(ctx context.Context, version int) ([]Migration, error) {
+	if version != 0 && m.find(version) == nil {
+		return nil, fmt.Errorf("unknown migration version %d", version)
+	}
+
+	var changed []Migration
+	err := m.store.withLock(ctx, func(s session) error {
+		applied, err := s.appliedVersions(ctx)
+		if err != nil {
+			return err
+		}
+
+		// Revert newer migrations first, newest to oldest
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok || migration.Version <= version {
+				continue
+			}
+			if err := revert(ctx, s, migration); err != nil {
+				return err
+			}
+			changed = append(changed, migration)
+		}
+
+		// Then apply missing ones, oldest to newest
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok || migration.Version > version {
+				continue
+			}
+			if err := s.apply(ctx, migration); err != nil {
+				return err
+			}
+			changed = append(changed, migration)
+		}
+		return nil
+	})
+	return changed, err
+}
+
+// Status lists every known migration and when it was applied
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.store.withLock(ctx, func(s session) error {
+		applied, err := s.appliedVersions(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := Status{Version: migration.Version, Name: migration.Name}
+			if appliedAt, ok := applied[migration.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+func (m *Migrator) latestVersion() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+func (m *Migrator) find(version int) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
+
+// revert runs the down script of a migration, which it must have
+func revert(ctx context.Context, s session, migration Migration) error {
+	if migration.Down == "" {
+		return fmt.Errorf("migration %d_%s has no down script", migration.Version, migration.Name)
+	}
+	return s.revert(ctx, migration)
+}
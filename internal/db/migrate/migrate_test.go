@@ -0,0 +1,118 @@
+package migrate
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"go-backend-starter/internal/config"
+	"go-backend-starter/internal/db/sqlite"
+)
+
+var testMigrations = fstest.MapFS{
+	"001_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY)")},
+	"001_create_users.down.sql": {Data: []byte("DROP TABLE users")},
+	"002_add_email.up.sql":      {Data: []byte("ALTER TABLE users ADD COLUMN email TEXT")},
+	"002_add_email.down.sql":    {Data: []byte("ALTER TABLE users DROP COLUMN email")},
+}
+
+func newTestMigrator(t *testing.T) (*Migrator, *sqlite.SQLiteDB) {
+	t.Helper()
+
+	db, err := sqlite.NewSQLiteDB(&config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+
+	migrator, err := NewSQLiteMigrator(db.DB, testMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return migrator, db
+}
+
+func TestUpAndDown(t *testing.T) {
+	ctx := context.Background()
+	migrator, _ := newTestMigrator(t)
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 2 {
+		t.Fatalf("applied %d migrations, want 2", len(applied))
+	}
+	if applied, err := migrator.Up(ctx); err != nil || len(applied) != 0 {
+		t.Fatalf("second Up applied %d migrations: %v", len(applied), err)
+	}
+
+	reverted, err := migrator.Down(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != 1 || reverted[0].Version != 2 {
+		t.Fatalf("reverted %+v, want migration 2", reverted)
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statuses[0].AppliedAt == nil || statuses[1].AppliedAt != nil {
+		t.Errorf("statuses = %+v, want only migration 1 applied", statuses)
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("adopts a schema created by hand", func(t *testing.T) {
+		migrator, db := newTestMigrator(t)
+		if _, err := db.DB.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY)"); err != nil {
+			t.Fatal(err)
+		}
+
+		adopted, err := migrator.Baseline(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if adopted == nil || adopted.Version != 1 {
+			t.Fatalf("adopted %+v, want migration 1", adopted)
+		}
+
+		// Only the later migrations run
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(applied) != 1 || applied[0].Version != 2 {
+			t.Errorf("applied %+v, want migration 2", applied)
+		}
+	})
+
+	t.Run("does nothing on an empty database", func(t *testing.T) {
+		migrator, _ := newTestMigrator(t)
+
+		adopted, err := migrator.Baseline(ctx)
+		if err != nil || adopted != nil {
+			t.Fatalf("Baseline = %+v, %v; want nothing adopted", adopted, err)
+		}
+		if applied, err := migrator.Up(ctx); err != nil || len(applied) != 2 {
+			t.Errorf("applied %d migrations: %v; want 2", len(applied), err)
+		}
+	})
+
+	t.Run("does nothing once migrations are recorded", func(t *testing.T) {
+		migrator, _ := newTestMigrator(t)
+		if _, err := migrator.To(ctx, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		adopted, err := migrator.Baseline(ctx)
+		if err != nil || adopted != nil {
+			t.Fatalf("Baseline = %+v, %v; want nothing adopted", adopted, err)
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// lockID is the key of the Postgres advisory lock held while migrating, so
+// that replicas starting at the same time do not migrate concurrently
+const lockID = 724_301_115
+
+// NewMigrator creates a migrator applying the migrations found in fsys to a
+// Postgres database
+func NewMigrator(pool *pgxpool.Pool, fsys fs.FS) (*Migrator, error) {
+	return newMigrator(postgresStore{pool: pool}, fsys)
+}
+
+type postgresStore struct {
+	pool *pgxpool.Pool
+}
+
+// withLock runs fn on a dedicated connection holding the migration advisory lock
+func (p postgresStore) withLock(ctx context.Context, fn func(s session) error) error {
+	conn, err := p.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer func() {
+		// Use a fresh context so the lock is released even if ctx was cancelled
+		_, _ = conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", lockID)
+	}()
+
+	if _, err := conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		)
+	`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	return fn(postgresSession{conn: conn})
+}
+
+type postgresSession struct {
+	conn *pgxpool.Conn
+}
+
+func (p postgresSession) appliedVersions(ctx context.Context) (map[int]time.Time, error) {
+	rows, err := p.conn.Query(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_migrations: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+func (p postgresSession) hasTable(ctx context.Context, name string) (bool, error) {
+	var exists bool
+	if err := p.conn.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", name).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to look up table %s: %w", name, err)
+	}
+	return exists, nil
+}
+
+// apply runs an up script and records it in one transaction
+func (p postgresSession) apply(ctx context.Context, migration Migration) error {
+	return pgx.BeginFunc(ctx, p.conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, migration.Up); err != nil {
+			return fmt.Errorf("failed to apply migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO schema_migrations (version, name, applied_at)
+			VALUES ($1, $2, NOW())
+		`, migration.Version, migration.Name); err != nil {
+			return fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+		}
+		return nil
+	})
+}
+
+func (p postgresSession) record(ctx context.Context, migration Migration) error {
+	if _, err := p.conn.Exec(ctx, `
+		INSERT INTO schema_migrations (version, name, applied_at)
+		VALUES ($1, $2, NOW())
+	`, migration.Version, migration.Name); err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+	}
+	return nil
+}
+
+// revert runs a down script and removes its record in one transaction
+func (p postgresSession) revert(ctx context.Context, migration Migration) error {
+	return pgx.BeginFunc(ctx, p.conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, migration.Down); err != nil {
+			return fmt.Errorf("failed to revert migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if _, err := tx.Exec(ctx, "DELETE FROM schema_migrations WHERE version = $1", migration.Version); err != nil {
+			return fmt.Errorf("failed to unrecord migration %d: %w", migration.Version, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,128 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"time"
+)
+
+// NewSQLiteMigrator creates a migrator applying the migrations found in fsys
+// to a SQLite database
+func NewSQLiteMigrator(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	return newMigrator(sqliteStore{db: db}, fsys)
+}
+
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// withLock runs fn on a dedicated connection. A SQLite database belongs to a
+// single server process, and each migration takes the database write lock
+// while it runs.
+func (s sqliteStore) withLock(ctx context.Context, fn func(s session) error) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at DATETIME
+		)
+	`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	return fn(sqliteSession{conn: conn})
+}
+
+type sqliteSession struct {
+	conn *sql.Conn
+}
+
+func (s sqliteSession) appliedVersions(ctx context.Context) (map[int]time.Time, error) {
+	rows, err := s.conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_migrations: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+func (s sqliteSession) hasTable(ctx context.Context, name string) (bool, error) {
+	var count int
+	if err := s.conn.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = $1", name,
+	).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to look up table %s: %w", name, err)
+	}
+	return count > 0, nil
+}
+
+// apply runs an up script and records it in one transaction
+func (s sqliteSession) apply(ctx context.Context, migration Migration) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+			return fmt.Errorf("failed to apply migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO schema_migrations (version, name, applied_at)
+			VALUES ($1, $2, $3)
+		`, migration.Version, migration.Name, time.Now().UTC()); err != nil {
+			return fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+		}
+		return nil
+	})
+}
+
+func (s sqliteSession) record(ctx context.Context, migration Migration) error {
+	if _, err := s.conn.ExecContext(ctx, `
+		INSERT INTO schema_migrations (version, name, applied_at)
+		VALUES ($1, $2, $3)
+	`, migration.Version, migration.Name, time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+	}
+	return nil
+}
+
+// revert runs a down script and removes its record in one transaction
+func (s sqliteSession) revert(ctx context.Context, migration Migration) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+			return fmt.Errorf("failed to revert migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", migration.Version); err != nil {
+			return fmt.Errorf("failed to unrecord migration %d: %w", migration.Version, err)
+		}
+		return nil
+	})
+}
+
+func (s sqliteSession) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,17 @@
+-- Individually revoked access tokens, keyed by their jti claim.
+-- Rows can be purged once the token would have expired anyway.
+CREATE TABLE revoked_tokens (
+    jti VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
+
+-- Access tokens of a user issued before revoked_before are rejected.
+-- No foreign key: the row must outlive a deleted user.
+CREATE TABLE user_token_revocations (
+    user_id INTEGER PRIMARY KEY,
+    revoked_before TIMESTAMP WITH TIME ZONE NOT NULL
+);
@@ -0,0 +1,2 @@
+-- Supports keyset pagination of users sorted by creation time
+CREATE INDEX idx_users_created_at_id ON users (created_at, id);
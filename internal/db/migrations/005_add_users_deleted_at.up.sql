@@ -0,0 +1,5 @@
+-- Soft delete: deleted users keep their row (and their username and email)
+-- until they are purged
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_users_deleted_at ON users (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,29 @@
+-- TOTP two-factor authentication. mfa_secret is set when enrollment starts,
+-- mfa_enabled_at once the user has confirmed a code. mfa_last_step is the
+-- last accepted TOTP time step, so a code cannot be used twice.
+ALTER TABLE users
+    ADD COLUMN mfa_secret VARCHAR(64),
+    ADD COLUMN mfa_enabled_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN mfa_last_step BIGINT;
+
+CREATE TABLE mfa_recovery_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL, -- SHA-256 hex of the normalized code
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    used_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (user_id, code_hash)
+);
+
+-- Issued by a password login when a second factor is needed
+CREATE TABLE mfa_challenges (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE, -- SHA-256 hex of the opaque token
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    attempts INTEGER NOT NULL DEFAULT 0, -- failed codes entered for this challenge
+    used_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_mfa_challenges_user_id ON mfa_challenges (user_id);
@@ -0,0 +1,42 @@
+-- Permissions are defined by the application; roles grant sets of them
+CREATE TABLE permissions (
+    name VARCHAR(100) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE roles (
+    name VARCHAR(50) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    builtin BOOLEAN NOT NULL DEFAULT FALSE, -- built-in roles cannot be deleted
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE role_permissions (
+    role_name VARCHAR(50) NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    permission VARCHAR(100) NOT NULL REFERENCES permissions(name) ON DELETE CASCADE,
+    PRIMARY KEY (role_name, permission)
+);
+
+INSERT INTO permissions (name, description) VALUES
+    ('users:read', 'List and view users'),
+    ('users:write', 'Create and update users'),
+    ('users:delete', 'Delete, restore and purge users'),
+    ('users:security', 'Reset MFA and lift login lockouts'),
+    ('roles:read', 'List roles and permissions'),
+    ('roles:write', 'Create, update and delete roles');
+
+INSERT INTO roles (name, description, builtin) VALUES
+    ('admin', 'Full access', TRUE),
+    ('user', 'Regular user', TRUE);
+
+INSERT INTO role_permissions (role_name, permission)
+SELECT 'admin', name FROM permissions;
+
+-- Keep any other roles already assigned to users, without permissions
+INSERT INTO roles (name)
+SELECT DISTINCT role FROM users
+ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE users
+    ADD CONSTRAINT users_role_fkey FOREIGN KEY (role) REFERENCES roles(name);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS organization_members;
+DROP TABLE IF EXISTS organizations;
+DELETE FROM permissions WHERE name = 'organizations:write';
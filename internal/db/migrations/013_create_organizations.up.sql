@@ -0,0 +1,33 @@
+CREATE TABLE organizations (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    slug VARCHAR(100) NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Users belong to organizations with a role per organization, which takes
+-- the place of their global role while they act in it
+CREATE TABLE organization_members (
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(50) NOT NULL REFERENCES roles(name),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX idx_organization_members_user_id ON organization_members (user_id);
+
+INSERT INTO permissions (name, description) VALUES
+    ('organizations:write', 'Create organizations and manage their members');
+
+INSERT INTO role_permissions (role_name, permission) VALUES
+    ('admin', 'organizations:write');
+
+-- Existing users keep working together in a default organization
+INSERT INTO organizations (name, slug) VALUES ('Default', 'default');
+
+INSERT INTO organization_members (organization_id, user_id, role)
+SELECT o.id, u.id, u.role
+FROM users u, organizations o
+WHERE o.slug = 'default';
@@ -0,0 +1,5 @@
+INSERT INTO permissions (name, description) VALUES
+    ('users:impersonate', 'Act as another user for support');
+
+INSERT INTO role_permissions (role_name, permission) VALUES
+    ('admin', 'users:impersonate');
@@ -0,0 +1,38 @@
+-- Administrative changes, written in the same transaction as the change.
+-- Actors and targets are not foreign keys so events outlive purged users.
+CREATE TABLE audit_events (
+    id SERIAL PRIMARY KEY,
+    actor_id INTEGER,
+    actor_username VARCHAR(50),
+    impersonator_id INTEGER, -- the admin acting as actor_id, if any
+    organization_id INTEGER,
+    action VARCHAR(50) NOT NULL,
+    target_type VARCHAR(50) NOT NULL,
+    target_id INTEGER,
+    before JSONB, -- changed fields only, with secrets redacted
+    after JSONB,
+    ip VARCHAR(45),
+    request_id VARCHAR(128),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_audit_events_target ON audit_events (target_type, target_id);
+CREATE INDEX idx_audit_events_actor_id ON audit_events (actor_id);
+CREATE INDEX idx_audit_events_organization_id ON audit_events (organization_id);
+
+-- The log is append-only
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+INSERT INTO permissions (name, description) VALUES
+    ('audit:read', 'View the audit log');
+
+INSERT INTO role_permissions (role_name, permission) VALUES
+    ('admin', 'audit:read');
@@ -0,0 +1,3 @@
+-- Whether the session that created the key passed a second factor, so
+-- requests made with the key claim only what that session proved
+ALTER TABLE api_keys ADD COLUMN mfa BOOLEAN NOT NULL DEFAULT FALSE;
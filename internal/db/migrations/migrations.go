@@ -0,0 +1,19 @@
+// Package migrations embeds the SQL schema migrations so they ship inside the
+// server binary. Files are named NNN_description.up.sql and
+// NNN_description.down.sql. The SQLite schema has its own migrations in the
+// sqlite directory.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed *.sql
+var FS embed.FS
+
+//go:embed sqlite/*.sql
+var sqliteFS embed.FS
+
+// SQLiteFS holds the migrations of the SQLite schema
+var SQLiteFS, _ = fs.Sub(sqliteFS, "sqlite")
@@ -0,0 +1,233 @@
+-- The SQLite schema matches the Postgres one as of its migration 015.
+-- Timestamps are stored as UTC text that sorts chronologically, JSON and
+-- arrays as JSON text.
+
+CREATE TABLE permissions (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE roles (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    builtin BOOLEAN NOT NULL DEFAULT FALSE, -- built-in roles cannot be deleted
+    created_at DATETIME DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    updated_at DATETIME DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE TABLE role_permissions (
+    role_name TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    permission TEXT NOT NULL REFERENCES permissions(name) ON DELETE CASCADE,
+    PRIMARY KEY (role_name, permission)
+);
+
+CREATE TABLE users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    email TEXT NOT NULL UNIQUE,
+    role TEXT NOT NULL REFERENCES roles(name),
+    email_verified_at DATETIME,
+    mfa_secret TEXT,
+    mfa_enabled_at DATETIME,
+    mfa_last_step INTEGER,
+    created_at DATETIME DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    updated_at DATETIME DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    deleted_at DATETIME -- soft deleted users keep their username and email
+);
+
+CREATE INDEX idx_users_created_at_id ON users (created_at, id);
+CREATE INDEX idx_users_deleted_at ON users (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE TABLE refresh_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    family_id TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE, -- SHA-256 hex of the opaque token
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    rotated_at DATETIME, -- set once the token has been exchanged
+    revoked_at DATETIME  -- set when the whole family is revoked
+);
+
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+
+CREATE TABLE revoked_tokens (
+    jti TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    expires_at DATETIME NOT NULL,
+    revoked_at DATETIME DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE INDEX idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
+
+-- No foreign key: the row must outlive a deleted user
+CREATE TABLE user_token_revocations (
+    user_id INTEGER PRIMARY KEY,
+    revoked_before DATETIME NOT NULL
+);
+
+CREATE TABLE email_verification_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    used_at DATETIME
+);
+
+CREATE INDEX idx_email_verification_tokens_user_id ON email_verification_tokens (user_id);
+
+CREATE TABLE password_reset_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    used_at DATETIME
+);
+
+CREATE INDEX idx_password_reset_tokens_user_id ON password_reset_tokens (user_id);
+
+CREATE TABLE mfa_recovery_codes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    created_at DATETIME DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    used_at DATETIME,
+    UNIQUE (user_id, code_hash)
+);
+
+CREATE TABLE mfa_challenges (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    used_at DATETIME
+);
+
+CREATE INDEX idx_mfa_challenges_user_id ON mfa_challenges (user_id);
+
+CREATE TABLE login_attempts (
+    scope TEXT NOT NULL,
+    key TEXT NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at DATETIME NOT NULL,
+    locked_until DATETIME,
+    PRIMARY KEY (scope, key)
+);
+
+CREATE INDEX idx_login_attempts_last_failure_at ON login_attempts (last_failure_at);
+
+CREATE TABLE password_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    password_hash TEXT NOT NULL,
+    created_at DATETIME DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE INDEX idx_password_history_user_id ON password_history (user_id, id DESC);
+
+CREATE TABLE api_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL UNIQUE,
+    key_hash TEXT NOT NULL,
+    scopes TEXT NOT NULL, -- JSON array
+    expires_at DATETIME,
+    last_used_at DATETIME,
+    last_used_ip TEXT,
+    created_at DATETIME DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE INDEX idx_api_keys_user_id ON api_keys (user_id);
+
+CREATE TABLE organizations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    slug TEXT NOT NULL UNIQUE,
+    created_at DATETIME DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    updated_at DATETIME DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE TABLE organization_members (
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL REFERENCES roles(name),
+    created_at DATETIME DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX idx_organization_members_user_id ON organization_members (user_id);
+
+-- Actors and targets are not foreign keys so events outlive purged users
+CREATE TABLE audit_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    actor_id INTEGER,
+    actor_username TEXT,
+    impersonator_id INTEGER,
+    organization_id INTEGER,
+    action TEXT NOT NULL,
+    target_type TEXT NOT NULL,
+    target_id INTEGER,
+    before TEXT, -- JSON of the changed fields, with secrets redacted
+    after TEXT,
+    ip TEXT,
+    request_id TEXT,
+    created_at DATETIME DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE INDEX idx_audit_events_target ON audit_events (target_type, target_id);
+CREATE INDEX idx_audit_events_actor_id ON audit_events (actor_id);
+CREATE INDEX idx_audit_events_organization_id ON audit_events (organization_id);
+
+-- The log is append-only
+CREATE TRIGGER audit_events_no_update BEFORE UPDATE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+
+CREATE TRIGGER audit_events_no_delete BEFORE DELETE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+
+INSERT INTO permissions (name, description) VALUES
+    ('users:read', 'List and view users'),
+    ('users:write', 'Create and update users'),
+    ('users:delete', 'Delete, restore and purge users'),
+    ('users:security', 'Reset MFA and lift login lockouts'),
+    ('users:impersonate', 'Act as another user for support'),
+    ('roles:read', 'List roles and permissions'),
+    ('roles:write', 'Create, update and delete roles'),
+    ('organizations:write', 'Create organizations and manage their members'),
+    ('audit:read', 'View the audit log');
+
+INSERT INTO roles (name, description, builtin) VALUES
+    ('admin', 'Full access', TRUE),
+    ('user', 'Regular user', TRUE);
+
+INSERT INTO role_permissions (role_name, permission)
+SELECT 'admin', name FROM permissions;
+
+-- Create a superuser with admin privileges
+-- Password is 'admin123' (hashed with bcrypt)
+INSERT INTO users (username, password_hash, email, role, email_verified_at)
+VALUES (
+    'admin',
+    '$2a$12$RHDj3N3c/Q8wtaZmbCeI.uMV2YOJA4aVJyOkZEZDpZmyl63kf1y7a', -- bcrypt hash for 'admin123'
+    'admin@example.com',
+    'admin',
+    strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+);
+
+INSERT INTO organizations (name, slug) VALUES ('Default', 'default');
+
+INSERT INTO organization_members (organization_id, user_id, role)
+SELECT o.id, u.id, u.role
+FROM users u, organizations o
+WHERE o.slug = 'default';
@@ -0,0 +1,3 @@
+-- Whether the login that started the refresh token family passed a second
+-- factor, so refreshed access tokens claim only what the login proved
+ALTER TABLE refresh_tokens ADD COLUMN mfa BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1 @@
+ALTER TABLE organization_members DROP COLUMN created_account;
@@ -0,0 +1,7 @@
+-- Whether the organization created the member's account. Only then may it
+-- change the account's credentials or delete it.
+ALTER TABLE organization_members ADD COLUMN created_account BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Accounts in the default organization predate organizations
+UPDATE organization_members SET created_account = TRUE
+WHERE organization_id = (SELECT id FROM organizations WHERE slug = 'default');
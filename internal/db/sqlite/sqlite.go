@@ -0,0 +1,51 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+
+	"go-backend-starter/internal/config"
+
+	_ "modernc.org/sqlite" // registers the pure Go "sqlite" driver
+)
+
+type SQLiteDB struct {
+	DB *sql.DB
+}
+
+// NewSQLiteDB opens the database file at cfg.Path, creating it if needed
+func NewSQLiteDB(cfg *config.DatabaseConfig) (*SQLiteDB, error) {
+	// Foreign keys are off by default in SQLite. Times are written in a
+	// format that sorts chronologically as text, as long as they are UTC.
+	// Transactions take the write lock up front, so another process cannot
+	// make them fail halfway through.
+	query := url.Values{}
+	query.Add("_pragma", "foreign_keys(1)")
+	query.Add("_pragma", "busy_timeout(5000)")
+	query.Add("_pragma", "journal_mode(WAL)")
+	query.Set("_time_format", "sqlite")
+	query.Set("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite", "file:"+cfg.Path+"?"+query.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("unable to open database: %w", err)
+	}
+
+	// SQLite allows one writer at a time. A single connection serializes
+	// every transaction instead of failing them with SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to open database: %w", err)
+	}
+
+	return &SQLiteDB{DB: db}, nil
+}
+
+func (db *SQLiteDB) Close() {
+	if db.DB != nil {
+		db.DB.Close()
+	}
+}
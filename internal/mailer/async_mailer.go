@@ -0,0 +1,91 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrQueueFull is returned by AsyncMailer.Send when messages arrive faster
+// than they can be delivered
+var ErrQueueFull = errors.New("mail queue is full")
+
+// ErrClosed is returned by AsyncMailer.Send after Close
+var ErrClosed = errors.New("mailer is closed")
+
+// sendTimeout bounds the delivery of a single queued message, so a mail
+// server that hangs cannot stall the queue behind it
+const sendTimeout = 30 * time.Second
+
+// AsyncMailer queues messages and delivers them in the background, so
+// requests neither wait for the mail server nor take longer depending on
+// whether a message was sent. Failed deliveries are logged.
+type AsyncMailer struct {
+	next  Mailer
+	queue chan *Message
+	done  chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewAsyncMailer starts delivering messages through next, holding up to
+// queueSize messages that have not been sent yet
+func NewAsyncMailer(next Mailer, queueSize int) *AsyncMailer {
+	m := &AsyncMailer{
+		next:  next,
+		queue: make(chan *Message, queueSize),
+		done:  make(chan struct{}),
+	}
+	go m.run()
+	return m
+}
+
+// Send queues the message. It only fails when the queue is full or closed.
+func (m *AsyncMailer) Send(ctx context.Context, msg *Message) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+	select {
+	case m.queue <- msg:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close stops accepting messages and waits until the queued ones have been
+// delivered, or ctx is done
+func (m *AsyncMailer) Close(ctx context.Context) error {
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.queue)
+	}
+	m.mu.Unlock()
+
+	select {
+	case <-m.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *AsyncMailer) run() {
+	defer close(m.done)
+
+	for msg := range m.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		if err := m.next.Send(ctx, msg); err != nil {
+			log.Error().Err(err).Str("subject", msg.Subject).Msg("Failed to deliver email")
+		}
+		cancel()
+	}
+}
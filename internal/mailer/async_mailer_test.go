@@ -0,0 +1,96 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// recorder is a mailer that keeps what it is given, optionally blocking
+// until released
+type recorder struct {
+	mu      sync.Mutex
+	sent    []*Message
+	release chan struct{}
+	err     error
+}
+
+func (r *recorder) Send(ctx context.Context, msg *Message) error {
+	if r.release != nil {
+		<-r.release
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = append(r.sent, msg)
+	return r.err
+}
+
+func TestAsyncMailerDelivers(t *testing.T) {
+	next := &recorder{release: make(chan struct{})}
+	m := NewAsyncMailer(next, 10)
+
+	// Send returns before the message is delivered
+	for _, subject := range []string{"one", "two"} {
+		if err := m.Send(context.Background(), &Message{Subject: subject}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(next.release)
+
+	// Close waits for the queue to drain
+	if err := m.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(next.sent) != 2 || next.sent[0].Subject != "one" || next.sent[1].Subject != "two" {
+		t.Errorf("sent = %+v", next.sent)
+	}
+
+	if err := m.Send(context.Background(), &Message{}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Send after Close: error = %v, want ErrClosed", err)
+	}
+	if err := m.Close(context.Background()); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
+
+func TestAsyncMailerQueueFull(t *testing.T) {
+	next := &recorder{release: make(chan struct{})}
+	m := NewAsyncMailer(next, 1)
+	defer m.Close(context.Background())
+	defer close(next.release)
+
+	// One message is being delivered and one waits; there is no room for more
+	var err error
+	for i := 0; i < 3 && err == nil; i++ {
+		err = m.Send(context.Background(), &Message{})
+	}
+	if !errors.Is(err, ErrQueueFull) {
+		t.Errorf("error = %v, want ErrQueueFull", err)
+	}
+}
+
+func TestAsyncMailerSurvivesFailures(t *testing.T) {
+	defer zerolog.SetGlobalLevel(zerolog.GlobalLevel())
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	next := &recorder{err: errors.New("connection refused")}
+	m := NewAsyncMailer(next, 10)
+	for i := 0; i < 2; i++ {
+		if err := m.Send(context.Background(), &Message{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := m.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(next.sent) != 2 {
+		t.Errorf("%d delivery attempts, want 2", len(next.sent))
+	}
+}
@@ -0,0 +1,26 @@
+package mailer
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+)
+
+// LogMailer writes messages to the application log instead of sending them.
+// Meant for local development only: message bodies may contain secrets.
+type LogMailer struct{}
+
+// NewLogMailer creates a log mailer
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+// Send logs the message
+func (m *LogMailer) Send(ctx context.Context, msg *Message) error {
+	log.Info().
+		Str("to", msg.To).
+		Str("subject", msg.Subject).
+		Str("body", msg.Body).
+		Msg("Email (log mailer)")
+	return nil
+}
@@ -0,0 +1,42 @@
+// Package mailer sends transactional email through a configurable backend.
+package mailer
+
+import (
+	"context"
+	"fmt"
+
+	"go-backend-starter/internal/config"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email messages
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// New creates the mailer selected by the configuration. Without a driver,
+// messages are logged in development and the configuration is rejected
+// elsewhere, so a deployment cannot silently drop its email.
+func New(cfg *config.MailerConfig, environment string) (Mailer, error) {
+	switch cfg.Driver {
+	case "":
+		if environment != "development" {
+			return nil, fmt.Errorf("no mailer driver configured for the %q environment", environment)
+		}
+		return NewLogMailer(), nil
+	case "log":
+		return NewLogMailer(), nil
+	case "file":
+		return NewFileMailer(cfg.Dir, cfg.From)
+	case "smtp":
+		return NewSMTPMailer(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer driver %q", cfg.Driver)
+	}
+}
@@ -0,0 +1,25 @@
+package mailer
+
+import (
+	"testing"
+
+	"go-backend-starter/internal/config"
+)
+
+func TestNew(t *testing.T) {
+	if m, err := New(&config.MailerConfig{}, "development"); err != nil {
+		t.Errorf("no driver in development: %v", err)
+	} else if _, ok := m.(*LogMailer); !ok {
+		t.Errorf("no driver in development: got %T, want *LogMailer", m)
+	}
+
+	if _, err := New(&config.MailerConfig{}, "production"); err == nil {
+		t.Error("no driver in production was accepted")
+	}
+	if _, err := New(&config.MailerConfig{Driver: "log"}, "production"); err != nil {
+		t.Errorf("explicit log driver in production: %v", err)
+	}
+	if _, err := New(&config.MailerConfig{Driver: "pigeon"}, "development"); err == nil {
+		t.Error("unknown driver was accepted")
+	}
+}
@@ -0,0 +1,98 @@
+package mailer
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"go-backend-starter/internal/config"
+)
+
+// smtpServer listens for SMTP connections and hands each to serve
+func smtpServer(t *testing.T, serve func(conn net.Conn)) *SMTPMailer {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serve(conn)
+			}()
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	return NewSMTPMailer(&config.MailerConfig{SMTPHost: "127.0.0.1", SMTPPort: addr.Port, From: "no-reply@example.com"})
+}
+
+func TestSMTPMailerSends(t *testing.T) {
+	received := make(chan string, 1)
+	m := smtpServer(t, func(conn net.Conn) {
+		c := textproto.NewConn(conn)
+		c.PrintfLine("220 localhost ready")
+		for {
+			line, err := c.ReadLine()
+			if err != nil {
+				return
+			}
+			switch strings.ToUpper(strings.Fields(line)[0]) {
+			case "EHLO", "MAIL", "RCPT":
+				c.PrintfLine("250 OK")
+			case "DATA":
+				c.PrintfLine("354 go ahead")
+				data, err := c.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				received <- string(data)
+				c.PrintfLine("250 queued")
+			case "QUIT":
+				c.PrintfLine("221 bye")
+				return
+			default:
+				c.PrintfLine("502 not implemented")
+			}
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Send(ctx, &Message{To: "alice@example.com", Subject: "Hello", Body: "Hi alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if data := <-received; !strings.Contains(data, "Subject: Hello") || !strings.Contains(data, "Hi alice") {
+		t.Errorf("message = %q", data)
+	}
+}
+
+func TestSMTPMailerGivesUpOnAHungServer(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	m := smtpServer(t, func(conn net.Conn) { <-release })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- m.Send(ctx, &Message{To: "alice@example.com", Subject: "Hello", Body: "Hi alice"}) }()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Send succeeded without a greeting from the server")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Send did not give up when its context was done")
+	}
+}
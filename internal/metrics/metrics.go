@@ -0,0 +1,64 @@
+// Package metrics defines the Prometheus metrics of the server. They are
+// registered with the default registry, which also reports Go runtime and
+// process metrics.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Path is where metrics are served
+const Path = "/metrics"
+
+// Login results. A login that passes the password but still owes a second
+// factor is counted once LoginMFA settles it.
+const (
+	LoginSuccess    = "success"     // tokens issued
+	LoginFailure    = "failure"     // unknown user or wrong password
+	LoginMFAFailure = "mfa_failure" // wrong code or invalid MFA challenge
+	LoginLocked     = "locked"      // rejected by the login throttle
+)
+
+var (
+	// HTTPRequests counts handled requests. route is the route template, so
+	// that path parameters do not create a series per ID.
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests handled, by method, route template and status.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestDuration observes how long requests take to handle
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time taken to handle HTTP requests, by method, route template and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestsInFlight is the number of requests being handled
+	HTTPRequestsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests currently being handled.",
+	})
+
+	// Logins counts login attempts by result
+	Logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_logins_total",
+		Help: "Login attempts, by result (success, failure, mfa_failure or locked).",
+	}, []string{"result"})
+
+	// PasswordHashDuration observes password hashing, which is deliberately slow
+	PasswordHashDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "password_hash_duration_seconds",
+		Help:    "Time taken to hash or verify a password, by algorithm and operation.",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 10), // 5ms to 2.56s
+	}, []string{"algorithm", "operation"})
+)
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolCollector reports the statistics of a pgx connection pool. They are
+// read when metrics are scraped, so nothing has to poll the pool.
+type poolCollector struct {
+	pool *pgxpool.Pool
+
+	acquiredConns           *prometheus.Desc
+	idleConns               *prometheus.Desc
+	constructingConns       *prometheus.Desc
+	totalConns              *prometheus.Desc
+	maxConns                *prometheus.Desc
+	acquires                *prometheus.Desc
+	acquireDuration         *prometheus.Desc
+	canceledAcquires        *prometheus.Desc
+	emptyAcquires           *prometheus.Desc
+	newConns                *prometheus.Desc
+	maxLifetimeDestroyConns *prometheus.Desc
+	maxIdleDestroyConns     *prometheus.Desc
+}
+
+// NewPoolCollector creates a collector for the statistics of pool
+func NewPoolCollector(pool *pgxpool.Pool) prometheus.Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc("db_pool_"+name, help, nil, nil)
+	}
+
+	return &poolCollector{
+		pool:                    pool,
+		acquiredConns:           desc("acquired_connections", "Connections currently in use."),
+		idleConns:               desc("idle_connections", "Connections currently idle."),
+		constructingConns:       desc("constructing_connections", "Connections currently being established."),
+		totalConns:              desc("connections", "Connections currently open."),
+		maxConns:                desc("max_connections", "Maximum size of the pool."),
+		acquires:                desc("acquires_total", "Connections acquired from the pool."),
+		acquireDuration:         desc("acquire_duration_seconds_total", "Time spent acquiring connections."),
+		canceledAcquires:        desc("canceled_acquires_total", "Acquires canceled by their context."),
+		emptyAcquires:           desc("empty_acquires_total", "Acquires that had to wait for a connection."),
+		newConns:                desc("new_connections_total", "Connections opened."),
+		maxLifetimeDestroyConns: desc("max_lifetime_destroyed_connections_total", "Connections closed for exceeding their maximum lifetime."),
+		maxIdleDestroyConns:     desc("max_idle_destroyed_connections_total", "Connections closed for exceeding their maximum idle time."),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+
+	gauge := func(desc *prometheus.Desc, value float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value)
+	}
+	counter := func(desc *prometheus.Desc, value float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value)
+	}
+
+	gauge(c.acquiredConns, float64(stat.AcquiredConns()))
+	gauge(c.idleConns, float64(stat.IdleConns()))
+	gauge(c.constructingConns, float64(stat.ConstructingConns()))
+	gauge(c.totalConns, float64(stat.TotalConns()))
+	gauge(c.maxConns, float64(stat.MaxConns()))
+	counter(c.acquires, float64(stat.AcquireCount()))
+	counter(c.acquireDuration, stat.AcquireDuration().Seconds())
+	counter(c.canceledAcquires, float64(stat.CanceledAcquireCount()))
+	counter(c.emptyAcquires, float64(stat.EmptyAcquireCount()))
+	counter(c.newConns, float64(stat.NewConnsCount()))
+	counter(c.maxLifetimeDestroyConns, float64(stat.MaxLifetimeDestroyCount()))
+	counter(c.maxIdleDestroyConns, float64(stat.MaxIdleDestroyCount()))
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+)
+
+// API key scopes. Read-only keys may only make GET, HEAD and OPTIONS requests.
+const (
+	APIKeyScopeRead  = "read"
+	APIKeyScopeWrite = "write"
+)
+
+// APIKey is a long-lived credential a user creates for scripts and other
+// machine clients. Only a hash of the key is stored; Prefix identifies the
+// key for lookup and in listings.
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	MFA        bool       `json:"mfa"` // whether the session that created the key passed MFA
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP *string    `json:"last_used_ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// HasScope reports whether the key was granted the given scope
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type CreateAPIKeyInput struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1,dive,oneof=read write"`
+	ExpiresAt *time.Time `json:"expires_at"` // omit for a key that does not expire
+}
+
+// CreatedAPIKey is returned once when a key is created; Key cannot be
+// retrieved again
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
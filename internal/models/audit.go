@@ -0,0 +1,90 @@
+package models
+
+import (
+	"time"
+)
+
+// Audit actions. Each names the target type and what happened to it.
+const (
+	AuditUserCreate        = "user.create"
+	AuditUserUpdate        = "user.update"
+	AuditUserDelete        = "user.delete"
+	AuditUserRestore       = "user.restore"
+	AuditUserPurge         = "user.purge"
+	AuditUserImpersonate   = "user.impersonate"
+	AuditUserMFAReset      = "user.mfa_reset"
+	AuditUserUnlock        = "user.unlock"
+	AuditRoleCreate        = "role.create"
+	AuditRoleUpdate        = "role.update"
+	AuditRoleDelete        = "role.delete"
+	AuditMemberAdd         = "member.add"
+	AuditMemberRemove      = "member.remove"
+	AuditInvitationCreate  = "invitation.create"
+	AuditInvitationCancel  = "invitation.cancel"
+	AuditInvitationDecline = "invitation.decline"
+	AuditAPIKeyCreate      = "api_key.create"
+	AuditAPIKeyRevoke      = "api_key.revoke"
+)
+
+// Audit target types. Members are targeted by user ID; roles have no ID and
+// are named in before and after instead.
+const (
+	AuditTargetUser       = "user"
+	AuditTargetRole       = "role"
+	AuditTargetMember     = "member"
+	AuditTargetInvitation = "invitation"
+	AuditTargetAPIKey     = "api_key"
+)
+
+// AuditEvent records an administrative action. Before and After hold only
+// the fields that changed, with secrets redacted.
+type AuditEvent struct {
+	ID             int            `json:"id"`
+	ActorID        *int           `json:"actor_id"`
+	ActorUsername  *string        `json:"actor_username"`
+	ImpersonatorID *int           `json:"impersonator_id,omitempty"`
+	OrganizationID *int           `json:"organization_id,omitempty"`
+	Action         string         `json:"action"`
+	TargetType     string         `json:"target_type"`
+	TargetID       *int           `json:"target_id"`
+	Before         map[string]any `json:"before"`
+	After          map[string]any `json:"after"`
+	IP             *string        `json:"ip"`
+	RequestID      *string        `json:"request_id"`
+	CreatedAt      time.Time      `json:"created_at"`
+}
+
+// ListAuditEventsInput holds the query parameters of GET /api/audit-events
+type ListAuditEventsInput struct {
+	Cursor        string     `form:"cursor"`
+	Limit         int        `form:"limit" binding:"omitempty,min=1,max=100"`
+	ActorID       int        `form:"actor_id" binding:"omitempty,min=1"`
+	Action        string     `form:"action" binding:"omitempty,max=50"`
+	TargetType    string     `form:"target_type" binding:"omitempty,max=50"`
+	TargetID      int        `form:"target_id" binding:"omitempty,min=1"`
+	CreatedAfter  *time.Time `form:"created_after"`
+	CreatedBefore *time.Time `form:"created_before"`
+}
+
+// AuditEventFilter narrows down which audit events are listed
+type AuditEventFilter struct {
+	ActorID       int
+	Action        string
+	TargetType    string
+	TargetID      int
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+}
+
+// AuditEventQuery is a filter plus a page of newest-first keyset pagination
+type AuditEventQuery struct {
+	AuditEventFilter
+	BeforeID int // only events older than this one, if set
+	Limit    int
+}
+
+// AuditEventPage is one page of GET /api/audit-events, newest first
+type AuditEventPage struct {
+	Data       []*AuditEvent `json:"data"`
+	NextCursor *string       `json:"next_cursor"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// Login throttling scopes
+const (
+	LoginScopeUser = "user"
+	LoginScopeIP   = "ip"
+)
+
+// LoginAttempt tracks recent failed logins for a username or a client IP
+type LoginAttempt struct {
+	Scope         string     `json:"scope"`
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+)
+
+// MFAChallenge is a stored, hashed token issued by a password login when the
+// user still has to provide a second factor
+type MFAChallenge struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	Attempts  int        `json:"attempts"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+}
+
+// MFAChallengeResponse is returned by login instead of tokens when the user
+// has MFA enabled
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int    `json:"expires_in"` // challenge lifetime in seconds
+}
+
+// MFALoginInput completes a login with either a TOTP code or a recovery code
+type MFALoginInput struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code" binding:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code" binding:"required_without=Code"`
+}
+
+// TOTPEnrollment holds the secret of a pending TOTP enrollment. OTPAuthURI is
+// meant to be shown as a QR code.
+type TOTPEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type ConfirmTOTPInput struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
+
+// RecoveryCodes are shown once, when MFA is enabled
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
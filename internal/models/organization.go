@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+)
+
+// Organization is a tenant. Users are scoped to the organizations they are members of.
+type Organization struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// OrganizationMember links a user to an organization with a role in it.
+// CreatedAccount is set when the user's account was created in the
+// organization; AccountRole is the user's global role.
+type OrganizationMember struct {
+	OrganizationID int       `json:"organization_id"`
+	UserID         int       `json:"user_id"`
+	Role           string    `json:"role"`
+	CreatedAccount bool      `json:"created_account"`
+	AccountRole    string    `json:"account_role"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Membership is an organization as seen by one of its members
+type Membership struct {
+	Organization
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type CreateOrganizationInput struct {
+	Name string `json:"name" binding:"required,max=255"`
+	Slug string `json:"slug" binding:"required,max=100"`
+}
+
+// Invitation asks an existing user to join an organization. The user becomes
+// a member once they accept it.
+type Invitation struct {
+	ID               int       `json:"id"`
+	OrganizationID   int       `json:"organization_id"`
+	OrganizationName string    `json:"organization_name"`
+	UserID           int       `json:"user_id"`
+	Role             string    `json:"role"`
+	InvitedBy        *int      `json:"invited_by,omitempty"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// InviteMemberInput invites an existing user, found by email, to the current organization
+type InviteMemberInput struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required,max=50"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+)
+
+// Permission names. Roles grant permissions, and routes require them.
+const (
+	PermissionUsersRead        = "users:read"
+	PermissionUsersWrite       = "users:write"
+	PermissionUsersDelete      = "users:delete"
+	PermissionUsersSecurity    = "users:security"
+	PermissionUsersImpersonate = "users:impersonate"
+	PermissionRolesRead        = "roles:read"
+	PermissionRolesWrite       = "roles:write"
+	PermissionOrgsWrite        = "organizations:write"
+	PermissionAuditRead        = "audit:read"
+)
+
+// Built-in roles, which always exist
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// Permission is an action a role can be allowed to perform
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Role is a named set of permissions assigned to users
+type Role struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Builtin     bool      `json:"builtin"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// PermissionSet holds the permissions granted to a request
+type PermissionSet map[string]struct{}
+
+// Has reports whether the set contains a permission
+func (s PermissionSet) Has(permission string) bool {
+	_, ok := s[permission]
+	return ok
+}
+
+type CreateRoleInput struct {
+	Name        string   `json:"name" binding:"required,max=50"`
+	Description string   `json:"description" binding:"max=500"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+// UpdateRoleInput replaces a role's description and permissions
+type UpdateRoleInput struct {
+	Description string   `json:"description" binding:"max=500"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
@@ -5,30 +5,105 @@ import (
 )
 
 type User struct {
-	ID           int       `json:"id"`
-	Username     string    `json:"username"`
-	PasswordHash string    `json:"-"` // Don't expose password hash
-	Email        string    `json:"email"`
-	Role         string    `json:"role"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID              int        `json:"id"`
+	Username        string     `json:"username"`
+	PasswordHash    string     `json:"-"` // Don't expose password hash
+	Email           string     `json:"email"`
+	Role            string     `json:"role"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	MFASecret       *string    `json:"-"`
+	MFAEnabledAt    *time.Time `json:"mfa_enabled_at"`
+	MFALastStep     *int64     `json:"-"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"`
 }
 
 type CreateUserInput struct {
 	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required,min=8"`
+	Password string `json:"password" binding:"required"`
 	Email    string `json:"email" binding:"required,email"`
-	Role     string `json:"role" binding:"required,oneof=admin user"`
+	Role     string `json:"role" binding:"required,max=50"`
+
+	// Set by the service. Accounts created by an admin are trusted,
+	// self-registered ones have to verify their address first.
+	EmailVerified bool   `json:"-"`
+	PasswordHash  string `json:"-"`
+}
+
+// RegisterInput is the body of POST /api/auth/register. Self-registered
+// users always get the user role.
+type RegisterInput struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+}
+
+type VerifyEmailInput struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ResendVerificationInput struct {
+	Email string `json:"email" binding:"required,email"`
 }
 
 type UpdateUserInput struct {
 	Username string `json:"username"`
-	Password string `json:"password" binding:"omitempty,min=8"`
+	Password string `json:"password"`
 	Email    string `json:"email" binding:"omitempty,email"`
-	Role     string `json:"role" binding:"omitempty,oneof=admin user"`
+	Role     string `json:"role" binding:"omitempty,max=50"`
+
+	// PasswordHash is set by the service when Password is given
+	PasswordHash string `json:"-"`
 }
 
 type LoginInput struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
+
+// ListUsersInput holds the query parameters of GET /api/users
+type ListUsersInput struct {
+	Cursor        string     `form:"cursor"`
+	Limit         int        `form:"limit" binding:"omitempty,min=1,max=100"`
+	Sort          string     `form:"sort" binding:"omitempty,oneof=id -id username -username email -email created_at -created_at"`
+	Role          string     `form:"role" binding:"omitempty,max=50"`
+	CreatedAfter  *time.Time `form:"created_after"`
+	CreatedBefore *time.Time `form:"created_before"`
+	Search        string     `form:"q" binding:"omitempty,max=100"`
+	IncludeTotal  bool       `form:"include_total"`
+}
+
+// UserFilter narrows down which users are listed
+type UserFilter struct {
+	Role          string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Search        string // substring of username or email
+	Deleted       bool   // list soft deleted users instead of active ones
+}
+
+// UserKey is a position in a sorted user list: the sort column value and the
+// ID of the user at that position
+type UserKey struct {
+	Value interface{}
+	ID    int
+}
+
+// UserListQuery is a keyset page request: up to Limit users matching the
+// filter, ordered by SortField then ID, strictly after the After key
+type UserListQuery struct {
+	UserFilter
+	SortField  string // id, username, email or created_at
+	Descending bool
+	After      *UserKey
+	Limit      int
+}
+
+// UserPage is a page of users with cursors to the neighbouring pages
+type UserPage struct {
+	Data       []*User `json:"data"`
+	NextCursor *string `json:"next_cursor"`
+	PrevCursor *string `json:"prev_cursor"`
+	Total      *int    `json:"total,omitempty"`
+}
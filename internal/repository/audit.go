@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go-backend-starter/internal/audit"
+	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/tenant"
+)
+
+// userEvent describes a change to a user. before is nil for created users
+// and after is nil for purged ones.
+func userEvent(ctx context.Context, action string, before, after *models.User) *models.AuditEvent {
+	target := after
+	if target == nil {
+		target = before
+	}
+	id := target.ID
+
+	event := &models.AuditEvent{
+		Action:     action,
+		TargetType: models.AuditTargetUser,
+		TargetID:   &id,
+	}
+	event.Before, event.After = audit.Diff(auditUserSnapshot(before), auditUserSnapshot(after))
+
+	return event
+}
+
+// withSource fills in who made a change and where from, as carried by the
+// context
+func withSource(ctx context.Context, event *models.AuditEvent) {
+	source := audit.SourceFrom(ctx)
+	event.ActorID = source.ActorID
+	event.ActorUsername = source.ActorUsername
+	event.ImpersonatorID = source.ImpersonatorID
+	event.IP = nullString(source.IP)
+	event.RequestID = nullString(source.RequestID)
+
+	event.OrganizationID = nil
+	if id, ok := tenant.OrganizationID(ctx); ok {
+		event.OrganizationID = &id
+	}
+}
+
+// auditUserSnapshot returns the audited fields of a user. The password hash
+// is included so changes show up, and is redacted by audit.Diff.
+func auditUserSnapshot(user *models.User) map[string]any {
+	if user == nil {
+		return nil
+	}
+	return map[string]any{
+		"username":          user.Username,
+		"email":             user.Email,
+		"role":              user.Role,
+		"password":          user.PasswordHash,
+		"email_verified_at": auditTime(user.EmailVerifiedAt),
+		"mfa_enabled_at":    auditTime(user.MFAEnabledAt),
+		"deleted_at":        auditTime(user.DeletedAt),
+	}
+}
+
+// auditTime formats an optional timestamp for a snapshot
+func auditTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,627 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"go-backend-starter/internal/audit"
+	"go-backend-starter/internal/config"
+	"go-backend-starter/internal/db/migrate"
+	"go-backend-starter/internal/db/migrations"
+	"go-backend-starter/internal/db/sqlite"
+	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/repository"
+	"go-backend-starter/internal/tenant"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestMemoryRepository(t *testing.T) {
+	runConformance(t, func(t *testing.T) repository.Repository {
+		return repository.NewMemoryRepository()
+	})
+}
+
+// TestPostgresRepository runs the suite against the database at
+// TEST_DATABASE_URL, migrating it first. Records are named uniquely per run,
+// so the database can be reused.
+func TestPostgresRepository(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	migrator, err := migrate.NewMigrator(pool, migrations.FS)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	runConformance(t, func(t *testing.T) repository.Repository {
+		return repository.NewPostgresRepository(pool)
+	})
+}
+
+// TestSQLiteRepository runs the suite against a fresh database file
+func TestSQLiteRepository(t *testing.T) {
+	db, err := sqlite.NewSQLiteDB(&config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(db.Close)
+
+	migrator, err := migrate.NewSQLiteMigrator(db.DB, migrations.SQLiteFS)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	runConformance(t, func(t *testing.T) repository.Repository {
+		return repository.NewSQLiteRepository(db.DB)
+	})
+}
+
+// runConformance checks the behavior every Repository implementation must
+// share. newRepo returns a repository for one subtest.
+func runConformance(t *testing.T, newRepo func(t *testing.T) repository.Repository) {
+	run := strconv.FormatInt(time.Now().UnixNano(), 36)
+	var seq int
+	unique := func(prefix string) string {
+		seq++
+		return prefix + run + strconv.Itoa(seq)
+	}
+
+	createUser := func(t *testing.T, repo repository.Repository, ctx context.Context, username string) *models.User {
+		t.Helper()
+		user, err := repo.CreateUser(ctx, &models.CreateUserInput{
+			Username:     username,
+			Email:        username + "@example.com",
+			Role:         models.RoleUser,
+			PasswordHash: "hash",
+		})
+		if err != nil {
+			t.Fatalf("CreateUser(%q): %v", username, err)
+		}
+		return user
+	}
+
+	t.Run("users", func(t *testing.T) {
+		repo, ctx := newRepo(t), context.Background()
+		name := unique("user")
+		user := createUser(t, repo, ctx, name)
+
+		if user.ID == 0 || user.Username != name || user.Role != models.RoleUser || user.CreatedAt.IsZero() {
+			t.Fatalf("CreateUser returned %+v", user)
+		}
+
+		for _, get := range []func() (*models.User, error){
+			func() (*models.User, error) { return repo.GetUserByID(ctx, user.ID) },
+			func() (*models.User, error) { return repo.GetUserByUsername(ctx, name) },
+			func() (*models.User, error) { return repo.GetUserByEmail(ctx, name+"@example.com") },
+		} {
+			got, err := get()
+			if err != nil || got == nil || got.ID != user.ID {
+				t.Fatalf("get user = %+v, %v; want user %d", got, err, user.ID)
+			}
+		}
+
+		got, err := repo.GetUserByUsername(ctx, unique("missing"))
+		if got != nil || err != nil {
+			t.Fatalf("GetUserByUsername(missing) = %+v, %v; want nil, nil", got, err)
+		}
+
+		updated, err := repo.UpdateUser(ctx, user.ID, &models.UpdateUserInput{Email: unique("new") + "@example.com"})
+		if err != nil || updated == nil || updated.Email == user.Email || updated.Username != name {
+			t.Fatalf("UpdateUser = %+v, %v", updated, err)
+		}
+
+		updated, err = repo.UpdateUser(ctx, 1<<30, &models.UpdateUserInput{Username: unique("ghost")})
+		if updated != nil || err != nil {
+			t.Fatalf("UpdateUser(missing) = %+v, %v; want nil, nil", updated, err)
+		}
+	})
+
+	t.Run("uniqueness", func(t *testing.T) {
+		repo, ctx := newRepo(t), context.Background()
+		first := createUser(t, repo, ctx, unique("first"))
+		second := createUser(t, repo, ctx, unique("second"))
+
+		tests := []struct {
+			name       string
+			err        error
+			constraint string
+		}{
+			{
+				name: "username",
+				err: func() error {
+					_, err := repo.CreateUser(ctx, &models.CreateUserInput{
+						Username: first.Username, Email: unique("other") + "@example.com", Role: models.RoleUser,
+					})
+					return err
+				}(),
+				constraint: "users_username_key",
+			},
+			{
+				name: "email",
+				err: func() error {
+					_, err := repo.CreateUser(ctx, &models.CreateUserInput{
+						Username: unique("other"), Email: first.Email, Role: models.RoleUser,
+					})
+					return err
+				}(),
+				constraint: "users_email_key",
+			},
+			{
+				name: "update",
+				err: func() error {
+					_, err := repo.UpdateUser(ctx, second.ID, &models.UpdateUserInput{Username: first.Username})
+					return err
+				}(),
+				constraint: "users_username_key",
+			},
+		}
+
+		for _, tt := range tests {
+			var dup *repository.DuplicateError
+			if !errors.As(tt.err, &dup) || dup.Constraint != tt.constraint {
+				t.Errorf("%s: err = %v; want duplicate %s", tt.name, tt.err, tt.constraint)
+			}
+		}
+
+		_, err := repo.CreateUser(ctx, &models.CreateUserInput{
+			Username: unique("norole"), Email: unique("norole") + "@example.com", Role: unique("role"),
+		})
+		var ref *repository.ReferenceError
+		if !errors.As(err, &ref) || ref.Constraint != "users_role_fkey" {
+			t.Errorf("unknown role: err = %v; want reference users_role_fkey", err)
+		}
+	})
+
+	t.Run("soft delete", func(t *testing.T) {
+		repo, ctx := newRepo(t), context.Background()
+		user := createUser(t, repo, ctx, unique("deleted"))
+
+		if ok, err := repo.DeleteUser(ctx, user.ID); !ok || err != nil {
+			t.Fatalf("DeleteUser = %v, %v; want true", ok, err)
+		}
+		if ok, err := repo.DeleteUser(ctx, user.ID); ok || err != nil {
+			t.Fatalf("second DeleteUser = %v, %v; want false", ok, err)
+		}
+		if got, err := repo.GetUserByID(ctx, user.ID); got != nil || err != nil {
+			t.Fatalf("GetUserByID(deleted) = %+v, %v; want nil, nil", got, err)
+		}
+
+		// A deleted user keeps their username and email
+		_, err := repo.CreateUser(ctx, &models.CreateUserInput{
+			Username: user.Username, Email: unique("taken") + "@example.com", Role: models.RoleUser,
+		})
+		var dup *repository.DuplicateError
+		if !errors.As(err, &dup) {
+			t.Fatalf("reusing deleted username: err = %v; want duplicate", err)
+		}
+
+		restored, err := repo.RestoreUser(ctx, user.ID)
+		if err != nil || restored == nil || restored.DeletedAt != nil {
+			t.Fatalf("RestoreUser = %+v, %v", restored, err)
+		}
+
+		if ok, err := repo.PurgeUser(ctx, user.ID); !ok || err != nil {
+			t.Fatalf("PurgeUser = %v, %v; want true", ok, err)
+		}
+		if got, err := repo.RestoreUser(ctx, user.ID); got != nil || err != nil {
+			t.Fatalf("RestoreUser(purged) = %+v, %v; want nil, nil", got, err)
+		}
+	})
+
+	t.Run("list users", func(t *testing.T) {
+		repo, ctx := newRepo(t), context.Background()
+		tag := unique("list")
+		var ids []int
+		for _, name := range []string{"c", "a", "e", "b", "d"} {
+			ids = append(ids, createUser(t, repo, ctx, name+tag).ID)
+		}
+		filter := models.UserFilter{Search: tag}
+
+		if n, err := repo.CountUsers(ctx, &filter); n != 5 || err != nil {
+			t.Fatalf("CountUsers = %d, %v; want 5", n, err)
+		}
+
+		for _, tt := range []struct {
+			sort       string
+			descending bool
+			want       string
+		}{
+			{"username", false, "abcde"},
+			{"username", true, "edcba"},
+			{"id", false, "caebd"},
+			{"id", true, "dbeac"},
+		} {
+			query := &models.UserListQuery{UserFilter: filter, SortField: tt.sort, Descending: tt.descending, Limit: 2}
+
+			var got string
+			for range 4 {
+				page, err := repo.ListUsers(ctx, query)
+				if err != nil {
+					t.Fatalf("ListUsers: %v", err)
+				}
+				if len(page) == 0 {
+					break
+				}
+				for _, user := range page {
+					got += user.Username[:1]
+				}
+				last := page[len(page)-1]
+				query.After = &models.UserKey{Value: last.Username, ID: last.ID}
+			}
+
+			if got != tt.want {
+				t.Errorf("sort %s descending=%v: got %s; want %s", tt.sort, tt.descending, got, tt.want)
+			}
+		}
+
+		if _, err := repo.DeleteUser(ctx, ids[0]); err != nil {
+			t.Fatalf("DeleteUser: %v", err)
+		}
+		deleted := filter
+		deleted.Deleted = true
+		page, err := repo.ListUsers(ctx, &models.UserListQuery{UserFilter: deleted, SortField: "id", Limit: 10})
+		if err != nil || len(page) != 1 || page[0].ID != ids[0] {
+			t.Fatalf("ListUsers(deleted) = %v, %v; want user %d", page, err, ids[0])
+		}
+	})
+
+	t.Run("organizations", func(t *testing.T) {
+		repo, ctx := newRepo(t), context.Background()
+		owner := createUser(t, repo, ctx, unique("owner"))
+		outsider := createUser(t, repo, ctx, unique("outsider"))
+
+		slug := unique("org")
+		org, err := repo.CreateOrganization(ctx, &models.Organization{Name: slug, Slug: slug}, owner.ID, models.RoleAdmin)
+		if err != nil {
+			t.Fatalf("CreateOrganization: %v", err)
+		}
+
+		scoped := tenant.WithOrganization(ctx, org.ID)
+		member := createUser(t, repo, scoped, unique("member"))
+
+		if got, err := repo.GetUserByID(scoped, outsider.ID); got != nil || err != nil {
+			t.Fatalf("GetUserByID(outsider) in org = %+v, %v; want nil, nil", got, err)
+		}
+		if got, err := repo.GetUserByID(scoped, owner.ID); err != nil || got == nil || got.Role != models.RoleAdmin {
+			t.Fatalf("GetUserByID(owner) in org = %+v, %v; want org admin", got, err)
+		}
+		if got, err := repo.GetUserByID(ctx, member.ID); err != nil || got == nil || got.Role != models.RoleUser {
+			t.Fatalf("GetUserByID(member) = %+v, %v; want global user", got, err)
+		}
+
+		// Only accounts created in the organization are marked as such
+		if got, err := repo.GetOrganizationMember(ctx, org.ID, member.ID); err != nil || got == nil || !got.CreatedAccount || got.AccountRole != models.RoleUser {
+			t.Fatalf("GetOrganizationMember(member) = %+v, %v; want created account with the user role", got, err)
+		}
+		if got, err := repo.GetOrganizationMember(ctx, org.ID, owner.ID); err != nil || got == nil || got.CreatedAccount {
+			t.Fatalf("GetOrganizationMember(owner) = %+v, %v; want an account created elsewhere", got, err)
+		}
+
+		err = repo.AddOrganizationMember(ctx, org.ID, member.ID, models.RoleUser)
+		var dup *repository.DuplicateError
+		if !errors.As(err, &dup) {
+			t.Fatalf("adding member twice: err = %v; want duplicate", err)
+		}
+
+		if n, err := repo.CountUsers(scoped, &models.UserFilter{}); n != 2 || err != nil {
+			t.Fatalf("CountUsers in org = %d, %v; want 2", n, err)
+		}
+
+		if ok, err := repo.RemoveOrganizationMember(ctx, org.ID, member.ID); !ok || err != nil {
+			t.Fatalf("RemoveOrganizationMember = %v, %v; want true", ok, err)
+		}
+		if got, err := repo.GetOrganizationMember(ctx, org.ID, member.ID); got != nil || err != nil {
+			t.Fatalf("GetOrganizationMember(removed) = %+v, %v; want nil, nil", got, err)
+		}
+	})
+
+	t.Run("invitations", func(t *testing.T) {
+		repo, ctx := newRepo(t), context.Background()
+		owner := createUser(t, repo, ctx, unique("owner"))
+		invitee := createUser(t, repo, ctx, unique("invitee"))
+
+		slug := unique("org")
+		org, err := repo.CreateOrganization(ctx, &models.Organization{Name: slug, Slug: slug}, owner.ID, models.RoleAdmin)
+		if err != nil {
+			t.Fatalf("CreateOrganization: %v", err)
+		}
+
+		invite := func(role string, expiresAt time.Time) (*models.Invitation, error) {
+			return repo.CreateInvitation(ctx, &models.Invitation{
+				OrganizationID: org.ID, UserID: invitee.ID, Role: role, InvitedBy: &owner.ID, ExpiresAt: expiresAt,
+			})
+		}
+
+		first, err := invite(models.RoleUser, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatalf("CreateInvitation: %v", err)
+		}
+		if first.OrganizationName != slug || first.InvitedBy == nil || *first.InvitedBy != owner.ID {
+			t.Fatalf("CreateInvitation = %+v", first)
+		}
+
+		// Inviting again replaces the invitation
+		second, err := invite(models.RoleAdmin, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatalf("CreateInvitation(again): %v", err)
+		}
+		if second.ID != first.ID || second.Role != models.RoleAdmin {
+			t.Fatalf("CreateInvitation(again) = %+v; want invitation %d updated", second, first.ID)
+		}
+		if list, err := repo.ListOrganizationInvitations(ctx, org.ID); err != nil || len(list) != 1 {
+			t.Fatalf("ListOrganizationInvitations = %v, %v; want 1", list, err)
+		}
+
+		_, err = invite(unique("missing"), time.Now().Add(time.Hour))
+		var ref *repository.ReferenceError
+		if !errors.As(err, &ref) {
+			t.Fatalf("CreateInvitation(unknown role) err = %v; want reference", err)
+		}
+
+		// Expired invitations are not listed, but can be looked up
+		expired, err := invite(models.RoleUser, time.Now().Add(-time.Minute))
+		if err != nil {
+			t.Fatalf("CreateInvitation(expired): %v", err)
+		}
+		if list, err := repo.ListUserInvitations(ctx, invitee.ID); err != nil || len(list) != 0 {
+			t.Fatalf("ListUserInvitations = %v, %v; want expired invitations left out", list, err)
+		}
+		if got, err := repo.GetInvitation(ctx, expired.ID); err != nil || got == nil {
+			t.Fatalf("GetInvitation(expired) = %+v, %v", got, err)
+		}
+
+		if ok, err := repo.DeleteInvitation(ctx, expired.ID); !ok || err != nil {
+			t.Fatalf("DeleteInvitation = %v, %v; want true", ok, err)
+		}
+		if got, err := repo.GetInvitation(ctx, expired.ID); got != nil || err != nil {
+			t.Fatalf("GetInvitation(deleted) = %+v, %v; want nil, nil", got, err)
+		}
+		if ok, err := repo.DeleteInvitation(ctx, expired.ID); ok || err != nil {
+			t.Fatalf("DeleteInvitation(deleted) = %v, %v; want false", ok, err)
+		}
+	})
+
+	t.Run("roles", func(t *testing.T) {
+		repo, ctx := newRepo(t), context.Background()
+		name := unique("role")
+
+		role, err := repo.CreateRole(ctx, &models.Role{
+			Name:        name,
+			Permissions: []string{models.PermissionUsersWrite, models.PermissionUsersRead},
+		})
+		if err != nil {
+			t.Fatalf("CreateRole: %v", err)
+		}
+		if len(role.Permissions) != 2 || role.Permissions[0] != models.PermissionUsersRead {
+			t.Fatalf("CreateRole permissions = %v; want sorted", role.Permissions)
+		}
+
+		_, err = repo.CreateRole(ctx, &models.Role{Name: name})
+		var dup *repository.DuplicateError
+		if !errors.As(err, &dup) {
+			t.Fatalf("CreateRole(existing) err = %v; want duplicate", err)
+		}
+
+		_, err = repo.UpdateRole(ctx, name, &models.UpdateRoleInput{Permissions: []string{"no:such"}})
+		var ref *repository.ReferenceError
+		if !errors.As(err, &ref) {
+			t.Fatalf("UpdateRole(unknown permission) err = %v; want reference", err)
+		}
+
+		user := createUser(t, repo, ctx, unique("holder"))
+		if _, err := repo.UpdateUser(ctx, user.ID, &models.UpdateUserInput{Role: name}); err != nil {
+			t.Fatalf("UpdateUser: %v", err)
+		}
+		if _, err := repo.DeleteRole(ctx, name); !errors.As(err, &ref) {
+			t.Fatalf("DeleteRole(in use) err = %v; want reference", err)
+		}
+		if got, err := repo.GetRole(ctx, unique("missing")); got != nil || err != nil {
+			t.Fatalf("GetRole(missing) = %+v, %v; want nil, nil", got, err)
+		}
+	})
+
+	t.Run("tokens", func(t *testing.T) {
+		repo, ctx := newRepo(t), context.Background()
+		user := createUser(t, repo, ctx, unique("verify"))
+		hash := unique("hash")
+
+		if _, err := repo.CreateEmailVerificationToken(ctx, &models.EmailVerificationToken{
+			UserID: user.ID, TokenHash: hash, ExpiresAt: time.Now().Add(time.Hour),
+		}); err != nil {
+			t.Fatalf("CreateEmailVerificationToken: %v", err)
+		}
+
+		token, err := repo.ConsumeEmailVerificationToken(ctx, hash)
+		if err != nil || token == nil || token.UserID != user.ID || token.UsedAt == nil {
+			t.Fatalf("ConsumeEmailVerificationToken = %+v, %v", token, err)
+		}
+		if token, err := repo.ConsumeEmailVerificationToken(ctx, hash); token != nil || err != nil {
+			t.Fatalf("second ConsumeEmailVerificationToken = %+v, %v; want nil, nil", token, err)
+		}
+
+		refreshHash := unique("refresh")
+		if _, err := repo.CreateRefreshToken(ctx, &models.RefreshToken{
+			UserID: user.ID, FamilyID: unique("family"), TokenHash: refreshHash, ExpiresAt: time.Now().Add(time.Hour), MFA: true,
+		}); err != nil {
+			t.Fatalf("CreateRefreshToken: %v", err)
+		}
+		refresh, err := repo.GetRefreshTokenByHash(ctx, refreshHash)
+		if err != nil || refresh == nil || refresh.UserID != user.ID || !refresh.MFA {
+			t.Fatalf("GetRefreshTokenByHash = %+v, %v; want the token with mfa", refresh, err)
+		}
+
+		challenge, err := repo.CreateMFAChallenge(ctx, &models.MFAChallenge{
+			UserID: user.ID, TokenHash: unique("challenge"), ExpiresAt: time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("CreateMFAChallenge: %v", err)
+		}
+		for want := 1; want <= 2; want++ {
+			if attempts, err := repo.RecordMFAChallengeAttempt(ctx, challenge.ID); err != nil || attempts != want {
+				t.Fatalf("RecordMFAChallengeAttempt = %d, %v; want %d", attempts, err, want)
+			}
+		}
+		if attempts, err := repo.RecordMFAChallengeAttempt(ctx, challenge.ID+1000); err != nil || attempts != 0 {
+			t.Fatalf("RecordMFAChallengeAttempt(missing) = %d, %v; want 0", attempts, err)
+		}
+	})
+
+	t.Run("api keys", func(t *testing.T) {
+		repo, ctx := newRepo(t), context.Background()
+		user := createUser(t, repo, ctx, unique("keys"))
+
+		var prefixes []string
+		for i := 0; i < 2; i++ {
+			prefix := unique("prefix")
+			if _, err := repo.CreateAPIKey(ctx, &models.APIKey{
+				UserID: user.ID, Name: "ci", Prefix: prefix, KeyHash: unique("hash"), Scopes: []string{models.APIKeyScopeRead}, MFA: i == 0,
+			}); err != nil {
+				t.Fatalf("CreateAPIKey: %v", err)
+			}
+			prefixes = append(prefixes, prefix)
+		}
+
+		key, err := repo.GetAPIKeyByPrefix(ctx, prefixes[0])
+		if err != nil || key == nil || key.UserID != user.ID || !key.MFA || !key.HasScope(models.APIKeyScopeRead) {
+			t.Fatalf("GetAPIKeyByPrefix = %+v, %v; want the read key with mfa", key, err)
+		}
+
+		if err := repo.DeleteUserAPIKeys(ctx, user.ID); err != nil {
+			t.Fatalf("DeleteUserAPIKeys: %v", err)
+		}
+		if keys, err := repo.ListUserAPIKeys(ctx, user.ID); err != nil || len(keys) != 0 {
+			t.Fatalf("ListUserAPIKeys after DeleteUserAPIKeys = %+v, %v; want none", keys, err)
+		}
+	})
+
+	t.Run("login attempts", func(t *testing.T) {
+		repo, ctx := newRepo(t), context.Background()
+		key := unique("key")
+
+		for want := 1; want <= 2; want++ {
+			attempt, err := repo.RecordLoginFailure(ctx, "user", key, time.Hour)
+			if err != nil || attempt.Failures != want {
+				t.Fatalf("RecordLoginFailure = %+v, %v; want %d failures", attempt, err, want)
+			}
+		}
+
+		if err := repo.ForgiveLoginFailure(ctx, "user", key); err != nil {
+			t.Fatalf("ForgiveLoginFailure: %v", err)
+		}
+		if attempt, err := repo.GetLoginAttempt(ctx, "user", key); err != nil || attempt == nil || attempt.Failures != 1 {
+			t.Fatalf("GetLoginAttempt(forgiven) = %+v, %v; want 1 failure", attempt, err)
+		}
+
+		until := time.Now().Add(time.Hour)
+		if err := repo.LockLogin(ctx, "user", key, until); err != nil {
+			t.Fatalf("LockLogin: %v", err)
+		}
+		if err := repo.LockLogin(ctx, "user", key, until.Add(-time.Minute)); err != nil {
+			t.Fatalf("LockLogin: %v", err)
+		}
+		attempt, err := repo.GetLoginAttempt(ctx, "user", key)
+		if err != nil || attempt == nil || attempt.LockedUntil == nil || attempt.LockedUntil.Before(until.Add(-time.Second)) {
+			t.Fatalf("GetLoginAttempt = %+v, %v; want locked until %v", attempt, err, until)
+		}
+
+		if err := repo.ClearLoginFailures(ctx, "user", key); err != nil {
+			t.Fatalf("ClearLoginFailures: %v", err)
+		}
+		if attempt, err := repo.GetLoginAttempt(ctx, "user", key); attempt != nil || err != nil {
+			t.Fatalf("GetLoginAttempt(cleared) = %+v, %v; want nil, nil", attempt, err)
+		}
+	})
+
+	t.Run("audit", func(t *testing.T) {
+		repo := newRepo(t)
+		actor := createUser(t, repo, context.Background(), unique("actor"))
+		ctx := audit.WithSource(context.Background(), audit.Source{
+			ActorID: &actor.ID, ActorUsername: &actor.Username, IP: "192.0.2.1", RequestID: unique("req"),
+		})
+
+		user := createUser(t, repo, ctx, unique("audited"))
+		if _, err := repo.UpdateUser(ctx, user.ID, &models.UpdateUserInput{PasswordHash: "changed"}); err != nil {
+			t.Fatalf("UpdateUser: %v", err)
+		}
+
+		events, err := repo.ListAuditEvents(ctx, &models.AuditEventQuery{
+			AuditEventFilter: models.AuditEventFilter{TargetType: models.AuditTargetUser, TargetID: user.ID},
+			Limit:            10,
+		})
+		if err != nil || len(events) != 2 {
+			t.Fatalf("ListAuditEvents = %d events, %v; want 2", len(events), err)
+		}
+
+		update, create := events[0], events[1]
+		if create.Action != models.AuditUserCreate || update.Action != models.AuditUserUpdate {
+			t.Fatalf("actions = %s, %s; want newest first", update.Action, create.Action)
+		}
+		if update.ActorID == nil || *update.ActorID != actor.ID || update.IP == nil || *update.IP != "192.0.2.1" {
+			t.Errorf("update source = actor %v, ip %v", update.ActorID, update.IP)
+		}
+		if update.After["password"] != audit.Redacted || len(update.After) != 1 {
+			t.Errorf("update after = %v; want only the redacted password", update.After)
+		}
+
+		older, err := repo.ListAuditEvents(ctx, &models.AuditEventQuery{
+			AuditEventFilter: models.AuditEventFilter{TargetType: models.AuditTargetUser, TargetID: user.ID},
+			BeforeID:         update.ID,
+			Limit:            10,
+		})
+		if err != nil || len(older) != 1 || older[0].ID != create.ID {
+			t.Fatalf("ListAuditEvents before %d = %v, %v; want the create event", update.ID, older, err)
+		}
+	})
+
+	t.Run("transactions", func(t *testing.T) {
+		repo, ctx := newRepo(t), context.Background()
+		name := unique("rollback")
+		failure := errors.New("abort")
+
+		err := repo.WithTx(ctx, repository.TxOptions{}, func(tx repository.Repository) error {
+			createUser(t, tx, ctx, name)
+			if got, err := tx.GetUserByUsername(ctx, name); got == nil || err != nil {
+				t.Errorf("GetUserByUsername in tx = %+v, %v; want the new user", got, err)
+			}
+			return failure
+		})
+		if !errors.Is(err, failure) {
+			t.Fatalf("WithTx err = %v; want %v", err, failure)
+		}
+		if got, err := repo.GetUserByUsername(ctx, name); got != nil || err != nil {
+			t.Fatalf("GetUserByUsername after rollback = %+v, %v; want nil, nil", got, err)
+		}
+
+		err = repo.WithTx(ctx, repository.TxOptions{}, func(tx repository.Repository) error {
+			createUser(t, tx, ctx, name)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("WithTx: %v", err)
+		}
+		if got, err := repo.GetUserByUsername(ctx, name); got == nil || err != nil {
+			t.Fatalf("GetUserByUsername after commit = %+v, %v; want the user", got, err)
+		}
+	})
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"modernc.org/sqlite"
+)
+
+// Postgres SQLSTATEs the repository translates
+const (
+	uniqueViolation      = "23505"
+	foreignKeyViolation  = "23503"
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+)
+
+// SQLite extended result codes the repository translates
+const (
+	sqliteForeignKey = 787  // SQLITE_CONSTRAINT_FOREIGNKEY
+	sqlitePrimaryKey = 1555 // SQLITE_CONSTRAINT_PRIMARYKEY
+	sqliteUnique     = 2067 // SQLITE_CONSTRAINT_UNIQUE
+)
+
+// sqliteUniqueConstraints maps the columns SQLite reports for a unique
+// violation to the name of the Postgres constraint, which the service layer
+// acts on
+var sqliteUniqueConstraints = map[string]string{
+	"users.username":     "users_username_key",
+	"users.email":        "users_email_key",
+	"organizations.slug": "organizations_slug_key",
+	"roles.name":         "roles_pkey",
+	"organization_members.organization_id, organization_members.user_id": "organization_members_pkey",
+	"mfa_recovery_codes.user_id, mfa_recovery_codes.code_hash":           "mfa_recovery_codes_user_id_code_hash_key",
+	"api_keys.prefix": "api_keys_prefix_key",
+}
+
+var sqliteUniquePattern = regexp.MustCompile(`UNIQUE constraint failed: ([^()]+?)(?: \(\d+\))?$`)
+
+// DuplicateError is returned when a write violates a unique constraint
+type DuplicateError struct {
+	Constraint string
+	Err        error
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("duplicate value violates unique constraint %q", e.Constraint)
+}
+
+func (e *DuplicateError) Unwrap() error {
+	return e.Err
+}
+
+// ReferenceError is returned when a write violates a foreign key constraint,
+// e.g. a reference to a row that does not exist or deleting a row that is
+// still referenced
+type ReferenceError struct {
+	Constraint string
+	Err        error
+}
+
+func (e *ReferenceError) Error() string {
+	return fmt.Sprintf("value violates foreign key constraint %q", e.Constraint)
+}
+
+func (e *ReferenceError) Unwrap() error {
+	return e.Err
+}
+
+// isRetryable reports whether a transaction failed only because it ran
+// concurrently with another one, so running it again may succeed
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == serializationFailure || pgErr.Code == deadlockDetected
+}
+
+// translateError converts driver errors the service layer needs to act on
+// into repository errors
+func translateError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	switch pgErr.Code {
+	case uniqueViolation:
+		return &DuplicateError{Constraint: pgErr.ConstraintName, Err: err}
+	case foreignKeyViolation:
+		return &ReferenceError{Constraint: pgErr.ConstraintName, Err: err}
+	}
+	return err
+}
+
+// translateSQLiteError is translateError for SQLite. SQLite does not report
+// which foreign key was violated, so callers name the one a statement can
+// violate.
+func translateSQLiteError(err error, foreignKey string) error {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+	switch sqliteErr.Code() {
+	case sqliteUnique, sqlitePrimaryKey:
+		constraint := ""
+		if match := sqliteUniquePattern.FindStringSubmatch(sqliteErr.Error()); match != nil {
+			constraint = match[1]
+			if name, ok := sqliteUniqueConstraints[constraint]; ok {
+				constraint = name
+			}
+		}
+		return &DuplicateError{Constraint: constraint, Err: err}
+	case sqliteForeignKey:
+		return &ReferenceError{Constraint: foreignKey, Err: err}
+	}
+	return err
+}
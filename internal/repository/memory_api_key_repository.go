@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"go-backend-starter/internal/models"
+)
+
+// CreateAPIKey stores a new hashed API key
+func (r *MemoryRepository) CreateAPIKey(ctx context.Context, key *models.APIKey) (*models.APIKey, error) {
+	defer r.write()()
+
+	if _, ok := r.state.users[key.UserID]; !ok {
+		return nil, fmt.Errorf("failed to create API key: %w", errMissingUser("api_keys"))
+	}
+	for _, other := range r.state.apiKeys {
+		if other.Prefix == key.Prefix {
+			return nil, fmt.Errorf("failed to create API key: %w",
+				fmt.Errorf("duplicate key value violates unique constraint \"api_keys_prefix_key\""))
+		}
+	}
+
+	created := models.APIKey{
+		ID:        r.state.nextID("api_keys"),
+		UserID:    key.UserID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		KeyHash:   key.KeyHash,
+		Scopes:    slices.Clone(key.Scopes),
+		MFA:       key.MFA,
+		ExpiresAt: key.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	r.state.apiKeys[created.ID] = created
+
+	return copyAPIKey(created), nil
+}
+
+// GetAPIKeyByPrefix returns the key with the given prefix, or nil if there is none
+func (r *MemoryRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	defer r.read()()
+
+	for _, key := range r.state.apiKeys {
+		if key.Prefix == prefix {
+			return copyAPIKey(key), nil
+		}
+	}
+	return nil, nil
+}
+
+// ListUserAPIKeys returns a user's API keys, newest first
+func (r *MemoryRepository) ListUserAPIKeys(ctx context.Context, userID int) ([]*models.APIKey, error) {
+	defer r.read()()
+
+	var keys []*models.APIKey
+	for _, key := range r.state.apiKeys {
+		if key.UserID == userID {
+			keys = append(keys, copyAPIKey(key))
+		}
+	}
+	slices.SortFunc(keys, func(a, b *models.APIKey) int { return cmp.Compare(b.ID, a.ID) })
+
+	return keys, nil
+}
+
+// DeleteAPIKey removes one of a user's API keys and reports whether it existed
+func (r *MemoryRepository) DeleteAPIKey(ctx context.Context, userID, id int) (bool, error) {
+	defer r.write()()
+
+	key, ok := r.state.apiKeys[id]
+	if !ok || key.UserID != userID {
+		return false, nil
+	}
+	delete(r.state.apiKeys, id)
+	return true, nil
+}
+
+// DeleteUserAPIKeys removes all of a user's API keys
+func (r *MemoryRepository) DeleteUserAPIKeys(ctx context.Context, userID int) error {
+	defer r.write()()
+
+	for id, key := range r.state.apiKeys {
+		if key.UserID == userID {
+			delete(r.state.apiKeys, id)
+		}
+	}
+	return nil
+}
+
+// TouchAPIKey records when and from where a key was last used
+func (r *MemoryRepository) TouchAPIKey(ctx context.Context, id int, ip string) error {
+	defer r.write()()
+
+	if key, ok := r.state.apiKeys[id]; ok {
+		now := time.Now()
+		key.LastUsedAt = &now
+		key.LastUsedIP = &ip
+		r.state.apiKeys[id] = key
+	}
+	return nil
+}
+
+func copyAPIKey(key models.APIKey) *models.APIKey {
+	key.Scopes = slices.Clone(key.Scopes)
+	return &key
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"maps"
+	"time"
+
+	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/tenant"
+)
+
+// CreateAuditEvent records an event that does not go with a change, such as
+// the start of an impersonation. The actor, IP and request ID come from the
+// context.
+func (r *MemoryRepository) CreateAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	defer r.write()()
+
+	stored := *event
+	r.state.addAuditEvent(ctx, &stored)
+	return nil
+}
+
+// ListAuditEvents retrieves a page of audit events, newest first. Inside an
+// organization only its events are listed.
+func (r *MemoryRepository) ListAuditEvents(ctx context.Context, query *models.AuditEventQuery) ([]*models.AuditEvent, error) {
+	defer r.read()()
+
+	orgID, scoped := tenant.OrganizationID(ctx)
+
+	var events []*models.AuditEvent
+	for i := len(r.state.auditEvents) - 1; i >= 0 && len(events) < query.Limit; i-- {
+		event := r.state.auditEvents[i]
+		switch {
+		case scoped && (event.OrganizationID == nil || *event.OrganizationID != orgID):
+		case query.ActorID != 0 && (event.ActorID == nil || *event.ActorID != query.ActorID):
+		case query.Action != "" && event.Action != query.Action:
+		case query.TargetType != "" && event.TargetType != query.TargetType:
+		case query.TargetID != 0 && (event.TargetID == nil || *event.TargetID != query.TargetID):
+		case query.CreatedAfter != nil && event.CreatedAt.Before(*query.CreatedAfter):
+		case query.CreatedBefore != nil && !event.CreatedAt.Before(*query.CreatedBefore):
+		case query.BeforeID != 0 && event.ID >= query.BeforeID:
+		default:
+			event.Before, event.After = maps.Clone(event.Before), maps.Clone(event.After)
+			events = append(events, &event)
+		}
+	}
+
+	return events, nil
+}
+
+// addAuditEvent stores an event, taking its source from the context
+func (s *memoryState) addAuditEvent(ctx context.Context, event *models.AuditEvent) {
+	withSource(ctx, event)
+	event.ID = s.nextID("audit_events")
+	event.CreatedAt = time.Now()
+	s.auditEvents = append(s.auditEvents, *event)
+}
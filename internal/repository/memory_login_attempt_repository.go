@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go-backend-starter/internal/models"
+)
+
+// GetLoginAttempt retrieves the failed login counter for a scope and key
+func (r *MemoryRepository) GetLoginAttempt(ctx context.Context, scope, key string) (*models.LoginAttempt, error) {
+	defer r.read()()
+
+	attempt, ok := r.state.loginAttempts[loginKey{scope, key}]
+	if !ok {
+		return nil, nil
+	}
+	return &attempt, nil
+}
+
+// RecordLoginFailure counts a failed login and returns the updated counter.
+// Failures older than window no longer count.
+func (r *MemoryRepository) RecordLoginFailure(ctx context.Context, scope, key string, window time.Duration) (*models.LoginAttempt, error) {
+	defer r.write()()
+
+	now := time.Now()
+	attempt, ok := r.state.loginAttempts[loginKey{scope, key}]
+	switch {
+	case !ok:
+		attempt = models.LoginAttempt{Scope: scope, Key: key, Failures: 1}
+	case attempt.LastFailureAt.Before(now.Add(-window)):
+		attempt.Failures = 1
+	default:
+		attempt.Failures++
+	}
+	attempt.LastFailureAt = now
+	r.state.loginAttempts[loginKey{scope, key}] = attempt
+
+	return &attempt, nil
+}
+
+// LockLogin blocks logins for a scope and key until the given time
+func (r *MemoryRepository) LockLogin(ctx context.Context, scope, key string, until time.Time) error {
+	defer r.write()()
+
+	attempt, ok := r.state.loginAttempts[loginKey{scope, key}]
+	if !ok {
+		return nil
+	}
+	if attempt.LockedUntil == nil || attempt.LockedUntil.Before(until) {
+		attempt.LockedUntil = &until
+		r.state.loginAttempts[loginKey{scope, key}] = attempt
+	}
+	return nil
+}
+
+// ForgiveLoginFailure takes back one counted failure for a scope and key,
+// for an attempt that was counted before it turned out to succeed
+func (r *MemoryRepository) ForgiveLoginFailure(ctx context.Context, scope, key string) error {
+	defer r.write()()
+
+	attempt, ok := r.state.loginAttempts[loginKey{scope, key}]
+	if ok && attempt.Failures > 0 {
+		attempt.Failures--
+		r.state.loginAttempts[loginKey{scope, key}] = attempt
+	}
+	return nil
+}
+
+// ClearLoginFailures resets the failed login counter for a scope and key,
+// lifting any lockout
+func (r *MemoryRepository) ClearLoginFailures(ctx context.Context, scope, key string) error {
+	defer r.write()()
+
+	delete(r.state.loginAttempts, loginKey{scope, key})
+	return nil
+}
+
+// DeleteStaleLoginAttempts removes counters with no failures within window
+// and no active lockout
+func (r *MemoryRepository) DeleteStaleLoginAttempts(ctx context.Context, window time.Duration) error {
+	defer r.write()()
+
+	now := time.Now()
+	for k, attempt := range r.state.loginAttempts {
+		if attempt.LastFailureAt.Before(now.Add(-window)) && (attempt.LockedUntil == nil || attempt.LockedUntil.Before(now)) {
+			delete(r.state.loginAttempts, k)
+		}
+	}
+	return nil
+}
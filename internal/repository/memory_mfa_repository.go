@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"go-backend-starter/internal/models"
+)
+
+// SetUserMFASecret starts a TOTP enrollment, replacing any unconfirmed
+// secret. It reports false when the user does not exist or already has MFA
+// enabled.
+func (r *MemoryRepository) SetUserMFASecret(ctx context.Context, userID int, secret string) (bool, error) {
+	defer r.write()()
+
+	user, ok := r.state.users[userID]
+	if !ok || user.DeletedAt != nil || user.MFAEnabledAt != nil {
+		return false, nil
+	}
+
+	user.MFASecret = &secret
+	user.MFALastStep = nil
+	user.UpdatedAt = time.Now()
+	r.state.users[userID] = user
+	return true, nil
+}
+
+// EnableUserMFA confirms a pending enrollment, recording step as the last
+// used TOTP time step. It reports false when there is no pending enrollment.
+func (r *MemoryRepository) EnableUserMFA(ctx context.Context, userID int, step int64) (bool, error) {
+	defer r.write()()
+
+	user, ok := r.state.users[userID]
+	if !ok || user.DeletedAt != nil || user.MFASecret == nil || user.MFAEnabledAt != nil {
+		return false, nil
+	}
+
+	now := time.Now()
+	user.MFAEnabledAt = &now
+	user.MFALastStep = &step
+	user.UpdatedAt = now
+	r.state.users[userID] = user
+	return true, nil
+}
+
+// UseMFAStep records a TOTP time step as used. It reports false when the step
+// is not newer than the last one used, i.e. the code is being replayed.
+func (r *MemoryRepository) UseMFAStep(ctx context.Context, userID int, step int64) (bool, error) {
+	defer r.write()()
+
+	user, ok := r.state.users[userID]
+	if !ok || (user.MFALastStep != nil && *user.MFALastStep >= step) {
+		return false, nil
+	}
+
+	user.MFALastStep = &step
+	r.state.users[userID] = user
+	return true, nil
+}
+
+// ResetUserMFA turns MFA off for a user and removes their recovery codes. It
+// reports false when no active user has the ID.
+func (r *MemoryRepository) ResetUserMFA(ctx context.Context, userID int) (bool, error) {
+	defer r.write()()
+
+	if visible, ok := r.state.visibleUser(ctx, userID); !ok || visible.DeletedAt != nil {
+		return false, nil
+	}
+
+	user := r.state.users[userID]
+	user.MFASecret = nil
+	user.MFAEnabledAt = nil
+	user.MFALastStep = nil
+	user.UpdatedAt = time.Now()
+	r.state.users[userID] = user
+	delete(r.state.recoveryCodes, userID)
+	return true, nil
+}
+
+// ReplaceMFARecoveryCodes replaces all recovery codes of a user
+func (r *MemoryRepository) ReplaceMFARecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	defer r.write()()
+
+	if _, ok := r.state.users[userID]; !ok && len(codeHashes) > 0 {
+		return fmt.Errorf("failed to store recovery codes: %w", errMissingUser("mfa_recovery_codes"))
+	}
+
+	codes := make([]recoveryCode, 0, len(codeHashes))
+	for i, hash := range codeHashes {
+		if slices.Contains(codeHashes[:i], hash) {
+			return fmt.Errorf("failed to store recovery codes: %w",
+				fmt.Errorf("duplicate key value violates unique constraint \"mfa_recovery_codes_user_id_code_hash_key\""))
+		}
+		codes = append(codes, recoveryCode{hash: hash})
+	}
+
+	if len(codes) == 0 {
+		delete(r.state.recoveryCodes, userID)
+	} else {
+		r.state.recoveryCodes[userID] = codes
+	}
+	return nil
+}
+
+// ConsumeMFARecoveryCode marks an unused recovery code as used. It reports
+// false when the user has no such unused code.
+func (r *MemoryRepository) ConsumeMFARecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	defer r.write()()
+
+	codes := r.state.recoveryCodes[userID]
+	i := slices.IndexFunc(codes, func(c recoveryCode) bool { return c.hash == codeHash && c.usedAt == nil })
+	if i < 0 {
+		return false, nil
+	}
+
+	now := time.Now()
+	codes = slices.Clone(codes)
+	codes[i].usedAt = &now
+	r.state.recoveryCodes[userID] = codes
+	return true, nil
+}
+
+// CreateMFAChallenge stores a new hashed MFA challenge token
+func (r *MemoryRepository) CreateMFAChallenge(ctx context.Context, challenge *models.MFAChallenge) (*models.MFAChallenge, error) {
+	defer r.write()()
+
+	if _, ok := r.state.users[challenge.UserID]; !ok {
+		return nil, fmt.Errorf("failed to create mfa challenge: %w", errMissingUser("mfa_challenges"))
+	}
+	for _, other := range r.state.mfaChallenges {
+		if other.TokenHash == challenge.TokenHash {
+			return nil, fmt.Errorf("failed to create mfa challenge: %w", errDuplicateHash("mfa_challenges"))
+		}
+	}
+
+	created := models.MFAChallenge{
+		ID:        r.state.nextID("mfa_challenges"),
+		UserID:    challenge.UserID,
+		TokenHash: challenge.TokenHash,
+		ExpiresAt: challenge.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	r.state.mfaChallenges[created.ID] = created
+
+	return &created, nil
+}
+
+// GetMFAChallengeByHash retrieves an MFA challenge by its token hash
+func (r *MemoryRepository) GetMFAChallengeByHash(ctx context.Context, tokenHash string) (*models.MFAChallenge, error) {
+	defer r.read()()
+
+	for _, challenge := range r.state.mfaChallenges {
+		if challenge.TokenHash == tokenHash {
+			return &challenge, nil
+		}
+	}
+	return nil, nil
+}
+
+// RecordMFAChallengeAttempt counts a code entered for a challenge and
+// returns the number of attempts so far, or 0 when there is no such challenge
+func (r *MemoryRepository) RecordMFAChallengeAttempt(ctx context.Context, id int) (int, error) {
+	defer r.write()()
+
+	challenge, ok := r.state.mfaChallenges[id]
+	if !ok {
+		return 0, nil
+	}
+	challenge.Attempts++
+	r.state.mfaChallenges[id] = challenge
+	return challenge.Attempts, nil
+}
+
+// ConsumeMFAChallenge marks a challenge as used. It reports false when it had
+// already been used, so a challenge completes at most one login.
+func (r *MemoryRepository) ConsumeMFAChallenge(ctx context.Context, id int) (bool, error) {
+	defer r.write()()
+
+	challenge, ok := r.state.mfaChallenges[id]
+	if !ok || challenge.UsedAt != nil {
+		return false, nil
+	}
+
+	now := time.Now()
+	challenge.UsedAt = &now
+	r.state.mfaChallenges[id] = challenge
+	return true, nil
+}
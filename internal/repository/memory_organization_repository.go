@@ -0,0 +1,223 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"go-backend-starter/internal/models"
+)
+
+// CreateOrganization stores a new organization with its first member
+func (r *MemoryRepository) CreateOrganization(ctx context.Context, org *models.Organization, ownerID int, ownerRole string) (*models.Organization, error) {
+	defer r.write()()
+
+	for _, other := range r.state.organizations {
+		if other.Slug == org.Slug {
+			return nil, fmt.Errorf("failed to create organization: %w", &DuplicateError{Constraint: "organizations_slug_key"})
+		}
+	}
+
+	now := time.Now()
+	created := models.Organization{
+		ID:        r.state.nextID("organizations"),
+		Name:      org.Name,
+		Slug:      org.Slug,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	// The organization is only stored along with its owner
+	r.state.organizations[created.ID] = created
+	if err := r.state.addMember(created.ID, ownerID, ownerRole, false, now); err != nil {
+		delete(r.state.organizations, created.ID)
+		return nil, fmt.Errorf("failed to add organization owner: %w", err)
+	}
+
+	return &created, nil
+}
+
+// GetOrganizationMember returns a user's membership in an organization, or
+// nil if they are not a member
+func (r *MemoryRepository) GetOrganizationMember(ctx context.Context, orgID, userID int) (*models.OrganizationMember, error) {
+	defer r.read()()
+
+	member, ok := r.state.members[memberKey{orgID, userID}]
+	if !ok {
+		return nil, nil
+	}
+	member.AccountRole = r.state.users[userID].Role
+	return &member, nil
+}
+
+// ListUserOrganizations returns the organizations a user belongs to, in the
+// order they joined them
+func (r *MemoryRepository) ListUserOrganizations(ctx context.Context, userID int) ([]*models.Membership, error) {
+	defer r.read()()
+
+	var memberships []*models.Membership
+	for key, member := range r.state.members {
+		if key.userID == userID {
+			memberships = append(memberships, &models.Membership{
+				Organization: r.state.organizations[key.organizationID],
+				Role:         member.Role,
+				JoinedAt:     member.CreatedAt,
+			})
+		}
+	}
+	slices.SortFunc(memberships, func(a, b *models.Membership) int {
+		return cmp.Or(a.JoinedAt.Compare(b.JoinedAt), a.ID-b.ID)
+	})
+
+	return memberships, nil
+}
+
+// AddOrganizationMember adds a user to an organization
+func (r *MemoryRepository) AddOrganizationMember(ctx context.Context, orgID, userID int, role string) error {
+	defer r.write()()
+
+	if err := r.state.addMember(orgID, userID, role, false, time.Now()); err != nil {
+		return fmt.Errorf("failed to add organization member: %w", err)
+	}
+	return nil
+}
+
+// RemoveOrganizationMember removes a user from an organization and reports
+// whether they were a member
+func (r *MemoryRepository) RemoveOrganizationMember(ctx context.Context, orgID, userID int) (bool, error) {
+	defer r.write()()
+
+	key := memberKey{orgID, userID}
+	if _, ok := r.state.members[key]; !ok {
+		return false, nil
+	}
+	delete(r.state.members, key)
+	return true, nil
+}
+
+// CountUserOrganizations counts the organizations a user belongs to
+func (r *MemoryRepository) CountUserOrganizations(ctx context.Context, userID int) (int, error) {
+	defer r.read()()
+
+	count := 0
+	for key := range r.state.members {
+		if key.userID == userID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// addMember enforces the constraints of organization_members and stores a
+// membership
+func (s *memoryState) addMember(orgID, userID int, role string, createdAccount bool, now time.Time) error {
+	key := memberKey{orgID, userID}
+	if _, ok := s.members[key]; ok {
+		return &DuplicateError{Constraint: "organization_members_pkey"}
+	}
+	if _, ok := s.organizations[orgID]; !ok {
+		return &ReferenceError{Constraint: "organization_members_organization_id_fkey"}
+	}
+	if _, ok := s.users[userID]; !ok {
+		return &ReferenceError{Constraint: "organization_members_user_id_fkey"}
+	}
+	if _, ok := s.roles[role]; !ok {
+		return &ReferenceError{Constraint: "organization_members_role_fkey"}
+	}
+
+	s.members[key] = models.OrganizationMember{
+		OrganizationID: orgID,
+		UserID:         userID,
+		Role:           role,
+		CreatedAccount: createdAccount,
+		CreatedAt:      now,
+	}
+	return nil
+}
+
+// CreateInvitation stores an invitation. An earlier invitation of the user to
+// the organization is replaced.
+func (r *MemoryRepository) CreateInvitation(ctx context.Context, invitation *models.Invitation) (*models.Invitation, error) {
+	defer r.write()()
+
+	org, ok := r.state.organizations[invitation.OrganizationID]
+	if !ok {
+		return nil, fmt.Errorf("failed to create invitation: %w", &ReferenceError{Constraint: "organization_invitations_organization_id_fkey"})
+	}
+	if _, ok := r.state.users[invitation.UserID]; !ok {
+		return nil, fmt.Errorf("failed to create invitation: %w", &ReferenceError{Constraint: "organization_invitations_user_id_fkey"})
+	}
+	if _, ok := r.state.roles[invitation.Role]; !ok {
+		return nil, fmt.Errorf("failed to create invitation: %w", &ReferenceError{Constraint: "organization_invitations_role_fkey"})
+	}
+
+	created := *invitation
+	created.OrganizationName = org.Name
+	created.CreatedAt = time.Now()
+	for id, other := range r.state.invitations {
+		if other.OrganizationID == created.OrganizationID && other.UserID == created.UserID {
+			delete(r.state.invitations, id)
+			created.ID = id
+		}
+	}
+	if created.ID == 0 {
+		created.ID = r.state.nextID("organization_invitations")
+	}
+	r.state.invitations[created.ID] = created
+
+	return &created, nil
+}
+
+// GetInvitation returns an invitation, expired or not, or nil if there is none
+func (r *MemoryRepository) GetInvitation(ctx context.Context, id int) (*models.Invitation, error) {
+	defer r.read()()
+
+	invitation, ok := r.state.invitations[id]
+	if !ok {
+		return nil, nil
+	}
+	return &invitation, nil
+}
+
+// ListOrganizationInvitations returns the unexpired invitations to an
+// organization, newest first
+func (r *MemoryRepository) ListOrganizationInvitations(ctx context.Context, orgID int) ([]*models.Invitation, error) {
+	defer r.read()()
+
+	return r.state.listInvitations(func(i models.Invitation) bool { return i.OrganizationID == orgID }), nil
+}
+
+// ListUserInvitations returns the unexpired invitations of a user, newest first
+func (r *MemoryRepository) ListUserInvitations(ctx context.Context, userID int) ([]*models.Invitation, error) {
+	defer r.read()()
+
+	return r.state.listInvitations(func(i models.Invitation) bool { return i.UserID == userID }), nil
+}
+
+// DeleteInvitation removes an invitation and reports whether it existed
+func (r *MemoryRepository) DeleteInvitation(ctx context.Context, id int) (bool, error) {
+	defer r.write()()
+
+	if _, ok := r.state.invitations[id]; !ok {
+		return false, nil
+	}
+	delete(r.state.invitations, id)
+	return true, nil
+}
+
+// listInvitations returns the unexpired invitations matching a condition,
+// newest first
+func (s *memoryState) listInvitations(match func(models.Invitation) bool) []*models.Invitation {
+	now := time.Now()
+	var invitations []*models.Invitation
+	for _, id := range slices.Backward(slices.Sorted(maps.Keys(s.invitations))) {
+		invitation := s.invitations[id]
+		if match(invitation) && invitation.ExpiresAt.After(now) {
+			invitations = append(invitations, &invitation)
+		}
+	}
+	return invitations
+}
@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// AddPasswordHistory records a password hash a user no longer uses, keeping
+// only their newest keep entries
+func (r *MemoryRepository) AddPasswordHistory(ctx context.Context, userID int, passwordHash string, keep int) error {
+	defer r.write()()
+
+	if _, ok := r.state.users[userID]; !ok {
+		return fmt.Errorf("failed to add password history: %w", errMissingUser("password_history"))
+	}
+
+	history := append(slices.Clone(r.state.passwordHistory[userID]), passwordHash)
+	if len(history) > keep {
+		history = history[len(history)-keep:]
+	}
+	r.state.passwordHistory[userID] = history
+	return nil
+}
+
+// GetPasswordHistory returns a user's newest previous password hashes
+func (r *MemoryRepository) GetPasswordHistory(ctx context.Context, userID int, limit int) ([]string, error) {
+	defer r.read()()
+
+	history := r.state.passwordHistory[userID]
+	var hashes []string
+	for i := len(history) - 1; i >= 0 && len(hashes) < limit; i-- {
+		hashes = append(hashes, history[i])
+	}
+	return hashes, nil
+}
@@ -0,0 +1,589 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/tenant"
+)
+
+// MemoryRepository implements Repository in memory, for tests and demos. It
+// behaves like PostgresRepository on a freshly migrated database, including
+// its constraints, orderings and not-found results. Strings sort bytewise,
+// like Postgres with the C collation.
+type MemoryRepository struct {
+	mu    *sync.RWMutex
+	state *memoryState
+	inTx  bool // bound to a unit of work, which holds the write lock
+}
+
+// memoryState holds the tables. Stored values are never modified in place,
+// so a shallow copy of the maps is a consistent snapshot.
+type memoryState struct {
+	sequences          map[string]int
+	users              map[int]models.User
+	passwordHistory    map[int][]string // oldest first
+	organizations      map[int]models.Organization
+	members            map[memberKey]models.OrganizationMember
+	invitations        map[int]models.Invitation
+	roles              map[string]models.Role // Permissions holds the sorted permission names
+	permissions        map[string]models.Permission
+	refreshTokens      map[int]models.RefreshToken
+	revokedTokens      map[string]revokedToken
+	userRevocations    map[int]time.Time
+	verificationTokens map[int]models.EmailVerificationToken
+	resetTokens        map[int]models.PasswordResetToken
+	recoveryCodes      map[int][]recoveryCode
+	mfaChallenges      map[int]models.MFAChallenge
+	apiKeys            map[int]models.APIKey
+	loginAttempts      map[loginKey]models.LoginAttempt
+	auditEvents        []models.AuditEvent
+}
+
+type memberKey struct {
+	organizationID int
+	userID         int
+}
+
+type loginKey struct {
+	scope string
+	key   string
+}
+
+type revokedToken struct {
+	userID    int
+	expiresAt time.Time
+}
+
+type recoveryCode struct {
+	hash   string
+	usedAt *time.Time
+}
+
+// NewMemoryRepository creates an in-memory repository holding what the
+// migrations create: the permissions, the built-in roles, the default admin
+// user (password admin123) and the default organization.
+func NewMemoryRepository() *MemoryRepository {
+	s := &memoryState{
+		sequences:          make(map[string]int),
+		users:              make(map[int]models.User),
+		passwordHistory:    make(map[int][]string),
+		organizations:      make(map[int]models.Organization),
+		members:            make(map[memberKey]models.OrganizationMember),
+		invitations:        make(map[int]models.Invitation),
+		roles:              make(map[string]models.Role),
+		permissions:        make(map[string]models.Permission),
+		refreshTokens:      make(map[int]models.RefreshToken),
+		revokedTokens:      make(map[string]revokedToken),
+		userRevocations:    make(map[int]time.Time),
+		verificationTokens: make(map[int]models.EmailVerificationToken),
+		resetTokens:        make(map[int]models.PasswordResetToken),
+		recoveryCodes:      make(map[int][]recoveryCode),
+		mfaChallenges:      make(map[int]models.MFAChallenge),
+		apiKeys:            make(map[int]models.APIKey),
+		loginAttempts:      make(map[loginKey]models.LoginAttempt),
+	}
+
+	now := time.Now()
+	for _, p := range []models.Permission{
+		{Name: models.PermissionUsersRead, Description: "List and view users"},
+		{Name: models.PermissionUsersWrite, Description: "Create and update users"},
+		{Name: models.PermissionUsersDelete, Description: "Delete, restore and purge users"},
+		{Name: models.PermissionUsersSecurity, Description: "Reset MFA and lift login lockouts"},
+		{Name: models.PermissionRolesRead, Description: "List roles and permissions"},
+		{Name: models.PermissionRolesWrite, Description: "Create, update and delete roles"},
+		{Name: models.PermissionOrgsWrite, Description: "Create organizations and manage their members"},
+		{Name: models.PermissionUsersImpersonate, Description: "Act as another user for support"},
+		{Name: models.PermissionAuditRead, Description: "View the audit log"},
+	} {
+		s.permissions[p.Name] = p
+	}
+
+	s.roles[models.RoleAdmin] = models.Role{
+		Name:        models.RoleAdmin,
+		Description: "Full access",
+		Builtin:     true,
+		Permissions: slices.Sorted(maps.Keys(s.permissions)),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	s.roles[models.RoleUser] = models.Role{
+		Name:        models.RoleUser,
+		Description: "Regular user",
+		Builtin:     true,
+		Permissions: []string{},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	admin := models.User{
+		ID:           s.nextID("users"),
+		Username:     "admin",
+		PasswordHash: "$2a$12$RHDj3N3c/Q8wtaZmbCeI.uMV2YOJA4aVJyOkZEZDpZmyl63kf1y7a", // bcrypt hash for 'admin123'
+		Email:        "admin@example.com",
+		Role:         models.RoleAdmin,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	s.users[admin.ID] = admin
+
+	org := models.Organization{ID: s.nextID("organizations"), Name: "Default", Slug: "default", CreatedAt: now, UpdatedAt: now}
+	s.organizations[org.ID] = org
+	s.members[memberKey{org.ID, admin.ID}] = models.OrganizationMember{
+		OrganizationID: org.ID,
+		UserID:         admin.ID,
+		Role:           admin.Role,
+		CreatedAccount: true,
+		CreatedAt:      now,
+	}
+
+	return &MemoryRepository{mu: &sync.RWMutex{}, state: s}
+}
+
+// read locks the repository for reading and returns the unlock function.
+// Inside a unit of work the write lock is already held.
+func (r *MemoryRepository) read() func() {
+	if r.inTx {
+		return func() {}
+	}
+	r.mu.RLock()
+	return r.mu.RUnlock
+}
+
+// write locks the repository for writing and returns the unlock function
+func (r *MemoryRepository) write() func() {
+	if r.inTx {
+		return func() {}
+	}
+	r.mu.Lock()
+	return r.mu.Unlock
+}
+
+// WithTx runs fn as a unit of work. Units of work hold the write lock while
+// they run, so they are serializable and never need to be retried; opts is
+// accepted for compatibility. The changes of fn are undone when it returns
+// an error. Inside a unit of work fn joins the enclosing one.
+func (r *MemoryRepository) WithTx(ctx context.Context, opts TxOptions, fn func(repo Repository) error) error {
+	if r.inTx {
+		return fn(r)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot := r.state.clone()
+	if err := fn(&MemoryRepository{mu: r.mu, state: r.state, inTx: true}); err != nil {
+		*r.state = *snapshot
+		return err
+	}
+
+	return nil
+}
+
+// clone returns a snapshot of the state
+func (s *memoryState) clone() *memoryState {
+	return &memoryState{
+		sequences:          maps.Clone(s.sequences),
+		users:              maps.Clone(s.users),
+		passwordHistory:    maps.Clone(s.passwordHistory),
+		organizations:      maps.Clone(s.organizations),
+		members:            maps.Clone(s.members),
+		invitations:        maps.Clone(s.invitations),
+		roles:              maps.Clone(s.roles),
+		permissions:        maps.Clone(s.permissions),
+		refreshTokens:      maps.Clone(s.refreshTokens),
+		revokedTokens:      maps.Clone(s.revokedTokens),
+		userRevocations:    maps.Clone(s.userRevocations),
+		verificationTokens: maps.Clone(s.verificationTokens),
+		resetTokens:        maps.Clone(s.resetTokens),
+		recoveryCodes:      maps.Clone(s.recoveryCodes),
+		mfaChallenges:      maps.Clone(s.mfaChallenges),
+		apiKeys:            maps.Clone(s.apiKeys),
+		loginAttempts:      maps.Clone(s.loginAttempts),
+		auditEvents:        slices.Clip(s.auditEvents),
+	}
+}
+
+// nextID returns the next value of a table's ID sequence
+func (s *memoryState) nextID(table string) int {
+	s.sequences[table]++
+	return s.sequences[table]
+}
+
+// visibleUser returns a user as user queries in ctx see it: inside an
+// organization only its members, with their role there
+func (s *memoryState) visibleUser(ctx context.Context, id int) (models.User, bool) {
+	user, ok := s.users[id]
+	if !ok {
+		return models.User{}, false
+	}
+	if orgID, scoped := tenant.OrganizationID(ctx); scoped {
+		member, ok := s.members[memberKey{orgID, id}]
+		if !ok {
+			return models.User{}, false
+		}
+		user.Role = member.Role
+	}
+	return user, true
+}
+
+// findUser returns the first active visible user matching match
+func (s *memoryState) findUser(ctx context.Context, match func(models.User) bool) *models.User {
+	for id := range s.users {
+		user, ok := s.visibleUser(ctx, id)
+		if ok && user.DeletedAt == nil && match(user) {
+			return &user
+		}
+	}
+	return nil
+}
+
+// checkUserUnique enforces the unique constraints of users for a user with
+// the given ID, which may be 0 for a new user
+func (s *memoryState) checkUserUnique(id int, username, email string) error {
+	for _, other := range s.users {
+		if other.ID != id && other.Username == username {
+			return &DuplicateError{Constraint: "users_username_key"}
+		}
+	}
+	for _, other := range s.users {
+		if other.ID != id && other.Email == email {
+			return &DuplicateError{Constraint: "users_email_key"}
+		}
+	}
+	return nil
+}
+
+// GetUserByID retrieves a user by ID
+func (r *MemoryRepository) GetUserByID(ctx context.Context, id int) (*models.User, error) {
+	defer r.read()()
+
+	user, ok := r.state.visibleUser(ctx, id)
+	if !ok || user.DeletedAt != nil {
+		return nil, nil
+	}
+	return &user, nil
+}
+
+// GetUserByUsername retrieves a user by username
+func (r *MemoryRepository) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	defer r.read()()
+
+	return r.state.findUser(ctx, func(u models.User) bool { return u.Username == username }), nil
+}
+
+// GetUserByEmail retrieves a user by email
+func (r *MemoryRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	defer r.read()()
+
+	return r.state.findUser(ctx, func(u models.User) bool { return u.Email == email }), nil
+}
+
+// CreateUser creates a new user. Inside an organization the user becomes a
+// member with the given role and gets the user role globally.
+func (r *MemoryRepository) CreateUser(ctx context.Context, input *models.CreateUserInput) (*models.User, error) {
+	defer r.write()()
+
+	now := time.Now()
+	user := models.User{
+		Username:     input.Username,
+		PasswordHash: input.PasswordHash,
+		Email:        input.Email,
+		Role:         input.Role,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if input.EmailVerified {
+		user.EmailVerifiedAt = &now
+	}
+
+	orgID, scoped := tenant.OrganizationID(ctx)
+	if scoped {
+		user.Role = models.RoleUser
+	}
+
+	if err := r.state.checkUserUnique(0, user.Username, user.Email); err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	if _, ok := r.state.roles[user.Role]; !ok {
+		return nil, fmt.Errorf("failed to create user: %w", &ReferenceError{Constraint: "users_role_fkey"})
+	}
+	if scoped {
+		if _, ok := r.state.organizations[orgID]; !ok {
+			return nil, fmt.Errorf("failed to add organization member: %w", &ReferenceError{Constraint: "organization_members_organization_id_fkey"})
+		}
+		if _, ok := r.state.roles[input.Role]; !ok {
+			return nil, fmt.Errorf("failed to add organization member: %w", &ReferenceError{Constraint: "organization_members_role_fkey"})
+		}
+	}
+
+	user.ID = r.state.nextID("users")
+	r.state.users[user.ID] = user
+	if scoped {
+		r.state.members[memberKey{orgID, user.ID}] = models.OrganizationMember{
+			OrganizationID: orgID,
+			UserID:         user.ID,
+			Role:           input.Role,
+			CreatedAccount: true,
+			CreatedAt:      now,
+		}
+	}
+
+	created, _ := r.state.visibleUser(ctx, user.ID)
+	r.state.addAuditEvent(ctx, userEvent(ctx, models.AuditUserCreate, nil, &created))
+
+	return &created, nil
+}
+
+// UpdateUser updates an existing user. Inside an organization a role change
+// applies to the user's membership rather than their global role.
+func (r *MemoryRepository) UpdateUser(ctx context.Context, id int, input *models.UpdateUserInput) (*models.User, error) {
+	defer r.write()()
+
+	orgID, scoped := tenant.OrganizationID(ctx)
+
+	before, ok := r.state.visibleUser(ctx, id)
+	if !ok || before.DeletedAt != nil {
+		return nil, nil
+	}
+
+	// If no fields to update, just return the current user
+	if input.Username == "" && input.Email == "" && input.PasswordHash == "" && input.Role == "" {
+		return &before, nil
+	}
+
+	user := r.state.users[id]
+	if input.Username != "" {
+		user.Username = input.Username
+	}
+	if input.Email != "" {
+		user.Email = input.Email
+	}
+	if input.PasswordHash != "" {
+		user.PasswordHash = input.PasswordHash
+	}
+	if input.Role != "" && !scoped {
+		user.Role = input.Role
+	}
+	user.UpdatedAt = time.Now()
+
+	if err := r.state.checkUserUnique(id, user.Username, user.Email); err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+	if _, ok := r.state.roles[user.Role]; !ok {
+		return nil, fmt.Errorf("failed to update user: %w", &ReferenceError{Constraint: "users_role_fkey"})
+	}
+	if input.Role != "" && scoped {
+		if _, ok := r.state.roles[input.Role]; !ok {
+			return nil, fmt.Errorf("failed to update member role: %w", &ReferenceError{Constraint: "organization_members_role_fkey"})
+		}
+		member := r.state.members[memberKey{orgID, id}]
+		member.Role = input.Role
+		r.state.members[memberKey{orgID, id}] = member
+	}
+	r.state.users[id] = user
+
+	after, _ := r.state.visibleUser(ctx, id)
+	r.state.addAuditEvent(ctx, userEvent(ctx, models.AuditUserUpdate, &before, &after))
+
+	return &after, nil
+}
+
+// UpdateUserPasswordHash replaces a user's password hash without touching
+// updated_at, for upgrading hashes to the current algorithm
+func (r *MemoryRepository) UpdateUserPasswordHash(ctx context.Context, id int, passwordHash string) error {
+	defer r.write()()
+
+	if user, ok := r.state.users[id]; ok {
+		user.PasswordHash = passwordHash
+		r.state.users[id] = user
+	}
+	return nil
+}
+
+// DeleteUser soft deletes a user. It reports false when no active user has the ID.
+func (r *MemoryRepository) DeleteUser(ctx context.Context, id int) (bool, error) {
+	defer r.write()()
+
+	before, ok := r.state.visibleUser(ctx, id)
+	if !ok || before.DeletedAt != nil {
+		return false, nil
+	}
+
+	now := time.Now()
+	user := r.state.users[id]
+	user.DeletedAt = &now
+	r.state.users[id] = user
+
+	after := before
+	after.DeletedAt = &now
+	r.state.addAuditEvent(ctx, userEvent(ctx, models.AuditUserDelete, &before, &after))
+
+	return true, nil
+}
+
+// RestoreUser undoes a soft delete. It returns nil when no deleted user has the ID.
+func (r *MemoryRepository) RestoreUser(ctx context.Context, id int) (*models.User, error) {
+	defer r.write()()
+
+	before, ok := r.state.visibleUser(ctx, id)
+	if !ok || before.DeletedAt == nil {
+		return nil, nil
+	}
+
+	user := r.state.users[id]
+	user.DeletedAt = nil
+	user.UpdatedAt = time.Now()
+	r.state.users[id] = user
+
+	after, _ := r.state.visibleUser(ctx, id)
+	r.state.addAuditEvent(ctx, userEvent(ctx, models.AuditUserRestore, &before, &after))
+
+	return &after, nil
+}
+
+// PurgeUser permanently deletes a user, whether soft deleted or not. It
+// reports false when no user has the ID.
+func (r *MemoryRepository) PurgeUser(ctx context.Context, id int) (bool, error) {
+	defer r.write()()
+
+	before, ok := r.state.visibleUser(ctx, id)
+	if !ok {
+		return false, nil
+	}
+
+	// Rows referencing the user go with it
+	delete(r.state.users, id)
+	delete(r.state.passwordHistory, id)
+	delete(r.state.recoveryCodes, id)
+	maps.DeleteFunc(r.state.members, func(_ memberKey, m models.OrganizationMember) bool { return m.UserID == id })
+	maps.DeleteFunc(r.state.invitations, func(_ int, i models.Invitation) bool { return i.UserID == id })
+	for invitationID, invitation := range r.state.invitations {
+		if invitation.InvitedBy != nil && *invitation.InvitedBy == id {
+			invitation.InvitedBy = nil
+			r.state.invitations[invitationID] = invitation
+		}
+	}
+	maps.DeleteFunc(r.state.refreshTokens, func(_ int, t models.RefreshToken) bool { return t.UserID == id })
+	maps.DeleteFunc(r.state.verificationTokens, func(_ int, t models.EmailVerificationToken) bool { return t.UserID == id })
+	maps.DeleteFunc(r.state.resetTokens, func(_ int, t models.PasswordResetToken) bool { return t.UserID == id })
+	maps.DeleteFunc(r.state.mfaChallenges, func(_ int, c models.MFAChallenge) bool { return c.UserID == id })
+	maps.DeleteFunc(r.state.apiKeys, func(_ int, k models.APIKey) bool { return k.UserID == id })
+
+	r.state.addAuditEvent(ctx, userEvent(ctx, models.AuditUserPurge, &before, nil))
+
+	return true, nil
+}
+
+// ListUsers retrieves a page of users using keyset pagination
+func (r *MemoryRepository) ListUsers(ctx context.Context, query *models.UserListQuery) ([]*models.User, error) {
+	defer r.read()()
+
+	if _, ok := userSortColumns[query.SortField]; !ok {
+		return nil, fmt.Errorf("unsupported sort field %q", query.SortField)
+	}
+
+	direction := 1
+	if query.Descending {
+		direction = -1
+	}
+
+	users := r.state.filterUsers(ctx, &query.UserFilter)
+	slices.SortFunc(users, func(a, b *models.User) int {
+		return direction * compareUserKey(a, query.SortField, userKeyOf(b, query.SortField))
+	})
+
+	// Users strictly after the key in sort order; id breaks ties
+	if query.After != nil {
+		users = slices.DeleteFunc(users, func(u *models.User) bool {
+			return direction*compareUserKey(u, query.SortField, query.After) <= 0
+		})
+	}
+
+	if len(users) > query.Limit {
+		users = users[:query.Limit]
+	}
+
+	return users, nil
+}
+
+// CountUsers counts the users matching a filter
+func (r *MemoryRepository) CountUsers(ctx context.Context, filter *models.UserFilter) (int, error) {
+	defer r.read()()
+
+	return len(r.state.filterUsers(ctx, filter)), nil
+}
+
+// MarkEmailVerified records that a user has verified their email address
+func (r *MemoryRepository) MarkEmailVerified(ctx context.Context, userID int) error {
+	defer r.write()()
+
+	user, ok := r.state.users[userID]
+	if ok && user.EmailVerifiedAt == nil {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+		user.UpdatedAt = now
+		r.state.users[userID] = user
+	}
+	return nil
+}
+
+// filterUsers returns the visible users matching a filter
+func (s *memoryState) filterUsers(ctx context.Context, filter *models.UserFilter) []*models.User {
+	search := strings.ToLower(filter.Search)
+
+	var users []*models.User
+	for id := range s.users {
+		user, ok := s.visibleUser(ctx, id)
+		switch {
+		case !ok:
+		case filter.Deleted != (user.DeletedAt != nil):
+		case filter.Role != "" && user.Role != filter.Role:
+		case filter.CreatedAfter != nil && user.CreatedAt.Before(*filter.CreatedAfter):
+		case filter.CreatedBefore != nil && !user.CreatedAt.Before(*filter.CreatedBefore):
+		case search != "" && !strings.Contains(strings.ToLower(user.Username), search) &&
+			!strings.Contains(strings.ToLower(user.Email), search):
+		default:
+			users = append(users, &user)
+		}
+	}
+	return users
+}
+
+// userKeyOf returns the position of a user in a list sorted by field
+func userKeyOf(user *models.User, field string) *models.UserKey {
+	key := &models.UserKey{ID: user.ID}
+	switch field {
+	case "username":
+		key.Value = user.Username
+	case "email":
+		key.Value = user.Email
+	case "created_at":
+		key.Value = user.CreatedAt
+	}
+	return key
+}
+
+// compareUserKey compares a user's position in a list sorted ascending by
+// field with a key
+func compareUserKey(user *models.User, field string, key *models.UserKey) int {
+	var c int
+	switch field {
+	case "username":
+		c = strings.Compare(user.Username, key.Value.(string))
+	case "email":
+		c = strings.Compare(user.Email, key.Value.(string))
+	case "created_at":
+		c = user.CreatedAt.Compare(key.Value.(time.Time))
+	}
+	if c != 0 {
+		return c
+	}
+	return user.ID - key.ID
+}
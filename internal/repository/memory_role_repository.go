@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"go-backend-starter/internal/models"
+)
+
+// ListRoles returns every role with its permissions
+func (r *MemoryRepository) ListRoles(ctx context.Context) ([]*models.Role, error) {
+	defer r.read()()
+
+	var roles []*models.Role
+	for _, name := range slices.Sorted(maps.Keys(r.state.roles)) {
+		roles = append(roles, r.state.role(name))
+	}
+	return roles, nil
+}
+
+// GetRole returns a role with its permissions, or nil if there is none
+func (r *MemoryRepository) GetRole(ctx context.Context, name string) (*models.Role, error) {
+	defer r.read()()
+
+	return r.state.role(name), nil
+}
+
+// CreateRole stores a new custom role and its permissions
+func (r *MemoryRepository) CreateRole(ctx context.Context, role *models.Role) (*models.Role, error) {
+	defer r.write()()
+
+	if _, ok := r.state.roles[role.Name]; ok {
+		return nil, fmt.Errorf("failed to create role: %w", &DuplicateError{Constraint: "roles_pkey"})
+	}
+	permissions, err := r.state.rolePermissions(role.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	r.state.roles[role.Name] = models.Role{
+		Name:        role.Name,
+		Description: role.Description,
+		Permissions: permissions,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	return r.state.role(role.Name), nil
+}
+
+// UpdateRole replaces a role's description and permissions. It returns nil
+// when the role does not exist.
+func (r *MemoryRepository) UpdateRole(ctx context.Context, name string, input *models.UpdateRoleInput) (*models.Role, error) {
+	defer r.write()()
+
+	role, ok := r.state.roles[name]
+	if !ok {
+		return nil, nil
+	}
+	permissions, err := r.state.rolePermissions(input.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	role.Description = input.Description
+	role.Permissions = permissions
+	role.UpdatedAt = time.Now()
+	r.state.roles[name] = role
+
+	return r.state.role(name), nil
+}
+
+// DeleteRole removes a custom role. Built-in roles are never deleted, and a
+// role that is still assigned to users fails with a ReferenceError.
+func (r *MemoryRepository) DeleteRole(ctx context.Context, name string) (bool, error) {
+	defer r.write()()
+
+	role, ok := r.state.roles[name]
+	if !ok || role.Builtin {
+		return false, nil
+	}
+	for _, user := range r.state.users {
+		if user.Role == name {
+			return false, fmt.Errorf("failed to delete role: %w", &ReferenceError{Constraint: "users_role_fkey"})
+		}
+	}
+	for _, member := range r.state.members {
+		if member.Role == name {
+			return false, fmt.Errorf("failed to delete role: %w", &ReferenceError{Constraint: "organization_members_role_fkey"})
+		}
+	}
+
+	// Invitations to the role go with it
+	delete(r.state.roles, name)
+	maps.DeleteFunc(r.state.invitations, func(_ int, i models.Invitation) bool { return i.Role == name })
+	return true, nil
+}
+
+// ListPermissions returns every permission
+func (r *MemoryRepository) ListPermissions(ctx context.Context) ([]*models.Permission, error) {
+	defer r.read()()
+
+	var permissions []*models.Permission
+	for _, name := range slices.Sorted(maps.Keys(r.state.permissions)) {
+		permission := r.state.permissions[name]
+		permissions = append(permissions, &permission)
+	}
+	return permissions, nil
+}
+
+// GetRolePermissions returns the permission names a role grants
+func (r *MemoryRepository) GetRolePermissions(ctx context.Context, role string) ([]string, error) {
+	defer r.read()()
+
+	return slices.Clone(r.state.roles[role].Permissions), nil
+}
+
+// role returns a copy of a role, or nil if there is none
+func (s *memoryState) role(name string) *models.Role {
+	role, ok := s.roles[name]
+	if !ok {
+		return nil
+	}
+	role.Permissions = slices.Clone(role.Permissions)
+	return &role
+}
+
+// rolePermissions checks that permissions exist and returns them sorted and
+// without duplicates
+func (s *memoryState) rolePermissions(permissions []string) ([]string, error) {
+	for _, name := range permissions {
+		if _, ok := s.permissions[name]; !ok {
+			return nil, fmt.Errorf("failed to set role permissions: %w", &ReferenceError{Constraint: "role_permissions_permission_fkey"})
+		}
+	}
+
+	sorted := slices.Clone(permissions)
+	slices.Sort(sorted)
+	return append([]string{}, slices.Compact(sorted)...), nil
+}
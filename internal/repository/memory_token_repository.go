@@ -0,0 +1,265 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go-backend-starter/internal/models"
+)
+
+// errMissingUser is the foreign key violation of a row referencing a user
+// that does not exist. Like the Postgres error it is not translated.
+func errMissingUser(table string) error {
+	return fmt.Errorf("insert or update on table %q violates foreign key constraint \"%s_user_id_fkey\"", table, table)
+}
+
+// errDuplicateHash is the unique violation of a token hash. Like the
+// Postgres error it is not translated.
+func errDuplicateHash(table string) error {
+	return fmt.Errorf("duplicate key value violates unique constraint \"%s_token_hash_key\"", table)
+}
+
+// CreateRefreshToken stores a new hashed refresh token
+func (r *MemoryRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) (*models.RefreshToken, error) {
+	defer r.write()()
+
+	if _, ok := r.state.users[token.UserID]; !ok {
+		return nil, fmt.Errorf("failed to create refresh token: %w", errMissingUser("refresh_tokens"))
+	}
+	for _, other := range r.state.refreshTokens {
+		if other.TokenHash == token.TokenHash {
+			return nil, fmt.Errorf("failed to create refresh token: %w", errDuplicateHash("refresh_tokens"))
+		}
+	}
+
+	created := models.RefreshToken{
+		ID:        r.state.nextID("refresh_tokens"),
+		UserID:    token.UserID,
+		FamilyID:  token.FamilyID,
+		TokenHash: token.TokenHash,
+		ExpiresAt: token.ExpiresAt,
+		MFA:       token.MFA,
+		CreatedAt: time.Now(),
+	}
+	r.state.refreshTokens[created.ID] = created
+
+	return &created, nil
+}
+
+// GetRefreshTokenByHash retrieves a refresh token by its hash
+func (r *MemoryRepository) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	defer r.read()()
+
+	for _, token := range r.state.refreshTokens {
+		if token.TokenHash == tokenHash {
+			return &token, nil
+		}
+	}
+	return nil, nil
+}
+
+// MarkRefreshTokenRotated marks a refresh token as used. It reports false when
+// the token had already been rotated or revoked, so concurrent exchanges of the
+// same token cannot both succeed.
+func (r *MemoryRepository) MarkRefreshTokenRotated(ctx context.Context, id int) (bool, error) {
+	defer r.write()()
+
+	token, ok := r.state.refreshTokens[id]
+	if !ok || token.RotatedAt != nil || token.RevokedAt != nil {
+		return false, nil
+	}
+
+	now := time.Now()
+	token.RotatedAt = &now
+	r.state.refreshTokens[id] = token
+	return true, nil
+}
+
+// RevokeRefreshTokenFamily revokes every refresh token descended from the same login
+func (r *MemoryRepository) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	defer r.write()()
+
+	r.state.revokeRefreshTokens(func(t models.RefreshToken) bool { return t.FamilyID == familyID })
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes every outstanding refresh token of a user
+func (r *MemoryRepository) RevokeUserRefreshTokens(ctx context.Context, userID int) error {
+	defer r.write()()
+
+	r.state.revokeRefreshTokens(func(t models.RefreshToken) bool { return t.UserID == userID })
+	return nil
+}
+
+// revokeRefreshTokens revokes the unrevoked refresh tokens matching match
+func (s *memoryState) revokeRefreshTokens(match func(models.RefreshToken) bool) {
+	now := time.Now()
+	for id, token := range s.refreshTokens {
+		if token.RevokedAt == nil && match(token) {
+			token.RevokedAt = &now
+			s.refreshTokens[id] = token
+		}
+	}
+}
+
+// RevokeToken adds an access token to the revocation list
+func (r *MemoryRepository) RevokeToken(ctx context.Context, jti string, userID int, expiresAt time.Time) error {
+	defer r.write()()
+
+	if _, ok := r.state.revokedTokens[jti]; !ok {
+		r.state.revokedTokens[jti] = revokedToken{userID: userID, expiresAt: expiresAt}
+	}
+	return nil
+}
+
+// IsTokenRevoked reports whether an access token is on the revocation list
+func (r *MemoryRepository) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	defer r.read()()
+
+	_, revoked := r.state.revokedTokens[jti]
+	return revoked, nil
+}
+
+// DeleteExpiredRevokedTokens removes revocation entries for tokens that have expired
+func (r *MemoryRepository) DeleteExpiredRevokedTokens(ctx context.Context) error {
+	defer r.write()()
+
+	now := time.Now()
+	for jti, token := range r.state.revokedTokens {
+		if token.expiresAt.Before(now) {
+			delete(r.state.revokedTokens, jti)
+		}
+	}
+	return nil
+}
+
+// RevokeUserTokens rejects every access token of a user issued before the given time
+func (r *MemoryRepository) RevokeUserTokens(ctx context.Context, userID int, before time.Time) error {
+	defer r.write()()
+
+	if current, ok := r.state.userRevocations[userID]; !ok || current.Before(before) {
+		r.state.userRevocations[userID] = before
+	}
+	return nil
+}
+
+// GetUserTokensRevokedBefore returns the cut-off time for a user's access tokens, or nil if none is set
+func (r *MemoryRepository) GetUserTokensRevokedBefore(ctx context.Context, userID int) (*time.Time, error) {
+	defer r.read()()
+
+	before, ok := r.state.userRevocations[userID]
+	if !ok {
+		return nil, nil
+	}
+	return &before, nil
+}
+
+// CreateEmailVerificationToken stores a new hashed email verification token
+func (r *MemoryRepository) CreateEmailVerificationToken(ctx context.Context, token *models.EmailVerificationToken) (*models.EmailVerificationToken, error) {
+	defer r.write()()
+
+	if _, ok := r.state.users[token.UserID]; !ok {
+		return nil, fmt.Errorf("failed to create email verification token: %w", errMissingUser("email_verification_tokens"))
+	}
+	for _, other := range r.state.verificationTokens {
+		if other.TokenHash == token.TokenHash {
+			return nil, fmt.Errorf("failed to create email verification token: %w", errDuplicateHash("email_verification_tokens"))
+		}
+	}
+
+	created := models.EmailVerificationToken{
+		ID:        r.state.nextID("email_verification_tokens"),
+		UserID:    token.UserID,
+		TokenHash: token.TokenHash,
+		ExpiresAt: token.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	r.state.verificationTokens[created.ID] = created
+
+	return &created, nil
+}
+
+// ConsumeEmailVerificationToken marks an unused, unexpired token as used and
+// returns it. It returns nil when no such token exists, so a token can only be
+// redeemed once even under concurrent requests.
+func (r *MemoryRepository) ConsumeEmailVerificationToken(ctx context.Context, tokenHash string) (*models.EmailVerificationToken, error) {
+	defer r.write()()
+
+	now := time.Now()
+	for id, token := range r.state.verificationTokens {
+		if token.TokenHash == tokenHash && token.UsedAt == nil && token.ExpiresAt.After(now) {
+			token.UsedAt = &now
+			r.state.verificationTokens[id] = token
+			return &token, nil
+		}
+	}
+	return nil, nil
+}
+
+// CreatePasswordResetToken stores a new hashed password reset token
+func (r *MemoryRepository) CreatePasswordResetToken(ctx context.Context, token *models.PasswordResetToken) (*models.PasswordResetToken, error) {
+	defer r.write()()
+
+	if _, ok := r.state.users[token.UserID]; !ok {
+		return nil, fmt.Errorf("failed to create password reset token: %w", errMissingUser("password_reset_tokens"))
+	}
+	for _, other := range r.state.resetTokens {
+		if other.TokenHash == token.TokenHash {
+			return nil, fmt.Errorf("failed to create password reset token: %w", errDuplicateHash("password_reset_tokens"))
+		}
+	}
+
+	created := models.PasswordResetToken{
+		ID:        r.state.nextID("password_reset_tokens"),
+		UserID:    token.UserID,
+		TokenHash: token.TokenHash,
+		ExpiresAt: token.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	r.state.resetTokens[created.ID] = created
+
+	return &created, nil
+}
+
+// GetPasswordResetToken returns an unused, unexpired token without using it
+// up. It returns nil when no such token exists.
+func (r *MemoryRepository) GetPasswordResetToken(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error) {
+	defer r.read()()
+
+	now := time.Now()
+	for _, token := range r.state.resetTokens {
+		if token.TokenHash == tokenHash && token.UsedAt == nil && token.ExpiresAt.After(now) {
+			return &token, nil
+		}
+	}
+	return nil, nil
+}
+
+// ConsumePasswordResetToken marks an unused, unexpired token as used and
+// returns it. It returns nil when no such token exists.
+func (r *MemoryRepository) ConsumePasswordResetToken(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error) {
+	defer r.write()()
+
+	now := time.Now()
+	for id, token := range r.state.resetTokens {
+		if token.TokenHash == tokenHash && token.UsedAt == nil && token.ExpiresAt.After(now) {
+			token.UsedAt = &now
+			r.state.resetTokens[id] = token
+			return &token, nil
+		}
+	}
+	return nil, nil
+}
+
+// DeleteUserPasswordResetTokens removes every password reset token of a user
+func (r *MemoryRepository) DeleteUserPasswordResetTokens(ctx context.Context, userID int) error {
+	defer r.write()()
+
+	for id, token := range r.state.resetTokens {
+		if token.UserID == userID {
+			delete(r.state.resetTokens, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go-backend-starter/internal/models"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+)
+
+// apiKeyColumns lists the columns scanned into models.APIKey
+const apiKeyColumns = "id, user_id, name, prefix, key_hash, scopes, mfa, expires_at, last_used_at, last_used_ip, created_at"
+
+// CreateAPIKey stores a new hashed API key
+func (r *PostgresRepository) CreateAPIKey(ctx context.Context, key *models.APIKey) (*models.APIKey, error) {
+	var created models.APIKey
+	err := pgxscan.Get(ctx, r.db, &created, `
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, mfa, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+		RETURNING `+apiKeyColumns,
+		key.UserID, key.Name, key.Prefix, key.KeyHash, key.Scopes, key.MFA, key.ExpiresAt)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return &created, nil
+}
+
+// GetAPIKeyByPrefix returns the key with the given prefix, or nil if there is none
+func (r *PostgresRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := pgxscan.Get(ctx, r.db, &key, `
+		SELECT `+apiKeyColumns+`
+		FROM api_keys
+		WHERE prefix = $1
+	`, prefix)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	return &key, nil
+}
+
+// ListUserAPIKeys returns a user's API keys, newest first
+func (r *PostgresRepository) ListUserAPIKeys(ctx context.Context, userID int) ([]*models.APIKey, error) {
+	var keys []*models.APIKey
+	err := pgxscan.Select(ctx, r.db, &keys, `
+		SELECT `+apiKeyColumns+`
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY id DESC
+	`, userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// DeleteAPIKey removes one of a user's API keys and reports whether it existed
+func (r *PostgresRepository) DeleteAPIKey(ctx context.Context, userID, id int) (bool, error) {
+	tag, err := r.db.Exec(ctx, `
+		DELETE FROM api_keys
+		WHERE id = $1 AND user_id = $2
+	`, id, userID)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to delete API key: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// DeleteUserAPIKeys removes all of a user's API keys
+func (r *PostgresRepository) DeleteUserAPIKeys(ctx context.Context, userID int) error {
+	_, err := r.db.Exec(ctx, `
+		DELETE FROM api_keys
+		WHERE user_id = $1
+	`, userID)
+
+	if err != nil {
+		return fmt.Errorf("failed to delete API keys: %w", err)
+	}
+
+	return nil
+}
+
+// TouchAPIKey records when and from where a key was last used
+func (r *PostgresRepository) TouchAPIKey(ctx context.Context, id int, ip string) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE api_keys
+		SET last_used_at = NOW(), last_used_ip = $2
+		WHERE id = $1
+	`, id, ip)
+
+	if err != nil {
+		return fmt.Errorf("failed to record API key use: %w", err)
+	}
+
+	return nil
+}
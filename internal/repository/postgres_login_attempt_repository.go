@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-backend-starter/internal/models"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetLoginAttempt retrieves the failed login counter for a scope and key
+func (r *PostgresRepository) GetLoginAttempt(ctx context.Context, scope, key string) (*models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	err := pgxscan.Get(ctx, r.db, &attempt, `
+		SELECT scope, key, failures, last_failure_at, locked_until
+		FROM login_attempts
+		WHERE scope = $1 AND key = $2
+	`, scope, key)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get login attempt: %w", err)
+	}
+
+	return &attempt, nil
+}
+
+// RecordLoginFailure counts a failed login and returns the updated counter.
+// Failures older than window no longer count.
+func (r *PostgresRepository) RecordLoginFailure(ctx context.Context, scope, key string, window time.Duration) (*models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	err := pgxscan.Get(ctx, r.db, &attempt, `
+		INSERT INTO login_attempts (scope, key, failures, last_failure_at)
+		VALUES ($1, $2, 1, NOW())
+		ON CONFLICT (scope, key) DO UPDATE
+		SET failures = CASE
+				WHEN login_attempts.last_failure_at < NOW() - make_interval(secs => $3) THEN 1
+				ELSE login_attempts.failures + 1
+			END,
+			last_failure_at = NOW()
+		RETURNING scope, key, failures, last_failure_at, locked_until
+	`, scope, key, window.Seconds())
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	return &attempt, nil
+}
+
+// LockLogin blocks logins for a scope and key until the given time
+func (r *PostgresRepository) LockLogin(ctx context.Context, scope, key string, until time.Time) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE login_attempts
+		SET locked_until = GREATEST(locked_until, $3)
+		WHERE scope = $1 AND key = $2
+	`, scope, key, until)
+
+	if err != nil {
+		return fmt.Errorf("failed to lock login: %w", err)
+	}
+
+	return nil
+}
+
+// ForgiveLoginFailure takes back one counted failure for a scope and key,
+// for an attempt that was counted before it turned out to succeed
+func (r *PostgresRepository) ForgiveLoginFailure(ctx context.Context, scope, key string) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE login_attempts
+		SET failures = GREATEST(failures - 1, 0)
+		WHERE scope = $1 AND key = $2
+	`, scope, key)
+
+	if err != nil {
+		return fmt.Errorf("failed to forgive login failure: %w", err)
+	}
+
+	return nil
+}
+
+// ClearLoginFailures resets the failed login counter for a scope and key,
+// lifting any lockout
+func (r *PostgresRepository) ClearLoginFailures(ctx context.Context, scope, key string) error {
+	_, err := r.db.Exec(ctx, `
+		DELETE FROM login_attempts
+		WHERE scope = $1 AND key = $2
+	`, scope, key)
+
+	if err != nil {
+		return fmt.Errorf("failed to clear login failures: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteStaleLoginAttempts removes counters with no failures within window
+// and no active lockout
+func (r *PostgresRepository) DeleteStaleLoginAttempts(ctx context.Context, window time.Duration) error {
+	_, err := r.db.Exec(ctx, `
+		DELETE FROM login_attempts
+		WHERE last_failure_at < NOW() - make_interval(secs => $1)
+		AND (locked_until IS NULL OR locked_until < NOW())
+	`, window.Seconds())
+
+	if err != nil {
+		return fmt.Errorf("failed to delete stale login attempts: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,223 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go-backend-starter/internal/models"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+)
+
+// CreateOrganization stores a new organization with its first member
+func (r *PostgresRepository) CreateOrganization(ctx context.Context, org *models.Organization, ownerID int, ownerRole string) (*models.Organization, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var created models.Organization
+	err = pgxscan.Get(ctx, tx, &created, `
+		INSERT INTO organizations (name, slug, created_at, updated_at)
+		VALUES ($1, $2, NOW(), NOW())
+		RETURNING id, name, slug, created_at, updated_at
+	`, org.Name, org.Slug)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create organization: %w", translateError(err))
+	}
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO organization_members (organization_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, NOW())
+	`, created.ID, ownerID, ownerRole); err != nil {
+		return nil, fmt.Errorf("failed to add organization owner: %w", translateError(err))
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit organization: %w", err)
+	}
+
+	return &created, nil
+}
+
+// GetOrganizationMember returns a user's membership in an organization, or
+// nil if they are not a member
+func (r *PostgresRepository) GetOrganizationMember(ctx context.Context, orgID, userID int) (*models.OrganizationMember, error) {
+	var member models.OrganizationMember
+	err := pgxscan.Get(ctx, r.db, &member, `
+		SELECT m.organization_id, m.user_id, m.role, m.created_account, u.role AS account_role, m.created_at
+		FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.organization_id = $1 AND m.user_id = $2
+	`, orgID, userID)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get organization member: %w", err)
+	}
+
+	return &member, nil
+}
+
+// ListUserOrganizations returns the organizations a user belongs to, in the
+// order they joined them
+func (r *PostgresRepository) ListUserOrganizations(ctx context.Context, userID int) ([]*models.Membership, error) {
+	var memberships []*models.Membership
+	err := pgxscan.Select(ctx, r.db, &memberships, `
+		SELECT o.id, o.name, o.slug, o.created_at, o.updated_at, m.role, m.created_at AS joined_at
+		FROM organization_members m
+		JOIN organizations o ON o.id = m.organization_id
+		WHERE m.user_id = $1
+		ORDER BY m.created_at, o.id
+	`, userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user organizations: %w", err)
+	}
+
+	return memberships, nil
+}
+
+// AddOrganizationMember adds a user to an organization
+func (r *PostgresRepository) AddOrganizationMember(ctx context.Context, orgID, userID int, role string) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO organization_members (organization_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, NOW())
+	`, orgID, userID, role)
+
+	if err != nil {
+		return fmt.Errorf("failed to add organization member: %w", translateError(err))
+	}
+
+	return nil
+}
+
+// RemoveOrganizationMember removes a user from an organization and reports
+// whether they were a member
+func (r *PostgresRepository) RemoveOrganizationMember(ctx context.Context, orgID, userID int) (bool, error) {
+	tag, err := r.db.Exec(ctx, `
+		DELETE FROM organization_members
+		WHERE organization_id = $1 AND user_id = $2
+	`, orgID, userID)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to remove organization member: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// CountUserOrganizations counts the organizations a user belongs to
+func (r *PostgresRepository) CountUserOrganizations(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := r.db.QueryRow(ctx, `
+		SELECT COUNT(*)
+		FROM organization_members
+		WHERE user_id = $1
+	`, userID).Scan(&count)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to count user organizations: %w", err)
+	}
+
+	return count, nil
+}
+
+// invitationColumns are the columns of organization_invitations i joined
+// with organizations o, in the order of models.Invitation
+const invitationColumns = `i.id, i.organization_id, o.name AS organization_name, i.user_id, i.role, i.invited_by, i.expires_at, i.created_at`
+
+// CreateInvitation stores an invitation. An earlier invitation of the user to
+// the organization is replaced.
+func (r *PostgresRepository) CreateInvitation(ctx context.Context, invitation *models.Invitation) (*models.Invitation, error) {
+	var id int
+	err := r.db.QueryRow(ctx, `
+		INSERT INTO organization_invitations (organization_id, user_id, role, invited_by, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (organization_id, user_id) DO UPDATE
+		SET role = EXCLUDED.role, invited_by = EXCLUDED.invited_by, expires_at = EXCLUDED.expires_at, created_at = EXCLUDED.created_at
+		RETURNING id
+	`, invitation.OrganizationID, invitation.UserID, invitation.Role, invitation.InvitedBy, invitation.ExpiresAt).Scan(&id)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create invitation: %w", translateError(err))
+	}
+
+	return r.GetInvitation(ctx, id)
+}
+
+// GetInvitation returns an invitation, expired or not, or nil if there is none
+func (r *PostgresRepository) GetInvitation(ctx context.Context, id int) (*models.Invitation, error) {
+	var invitation models.Invitation
+	err := pgxscan.Get(ctx, r.db, &invitation, `
+		SELECT `+invitationColumns+`
+		FROM organization_invitations i
+		JOIN organizations o ON o.id = i.organization_id
+		WHERE i.id = $1
+	`, id)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get invitation: %w", err)
+	}
+
+	return &invitation, nil
+}
+
+// ListOrganizationInvitations returns the unexpired invitations to an
+// organization, newest first
+func (r *PostgresRepository) ListOrganizationInvitations(ctx context.Context, orgID int) ([]*models.Invitation, error) {
+	var invitations []*models.Invitation
+	err := pgxscan.Select(ctx, r.db, &invitations, `
+		SELECT `+invitationColumns+`
+		FROM organization_invitations i
+		JOIN organizations o ON o.id = i.organization_id
+		WHERE i.organization_id = $1 AND i.expires_at > NOW()
+		ORDER BY i.id DESC
+	`, orgID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+
+	return invitations, nil
+}
+
+// ListUserInvitations returns the unexpired invitations of a user, newest first
+func (r *PostgresRepository) ListUserInvitations(ctx context.Context, userID int) ([]*models.Invitation, error) {
+	var invitations []*models.Invitation
+	err := pgxscan.Select(ctx, r.db, &invitations, `
+		SELECT `+invitationColumns+`
+		FROM organization_invitations i
+		JOIN organizations o ON o.id = i.organization_id
+		WHERE i.user_id = $1 AND i.expires_at > NOW()
+		ORDER BY i.id DESC
+	`, userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+
+	return invitations, nil
+}
+
+// DeleteInvitation removes an invitation and reports whether it existed
+func (r *PostgresRepository) DeleteInvitation(ctx context.Context, id int) (bool, error) {
+	tag, err := r.db.Exec(ctx, `
+		DELETE FROM organization_invitations
+		WHERE id = $1
+	`, id)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to delete invitation: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+)
+
+// AddPasswordHistory records a password hash a user no longer uses, keeping
+// only their newest keep entries
+func (r *PostgresRepository) AddPasswordHistory(ctx context.Context, userID int, passwordHash string, keep int) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO password_history (user_id, password_hash, created_at)
+		VALUES ($1, $2, NOW())
+	`, userID, passwordHash); err != nil {
+		return fmt.Errorf("failed to add password history: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM password_history
+		WHERE user_id = $1 AND id NOT IN (
+			SELECT id FROM password_history
+			WHERE user_id = $1
+			ORDER BY id DESC
+			LIMIT $2
+		)
+	`, userID, keep); err != nil {
+		return fmt.Errorf("failed to trim password history: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit password history: %w", err)
+	}
+
+	return nil
+}
+
+// GetPasswordHistory returns a user's newest previous password hashes
+func (r *PostgresRepository) GetPasswordHistory(ctx context.Context, userID int, limit int) ([]string, error) {
+	var hashes []string
+	err := pgxscan.Select(ctx, r.db, &hashes, `
+		SELECT password_hash
+		FROM password_history
+		WHERE user_id = $1
+		ORDER BY id DESC
+		LIMIT $2
+	`, userID, limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get password history: %w", err)
+	}
+
+	return hashes, nil
+}
@@ -4,34 +4,111 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand/v2"
 	"strings"
 	"time"
 
 	"go-backend-starter/internal/models"
-	"go-backend-starter/internal/utils"
+	"go-backend-starter/internal/tenant"
 
 	"github.com/georgysavva/scany/v2/pgxscan"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// userColumns lists the columns scanned into models.User
+const userColumns = "id, username, password_hash, email, role, email_verified_at, mfa_secret, mfa_enabled_at, mfa_last_step, created_at, updated_at, deleted_at"
+
+// usersFrom returns the source user queries select from. Inside an
+// organization it holds only the organization's members, with their role in
+// the organization in place of their global role.
+func usersFrom(ctx context.Context) string {
+	orgID, ok := tenant.OrganizationID(ctx)
+	if !ok {
+		return "users"
+	}
+	return fmt.Sprintf(`(
+			SELECT u.id, u.username, u.password_hash, u.email, m.role, u.email_verified_at, u.mfa_secret,
+				u.mfa_enabled_at, u.mfa_last_step, u.created_at, u.updated_at, u.deleted_at
+			FROM users u
+			JOIN organization_members m ON m.user_id = u.id AND m.organization_id = %d
+		) AS users`, orgID)
+}
+
+// memberCondition restricts writes to users to the members of the context's
+// organization. It is empty outside an organization.
+func memberCondition(ctx context.Context) string {
+	orgID, ok := tenant.OrganizationID(ctx)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf(" AND id IN (SELECT user_id FROM organization_members WHERE organization_id = %d)", orgID)
+}
+
+// dbtx is satisfied by both the pool and transactions, so every operation
+// runs the same inside and outside a unit of work. Begin inside a
+// transaction starts a savepoint.
+type dbtx interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
 // PostgresRepository implements Repository interface for PostgreSQL
 type PostgresRepository struct {
-	db *pgxpool.Pool
+	pool *pgxpool.Pool
+	db   dbtx // the pool, or the transaction of a unit of work
 }
 
 // NewPostgresRepository creates a new PostgreSQL repository
 func NewPostgresRepository(db *pgxpool.Pool) *PostgresRepository {
-	return &PostgresRepository{db: db}
+	return &PostgresRepository{pool: db, db: db}
+}
+
+// WithTx runs fn in a transaction with the given isolation level, passing it
+// a repository bound to the transaction. The transaction commits when fn
+// returns nil and rolls back otherwise. Serialization failures and deadlocks
+// roll back and run fn again, up to opts.MaxRetries times, so fn must not
+// have effects outside the repository it is given. Inside a unit of work fn
+// joins the enclosing transaction.
+func (r *PostgresRepository) WithTx(ctx context.Context, opts TxOptions, fn func(repo Repository) error) error {
+	if _, inTx := r.db.(pgx.Tx); inTx {
+		return fn(r)
+	}
+
+	isolation := opts.Isolation
+	if isolation == "" {
+		isolation = Serializable
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := pgx.BeginTxFunc(ctx, r.pool, pgx.TxOptions{IsoLevel: pgx.TxIsoLevel(isolation)}, func(tx pgx.Tx) error {
+			return fn(&PostgresRepository{pool: r.pool, db: tx})
+		})
+		if err == nil || !isRetryable(err) || attempt >= opts.MaxRetries {
+			return err
+		}
+
+		// Back off a little, with jitter so the conflicting transactions
+		// do not collide again
+		backoff := time.Duration(attempt+1)*10*time.Millisecond + rand.N(10*time.Millisecond)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
 }
 
 // GetUserByID retrieves a user by ID
 func (r *PostgresRepository) GetUserByID(ctx context.Context, id int) (*models.User, error) {
 	var user models.User
 	err := pgxscan.Get(ctx, r.db, &user, `
-		SELECT id, username, password_hash, email, role, created_at, updated_at
-		FROM users
-		WHERE id = $1
+		SELECT `+userColumns+`
+		FROM `+usersFrom(ctx)+`
+		WHERE id = $1 AND deleted_at IS NULL
 	`, id)
 
 	if err != nil {
@@ -48,9 +125,9 @@ func (r *PostgresRepository) GetUserByID(ctx context.Context, id int) (*models.U
 func (r *PostgresRepository) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
 	var user models.User
 	err := pgxscan.Get(ctx, r.db, &user, `
-		SELECT id, username, password_hash, email, role, created_at, updated_at
-		FROM users
-		WHERE username = $1
+		SELECT `+userColumns+`
+		FROM `+usersFrom(ctx)+`
+		WHERE username = $1 AND deleted_at IS NULL
 	`, username)
 
 	if err != nil {
@@ -67,9 +144,9 @@ func (r *PostgresRepository) GetUserByUsername(ctx context.Context, username str
 func (r *PostgresRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	var user models.User
 	err := pgxscan.Get(ctx, r.db, &user, `
-		SELECT id, username, password_hash, email, role, created_at, updated_at
-		FROM users
-		WHERE email = $1
+		SELECT `+userColumns+`
+		FROM `+usersFrom(ctx)+`
+		WHERE email = $1 AND deleted_at IS NULL
 	`, email)
 
 	if err != nil {
@@ -82,31 +159,90 @@ func (r *PostgresRepository) GetUserByEmail(ctx context.Context, email string) (
 	return &user, nil
 }
 
-// CreateUser creates a new user
+// lockUser fetches a user inside a transaction and locks its row until the
+// transaction ends. It returns nil when no user has the ID and matches the
+// condition.
+func lockUser(ctx context.Context, tx pgx.Tx, id int, condition string) (*models.User, error) {
+	var user models.User
+	err := pgxscan.Get(ctx, tx, &user, `
+		SELECT `+userColumns+`
+		FROM `+usersFrom(ctx)+`
+		WHERE id = $1`+condition+`
+		FOR UPDATE
+	`, id)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get user by ID: %w", err)
+	}
+
+	return &user, nil
+}
+
+// CreateUser creates a new user. Inside an organization the user becomes a
+// member with the given role and gets the user role globally.
 func (r *PostgresRepository) CreateUser(ctx context.Context, input *models.CreateUserInput) (*models.User, error) {
-	// Hash password
-	passwordHash, err := utils.HashPassword(input.Password)
+	now := time.Now()
+	var emailVerifiedAt *time.Time
+	if input.EmailVerified {
+		emailVerifiedAt = &now
+	}
+
+	orgID, scoped := tenant.OrganizationID(ctx)
+	role := input.Role
+	if scoped {
+		role = models.RoleUser
+	}
+
+	tx, err := r.db.Begin(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to hash password: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
 	// Create user
-	var user models.User
-	err = pgxscan.Get(ctx, r.db, &user, `
-		INSERT INTO users (username, password_hash, email, role, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, username, password_hash, email, role, created_at, updated_at
-	`, input.Username, passwordHash, input.Email, input.Role, time.Now(), time.Now())
+	var id int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO users (username, password_hash, email, role, email_verified_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, input.Username, input.PasswordHash, input.Email, role, emailVerifiedAt, now, now).Scan(&id)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to create user: %w", err)
+		return nil, fmt.Errorf("failed to create user: %w", translateError(err))
 	}
 
-	return &user, nil
+	if scoped {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO organization_members (organization_id, user_id, role, created_account, created_at)
+			VALUES ($1, $2, $3, TRUE, NOW())
+		`, orgID, id, input.Role); err != nil {
+			return nil, fmt.Errorf("failed to add organization member: %w", translateError(err))
+		}
+	}
+
+	user, err := lockUser(ctx, tx, id, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := recordUserEvent(ctx, tx, models.AuditUserCreate, nil, user); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit user: %w", err)
+	}
+
+	return user, nil
 }
 
-// UpdateUser updates an existing user
+// UpdateUser updates an existing user. Inside an organization a role change
+// applies to the user's membership rather than their global role.
 func (r *PostgresRepository) UpdateUser(ctx context.Context, id int, input *models.UpdateUserInput) (*models.User, error) {
+	orgID, scoped := tenant.OrganizationID(ctx)
+
 	// Build the set clause and arguments for the SQL query
 	setClauses := []string{}
 	args := []interface{}{}
@@ -124,27 +260,37 @@ func (r *PostgresRepository) UpdateUser(ctx context.Context, id int, input *mode
 		paramCounter++
 	}
 
-	if input.Password != "" {
-		passwordHash, err := utils.HashPassword(input.Password)
-		if err != nil {
-			return nil, fmt.Errorf("failed to hash password: %w", err)
-		}
+	if input.PasswordHash != "" {
 		setClauses = append(setClauses, fmt.Sprintf("password_hash = $%d", paramCounter))
-		args = append(args, passwordHash)
+		args = append(args, input.PasswordHash)
 		paramCounter++
 	}
 
-	if input.Role != "" {
+	if input.Role != "" && !scoped {
 		setClauses = append(setClauses, fmt.Sprintf("role = $%d", paramCounter))
 		args = append(args, input.Role)
 		paramCounter++
 	}
 
 	// If no fields to update, just return the current user
-	if len(setClauses) == 0 {
+	if len(setClauses) == 0 && (input.Role == "" || !scoped) {
 		return r.GetUserByID(ctx, id)
 	}
 
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := lockUser(ctx, tx, id, " AND deleted_at IS NULL")
+	if err != nil {
+		return nil, err
+	}
+	if before == nil {
+		return nil, nil
+	}
+
 	// Add updated_at field
 	setClauses = append(setClauses, fmt.Sprintf("updated_at = $%d", paramCounter))
 	args = append(args, time.Now())
@@ -157,44 +303,219 @@ func (r *PostgresRepository) UpdateUser(ctx context.Context, id int, input *mode
 	setClause := strings.Join(setClauses, ", ")
 
 	// Execute update query
-	var updatedUser models.User
-	err := pgxscan.Get(ctx, r.db, &updatedUser, fmt.Sprintf(`
+	_, err = tx.Exec(ctx, fmt.Sprintf(`
 		UPDATE users
 		SET %s
 		WHERE id = $%d
-		RETURNING id, username, password_hash, email, role, created_at, updated_at
 	`, setClause, paramCounter), args...)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to update user: %w", err)
+		return nil, fmt.Errorf("failed to update user: %w", translateError(err))
+	}
+
+	if input.Role != "" && scoped {
+		if _, err := tx.Exec(ctx, `
+			UPDATE organization_members
+			SET role = $3
+			WHERE organization_id = $1 AND user_id = $2
+		`, orgID, id, input.Role); err != nil {
+			return nil, fmt.Errorf("failed to update member role: %w", translateError(err))
+		}
 	}
 
-	return &updatedUser, nil
+	after, err := lockUser(ctx, tx, id, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := recordUserEvent(ctx, tx, models.AuditUserUpdate, before, after); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit user: %w", err)
+	}
+
+	return after, nil
 }
 
-// DeleteUser deletes a user
-func (r *PostgresRepository) DeleteUser(ctx context.Context, id int) error {
+// UpdateUserPasswordHash replaces a user's password hash without touching
+// updated_at, for upgrading hashes to the current algorithm
+func (r *PostgresRepository) UpdateUserPasswordHash(ctx context.Context, id int, passwordHash string) error {
 	_, err := r.db.Exec(ctx, `
-		DELETE FROM users
+		UPDATE users
+		SET password_hash = $2
 		WHERE id = $1
-	`, id)
+	`, id, passwordHash)
 
 	if err != nil {
-		return fmt.Errorf("failed to delete user: %w", err)
+		return fmt.Errorf("failed to update password hash: %w", err)
 	}
 
 	return nil
 }
 
-// ListUsers retrieves a list of users with pagination
-func (r *PostgresRepository) ListUsers(ctx context.Context, offset, limit int) ([]*models.User, error) {
+// DeleteUser soft deletes a user. It reports false when no active user has the ID.
+func (r *PostgresRepository) DeleteUser(ctx context.Context, id int) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := lockUser(ctx, tx, id, " AND deleted_at IS NULL")
+	if err != nil {
+		return false, err
+	}
+	if before == nil {
+		return false, nil
+	}
+
+	after := *before
+	err = tx.QueryRow(ctx, `
+		UPDATE users
+		SET deleted_at = NOW()
+		WHERE id = $1
+		RETURNING deleted_at
+	`, id).Scan(&after.DeletedAt)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	if err := recordUserEvent(ctx, tx, models.AuditUserDelete, before, &after); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit user deletion: %w", err)
+	}
+
+	return true, nil
+}
+
+// RestoreUser undoes a soft delete. It returns nil when no deleted user has the ID.
+func (r *PostgresRepository) RestoreUser(ctx context.Context, id int) (*models.User, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := lockUser(ctx, tx, id, " AND deleted_at IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	if before == nil {
+		return nil, nil
+	}
+
+	after := *before
+	after.DeletedAt = nil
+	err = tx.QueryRow(ctx, `
+		UPDATE users
+		SET deleted_at = NULL, updated_at = NOW()
+		WHERE id = $1
+		RETURNING updated_at
+	`, id).Scan(&after.UpdatedAt)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore user: %w", err)
+	}
+
+	if err := recordUserEvent(ctx, tx, models.AuditUserRestore, before, &after); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit user restore: %w", err)
+	}
+
+	return &after, nil
+}
+
+// PurgeUser permanently deletes a user, whether soft deleted or not. It
+// reports false when no user has the ID.
+func (r *PostgresRepository) PurgeUser(ctx context.Context, id int) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := lockUser(ctx, tx, id, "")
+	if err != nil {
+		return false, err
+	}
+	if before == nil {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM users
+		WHERE id = $1
+	`, id); err != nil {
+		return false, fmt.Errorf("failed to purge user: %w", err)
+	}
+
+	if err := recordUserEvent(ctx, tx, models.AuditUserPurge, before, nil); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit user purge: %w", err)
+	}
+
+	return true, nil
+}
+
+// userSortColumns maps sort fields to their columns
+var userSortColumns = map[string]string{
+	"id":         "id",
+	"username":   "username",
+	"email":      "email",
+	"created_at": "created_at",
+}
+
+// ListUsers retrieves a page of users using keyset pagination
+func (r *PostgresRepository) ListUsers(ctx context.Context, query *models.UserListQuery) ([]*models.User, error) {
+	column, ok := userSortColumns[query.SortField]
+	if !ok {
+		return nil, fmt.Errorf("unsupported sort field %q", query.SortField)
+	}
+
+	conditions, args := userFilterConditions(&query.UserFilter, "ILIKE")
+
+	direction, comparison := "ASC", ">"
+	if query.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	// Rows strictly after the key in sort order; id breaks ties
+	if query.After != nil {
+		if column == "id" {
+			conditions = append(conditions, fmt.Sprintf("id %s $%d", comparison, len(args)+1))
+			args = append(args, query.After.ID)
+		} else {
+			conditions = append(conditions, fmt.Sprintf("(%s, id) %s ($%d, $%d)", column, comparison, len(args)+1, len(args)+2))
+			args = append(args, query.After.Value, query.After.ID)
+		}
+	}
+
+	orderBy := fmt.Sprintf("%s %s", column, direction)
+	if column != "id" {
+		orderBy += fmt.Sprintf(", id %s", direction)
+	}
+
+	args = append(args, query.Limit)
+
 	var users []*models.User
-	err := pgxscan.Select(ctx, r.db, &users, `
-		SELECT id, username, password_hash, email, role, created_at, updated_at
-		FROM users
-		ORDER BY id
-		LIMIT $1 OFFSET $2
-	`, limit, offset)
+	err := pgxscan.Select(ctx, r.db, &users, fmt.Sprintf(`
+		SELECT %s
+		FROM %s
+		%s
+		ORDER BY %s
+		LIMIT $%d
+	`, userColumns, usersFrom(ctx), whereClause(conditions), orderBy, len(args)), args...)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to list users: %w", err)
@@ -202,3 +523,81 @@ func (r *PostgresRepository) ListUsers(ctx context.Context, offset, limit int) (
 
 	return users, nil
 }
+
+// CountUsers counts the users matching a filter
+func (r *PostgresRepository) CountUsers(ctx context.Context, filter *models.UserFilter) (int, error) {
+	conditions, args := userFilterConditions(filter, "ILIKE")
+
+	var count int
+	err := r.db.QueryRow(ctx, fmt.Sprintf(`
+		SELECT COUNT(*)
+		FROM %s
+		%s
+	`, usersFrom(ctx), whereClause(conditions)), args...).Scan(&count)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	return count, nil
+}
+
+// MarkEmailVerified records that a user has verified their email address
+func (r *PostgresRepository) MarkEmailVerified(ctx context.Context, userID int) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE users
+		SET email_verified_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND email_verified_at IS NULL
+	`, userID)
+
+	if err != nil {
+		return fmt.Errorf("failed to mark email verified: %w", err)
+	}
+
+	return nil
+}
+
+// userFilterConditions builds the WHERE conditions and arguments for a user
+// filter. like is the case-insensitive LIKE operator of the database.
+func userFilterConditions(filter *models.UserFilter, like string) ([]string, []interface{}) {
+	conditions := []string{"deleted_at IS NULL"}
+	args := []interface{}{}
+
+	if filter.Deleted {
+		conditions[0] = "deleted_at IS NOT NULL"
+	}
+
+	if filter.Role != "" {
+		args = append(args, filter.Role)
+		conditions = append(conditions, fmt.Sprintf("role = $%d", len(args)))
+	}
+
+	if filter.CreatedAfter != nil {
+		args = append(args, *filter.CreatedAfter)
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+
+	if filter.CreatedBefore != nil {
+		args = append(args, *filter.CreatedBefore)
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+
+	if filter.Search != "" {
+		args = append(args, "%"+escapeLike(filter.Search)+"%")
+		conditions = append(conditions, fmt.Sprintf(`(username %[1]s $%[2]d ESCAPE '\' OR email %[1]s $%[2]d ESCAPE '\')`, like, len(args)))
+	}
+
+	return conditions, args
+}
+
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(conditions, " AND ")
+}
+
+// escapeLike escapes the LIKE wildcards in a user supplied search term
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go-backend-starter/internal/models"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+)
+
+// roleSelect reads roles together with their sorted permission names
+const roleSelect = `
+	SELECT r.name, r.description, r.builtin, r.created_at, r.updated_at,
+		COALESCE(array_agg(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}') AS permissions
+	FROM roles r
+	LEFT JOIN role_permissions rp ON rp.role_name = r.name
+`
+
+// ListRoles returns every role with its permissions
+func (r *PostgresRepository) ListRoles(ctx context.Context) ([]*models.Role, error) {
+	var roles []*models.Role
+	err := pgxscan.Select(ctx, r.db, &roles, roleSelect+`
+		GROUP BY r.name
+		ORDER BY r.name
+	`)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+
+	return roles, nil
+}
+
+// GetRole returns a role with its permissions, or nil if there is none
+func (r *PostgresRepository) GetRole(ctx context.Context, name string) (*models.Role, error) {
+	return getRole(ctx, r.db, name)
+}
+
+func getRole(ctx context.Context, db pgxscan.Querier, name string) (*models.Role, error) {
+	var role models.Role
+	err := pgxscan.Get(ctx, db, &role, roleSelect+`
+		WHERE r.name = $1
+		GROUP BY r.name
+	`, name)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get role: %w", err)
+	}
+
+	return &role, nil
+}
+
+// CreateRole stores a new custom role and its permissions
+func (r *PostgresRepository) CreateRole(ctx context.Context, role *models.Role) (*models.Role, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO roles (name, description, builtin, created_at, updated_at)
+		VALUES ($1, $2, FALSE, NOW(), NOW())
+	`, role.Name, role.Description); err != nil {
+		return nil, fmt.Errorf("failed to create role: %w", translateError(err))
+	}
+
+	if err := setRolePermissions(ctx, tx, role.Name, role.Permissions); err != nil {
+		return nil, err
+	}
+
+	created, err := getRole(ctx, tx, role.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit role: %w", err)
+	}
+
+	return created, nil
+}
+
+// UpdateRole replaces a role's description and permissions. It returns nil
+// when the role does not exist.
+func (r *PostgresRepository) UpdateRole(ctx context.Context, name string, input *models.UpdateRoleInput) (*models.Role, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE roles
+		SET description = $2, updated_at = NOW()
+		WHERE name = $1
+	`, name, input.Description)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update role: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, nil
+	}
+
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM role_permissions
+		WHERE role_name = $1
+	`, name); err != nil {
+		return nil, fmt.Errorf("failed to clear role permissions: %w", err)
+	}
+
+	if err := setRolePermissions(ctx, tx, name, input.Permissions); err != nil {
+		return nil, err
+	}
+
+	updated, err := getRole(ctx, tx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit role: %w", err)
+	}
+
+	return updated, nil
+}
+
+func setRolePermissions(ctx context.Context, tx pgx.Tx, role string, permissions []string) error {
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO role_permissions (role_name, permission)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT DO NOTHING
+	`, role, permissions); err != nil {
+		return fmt.Errorf("failed to set role permissions: %w", translateError(err))
+	}
+	return nil
+}
+
+// DeleteRole removes a custom role. Built-in roles are never deleted, and a
+// role that is still assigned to users fails with a ReferenceError.
+func (r *PostgresRepository) DeleteRole(ctx context.Context, name string) (bool, error) {
+	tag, err := r.db.Exec(ctx, `
+		DELETE FROM roles
+		WHERE name = $1 AND NOT builtin
+	`, name)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to delete role: %w", translateError(err))
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// ListPermissions returns every permission
+func (r *PostgresRepository) ListPermissions(ctx context.Context) ([]*models.Permission, error) {
+	var permissions []*models.Permission
+	err := pgxscan.Select(ctx, r.db, &permissions, `
+		SELECT name, description
+		FROM permissions
+		ORDER BY name
+	`)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list permissions: %w", err)
+	}
+
+	return permissions, nil
+}
+
+// GetRolePermissions returns the permission names a role grants
+func (r *PostgresRepository) GetRolePermissions(ctx context.Context, role string) ([]string, error) {
+	var permissions []string
+	err := pgxscan.Select(ctx, r.db, &permissions, `
+		SELECT permission
+		FROM role_permissions
+		WHERE role_name = $1
+	`, role)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role permissions: %w", err)
+	}
+
+	return permissions, nil
+}
@@ -0,0 +1,282 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-backend-starter/internal/models"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+)
+
+// CreateRefreshToken stores a new hashed refresh token
+func (r *PostgresRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) (*models.RefreshToken, error) {
+	var created models.RefreshToken
+	err := pgxscan.Get(ctx, r.db, &created, `
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at, mfa, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		RETURNING id, user_id, family_id, token_hash, expires_at, mfa, created_at, rotated_at, revoked_at
+	`, token.UserID, token.FamilyID, token.TokenHash, token.ExpiresAt, token.MFA)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	return &created, nil
+}
+
+// GetRefreshTokenByHash retrieves a refresh token by its hash
+func (r *PostgresRepository) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := pgxscan.Get(ctx, r.db, &token, `
+		SELECT id, user_id, family_id, token_hash, expires_at, mfa, created_at, rotated_at, revoked_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+	`, tokenHash)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	return &token, nil
+}
+
+// MarkRefreshTokenRotated marks a refresh token as used. It reports false when
+// the token had already been rotated or revoked, so concurrent exchanges of the
+// same token cannot both succeed.
+func (r *PostgresRepository) MarkRefreshTokenRotated(ctx context.Context, id int) (bool, error) {
+	tag, err := r.db.Exec(ctx, `
+		UPDATE refresh_tokens
+		SET rotated_at = NOW()
+		WHERE id = $1 AND rotated_at IS NULL AND revoked_at IS NULL
+	`, id)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// RevokeRefreshTokenFamily revokes every refresh token descended from the same login
+func (r *PostgresRepository) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE refresh_tokens
+		SET revoked_at = NOW()
+		WHERE family_id = $1 AND revoked_at IS NULL
+	`, familyID)
+
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes every outstanding refresh token of a user
+func (r *PostgresRepository) RevokeUserRefreshTokens(ctx context.Context, userID int) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE refresh_tokens
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`, userID)
+
+	if err != nil {
+		return fmt.Errorf("failed to revoke user refresh tokens: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeToken adds an access token to the revocation list
+func (r *PostgresRepository) RevokeToken(ctx context.Context, jti string, userID int, expiresAt time.Time) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO revoked_tokens (jti, user_id, expires_at, revoked_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (jti) DO NOTHING
+	`, jti, userID, expiresAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	return nil
+}
+
+// IsTokenRevoked reports whether an access token is on the revocation list
+func (r *PostgresRepository) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	err := r.db.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)
+	`, jti).Scan(&revoked)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+
+	return revoked, nil
+}
+
+// DeleteExpiredRevokedTokens removes revocation entries for tokens that have expired
+func (r *PostgresRepository) DeleteExpiredRevokedTokens(ctx context.Context) error {
+	_, err := r.db.Exec(ctx, `
+		DELETE FROM revoked_tokens
+		WHERE expires_at < NOW()
+	`)
+
+	if err != nil {
+		return fmt.Errorf("failed to delete expired revoked tokens: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeUserTokens rejects every access token of a user issued before the given time
+func (r *PostgresRepository) RevokeUserTokens(ctx context.Context, userID int, before time.Time) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO user_token_revocations (user_id, revoked_before)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET revoked_before = GREATEST(user_token_revocations.revoked_before, EXCLUDED.revoked_before)
+	`, userID, before)
+
+	if err != nil {
+		return fmt.Errorf("failed to revoke user tokens: %w", err)
+	}
+
+	return nil
+}
+
+// GetUserTokensRevokedBefore returns the cut-off time for a user's access tokens, or nil if none is set
+func (r *PostgresRepository) GetUserTokensRevokedBefore(ctx context.Context, userID int) (*time.Time, error) {
+	var before time.Time
+	err := r.db.QueryRow(ctx, `
+		SELECT revoked_before
+		FROM user_token_revocations
+		WHERE user_id = $1
+	`, userID).Scan(&before)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get user token revocation: %w", err)
+	}
+
+	return &before, nil
+}
+
+// CreateEmailVerificationToken stores a new hashed email verification token
+func (r *PostgresRepository) CreateEmailVerificationToken(ctx context.Context, token *models.EmailVerificationToken) (*models.EmailVerificationToken, error) {
+	var created models.EmailVerificationToken
+	err := pgxscan.Get(ctx, r.db, &created, `
+		INSERT INTO email_verification_tokens (user_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, NOW())
+		RETURNING id, user_id, token_hash, expires_at, created_at, used_at
+	`, token.UserID, token.TokenHash, token.ExpiresAt)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create email verification token: %w", err)
+	}
+
+	return &created, nil
+}
+
+// ConsumeEmailVerificationToken marks an unused, unexpired token as used and
+// returns it. It returns nil when no such token exists, so a token can only be
+// redeemed once even under concurrent requests.
+func (r *PostgresRepository) ConsumeEmailVerificationToken(ctx context.Context, tokenHash string) (*models.EmailVerificationToken, error) {
+	var token models.EmailVerificationToken
+	err := pgxscan.Get(ctx, r.db, &token, `
+		UPDATE email_verification_tokens
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING id, user_id, token_hash, expires_at, created_at, used_at
+	`, tokenHash)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to consume email verification token: %w", err)
+	}
+
+	return &token, nil
+}
+
+// CreatePasswordResetToken stores a new hashed password reset token
+func (r *PostgresRepository) CreatePasswordResetToken(ctx context.Context, token *models.PasswordResetToken) (*models.PasswordResetToken, error) {
+	var created models.PasswordResetToken
+	err := pgxscan.Get(ctx, r.db, &created, `
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, NOW())
+		RETURNING id, user_id, token_hash, expires_at, created_at, used_at
+	`, token.UserID, token.TokenHash, token.ExpiresAt)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create password reset token: %w", err)
+	}
+
+	return &created, nil
+}
+
+// GetPasswordResetToken returns an unused, unexpired token without using it
+// up. It returns nil when no such token exists.
+func (r *PostgresRepository) GetPasswordResetToken(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error) {
+	var token models.PasswordResetToken
+	err := pgxscan.Get(ctx, r.db, &token, `
+		SELECT id, user_id, token_hash, expires_at, created_at, used_at
+		FROM password_reset_tokens
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+	`, tokenHash)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get password reset token: %w", err)
+	}
+
+	return &token, nil
+}
+
+// ConsumePasswordResetToken marks an unused, unexpired token as used and
+// returns it. It returns nil when no such token exists.
+func (r *PostgresRepository) ConsumePasswordResetToken(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error) {
+	var token models.PasswordResetToken
+	err := pgxscan.Get(ctx, r.db, &token, `
+		UPDATE password_reset_tokens
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING id, user_id, token_hash, expires_at, created_at, used_at
+	`, tokenHash)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to consume password reset token: %w", err)
+	}
+
+	return &token, nil
+}
+
+// DeleteUserPasswordResetTokens removes every password reset token of a user
+func (r *PostgresRepository) DeleteUserPasswordResetTokens(ctx context.Context, userID int) error {
+	_, err := r.db.Exec(ctx, `
+		DELETE FROM password_reset_tokens
+		WHERE user_id = $1
+	`, userID)
+
+	if err != nil {
+		return fmt.Errorf("failed to delete password reset tokens: %w", err)
+	}
+
+	return nil
+}
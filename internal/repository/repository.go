@@ -2,18 +2,139 @@ package repository
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"go-backend-starter/internal/models"
 )
 
-// Repository defines all data access operations
+// IsolationLevel is the isolation level of a unit of work
+type IsolationLevel string
+
+// Supported isolation levels
+const (
+	ReadCommitted  IsolationLevel = "read committed"
+	RepeatableRead IsolationLevel = "repeatable read"
+	Serializable   IsolationLevel = "serializable"
+)
+
+// ParseIsolationLevel checks an isolation level from the configuration. An
+// empty level is serializable.
+func ParseIsolationLevel(level string) (IsolationLevel, error) {
+	switch IsolationLevel(level) {
+	case "":
+		return Serializable, nil
+	case ReadCommitted, RepeatableRead, Serializable:
+		return IsolationLevel(level), nil
+	}
+	return "", fmt.Errorf("unknown isolation level %q", level)
+}
+
+// TxOptions configures a unit of work
+type TxOptions struct {
+	Isolation  IsolationLevel // serializable when empty
+	MaxRetries int            // reruns after serialization failures and deadlocks
+}
+
+// Repository defines all data access operations. User operations are scoped
+// to the organization of the context (see package tenant) when there is one.
 type Repository interface {
-	// User operations
+	// Unit of work. Every operation is available on the repository passed
+	// to fn and runs in its transaction.
+	WithTx(ctx context.Context, opts TxOptions, fn func(repo Repository) error) error
+
+	// User operations. Creating, updating, deleting, restoring and purging a
+	// user records an audit event in the same transaction.
 	GetUserByID(ctx context.Context, id int) (*models.User, error)
 	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
 	CreateUser(ctx context.Context, input *models.CreateUserInput) (*models.User, error)
 	UpdateUser(ctx context.Context, id int, input *models.UpdateUserInput) (*models.User, error)
-	DeleteUser(ctx context.Context, id int) error
-	ListUsers(ctx context.Context, offset, limit int) ([]*models.User, error)
+	UpdateUserPasswordHash(ctx context.Context, id int, passwordHash string) error
+	AddPasswordHistory(ctx context.Context, userID int, passwordHash string, keep int) error
+	GetPasswordHistory(ctx context.Context, userID int, limit int) ([]string, error)
+	DeleteUser(ctx context.Context, id int) (bool, error)
+	RestoreUser(ctx context.Context, id int) (*models.User, error)
+	PurgeUser(ctx context.Context, id int) (bool, error)
+	ListUsers(ctx context.Context, query *models.UserListQuery) ([]*models.User, error)
+	CountUsers(ctx context.Context, filter *models.UserFilter) (int, error)
+	MarkEmailVerified(ctx context.Context, userID int) error
+
+	// Audit operations
+	CreateAuditEvent(ctx context.Context, event *models.AuditEvent) error
+	ListAuditEvents(ctx context.Context, query *models.AuditEventQuery) ([]*models.AuditEvent, error)
+
+	// Organization operations
+	CreateOrganization(ctx context.Context, org *models.Organization, ownerID int, ownerRole string) (*models.Organization, error)
+	GetOrganizationMember(ctx context.Context, orgID, userID int) (*models.OrganizationMember, error)
+	ListUserOrganizations(ctx context.Context, userID int) ([]*models.Membership, error)
+	AddOrganizationMember(ctx context.Context, orgID, userID int, role string) error
+	RemoveOrganizationMember(ctx context.Context, orgID, userID int) (bool, error)
+	CountUserOrganizations(ctx context.Context, userID int) (int, error)
+	CreateInvitation(ctx context.Context, invitation *models.Invitation) (*models.Invitation, error)
+	GetInvitation(ctx context.Context, id int) (*models.Invitation, error)
+	ListOrganizationInvitations(ctx context.Context, orgID int) ([]*models.Invitation, error)
+	ListUserInvitations(ctx context.Context, userID int) ([]*models.Invitation, error)
+	DeleteInvitation(ctx context.Context, id int) (bool, error)
+
+	// Role and permission operations
+	ListRoles(ctx context.Context) ([]*models.Role, error)
+	GetRole(ctx context.Context, name string) (*models.Role, error)
+	CreateRole(ctx context.Context, role *models.Role) (*models.Role, error)
+	UpdateRole(ctx context.Context, name string, input *models.UpdateRoleInput) (*models.Role, error)
+	DeleteRole(ctx context.Context, name string) (bool, error)
+	ListPermissions(ctx context.Context) ([]*models.Permission, error)
+	GetRolePermissions(ctx context.Context, role string) ([]string, error)
+
+	// Email verification token operations
+	CreateEmailVerificationToken(ctx context.Context, token *models.EmailVerificationToken) (*models.EmailVerificationToken, error)
+	ConsumeEmailVerificationToken(ctx context.Context, tokenHash string) (*models.EmailVerificationToken, error)
+
+	// Password reset token operations
+	CreatePasswordResetToken(ctx context.Context, token *models.PasswordResetToken) (*models.PasswordResetToken, error)
+	GetPasswordResetToken(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error)
+	ConsumePasswordResetToken(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error)
+	DeleteUserPasswordResetTokens(ctx context.Context, userID int) error
+
+	// MFA operations
+	SetUserMFASecret(ctx context.Context, userID int, secret string) (bool, error)
+	EnableUserMFA(ctx context.Context, userID int, step int64) (bool, error)
+	UseMFAStep(ctx context.Context, userID int, step int64) (bool, error)
+	ResetUserMFA(ctx context.Context, userID int) (bool, error)
+	ReplaceMFARecoveryCodes(ctx context.Context, userID int, codeHashes []string) error
+	ConsumeMFARecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error)
+	CreateMFAChallenge(ctx context.Context, challenge *models.MFAChallenge) (*models.MFAChallenge, error)
+	GetMFAChallengeByHash(ctx context.Context, tokenHash string) (*models.MFAChallenge, error)
+	RecordMFAChallengeAttempt(ctx context.Context, id int) (int, error)
+	ConsumeMFAChallenge(ctx context.Context, id int) (bool, error)
+
+	// API key operations
+	CreateAPIKey(ctx context.Context, key *models.APIKey) (*models.APIKey, error)
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error)
+	ListUserAPIKeys(ctx context.Context, userID int) ([]*models.APIKey, error)
+	DeleteAPIKey(ctx context.Context, userID, id int) (bool, error)
+	DeleteUserAPIKeys(ctx context.Context, userID int) error
+	TouchAPIKey(ctx context.Context, id int, ip string) error
+
+	// Login throttling operations
+	GetLoginAttempt(ctx context.Context, scope, key string) (*models.LoginAttempt, error)
+	RecordLoginFailure(ctx context.Context, scope, key string, window time.Duration) (*models.LoginAttempt, error)
+	LockLogin(ctx context.Context, scope, key string, until time.Time) error
+	ForgiveLoginFailure(ctx context.Context, scope, key string) error
+	ClearLoginFailures(ctx context.Context, scope, key string) error
+	DeleteStaleLoginAttempts(ctx context.Context, window time.Duration) error
+
+	// Refresh token operations
+	CreateRefreshToken(ctx context.Context, token *models.RefreshToken) (*models.RefreshToken, error)
+	GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	MarkRefreshTokenRotated(ctx context.Context, id int) (bool, error)
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
+	RevokeUserRefreshTokens(ctx context.Context, userID int) error
+
+	// Access token revocation operations
+	RevokeToken(ctx context.Context, jti string, userID int, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	DeleteExpiredRevokedTokens(ctx context.Context) error
+	RevokeUserTokens(ctx context.Context, userID int, before time.Time) error
+	GetUserTokensRevokedBefore(ctx context.Context, userID int) (*time.Time, error)
 }
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-backend-starter/internal/models"
+)
+
+// CreateAPIKey stores a new hashed API key
+func (r *SQLiteRepository) CreateAPIKey(ctx context.Context, key *models.APIKey) (*models.APIKey, error) {
+	created, err := scanSQLiteAPIKey(r.q.QueryRowContext(ctx, `
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, mfa, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING `+apiKeyColumns,
+		key.UserID, key.Name, key.Prefix, key.KeyHash, jsonValue{key.Scopes}, key.MFA, key.ExpiresAt, time.Now()))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return created, nil
+}
+
+// GetAPIKeyByPrefix returns the key with the given prefix, or nil if there is none
+func (r *SQLiteRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	key, err := scanSQLiteAPIKey(r.q.QueryRowContext(ctx, `
+		SELECT `+apiKeyColumns+`
+		FROM api_keys
+		WHERE prefix = $1
+	`, prefix))
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	return key, nil
+}
+
+// ListUserAPIKeys returns a user's API keys, newest first
+func (r *SQLiteRepository) ListUserAPIKeys(ctx context.Context, userID int) ([]*models.APIKey, error) {
+	rows, err := r.q.QueryContext(ctx, `
+		SELECT `+apiKeyColumns+`
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY id DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []*models.APIKey
+	for rows.Next() {
+		key, err := scanSQLiteAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list API keys: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// DeleteAPIKey removes one of a user's API keys and reports whether it existed
+func (r *SQLiteRepository) DeleteAPIKey(ctx context.Context, userID, id int) (bool, error) {
+	result, err := r.q.ExecContext(ctx, `
+		DELETE FROM api_keys
+		WHERE id = $1 AND user_id = $2
+	`, id, userID)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to delete API key: %w", err)
+	}
+
+	return rowsAffected(result) > 0, nil
+}
+
+// DeleteUserAPIKeys removes all of a user's API keys
+func (r *SQLiteRepository) DeleteUserAPIKeys(ctx context.Context, userID int) error {
+	_, err := r.q.ExecContext(ctx, `
+		DELETE FROM api_keys
+		WHERE user_id = $1
+	`, userID)
+
+	if err != nil {
+		return fmt.Errorf("failed to delete API keys: %w", err)
+	}
+
+	return nil
+}
+
+// TouchAPIKey records when and from where a key was last used
+func (r *SQLiteRepository) TouchAPIKey(ctx context.Context, id int, ip string) error {
+	_, err := r.q.ExecContext(ctx, `
+		UPDATE api_keys
+		SET last_used_at = $3, last_used_ip = $2
+		WHERE id = $1
+	`, id, ip, time.Now())
+
+	if err != nil {
+		return fmt.Errorf("failed to record API key use: %w", err)
+	}
+
+	return nil
+}
+
+// scanSQLiteAPIKey reads a row of apiKeyColumns, decoding the JSON scopes
+func scanSQLiteAPIKey(row interface{ Scan(dest ...any) error }) (*models.APIKey, error) {
+	var key models.APIKey
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, jsonValue{&key.Scopes},
+		&key.MFA, &key.ExpiresAt, &key.LastUsedAt, &key.LastUsedIP, &key.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/tenant"
+)
+
+// CreateAuditEvent records an event that does not go with a change, such as
+// the start of an impersonation. The actor, IP and request ID come from the
+// context.
+func (r *SQLiteRepository) CreateAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	return insertSQLiteAuditEvent(ctx, r.q, event)
+}
+
+// ListAuditEvents retrieves a page of audit events, newest first. Inside an
+// organization only its events are listed.
+func (r *SQLiteRepository) ListAuditEvents(ctx context.Context, query *models.AuditEventQuery) ([]*models.AuditEvent, error) {
+	conditions := []string{}
+	args := []interface{}{}
+
+	if orgID, ok := tenant.OrganizationID(ctx); ok {
+		args = append(args, orgID)
+		conditions = append(conditions, fmt.Sprintf("organization_id = $%d", len(args)))
+	}
+
+	if query.ActorID != 0 {
+		args = append(args, query.ActorID)
+		conditions = append(conditions, fmt.Sprintf("actor_id = $%d", len(args)))
+	}
+
+	if query.Action != "" {
+		args = append(args, query.Action)
+		conditions = append(conditions, fmt.Sprintf("action = $%d", len(args)))
+	}
+
+	if query.TargetType != "" {
+		args = append(args, query.TargetType)
+		conditions = append(conditions, fmt.Sprintf("target_type = $%d", len(args)))
+	}
+
+	if query.TargetID != 0 {
+		args = append(args, query.TargetID)
+		conditions = append(conditions, fmt.Sprintf("target_id = $%d", len(args)))
+	}
+
+	if query.CreatedAfter != nil {
+		args = append(args, *query.CreatedAfter)
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+
+	if query.CreatedBefore != nil {
+		args = append(args, *query.CreatedBefore)
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+
+	if query.BeforeID != 0 {
+		args = append(args, query.BeforeID)
+		conditions = append(conditions, fmt.Sprintf("id < $%d", len(args)))
+	}
+
+	args = append(args, query.Limit)
+
+	rows, err := r.q.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s
+		FROM audit_events
+		%s
+		ORDER BY id DESC
+		LIMIT $%d
+	`, auditEventColumns, whereClause(conditions), len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*models.AuditEvent
+	for rows.Next() {
+		event, err := scanSQLiteAuditEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list audit events: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+
+	return events, nil
+}
+
+// scanSQLiteAuditEvent reads a row of auditEventColumns, decoding the JSON
+// before and after snapshots
+func scanSQLiteAuditEvent(rows *sql.Rows) (*models.AuditEvent, error) {
+	var event models.AuditEvent
+	err := rows.Scan(&event.ID, &event.ActorID, &event.ActorUsername, &event.ImpersonatorID, &event.OrganizationID,
+		&event.Action, &event.TargetType, &event.TargetID, jsonValue{&event.Before}, jsonValue{&event.After},
+		&event.IP, &event.RequestID, &event.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// recordSQLiteUserEvent records a change to a user in the transaction making it
+func recordSQLiteUserEvent(ctx context.Context, q sqliteConn, action string, before, after *models.User) error {
+	return insertSQLiteAuditEvent(ctx, q, userEvent(ctx, action, before, after))
+}
+
+// insertSQLiteAuditEvent stores an event, taking its source from the context
+func insertSQLiteAuditEvent(ctx context.Context, q sqliteConn, event *models.AuditEvent) error {
+	withSource(ctx, event)
+
+	_, err := q.ExecContext(ctx, `
+		INSERT INTO audit_events (actor_id, actor_username, impersonator_id, organization_id, action,
+			target_type, target_id, before, after, ip, request_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`, event.ActorID, event.ActorUsername, event.ImpersonatorID, event.OrganizationID, event.Action,
+		event.TargetType, event.TargetID, jsonValue{event.Before}, jsonValue{event.After}, event.IP, event.RequestID,
+		time.Now())
+
+	if err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-backend-starter/internal/models"
+
+	"github.com/georgysavva/scany/v2/sqlscan"
+)
+
+// GetLoginAttempt retrieves the failed login counter for a scope and key
+func (r *SQLiteRepository) GetLoginAttempt(ctx context.Context, scope, key string) (*models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	err := sqlscan.Get(ctx, r.q, &attempt, `
+		SELECT scope, key, failures, last_failure_at, locked_until
+		FROM login_attempts
+		WHERE scope = $1 AND key = $2
+	`, scope, key)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get login attempt: %w", err)
+	}
+
+	return &attempt, nil
+}
+
+// RecordLoginFailure counts a failed login and returns the updated counter.
+// Failures older than window no longer count.
+func (r *SQLiteRepository) RecordLoginFailure(ctx context.Context, scope, key string, window time.Duration) (*models.LoginAttempt, error) {
+	now := time.Now()
+
+	var attempt models.LoginAttempt
+	err := sqlscan.Get(ctx, r.q, &attempt, `
+		INSERT INTO login_attempts (scope, key, failures, last_failure_at)
+		VALUES ($1, $2, 1, $3)
+		ON CONFLICT (scope, key) DO UPDATE
+		SET failures = CASE
+				WHEN login_attempts.last_failure_at < $4 THEN 1
+				ELSE login_attempts.failures + 1
+			END,
+			last_failure_at = $3
+		RETURNING scope, key, failures, last_failure_at, locked_until
+	`, scope, key, now, now.Add(-window))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	return &attempt, nil
+}
+
+// LockLogin blocks logins for a scope and key until the given time
+func (r *SQLiteRepository) LockLogin(ctx context.Context, scope, key string, until time.Time) error {
+	_, err := r.q.ExecContext(ctx, `
+		UPDATE login_attempts
+		SET locked_until = CASE WHEN locked_until IS NULL OR locked_until < $3 THEN $3 ELSE locked_until END
+		WHERE scope = $1 AND key = $2
+	`, scope, key, until)
+
+	if err != nil {
+		return fmt.Errorf("failed to lock login: %w", err)
+	}
+
+	return nil
+}
+
+// ForgiveLoginFailure takes back one counted failure for a scope and key,
+// for an attempt that was counted before it turned out to succeed
+func (r *SQLiteRepository) ForgiveLoginFailure(ctx context.Context, scope, key string) error {
+	_, err := r.q.ExecContext(ctx, `
+		UPDATE login_attempts
+		SET failures = MAX(failures - 1, 0)
+		WHERE scope = $1 AND key = $2
+	`, scope, key)
+
+	if err != nil {
+		return fmt.Errorf("failed to forgive login failure: %w", err)
+	}
+
+	return nil
+}
+
+// ClearLoginFailures resets the failed login counter for a scope and key,
+// lifting any lockout
+func (r *SQLiteRepository) ClearLoginFailures(ctx context.Context, scope, key string) error {
+	_, err := r.q.ExecContext(ctx, `
+		DELETE FROM login_attempts
+		WHERE scope = $1 AND key = $2
+	`, scope, key)
+
+	if err != nil {
+		return fmt.Errorf("failed to clear login failures: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteStaleLoginAttempts removes counters with no failures within window
+// and no active lockout
+func (r *SQLiteRepository) DeleteStaleLoginAttempts(ctx context.Context, window time.Duration) error {
+	now := time.Now()
+
+	_, err := r.q.ExecContext(ctx, `
+		DELETE FROM login_attempts
+		WHERE last_failure_at < $1
+		AND (locked_until IS NULL OR locked_until < $2)
+	`, now.Add(-window), now)
+
+	if err != nil {
+		return fmt.Errorf("failed to delete stale login attempts: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-backend-starter/internal/models"
+
+	"github.com/georgysavva/scany/v2/sqlscan"
+)
+
+// SetUserMFASecret starts a TOTP enrollment, replacing any unconfirmed
+// secret. It reports false when the user does not exist or already has MFA
+// enabled.
+func (r *SQLiteRepository) SetUserMFASecret(ctx context.Context, userID int, secret string) (bool, error) {
+	result, err := r.q.ExecContext(ctx, `
+		UPDATE users
+		SET mfa_secret = $2, mfa_last_step = NULL, updated_at = $3
+		WHERE id = $1 AND deleted_at IS NULL AND mfa_enabled_at IS NULL
+	`, userID, secret, time.Now())
+
+	if err != nil {
+		return false, fmt.Errorf("failed to set mfa secret: %w", err)
+	}
+
+	return rowsAffected(result) == 1, nil
+}
+
+// EnableUserMFA confirms a pending enrollment, recording step as the last
+// used TOTP time step. It reports false when there is no pending enrollment.
+func (r *SQLiteRepository) EnableUserMFA(ctx context.Context, userID int, step int64) (bool, error) {
+	result, err := r.q.ExecContext(ctx, `
+		UPDATE users
+		SET mfa_enabled_at = $3, mfa_last_step = $2, updated_at = $3
+		WHERE id = $1 AND deleted_at IS NULL AND mfa_secret IS NOT NULL AND mfa_enabled_at IS NULL
+	`, userID, step, time.Now())
+
+	if err != nil {
+		return false, fmt.Errorf("failed to enable mfa: %w", err)
+	}
+
+	return rowsAffected(result) == 1, nil
+}
+
+// UseMFAStep records a TOTP time step as used. It reports false when the step
+// is not newer than the last one used, i.e. the code is being replayed.
+func (r *SQLiteRepository) UseMFAStep(ctx context.Context, userID int, step int64) (bool, error) {
+	result, err := r.q.ExecContext(ctx, `
+		UPDATE users
+		SET mfa_last_step = $2
+		WHERE id = $1 AND (mfa_last_step IS NULL OR mfa_last_step < $2)
+	`, userID, step)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to record mfa step: %w", err)
+	}
+
+	return rowsAffected(result) == 1, nil
+}
+
+// ResetUserMFA turns MFA off for a user and removes their recovery codes. It
+// reports false when no active user has the ID.
+func (r *SQLiteRepository) ResetUserMFA(ctx context.Context, userID int) (bool, error) {
+	reset := false
+	err := r.inTx(ctx, func(q sqliteConn) error {
+		result, err := q.ExecContext(ctx, `
+			UPDATE users
+			SET mfa_secret = NULL, mfa_enabled_at = NULL, mfa_last_step = NULL, updated_at = $2
+			WHERE id = $1 AND deleted_at IS NULL`+memberCondition(ctx), userID, time.Now())
+		if err != nil {
+			return fmt.Errorf("failed to reset mfa: %w", err)
+		}
+		if rowsAffected(result) == 0 {
+			return nil
+		}
+
+		if _, err := q.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+			return fmt.Errorf("failed to delete recovery codes: %w", err)
+		}
+
+		reset = true
+		return nil
+	})
+
+	return reset, err
+}
+
+// ReplaceMFARecoveryCodes replaces all recovery codes of a user
+func (r *SQLiteRepository) ReplaceMFARecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	return r.inTx(ctx, func(q sqliteConn) error {
+		if _, err := q.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+			return fmt.Errorf("failed to delete recovery codes: %w", err)
+		}
+
+		if _, err := q.ExecContext(ctx, `
+			INSERT INTO mfa_recovery_codes (user_id, code_hash, created_at)
+			SELECT $1, value, $3
+			FROM json_each($2)
+		`, userID, jsonValue{codeHashes}, time.Now()); err != nil {
+			return fmt.Errorf("failed to store recovery codes: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// ConsumeMFARecoveryCode marks an unused recovery code as used. It reports
+// false when the user has no such unused code.
+func (r *SQLiteRepository) ConsumeMFARecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	result, err := r.q.ExecContext(ctx, `
+		UPDATE mfa_recovery_codes
+		SET used_at = $3
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userID, codeHash, time.Now())
+
+	if err != nil {
+		return false, fmt.Errorf("failed to consume recovery code: %w", err)
+	}
+
+	return rowsAffected(result) == 1, nil
+}
+
+// CreateMFAChallenge stores a new hashed MFA challenge token
+func (r *SQLiteRepository) CreateMFAChallenge(ctx context.Context, challenge *models.MFAChallenge) (*models.MFAChallenge, error) {
+	var created models.MFAChallenge
+	err := sqlscan.Get(ctx, r.q, &created, `
+		INSERT INTO mfa_challenges (user_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, user_id, token_hash, expires_at, created_at, attempts, used_at
+	`, challenge.UserID, challenge.TokenHash, challenge.ExpiresAt, time.Now())
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mfa challenge: %w", err)
+	}
+
+	return &created, nil
+}
+
+// GetMFAChallengeByHash retrieves an MFA challenge by its token hash
+func (r *SQLiteRepository) GetMFAChallengeByHash(ctx context.Context, tokenHash string) (*models.MFAChallenge, error) {
+	var challenge models.MFAChallenge
+	err := sqlscan.Get(ctx, r.q, &challenge, `
+		SELECT id, user_id, token_hash, expires_at, created_at, attempts, used_at
+		FROM mfa_challenges
+		WHERE token_hash = $1
+	`, tokenHash)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get mfa challenge: %w", err)
+	}
+
+	return &challenge, nil
+}
+
+// RecordMFAChallengeAttempt counts a code entered for a challenge and
+// returns the number of attempts so far, or 0 when there is no such challenge
+func (r *SQLiteRepository) RecordMFAChallengeAttempt(ctx context.Context, id int) (int, error) {
+	var attempts int
+	err := r.q.QueryRowContext(ctx, `
+		UPDATE mfa_challenges
+		SET attempts = attempts + 1
+		WHERE id = $1
+		RETURNING attempts
+	`, id).Scan(&attempts)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to record mfa challenge attempt: %w", err)
+	}
+
+	return attempts, nil
+}
+
+// ConsumeMFAChallenge marks a challenge as used. It reports false when it had
+// already been used, so a challenge completes at most one login.
+func (r *SQLiteRepository) ConsumeMFAChallenge(ctx context.Context, id int) (bool, error) {
+	result, err := r.q.ExecContext(ctx, `
+		UPDATE mfa_challenges
+		SET used_at = $2
+		WHERE id = $1 AND used_at IS NULL
+	`, id, time.Now())
+
+	if err != nil {
+		return false, fmt.Errorf("failed to consume mfa challenge: %w", err)
+	}
+
+	return rowsAffected(result) == 1, nil
+}
@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-backend-starter/internal/models"
+
+	"github.com/georgysavva/scany/v2/sqlscan"
+)
+
+// CreateOrganization stores a new organization with its first member
+func (r *SQLiteRepository) CreateOrganization(ctx context.Context, org *models.Organization, ownerID int, ownerRole string) (*models.Organization, error) {
+	var created models.Organization
+	err := r.inTx(ctx, func(q sqliteConn) error {
+		now := time.Now()
+		if err := sqlscan.Get(ctx, q, &created, `
+			INSERT INTO organizations (name, slug, created_at, updated_at)
+			VALUES ($1, $2, $3, $3)
+			RETURNING id, name, slug, created_at, updated_at
+		`, org.Name, org.Slug, now); err != nil {
+			return fmt.Errorf("failed to create organization: %w", translateSQLiteError(err, ""))
+		}
+
+		if err := addSQLiteMember(ctx, q, created.ID, ownerID, ownerRole, false); err != nil {
+			return fmt.Errorf("failed to add organization owner: %w", err)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+// GetOrganizationMember returns a user's membership in an organization, or
+// nil if they are not a member
+func (r *SQLiteRepository) GetOrganizationMember(ctx context.Context, orgID, userID int) (*models.OrganizationMember, error) {
+	var member models.OrganizationMember
+	err := sqlscan.Get(ctx, r.q, &member, `
+		SELECT m.organization_id, m.user_id, m.role, m.created_account, u.role AS account_role, m.created_at
+		FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.organization_id = $1 AND m.user_id = $2
+	`, orgID, userID)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get organization member: %w", err)
+	}
+
+	return &member, nil
+}
+
+// ListUserOrganizations returns the organizations a user belongs to, in the
+// order they joined them
+func (r *SQLiteRepository) ListUserOrganizations(ctx context.Context, userID int) ([]*models.Membership, error) {
+	var memberships []*models.Membership
+	err := sqlscan.Select(ctx, r.q, &memberships, `
+		SELECT o.id, o.name, o.slug, o.created_at, o.updated_at, m.role, m.created_at AS joined_at
+		FROM organization_members m
+		JOIN organizations o ON o.id = m.organization_id
+		WHERE m.user_id = $1
+		ORDER BY m.created_at, o.id
+	`, userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user organizations: %w", err)
+	}
+
+	return memberships, nil
+}
+
+// AddOrganizationMember adds a user to an organization
+func (r *SQLiteRepository) AddOrganizationMember(ctx context.Context, orgID, userID int, role string) error {
+	if err := addSQLiteMember(ctx, r.q, orgID, userID, role, false); err != nil {
+		return fmt.Errorf("failed to add organization member: %w", err)
+	}
+	return nil
+}
+
+// addSQLiteMember inserts a membership. As SQLite does not say which foreign
+// key a violation is of, it looks for the missing reference itself.
+func addSQLiteMember(ctx context.Context, q sqliteConn, orgID, userID int, role string, createdAccount bool) error {
+	_, err := q.ExecContext(ctx, `
+		INSERT INTO organization_members (organization_id, user_id, role, created_account, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, orgID, userID, role, createdAccount, time.Now())
+	if err == nil {
+		return nil
+	}
+
+	var missing string
+	if lookupErr := q.QueryRowContext(ctx, `
+		SELECT CASE
+			WHEN NOT EXISTS (SELECT 1 FROM organizations WHERE id = $1) THEN 'organization_members_organization_id_fkey'
+			WHEN NOT EXISTS (SELECT 1 FROM users WHERE id = $2) THEN 'organization_members_user_id_fkey'
+			ELSE 'organization_members_role_fkey'
+		END
+	`, orgID, userID).Scan(&missing); lookupErr != nil {
+		return err
+	}
+
+	return translateSQLiteError(err, missing)
+}
+
+// RemoveOrganizationMember removes a user from an organization and reports
+// whether they were a member
+func (r *SQLiteRepository) RemoveOrganizationMember(ctx context.Context, orgID, userID int) (bool, error) {
+	result, err := r.q.ExecContext(ctx, `
+		DELETE FROM organization_members
+		WHERE organization_id = $1 AND user_id = $2
+	`, orgID, userID)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to remove organization member: %w", err)
+	}
+
+	return rowsAffected(result) > 0, nil
+}
+
+// CountUserOrganizations counts the organizations a user belongs to
+func (r *SQLiteRepository) CountUserOrganizations(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := r.q.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM organization_members
+		WHERE user_id = $1
+	`, userID).Scan(&count)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to count user organizations: %w", err)
+	}
+
+	return count, nil
+}
+
+// CreateInvitation stores an invitation. An earlier invitation of the user to
+// the organization is replaced.
+func (r *SQLiteRepository) CreateInvitation(ctx context.Context, invitation *models.Invitation) (*models.Invitation, error) {
+	var id int
+	err := r.q.QueryRowContext(ctx, `
+		INSERT INTO organization_invitations (organization_id, user_id, role, invited_by, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (organization_id, user_id) DO UPDATE
+		SET role = excluded.role, invited_by = excluded.invited_by, expires_at = excluded.expires_at, created_at = excluded.created_at
+		RETURNING id
+	`, invitation.OrganizationID, invitation.UserID, invitation.Role, invitation.InvitedBy, invitation.ExpiresAt, time.Now()).Scan(&id)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create invitation: %w", translateSQLiteError(err, "organization_invitations_role_fkey"))
+	}
+
+	return r.GetInvitation(ctx, id)
+}
+
+// GetInvitation returns an invitation, expired or not, or nil if there is none
+func (r *SQLiteRepository) GetInvitation(ctx context.Context, id int) (*models.Invitation, error) {
+	var invitation models.Invitation
+	err := sqlscan.Get(ctx, r.q, &invitation, `
+		SELECT `+invitationColumns+`
+		FROM organization_invitations i
+		JOIN organizations o ON o.id = i.organization_id
+		WHERE i.id = $1
+	`, id)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get invitation: %w", err)
+	}
+
+	return &invitation, nil
+}
+
+// ListOrganizationInvitations returns the unexpired invitations to an
+// organization, newest first
+func (r *SQLiteRepository) ListOrganizationInvitations(ctx context.Context, orgID int) ([]*models.Invitation, error) {
+	var invitations []*models.Invitation
+	err := sqlscan.Select(ctx, r.q, &invitations, `
+		SELECT `+invitationColumns+`
+		FROM organization_invitations i
+		JOIN organizations o ON o.id = i.organization_id
+		WHERE i.organization_id = $1 AND i.expires_at > $2
+		ORDER BY i.id DESC
+	`, orgID, time.Now())
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+
+	return invitations, nil
+}
+
+// ListUserInvitations returns the unexpired invitations of a user, newest first
+func (r *SQLiteRepository) ListUserInvitations(ctx context.Context, userID int) ([]*models.Invitation, error) {
+	var invitations []*models.Invitation
+	err := sqlscan.Select(ctx, r.q, &invitations, `
+		SELECT `+invitationColumns+`
+		FROM organization_invitations i
+		JOIN organizations o ON o.id = i.organization_id
+		WHERE i.user_id = $1 AND i.expires_at > $2
+		ORDER BY i.id DESC
+	`, userID, time.Now())
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+
+	return invitations, nil
+}
+
+// DeleteInvitation removes an invitation and reports whether it existed
+func (r *SQLiteRepository) DeleteInvitation(ctx context.Context, id int) (bool, error) {
+	result, err := r.q.ExecContext(ctx, `
+		DELETE FROM organization_invitations
+		WHERE id = $1
+	`, id)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to delete invitation: %w", err)
+	}
+
+	return rowsAffected(result) > 0, nil
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/georgysavva/scany/v2/sqlscan"
+)
+
+// AddPasswordHistory records a password hash a user no longer uses, keeping
+// only their newest keep entries
+func (r *SQLiteRepository) AddPasswordHistory(ctx context.Context, userID int, passwordHash string, keep int) error {
+	return r.inTx(ctx, func(q sqliteConn) error {
+		if _, err := q.ExecContext(ctx, `
+			INSERT INTO password_history (user_id, password_hash, created_at)
+			VALUES ($1, $2, $3)
+		`, userID, passwordHash, time.Now()); err != nil {
+			return fmt.Errorf("failed to add password history: %w", err)
+		}
+
+		if _, err := q.ExecContext(ctx, `
+			DELETE FROM password_history
+			WHERE user_id = $1 AND id NOT IN (
+				SELECT id FROM password_history
+				WHERE user_id = $1
+				ORDER BY id DESC
+				LIMIT $2
+			)
+		`, userID, keep); err != nil {
+			return fmt.Errorf("failed to trim password history: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// GetPasswordHistory returns a user's newest previous password hashes
+func (r *SQLiteRepository) GetPasswordHistory(ctx context.Context, userID int, limit int) ([]string, error) {
+	var hashes []string
+	err := sqlscan.Select(ctx, r.q, &hashes, `
+		SELECT password_hash
+		FROM password_history
+		WHERE user_id = $1
+		ORDER BY id DESC
+		LIMIT $2
+	`, userID, limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get password history: %w", err)
+	}
+
+	return hashes, nil
+}
@@ -0,0 +1,546 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/tenant"
+
+	"github.com/georgysavva/scany/v2/sqlscan"
+)
+
+// sqlDB is satisfied by both *sql.DB and *sql.Tx
+type sqlDB interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// sqliteConn runs statements with every time argument converted to UTC, the
+// only zone in which times stored as text sort chronologically
+type sqliteConn struct {
+	db sqlDB
+}
+
+func (c sqliteConn) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return c.db.ExecContext(ctx, query, utcArgs(args)...)
+}
+
+func (c sqliteConn) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return c.db.QueryContext(ctx, query, utcArgs(args)...)
+}
+
+func (c sqliteConn) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return c.db.QueryRowContext(ctx, query, utcArgs(args)...)
+}
+
+func utcArgs(args []any) []any {
+	converted := make([]any, len(args))
+	for i, arg := range args {
+		switch t := arg.(type) {
+		case time.Time:
+			arg = t.UTC()
+		case *time.Time:
+			if t != nil {
+				arg = t.UTC()
+			}
+		}
+		converted[i] = arg
+	}
+	return converted
+}
+
+// jsonValue stores a value as JSON text and scans it back. Nil values are
+// stored as NULL.
+type jsonValue struct {
+	v any // the value to store, or a pointer to scan into
+}
+
+func (j jsonValue) Value() (driver.Value, error) {
+	data, err := json.Marshal(j.v)
+	if err != nil || string(data) == "null" {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (j jsonValue) Scan(src any) error {
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(src), j.v)
+	case []byte:
+		return json.Unmarshal(src, j.v)
+	}
+	return fmt.Errorf("cannot scan %T into JSON", src)
+}
+
+// rowsAffected returns the number of rows a statement changed. The SQLite
+// driver always knows it.
+func rowsAffected(result sql.Result) int64 {
+	n, _ := result.RowsAffected()
+	return n
+}
+
+// SQLiteRepository implements Repository interface for SQLite, with the same
+// semantics as PostgresRepository
+type SQLiteRepository struct {
+	db *sql.DB
+	q  sqliteConn // the database, or the transaction of a unit of work
+	tx *sql.Tx    // set inside a unit of work
+}
+
+// NewSQLiteRepository creates a new SQLite repository
+func NewSQLiteRepository(db *sql.DB) *SQLiteRepository {
+	return &SQLiteRepository{db: db, q: sqliteConn{db: db}}
+}
+
+// WithTx runs fn in a transaction, passing it a repository bound to the
+// transaction. The transaction commits when fn returns nil and rolls back
+// otherwise. SQLite transactions are always serializable and run one at a
+// time, so opts is ignored. Inside a unit of work fn joins the enclosing
+// transaction.
+func (r *SQLiteRepository) WithTx(ctx context.Context, opts TxOptions, fn func(repo Repository) error) error {
+	if r.tx != nil {
+		return fn(r)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(&SQLiteRepository{db: r.db, q: sqliteConn{db: tx}, tx: tx}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// inTx runs fn in a transaction that commits when fn returns nil. Inside a
+// unit of work it runs in a savepoint of the enclosing transaction instead.
+func (r *SQLiteRepository) inTx(ctx context.Context, fn func(q sqliteConn) error) error {
+	if r.tx != nil {
+		if _, err := r.q.ExecContext(ctx, "SAVEPOINT repository"); err != nil {
+			return fmt.Errorf("failed to begin savepoint: %w", err)
+		}
+		if err := fn(r.q); err != nil {
+			_, _ = r.q.ExecContext(ctx, "ROLLBACK TO repository; RELEASE repository")
+			return err
+		}
+		if _, err := r.q.ExecContext(ctx, "RELEASE repository"); err != nil {
+			return fmt.Errorf("failed to release savepoint: %w", err)
+		}
+		return nil
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(sqliteConn{db: tx}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetUserByID retrieves a user by ID
+func (r *SQLiteRepository) GetUserByID(ctx context.Context, id int) (*models.User, error) {
+	user, err := getSQLiteUser(ctx, r.q, id, " AND deleted_at IS NULL")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by ID: %w", err)
+	}
+	return user, nil
+}
+
+// GetUserByUsername retrieves a user by username
+func (r *SQLiteRepository) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	var user models.User
+	err := sqlscan.Get(ctx, r.q, &user, `
+		SELECT `+userColumns+`
+		FROM `+usersFrom(ctx)+`
+		WHERE username = $1 AND deleted_at IS NULL
+	`, username)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get user by username: %w", err)
+	}
+
+	return &user, nil
+}
+
+// GetUserByEmail retrieves a user by email
+func (r *SQLiteRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	err := sqlscan.Get(ctx, r.q, &user, `
+		SELECT `+userColumns+`
+		FROM `+usersFrom(ctx)+`
+		WHERE email = $1 AND deleted_at IS NULL
+	`, email)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get user by email: %w", err)
+	}
+
+	return &user, nil
+}
+
+// getSQLiteUser fetches a user by ID as seen from the context's organization.
+// SQLite transactions hold the database write lock from the start, so unlike
+// lockUser it needs no row lock. It returns nil when no user has the ID and
+// matches the condition.
+func getSQLiteUser(ctx context.Context, q sqliteConn, id int, condition string) (*models.User, error) {
+	var user models.User
+	err := sqlscan.Get(ctx, q, &user, `
+		SELECT `+userColumns+`
+		FROM `+usersFrom(ctx)+`
+		WHERE id = $1`+condition, id)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// CreateUser creates a new user. Inside an organization the user becomes a
+// member with the given role and gets the user role globally.
+func (r *SQLiteRepository) CreateUser(ctx context.Context, input *models.CreateUserInput) (*models.User, error) {
+	now := time.Now()
+	var emailVerifiedAt *time.Time
+	if input.EmailVerified {
+		emailVerifiedAt = &now
+	}
+
+	orgID, scoped := tenant.OrganizationID(ctx)
+	role := input.Role
+	if scoped {
+		role = models.RoleUser
+	}
+
+	var user *models.User
+	err := r.inTx(ctx, func(q sqliteConn) error {
+		var id int
+		err := q.QueryRowContext(ctx, `
+			INSERT INTO users (username, password_hash, email, role, email_verified_at, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id
+		`, input.Username, input.PasswordHash, input.Email, role, emailVerifiedAt, now, now).Scan(&id)
+
+		if err != nil {
+			return fmt.Errorf("failed to create user: %w", translateSQLiteError(err, "users_role_fkey"))
+		}
+
+		if scoped {
+			if err := addSQLiteMember(ctx, q, orgID, id, input.Role, true); err != nil {
+				return fmt.Errorf("failed to add organization member: %w", err)
+			}
+		}
+
+		if user, err = getSQLiteUser(ctx, q, id, ""); err != nil {
+			return fmt.Errorf("failed to get user by ID: %w", err)
+		}
+		return recordSQLiteUserEvent(ctx, q, models.AuditUserCreate, nil, user)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// UpdateUser updates an existing user. Inside an organization a role change
+// applies to the user's membership rather than their global role.
+func (r *SQLiteRepository) UpdateUser(ctx context.Context, id int, input *models.UpdateUserInput) (*models.User, error) {
+	orgID, scoped := tenant.OrganizationID(ctx)
+
+	setClauses := []string{}
+	args := []interface{}{}
+
+	if input.Username != "" {
+		args = append(args, input.Username)
+		setClauses = append(setClauses, fmt.Sprintf("username = $%d", len(args)))
+	}
+
+	if input.Email != "" {
+		args = append(args, input.Email)
+		setClauses = append(setClauses, fmt.Sprintf("email = $%d", len(args)))
+	}
+
+	if input.PasswordHash != "" {
+		args = append(args, input.PasswordHash)
+		setClauses = append(setClauses, fmt.Sprintf("password_hash = $%d", len(args)))
+	}
+
+	if input.Role != "" && !scoped {
+		args = append(args, input.Role)
+		setClauses = append(setClauses, fmt.Sprintf("role = $%d", len(args)))
+	}
+
+	// If no fields to update, just return the current user
+	if len(setClauses) == 0 && (input.Role == "" || !scoped) {
+		return r.GetUserByID(ctx, id)
+	}
+
+	args = append(args, time.Now())
+	setClauses = append(setClauses, fmt.Sprintf("updated_at = $%d", len(args)))
+	args = append(args, id)
+
+	var after *models.User
+	err := r.inTx(ctx, func(q sqliteConn) error {
+		before, err := getSQLiteUser(ctx, q, id, " AND deleted_at IS NULL")
+		if err != nil {
+			return fmt.Errorf("failed to get user by ID: %w", err)
+		}
+		if before == nil {
+			return nil
+		}
+
+		if _, err := q.ExecContext(ctx, fmt.Sprintf(`
+			UPDATE users
+			SET %s
+			WHERE id = $%d
+		`, strings.Join(setClauses, ", "), len(args)), args...); err != nil {
+			return fmt.Errorf("failed to update user: %w", translateSQLiteError(err, "users_role_fkey"))
+		}
+
+		if input.Role != "" && scoped {
+			if _, err := q.ExecContext(ctx, `
+				UPDATE organization_members
+				SET role = $3
+				WHERE organization_id = $1 AND user_id = $2
+			`, orgID, id, input.Role); err != nil {
+				return fmt.Errorf("failed to update member role: %w", translateSQLiteError(err, "organization_members_role_fkey"))
+			}
+		}
+
+		if after, err = getSQLiteUser(ctx, q, id, ""); err != nil {
+			return fmt.Errorf("failed to get user by ID: %w", err)
+		}
+		return recordSQLiteUserEvent(ctx, q, models.AuditUserUpdate, before, after)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return after, nil
+}
+
+// UpdateUserPasswordHash replaces a user's password hash without touching
+// updated_at, for upgrading hashes to the current algorithm
+func (r *SQLiteRepository) UpdateUserPasswordHash(ctx context.Context, id int, passwordHash string) error {
+	_, err := r.q.ExecContext(ctx, `
+		UPDATE users
+		SET password_hash = $2
+		WHERE id = $1
+	`, id, passwordHash)
+
+	if err != nil {
+		return fmt.Errorf("failed to update password hash: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteUser soft deletes a user. It reports false when no active user has the ID.
+func (r *SQLiteRepository) DeleteUser(ctx context.Context, id int) (bool, error) {
+	var deleted bool
+	err := r.inTx(ctx, func(q sqliteConn) error {
+		before, err := getSQLiteUser(ctx, q, id, " AND deleted_at IS NULL")
+		if err != nil {
+			return fmt.Errorf("failed to get user by ID: %w", err)
+		}
+		if before == nil {
+			return nil
+		}
+
+		after := *before
+		now := time.Now()
+		after.DeletedAt = &now
+		if _, err := q.ExecContext(ctx, `
+			UPDATE users
+			SET deleted_at = $2
+			WHERE id = $1
+		`, id, now); err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+
+		deleted = true
+		return recordSQLiteUserEvent(ctx, q, models.AuditUserDelete, before, &after)
+	})
+
+	return deleted, err
+}
+
+// RestoreUser undoes a soft delete. It returns nil when no deleted user has the ID.
+func (r *SQLiteRepository) RestoreUser(ctx context.Context, id int) (*models.User, error) {
+	var restored *models.User
+	err := r.inTx(ctx, func(q sqliteConn) error {
+		before, err := getSQLiteUser(ctx, q, id, " AND deleted_at IS NOT NULL")
+		if err != nil {
+			return fmt.Errorf("failed to get user by ID: %w", err)
+		}
+		if before == nil {
+			return nil
+		}
+
+		after := *before
+		after.DeletedAt = nil
+		after.UpdatedAt = time.Now()
+		if _, err := q.ExecContext(ctx, `
+			UPDATE users
+			SET deleted_at = NULL, updated_at = $2
+			WHERE id = $1
+		`, id, after.UpdatedAt); err != nil {
+			return fmt.Errorf("failed to restore user: %w", err)
+		}
+
+		restored = &after
+		return recordSQLiteUserEvent(ctx, q, models.AuditUserRestore, before, &after)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return restored, nil
+}
+
+// PurgeUser permanently deletes a user, whether soft deleted or not. It
+// reports false when no user has the ID.
+func (r *SQLiteRepository) PurgeUser(ctx context.Context, id int) (bool, error) {
+	var purged bool
+	err := r.inTx(ctx, func(q sqliteConn) error {
+		before, err := getSQLiteUser(ctx, q, id, "")
+		if err != nil {
+			return fmt.Errorf("failed to get user by ID: %w", err)
+		}
+		if before == nil {
+			return nil
+		}
+
+		if _, err := q.ExecContext(ctx, `
+			DELETE FROM users
+			WHERE id = $1
+		`, id); err != nil {
+			return fmt.Errorf("failed to purge user: %w", err)
+		}
+
+		purged = true
+		return recordSQLiteUserEvent(ctx, q, models.AuditUserPurge, before, nil)
+	})
+
+	return purged, err
+}
+
+// ListUsers retrieves a page of users using keyset pagination
+func (r *SQLiteRepository) ListUsers(ctx context.Context, query *models.UserListQuery) ([]*models.User, error) {
+	column, ok := userSortColumns[query.SortField]
+	if !ok {
+		return nil, fmt.Errorf("unsupported sort field %q", query.SortField)
+	}
+
+	conditions, args := userFilterConditions(&query.UserFilter, "LIKE")
+
+	direction, comparison := "ASC", ">"
+	if query.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	// Rows strictly after the key in sort order; id breaks ties
+	if query.After != nil {
+		if column == "id" {
+			conditions = append(conditions, fmt.Sprintf("id %s $%d", comparison, len(args)+1))
+			args = append(args, query.After.ID)
+		} else {
+			conditions = append(conditions, fmt.Sprintf("(%s, id) %s ($%d, $%d)", column, comparison, len(args)+1, len(args)+2))
+			args = append(args, query.After.Value, query.After.ID)
+		}
+	}
+
+	orderBy := fmt.Sprintf("%s %s", column, direction)
+	if column != "id" {
+		orderBy += fmt.Sprintf(", id %s", direction)
+	}
+
+	args = append(args, query.Limit)
+
+	var users []*models.User
+	err := sqlscan.Select(ctx, r.q, &users, fmt.Sprintf(`
+		SELECT %s
+		FROM %s
+		%s
+		ORDER BY %s
+		LIMIT $%d
+	`, userColumns, usersFrom(ctx), whereClause(conditions), orderBy, len(args)), args...)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	return users, nil
+}
+
+// CountUsers counts the users matching a filter
+func (r *SQLiteRepository) CountUsers(ctx context.Context, filter *models.UserFilter) (int, error) {
+	conditions, args := userFilterConditions(filter, "LIKE")
+
+	var count int
+	err := r.q.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT COUNT(*)
+		FROM %s
+		%s
+	`, usersFrom(ctx), whereClause(conditions)), args...).Scan(&count)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	return count, nil
+}
+
+// MarkEmailVerified records that a user has verified their email address
+func (r *SQLiteRepository) MarkEmailVerified(ctx context.Context, userID int) error {
+	_, err := r.q.ExecContext(ctx, `
+		UPDATE users
+		SET email_verified_at = $2, updated_at = $2
+		WHERE id = $1 AND email_verified_at IS NULL
+	`, userID, time.Now())
+
+	if err != nil {
+		return fmt.Errorf("failed to mark email verified: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-backend-starter/internal/models"
+
+	"github.com/georgysavva/scany/v2/sqlscan"
+)
+
+// sqliteRoleSelect reads roles together with their sorted permission names
+// as a JSON array
+const sqliteRoleSelect = `
+	SELECT r.name, r.description, r.builtin, r.created_at, r.updated_at,
+		json_group_array(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL) AS permissions
+	FROM roles r
+	LEFT JOIN role_permissions rp ON rp.role_name = r.name
+`
+
+// ListRoles returns every role with its permissions
+func (r *SQLiteRepository) ListRoles(ctx context.Context) ([]*models.Role, error) {
+	rows, err := r.q.QueryContext(ctx, sqliteRoleSelect+`
+		GROUP BY r.name
+		ORDER BY r.name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	defer rows.Close()
+
+	var roles []*models.Role
+	for rows.Next() {
+		var role models.Role
+		if err := scanSQLiteRole(rows, &role); err != nil {
+			return nil, fmt.Errorf("failed to list roles: %w", err)
+		}
+		roles = append(roles, &role)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+
+	return roles, nil
+}
+
+// GetRole returns a role with its permissions, or nil if there is none
+func (r *SQLiteRepository) GetRole(ctx context.Context, name string) (*models.Role, error) {
+	return getSQLiteRole(ctx, r.q, name)
+}
+
+func getSQLiteRole(ctx context.Context, q sqliteConn, name string) (*models.Role, error) {
+	var role models.Role
+	err := scanSQLiteRole(q.QueryRowContext(ctx, sqliteRoleSelect+`
+		WHERE r.name = $1
+		GROUP BY r.name
+	`, name), &role)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get role: %w", err)
+	}
+
+	return &role, nil
+}
+
+// scanSQLiteRole reads a row of sqliteRoleSelect
+func scanSQLiteRole(row interface{ Scan(dest ...any) error }, role *models.Role) error {
+	return row.Scan(&role.Name, &role.Description, &role.Builtin, &role.CreatedAt, &role.UpdatedAt,
+		jsonValue{&role.Permissions})
+}
+
+// CreateRole stores a new custom role and its permissions
+func (r *SQLiteRepository) CreateRole(ctx context.Context, role *models.Role) (*models.Role, error) {
+	var created *models.Role
+	err := r.inTx(ctx, func(q sqliteConn) error {
+		if _, err := q.ExecContext(ctx, `
+			INSERT INTO roles (name, description, builtin, created_at, updated_at)
+			VALUES ($1, $2, FALSE, $3, $3)
+		`, role.Name, role.Description, time.Now()); err != nil {
+			return fmt.Errorf("failed to create role: %w", translateSQLiteError(err, ""))
+		}
+
+		if err := setSQLiteRolePermissions(ctx, q, role.Name, role.Permissions); err != nil {
+			return err
+		}
+
+		var err error
+		created, err = getSQLiteRole(ctx, q, role.Name)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// UpdateRole replaces a role's description and permissions. It returns nil
+// when the role does not exist.
+func (r *SQLiteRepository) UpdateRole(ctx context.Context, name string, input *models.UpdateRoleInput) (*models.Role, error) {
+	var updated *models.Role
+	err := r.inTx(ctx, func(q sqliteConn) error {
+		result, err := q.ExecContext(ctx, `
+			UPDATE roles
+			SET description = $2, updated_at = $3
+			WHERE name = $1
+		`, name, input.Description, time.Now())
+		if err != nil {
+			return fmt.Errorf("failed to update role: %w", err)
+		}
+		if rowsAffected(result) == 0 {
+			return nil
+		}
+
+		if _, err := q.ExecContext(ctx, `
+			DELETE FROM role_permissions
+			WHERE role_name = $1
+		`, name); err != nil {
+			return fmt.Errorf("failed to clear role permissions: %w", err)
+		}
+
+		if err := setSQLiteRolePermissions(ctx, q, name, input.Permissions); err != nil {
+			return err
+		}
+
+		updated, err = getSQLiteRole(ctx, q, name)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+func setSQLiteRolePermissions(ctx context.Context, q sqliteConn, role string, permissions []string) error {
+	// WHERE true tells the parser the ON CONFLICT clause is not a join constraint
+	if _, err := q.ExecContext(ctx, `
+		INSERT INTO role_permissions (role_name, permission)
+		SELECT $1, value FROM json_each($2) WHERE true
+		ON CONFLICT DO NOTHING
+	`, role, jsonValue{permissions}); err != nil {
+		return fmt.Errorf("failed to set role permissions: %w", translateSQLiteError(err, "role_permissions_permission_fkey"))
+	}
+	return nil
+}
+
+// DeleteRole removes a custom role. Built-in roles are never deleted, and a
+// role that is still assigned to users fails with a ReferenceError.
+func (r *SQLiteRepository) DeleteRole(ctx context.Context, name string) (bool, error) {
+	result, err := r.q.ExecContext(ctx, `
+		DELETE FROM roles
+		WHERE name = $1 AND NOT builtin
+	`, name)
+
+	if err != nil {
+		foreignKey := "organization_members_role_fkey"
+		var assigned bool
+		if r.q.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM users WHERE role = $1)
+		`, name).Scan(&assigned) == nil && assigned {
+			foreignKey = "users_role_fkey"
+		}
+		return false, fmt.Errorf("failed to delete role: %w", translateSQLiteError(err, foreignKey))
+	}
+
+	return rowsAffected(result) > 0, nil
+}
+
+// ListPermissions returns every permission
+func (r *SQLiteRepository) ListPermissions(ctx context.Context) ([]*models.Permission, error) {
+	var permissions []*models.Permission
+	err := sqlscan.Select(ctx, r.q, &permissions, `
+		SELECT name, description
+		FROM permissions
+		ORDER BY name
+	`)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list permissions: %w", err)
+	}
+
+	return permissions, nil
+}
+
+// GetRolePermissions returns the permission names a role grants
+func (r *SQLiteRepository) GetRolePermissions(ctx context.Context, role string) ([]string, error) {
+	var permissions []string
+	err := sqlscan.Select(ctx, r.q, &permissions, `
+		SELECT permission
+		FROM role_permissions
+		WHERE role_name = $1
+	`, role)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role permissions: %w", err)
+	}
+
+	return permissions, nil
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/utils"
+)
+
+// apiKeyPrefix starts every API key, so leaked keys are easy to recognise
+// and to search for
+const apiKeyPrefix = "gbs_"
+
+// CreateAPIKey creates an API key for a user. mfa tells whether the session
+// creating the key passed a second factor; the key claims MFA only then. The
+// returned key is the only time the secret is available; only its hash is
+// stored.
+func (s *Service) CreateAPIKey(ctx context.Context, userID int, mfa bool, input *models.CreateAPIKeyInput) (*models.CreatedAPIKey, error) {
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return nil, InvalidFields("the API key would already be expired",
+			FieldError{Field: "expires_at", Rule: "future", Message: "must be in the future"})
+	}
+
+	// The key is gbs_<lookup prefix>_<secret>. The prefix is stored in plain
+	// text to find the key; the whole key is only stored hashed.
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to generate API key prefix: %w", err)
+	}
+	prefix := hex.EncodeToString(b)
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+	key := apiKeyPrefix + prefix + "_" + secret
+
+	var stored *models.APIKey
+	err = s.inTx(ctx, func(tx *Service) error {
+		var err error
+		stored, err = tx.repo.CreateAPIKey(ctx, &models.APIKey{
+			UserID:    userID,
+			Name:      input.Name,
+			Prefix:    prefix,
+			KeyHash:   utils.HashToken(key),
+			Scopes:    input.Scopes,
+			MFA:       mfa,
+			ExpiresAt: input.ExpiresAt,
+		})
+		if err != nil {
+			return err
+		}
+		return tx.recordEvent(ctx, models.AuditAPIKeyCreate, models.AuditTargetAPIKey, &stored.ID, nil, apiKeySnapshot(stored))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.CreatedAPIKey{APIKey: *stored, Key: key}, nil
+}
+
+// ListAPIKeys returns a user's API keys
+func (s *Service) ListAPIKeys(ctx context.Context, userID int) ([]*models.APIKey, error) {
+	keys, err := s.repo.ListUserAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if keys == nil {
+		keys = []*models.APIKey{}
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey deletes one of a user's API keys
+func (s *Service) RevokeAPIKey(ctx context.Context, userID, id int) error {
+	return s.inTx(ctx, func(tx *Service) error {
+		keys, err := tx.repo.ListUserAPIKeys(ctx, userID)
+		if err != nil {
+			return err
+		}
+		i := slices.IndexFunc(keys, func(key *models.APIKey) bool { return key.ID == id })
+		if i < 0 {
+			return NotFound("API key not found")
+		}
+
+		if _, err := tx.repo.DeleteAPIKey(ctx, userID, id); err != nil {
+			return err
+		}
+		return tx.recordEvent(ctx, models.AuditAPIKeyRevoke, models.AuditTargetAPIKey, &id, apiKeySnapshot(keys[i]), nil)
+	})
+}
+
+// AuthenticateAPIKey checks an API key and returns claims for its user, like
+// ValidateToken does for access tokens. The key's use is recorded along with
+// the client IP.
+func (s *Service) AuthenticateAPIKey(ctx context.Context, key, ip string) (*utils.JWTClaims, *models.APIKey, error) {
+	rest, ok := strings.CutPrefix(key, apiKeyPrefix)
+	if !ok {
+		return nil, nil, Unauthorized("invalid API key")
+	}
+	prefix, _, ok := strings.Cut(rest, "_")
+	if !ok {
+		return nil, nil, Unauthorized("invalid API key")
+	}
+
+	stored, err := s.repo.GetAPIKeyByPrefix(ctx, prefix)
+	if err != nil {
+		return nil, nil, err
+	}
+	if stored == nil || subtle.ConstantTimeCompare([]byte(stored.KeyHash), []byte(utils.HashToken(key))) != 1 {
+		return nil, nil, Unauthorized("invalid API key")
+	}
+	if stored.ExpiresAt != nil && !stored.ExpiresAt.After(time.Now()) {
+		return nil, nil, Unauthorized("API key has expired")
+	}
+
+	// Keys act with the user's current role, and stop working once the user is deleted
+	user, err := s.repo.GetUserByID(ctx, stored.UserID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, nil, Unauthorized("invalid API key")
+	}
+
+	if err := s.repo.TouchAPIKey(ctx, stored.ID, ip); err != nil {
+		return nil, nil, err
+	}
+
+	orgID, err := s.defaultOrganizationID(ctx, user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Like refreshed sessions, keys claim MFA only while the user still has it
+	amr := []string{"apikey"}
+	if stored.MFA && user.MFAEnabledAt != nil {
+		amr = append(amr, "mfa")
+	}
+
+	claims := &utils.JWTClaims{
+		UserID:   user.ID,
+		Username: user.Username,
+		Role:     user.Role,
+		OrgID:    orgID,
+		AMR:      amr,
+	}
+	return claims, stored, nil
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go-backend-starter/internal/config"
+	"go-backend-starter/internal/models"
+)
+
+// createAPIKey creates a read and write key for a user
+func (ts *testService) createAPIKey(t *testing.T, userID int, mfa bool) string {
+	t.Helper()
+
+	created, err := ts.CreateAPIKey(context.Background(), userID, mfa, &models.CreateAPIKeyInput{
+		Name:   "ci",
+		Scopes: []string{models.APIKeyScopeRead, models.APIKeyScopeWrite},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return created.Key
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+	user := ts.createUser(t, "alice", models.RoleUser)
+	key := ts.createAPIKey(t, user.ID, false)
+
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		t.Fatalf("key %q does not start with %q", key, apiKeyPrefix)
+	}
+
+	claims, stored, err := ts.AuthenticateAPIKey(ctx, key, "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != user.ID || !claims.HasAMR("apikey") || stored.Name != "ci" {
+		t.Errorf("claims = %+v, key = %+v", claims, stored)
+	}
+	if keys, err := ts.ListAPIKeys(ctx, user.ID); err != nil || keys[0].LastUsedIP == nil || *keys[0].LastUsedIP != "192.0.2.1" {
+		t.Errorf("ListAPIKeys = %+v, %v; want the use recorded", keys, err)
+	}
+
+	prefix, _, _ := strings.Cut(strings.TrimPrefix(key, apiKeyPrefix), "_")
+	for _, bad := range []string{
+		"",
+		strings.TrimPrefix(key, apiKeyPrefix),
+		apiKeyPrefix + prefix,
+		apiKeyPrefix + prefix + "_wrong",
+		apiKeyPrefix + "000000000000_" + strings.Repeat("a", 43),
+		key + "x",
+	} {
+		_, _, err := ts.AuthenticateAPIKey(ctx, bad, "192.0.2.1")
+		expectKind(t, err, ErrUnauthorized)
+	}
+
+	t.Run("expired", func(t *testing.T) {
+		past := time.Now().Add(-time.Minute)
+		_, err := ts.CreateAPIKey(ctx, user.ID, false, &models.CreateAPIKeyInput{Name: "old", Scopes: []string{models.APIKeyScopeRead}, ExpiresAt: &past})
+		expectKind(t, err, ErrValidation)
+
+		soon := time.Now().Add(time.Hour)
+		created, err := ts.CreateAPIKey(ctx, user.ID, false, &models.CreateAPIKeyInput{Name: "soon", Scopes: []string{models.APIKeyScopeRead}, ExpiresAt: &soon})
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored, err := ts.repo.GetAPIKeyByPrefix(ctx, created.Prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ts.repo.DeleteAPIKey(ctx, user.ID, stored.ID); err != nil {
+			t.Fatal(err)
+		}
+		stored.ExpiresAt = &past
+		if _, err := ts.repo.CreateAPIKey(ctx, stored); err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = ts.AuthenticateAPIKey(ctx, created.Key, "192.0.2.1")
+		expectKind(t, err, ErrUnauthorized)
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		other := ts.createAPIKey(t, user.ID, false)
+		keys, err := ts.ListAPIKeys(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ts.RevokeAPIKey(ctx, user.ID, keys[0].ID); err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = ts.AuthenticateAPIKey(ctx, other, "192.0.2.1")
+		expectKind(t, err, ErrUnauthorized)
+
+		err = ts.RevokeAPIKey(ctx, 1, keys[1].ID)
+		expectKind(t, err, ErrNotFound)
+	})
+}
+
+func TestAPIKeysClaimMFAOnlyWhenTheirSessionPassedIt(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t, func(cfg *config.Config) { cfg.Auth.MFARequiredRoles = []string{models.RoleUser} })
+	user := ts.createUser(t, "alice", models.RoleUser)
+
+	// A key created before MFA was set up must not get around the requirement
+	before := ts.createAPIKey(t, user.ID, false)
+	ts.enableMFA(t, user.ID)
+	after := ts.createAPIKey(t, user.ID, true)
+
+	for key, want := range map[string]bool{before: true, after: false} {
+		claims, _, err := ts.AuthenticateAPIKey(ctx, key, "192.0.2.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ts.MFARequired(claims); got != want {
+			t.Errorf("MFARequired(%v) = %v, want %v", claims.AMR, got, want)
+		}
+	}
+}
+
+func TestAPIKeysAreDeletedWithTheSessions(t *testing.T) {
+	ctx := context.Background()
+
+	for name, change := range map[string]func(t *testing.T, ts *testService, userID int) error{
+		"role change": func(t *testing.T, ts *testService, userID int) error {
+			_, err := ts.UpdateUser(ctx, userID, &models.UpdateUserInput{Role: models.RoleAdmin})
+			return err
+		},
+		"password change": func(t *testing.T, ts *testService, userID int) error {
+			_, err := ts.UpdateUser(ctx, userID, &models.UpdateUserInput{Password: "another password"})
+			return err
+		},
+		"mfa reset": func(t *testing.T, ts *testService, userID int) error {
+			ts.enableMFA(t, userID)
+			return ts.ResetMFA(ctx, userID)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ts := newTestService(t)
+			user := ts.createUser(t, "alice", models.RoleUser)
+			key := ts.createAPIKey(t, user.ID, false)
+			admin := ts.createAPIKey(t, 1, false)
+
+			if err := change(t, ts, user.ID); err != nil {
+				t.Fatal(err)
+			}
+
+			_, _, err := ts.AuthenticateAPIKey(ctx, key, "192.0.2.1")
+			expectKind(t, err, ErrUnauthorized)
+			if _, _, err := ts.AuthenticateAPIKey(ctx, admin, "192.0.2.1"); err != nil {
+				t.Errorf("key of another user: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-backend-starter/internal/audit"
+	"go-backend-starter/internal/models"
+)
+
+// auditCursorSort marks cursors of the audit log, which is always newest first
+const auditCursorSort = "audit"
+
+// ListAuditEvents retrieves a page of audit events, newest first
+func (s *Service) ListAuditEvents(ctx context.Context, input *models.ListAuditEventsInput) (*models.AuditEventPage, error) {
+	limit := input.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	query := &models.AuditEventQuery{
+		AuditEventFilter: models.AuditEventFilter{
+			ActorID:       input.ActorID,
+			Action:        input.Action,
+			TargetType:    input.TargetType,
+			TargetID:      input.TargetID,
+			CreatedAfter:  input.CreatedAfter,
+			CreatedBefore: input.CreatedBefore,
+		},
+		Limit: limit + 1, // one extra row tells whether another page follows
+	}
+
+	if input.Cursor != "" {
+		c, err := decodeCursor(input.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if c.Sort != auditCursorSort || c.ID <= 0 {
+			return nil, Validation("invalid cursor")
+		}
+		query.BeforeID = c.ID
+	}
+
+	events, err := s.repo.ListAuditEvents(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.AuditEventPage{Data: events}
+	if len(events) > limit {
+		page.Data = events[:limit]
+		page.NextCursor = encodeCursor(cursor{Sort: auditCursorSort, ID: page.Data[limit-1].ID})
+	}
+	if page.Data == nil {
+		page.Data = []*models.AuditEvent{}
+	}
+
+	return page, nil
+}
+
+// recordEvent stores an audit event for a change the service made itself,
+// as opposed to the user changes the repository records. Call it in the
+// unit of work of the change, so neither is stored without the other.
+// before and after are snapshots of the target, nil when it did not exist.
+func (s *Service) recordEvent(ctx context.Context, action, targetType string, targetID *int, before, after map[string]any) error {
+	event := &models.AuditEvent{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+	}
+	event.Before, event.After = audit.Diff(before, after)
+
+	if err := s.repo.CreateAuditEvent(ctx, event); err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+	return nil
+}
+
+// roleSnapshot returns the audited fields of a role. Permissions are joined,
+// as snapshot values must be comparable.
+func roleSnapshot(role *models.Role) map[string]any {
+	if role == nil {
+		return nil
+	}
+	return map[string]any{
+		"name":        role.Name,
+		"description": role.Description,
+		"permissions": strings.Join(role.Permissions, ","),
+	}
+}
+
+// invitationSnapshot returns the audited fields of an invitation
+func invitationSnapshot(invitation *models.Invitation) map[string]any {
+	return map[string]any{
+		"user_id":    invitation.UserID,
+		"role":       invitation.Role,
+		"expires_at": invitation.ExpiresAt.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// apiKeySnapshot returns the audited fields of an API key, never its hash
+func apiKeySnapshot(key *models.APIKey) map[string]any {
+	var expiresAt any
+	if key.ExpiresAt != nil {
+		expiresAt = key.ExpiresAt.UTC().Format(time.RFC3339Nano)
+	}
+	return map[string]any{
+		"user_id":    key.UserID,
+		"name":       key.Name,
+		"prefix":     key.Prefix,
+		"scopes":     strings.Join(key.Scopes, ","),
+		"mfa":        key.MFA,
+		"expires_at": expiresAt,
+	}
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"go-backend-starter/internal/audit"
+	"go-backend-starter/internal/models"
+)
+
+// lastEvent returns the newest audit event with an action visible in ctx
+func (ts *testService) lastEvent(t *testing.T, ctx context.Context, action string) *models.AuditEvent {
+	t.Helper()
+
+	page, err := ts.ListAuditEvents(ctx, &models.ListAuditEventsInput{Action: action})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Data) == 0 {
+		t.Fatalf("no %s event", action)
+	}
+	return page.Data[0]
+}
+
+func TestAdministrativeChangesAreAudited(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+	actx := asActor(ctx, 1)
+	alice := ts.createUser(t, "alice", models.RoleUser)
+
+	t.Run("roles", func(t *testing.T) {
+		if _, err := ts.CreateRole(actx, &models.CreateRoleInput{Name: "helpdesk", Permissions: []string{models.PermissionUsersRead}}); err != nil {
+			t.Fatal(err)
+		}
+		event := ts.lastEvent(t, ctx, models.AuditRoleCreate)
+		if event.TargetType != models.AuditTargetRole || event.After["name"] != "helpdesk" || event.After["permissions"] != models.PermissionUsersRead {
+			t.Errorf("create event = %+v", event)
+		}
+		if event.ActorID == nil || *event.ActorID != 1 {
+			t.Errorf("create event actor = %v, want 1", event.ActorID)
+		}
+
+		// Granting permissions shows up as the change of the role's permissions
+		if _, err := ts.UpdateRole(actx, "helpdesk", &models.UpdateRoleInput{
+			Permissions: []string{models.PermissionUsersRead, models.PermissionUsersWrite},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		event = ts.lastEvent(t, ctx, models.AuditRoleUpdate)
+		if event.Before["permissions"] != "users:read" || event.After["permissions"] != "users:read,users:write" {
+			t.Errorf("update event = %v -> %v", event.Before, event.After)
+		}
+
+		if err := ts.DeleteRole(actx, "helpdesk"); err != nil {
+			t.Fatal(err)
+		}
+		if event := ts.lastEvent(t, ctx, models.AuditRoleDelete); event.Before["name"] != "helpdesk" || event.After != nil {
+			t.Errorf("delete event = %+v", event)
+		}
+
+		// Failed changes leave no event behind
+		expectKind(t, ts.DeleteRole(actx, models.RoleUser), ErrForbidden)
+		if event := ts.lastEvent(t, ctx, models.AuditRoleDelete); event.Before["name"] != "helpdesk" {
+			t.Errorf("event for a refused delete: %+v", event)
+		}
+	})
+
+	t.Run("memberships", func(t *testing.T) {
+		acme := asActor(ts.createOrganization(t, "acme"), 1)
+
+		invitation, err := ts.InviteOrganizationMember(acme, &models.InviteMemberInput{Email: alice.Email, Role: models.RoleUser})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event := ts.lastEvent(t, acme, models.AuditInvitationCreate); *event.TargetID != invitation.ID || event.After["user_id"] != alice.ID {
+			t.Errorf("invitation event = %+v", event)
+		}
+
+		// Accepting is recorded in the organization, though alice acts outside it
+		if _, err := ts.AcceptInvitation(asActor(ctx, alice.ID), alice.ID, invitation.ID); err != nil {
+			t.Fatal(err)
+		}
+		event := ts.lastEvent(t, acme, models.AuditMemberAdd)
+		if *event.TargetID != alice.ID || event.After["role"] != models.RoleUser || event.OrganizationID == nil || *event.ActorID != alice.ID {
+			t.Errorf("member add event = %+v", event)
+		}
+
+		// A role change in an organization is one of the membership
+		ts.createRole(t, "manager", models.PermissionUsersRead)
+		if _, err := ts.UpdateUser(acme, alice.ID, &models.UpdateUserInput{Role: "manager"}); err != nil {
+			t.Fatal(err)
+		}
+		event = ts.lastEvent(t, acme, models.AuditUserUpdate)
+		if event.Before["role"] != models.RoleUser || event.After["role"] != "manager" || event.OrganizationID == nil {
+			t.Errorf("member role event = %+v", event)
+		}
+
+		if err := ts.RemoveOrganizationMember(acme, alice.ID); err != nil {
+			t.Fatal(err)
+		}
+		if event := ts.lastEvent(t, acme, models.AuditMemberRemove); event.Before["role"] != "manager" {
+			t.Errorf("member remove event = %+v", event)
+		}
+
+		cancelled, err := ts.InviteOrganizationMember(acme, &models.InviteMemberInput{Email: alice.Email, Role: models.RoleUser})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ts.CancelInvitation(acme, cancelled.ID); err != nil {
+			t.Fatal(err)
+		}
+		if event := ts.lastEvent(t, acme, models.AuditInvitationCancel); *event.TargetID != cancelled.ID {
+			t.Errorf("cancel event = %+v", event)
+		}
+
+		declined, err := ts.InviteOrganizationMember(acme, &models.InviteMemberInput{Email: alice.Email, Role: models.RoleUser})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ts.DeclineInvitation(ctx, alice.ID, declined.ID); err != nil {
+			t.Fatal(err)
+		}
+		if event := ts.lastEvent(t, acme, models.AuditInvitationDecline); *event.TargetID != declined.ID {
+			t.Errorf("decline event = %+v", event)
+		}
+	})
+
+	t.Run("security", func(t *testing.T) {
+		ts.enableMFA(t, alice.ID)
+		if err := ts.ResetMFA(actx, alice.ID); err != nil {
+			t.Fatal(err)
+		}
+		if event := ts.lastEvent(t, ctx, models.AuditUserMFAReset); *event.TargetID != alice.ID || *event.ActorID != 1 {
+			t.Errorf("mfa reset event = %+v", event)
+		}
+
+		if err := ts.UnlockUser(actx, alice.ID); err != nil {
+			t.Fatal(err)
+		}
+		if event := ts.lastEvent(t, ctx, models.AuditUserUnlock); *event.TargetID != alice.ID {
+			t.Errorf("unlock event = %+v", event)
+		}
+	})
+
+	t.Run("api keys", func(t *testing.T) {
+		if _, err := ts.CreateAPIKey(asActor(ctx, alice.ID), alice.ID, false, &models.CreateAPIKeyInput{
+			Name: "ci", Scopes: []string{models.APIKeyScopeRead},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		event := ts.lastEvent(t, ctx, models.AuditAPIKeyCreate)
+		if event.TargetType != models.AuditTargetAPIKey || event.After["name"] != "ci" || event.After["scopes"] != models.APIKeyScopeRead {
+			t.Errorf("create event = %+v", event)
+		}
+		if _, ok := event.After["key_hash"]; ok {
+			t.Errorf("create event records the key hash: %v", event.After)
+		}
+
+		if err := ts.RevokeAPIKey(ctx, alice.ID, *event.TargetID); err != nil {
+			t.Fatal(err)
+		}
+		if event := ts.lastEvent(t, ctx, models.AuditAPIKeyRevoke); event.Before["name"] != "ci" {
+			t.Errorf("revoke event = %+v", event)
+		}
+	})
+}
+
+func TestAuditedPasswordsAreRedacted(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+	alice := ts.createUser(t, "alice", models.RoleUser)
+
+	if _, err := ts.UpdateUser(ctx, alice.ID, &models.UpdateUserInput{Password: "another password"}); err != nil {
+		t.Fatal(err)
+	}
+
+	event := ts.lastEvent(t, ctx, models.AuditUserUpdate)
+	if event.Before["password"] != audit.Redacted || event.After["password"] != audit.Redacted {
+		t.Errorf("password change = %v -> %v, want it redacted", event.Before, event.After)
+	}
+	if created := ts.lastEvent(t, ctx, models.AuditUserCreate); created.After["password"] != audit.Redacted {
+		t.Errorf("created user = %v, want the password redacted", created.After)
+	}
+}
@@ -4,38 +4,412 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"go-backend-starter/internal/metrics"
 	"go-backend-starter/internal/models"
 	"go-backend-starter/internal/utils"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
 )
 
-// Login authenticates a user and returns a JWT token
-func (s *Service) Login(ctx context.Context, input *models.LoginInput) (string, error) {
+// ErrRefreshTokenReused is returned when an already rotated refresh token is
+// presented again. The whole token family is revoked when this happens.
+var ErrRefreshTokenReused = &Error{Kind: ErrUnauthorized, Message: "invalid refresh token", Err: errors.New("refresh token reuse detected")}
+
+// Login authenticates a user with username and password. It returns an
+// access token and a refresh token, or an MFA challenge when the user has a
+// second factor that must be checked with LoginMFA. Repeated failures for
+// the username or the client IP lock further attempts out for a while.
+func (s *Service) Login(ctx context.Context, input *models.LoginInput, ip string) (*models.AuthTokens, *models.MFAChallengeResponse, error) {
+	if err := s.chargeLoginAttempt(ctx, input.Username, ip); err != nil {
+		if errors.Is(err, ErrTooManyRequests) {
+			metrics.Logins.WithLabelValues(metrics.LoginLocked).Inc()
+		}
+		return nil, nil, err
+	}
+
 	user, err := s.repo.GetUserByUsername(ctx, input.Username)
 	if err != nil {
-		return "", fmt.Errorf("failed to get user: %w", err)
+		return nil, nil, fmt.Errorf("failed to get user: %w", err)
 	}
-	if user == nil {
-		return "", errors.New("invalid username or password")
+
+	valid := false
+	if user != nil {
+		valid, err = s.hasher.Verify(input.Password, user.PasswordHash)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to verify password: %w", err)
+		}
+	} else if err := s.verifyDummyPassword(input.Password); err != nil {
+		return nil, nil, err
+	}
+
+	// Unknown usernames count as failures too, so lockouts do not reveal which accounts exist
+	if !valid {
+		metrics.Logins.WithLabelValues(metrics.LoginFailure).Inc()
+		if err := s.loginFailed(ctx, ip); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, Unauthorized("invalid username or password")
+	}
+
+	if err := s.forgiveLoginAttempt(ctx, ip); err != nil {
+		return nil, nil, err
+	}
+	// With a second factor the login is only complete once LoginMFA passes
+	// it, so the account keeps its count of failures until then
+	if user.MFAEnabledAt != nil {
+		err = s.repo.ForgiveLoginFailure(ctx, models.LoginScopeUser, input.Username)
+	} else {
+		err = s.clearLoginFailures(ctx, input.Username)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Upgrade the stored hash while the plain password is at hand. A failure
+	// is harmless: the old hash keeps working and the next login tries again.
+	if s.hasher.NeedsRehash(user.PasswordHash) {
+		if err := s.rehashPassword(ctx, user.ID, input.Password); err != nil {
+			log.Warn().Err(err).Int("user_id", user.ID).Msg("Failed to upgrade password hash")
+		}
+	}
+
+	if s.auth.RequireEmailVerification && user.EmailVerifiedAt == nil {
+		return nil, nil, Forbidden("email address has not been verified")
 	}
 
-	if !utils.CheckPasswordHash(input.Password, user.PasswordHash) {
-		return "", errors.New("invalid username or password")
+	if user.MFAEnabledAt != nil {
+		challenge, err := s.createMFAChallenge(ctx, user)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, challenge, nil
 	}
 
-	token, err := utils.GenerateJWT(user.ID, user.Username, user.Role, s.jwtSecret, s.jwtExpiration)
+	tokens, err := s.startSession(ctx, user, false)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate token: %w", err)
+		return nil, nil, err
 	}
+	metrics.Logins.WithLabelValues(metrics.LoginSuccess).Inc()
 
-	return token, nil
+	return tokens, nil, nil
 }
 
-// ValidateToken validates a JWT token and returns the claims
-func (s *Service) ValidateToken(tokenString string) (*utils.JWTClaims, error) {
-	claims, err := utils.ValidateJWT(tokenString, s.jwtSecret)
+// startSession issues tokens in a new refresh token family. mfa tells
+// whether the login passed a second factor.
+func (s *Service) startSession(ctx context.Context, user *models.User, mfa bool) (*models.AuthTokens, error) {
+	// Every login starts a new refresh token family
+	familyID, err := utils.GenerateRandomToken(16)
 	if err != nil {
-		return nil, fmt.Errorf("failed to validate token: %w", err)
+		return nil, fmt.Errorf("failed to generate token family: %w", err)
+	}
+
+	return s.issueTokens(ctx, user, familyID, mfa)
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh
+// token. Each refresh token can be used once; replaying a used token revokes
+// every token in its family.
+func (s *Service) Refresh(ctx context.Context, refreshToken string) (*models.AuthTokens, error) {
+	stored, err := s.repo.GetRefreshTokenByHash(ctx, utils.HashToken(refreshToken))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	if stored == nil {
+		return nil, Unauthorized("invalid refresh token")
+	}
+
+	if stored.RevokedAt != nil {
+		return nil, Unauthorized("refresh token revoked")
+	}
+
+	if stored.RotatedAt != nil {
+		if err := s.repo.RevokeRefreshTokenFamily(ctx, stored.FamilyID); err != nil {
+			return nil, fmt.Errorf("failed to revoke refresh token family: %w", err)
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, Unauthorized("refresh token expired")
+	}
+
+	rotated, err := s.repo.MarkRefreshTokenRotated(ctx, stored.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	if !rotated {
+		// Lost a race against another exchange of the same token
+		if err := s.repo.RevokeRefreshTokenFamily(ctx, stored.FamilyID); err != nil {
+			return nil, fmt.Errorf("failed to revoke refresh token family: %w", err)
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	// Reload the user so role changes are reflected in the new access token
+	user, err := s.repo.GetUserByID(ctx, stored.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, Unauthorized("invalid refresh token")
+	}
+
+	// The second factor the login passed no longer counts once MFA is reset
+	return s.issueTokens(ctx, user, stored.FamilyID, stored.MFA && user.MFAEnabledAt != nil)
+}
+
+// ValidateToken validates a JWT token and returns the claims. Tokens that were
+// revoked individually, or issued before their user's tokens were revoked,
+// are rejected.
+func (s *Service) ValidateToken(ctx context.Context, tokenString string) (*utils.JWTClaims, error) {
+	claims, err := utils.ValidateJWT(tokenString, s.jwtKeys)
+	if err != nil {
+		return nil, &Error{Kind: ErrUnauthorized, Message: "invalid or expired token", Err: err}
+	}
+
+	if claims.ID == "" || claims.ExpiresAt == nil || claims.IssuedAt == nil {
+		return nil, Unauthorized("token is missing required claims")
+	}
+
+	revoked, err := s.isTokenRevoked(ctx, claims.ID, claims.ExpiresAt.Time)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, Unauthorized("token has been revoked")
+	}
+
+	before, err := s.userTokensRevokedBefore(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if before != nil && claims.IssuedAt.Time.Before(*before) {
+		return nil, Unauthorized("token has been revoked")
 	}
 
 	return claims, nil
 }
+
+// Logout revokes the access token described by claims and, when given, the
+// refresh token family it was issued with
+func (s *Service) Logout(ctx context.Context, claims *utils.JWTClaims, refreshToken string) error {
+	// Housekeeping: entries for expired tokens are no longer needed
+	if err := s.repo.DeleteExpiredRevokedTokens(ctx); err != nil {
+		return fmt.Errorf("failed to purge revoked tokens: %w", err)
+	}
+
+	if err := s.repo.RevokeToken(ctx, claims.ID, claims.UserID, claims.ExpiresAt.Time); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	s.revocations.setToken(claims.ID, true, claims.ExpiresAt.Time)
+
+	if refreshToken != "" {
+		stored, err := s.repo.GetRefreshTokenByHash(ctx, utils.HashToken(refreshToken))
+		if err != nil {
+			return fmt.Errorf("failed to get refresh token: %w", err)
+		}
+		// Ignore refresh tokens that belong to someone else
+		if stored != nil && stored.UserID == claims.UserID {
+			if err := s.repo.RevokeRefreshTokenFamily(ctx, stored.FamilyID); err != nil {
+				return fmt.Errorf("failed to revoke refresh token family: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// RevokeUserTokens invalidates every access and refresh token issued to a
+// user so far and deletes their API keys
+func (s *Service) RevokeUserTokens(ctx context.Context, userID int) error {
+	before, err := s.revokeUserTokens(ctx, userID)
+	if err != nil {
+		return err
+	}
+	s.revocations.setUser(userID, &before)
+
+	return nil
+}
+
+// revokeUserTokens makes the repository changes of RevokeUserTokens and
+// returns the token cut-off. It does not touch the revocation cache, so it
+// can be part of a unit of work; the caller caches the cut-off once the unit
+// of work has committed.
+func (s *Service) revokeUserTokens(ctx context.Context, userID int) (time.Time, error) {
+	// Token iat claims have second precision, so this also catches tokens
+	// issued earlier in the same second; see tokenIssuedAt for those issued
+	// later in it
+	before := time.Now()
+	if err := s.repo.RevokeUserTokens(ctx, userID, before); err != nil {
+		return time.Time{}, fmt.Errorf("failed to revoke user tokens: %w", err)
+	}
+
+	if err := s.repo.RevokeUserRefreshTokens(ctx, userID); err != nil {
+		return time.Time{}, fmt.Errorf("failed to revoke user refresh tokens: %w", err)
+	}
+
+	if err := s.repo.DeleteUserAPIKeys(ctx, userID); err != nil {
+		return time.Time{}, err
+	}
+
+	return before, nil
+}
+
+// tokenIssuedAt returns the issue time of a new token for a user. A token
+// issued in the second of a revocation would carry an iat claim before the
+// cut-off and be rejected by it, so it waits for the next second instead.
+func (s *Service) tokenIssuedAt(ctx context.Context, userID int) (time.Time, error) {
+	before, err := s.userTokensRevokedBefore(ctx, userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	now := time.Now()
+	if before == nil || !now.Truncate(time.Second).Before(*before) {
+		return now, nil
+	}
+
+	// The first whole second at or after the cut-off
+	next := before.Add(time.Second - 1).Truncate(time.Second)
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return time.Now(), nil
+	case <-ctx.Done():
+		return time.Time{}, ctx.Err()
+	}
+}
+
+// isTokenRevoked checks the revocation list, consulting the cache first
+func (s *Service) isTokenRevoked(ctx context.Context, jti string, expiresAt time.Time) (bool, error) {
+	if revoked, ok := s.revocations.token(jti); ok {
+		return revoked, nil
+	}
+
+	revoked, err := s.repo.IsTokenRevoked(ctx, jti)
+	if err != nil {
+		return false, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	s.revocations.setToken(jti, revoked, expiresAt)
+
+	return revoked, nil
+}
+
+// userTokensRevokedBefore returns a user's token cut-off time, consulting the cache first
+func (s *Service) userTokensRevokedBefore(ctx context.Context, userID int) (*time.Time, error) {
+	if before, ok := s.revocations.user(userID); ok {
+		return before, nil
+	}
+
+	before, err := s.repo.GetUserTokensRevokedBefore(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check user token revocation: %w", err)
+	}
+	s.revocations.setUser(userID, before)
+
+	return before, nil
+}
+
+// JWKS returns the public keys that verify access tokens
+func (s *Service) JWKS() utils.JWKS {
+	return s.jwtKeys.JWKS()
+}
+
+// issueTokens creates an access token and a refresh token in the given
+// family. The access token claims mfa only when the session passed a second
+// factor, which is remembered with the refresh token.
+func (s *Service) issueTokens(ctx context.Context, user *models.User, familyID string, mfa bool) (*models.AuthTokens, error) {
+	amr := []string{"pwd"}
+	if mfa {
+		amr = append(amr, "mfa")
+	}
+
+	orgID, err := s.defaultOrganizationID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	issuedAt, err := s.tokenIssuedAt(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := utils.GenerateJWTIssuedAt(utils.JWTClaims{
+		UserID:   user.ID,
+		Username: user.Username,
+		Role:     user.Role,
+		OrgID:    orgID,
+		AMR:      amr,
+	}, s.jwtKeys, s.jwtExpiration, issuedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	refreshToken, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	_, err = s.repo.CreateRefreshToken(ctx, &models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: utils.HashToken(refreshToken),
+		ExpiresAt: time.Now().Add(time.Duration(s.refreshExpiration) * time.Minute),
+		MFA:       mfa,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return &models.AuthTokens{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    s.jwtExpiration * 60,
+	}, nil
+}
+
+// rehashPassword stores a new hash of a user's password, made with the
+// configured algorithm and parameters
+func (s *Service) rehashPassword(ctx context.Context, userID int, password string) error {
+	passwordHash, err := s.hasher.Hash(password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	if err := s.repo.UpdateUserPasswordHash(ctx, userID, passwordHash); err != nil {
+		return fmt.Errorf("failed to update password hash: %w", err)
+	}
+	return nil
+}
+
+// dummyPassword is a hash of a random password, made with the configured
+// algorithm once it is first needed
+type dummyPassword struct {
+	once sync.Once
+	hash string
+	err  error
+}
+
+// verifyDummyPassword verifies a password against the dummy hash, so that
+// logins with unknown usernames take as long as those with wrong passwords
+// and response times do not reveal which accounts exist
+func (s *Service) verifyDummyPassword(password string) error {
+	s.dummyPassword.once.Do(func() {
+		secret, err := utils.GenerateRandomToken(16)
+		if err != nil {
+			s.dummyPassword.err = err
+			return
+		}
+		s.dummyPassword.hash, s.dummyPassword.err = s.hasher.Hash(secret)
+	})
+	if s.dummyPassword.err != nil {
+		return fmt.Errorf("failed to hash dummy password: %w", s.dummyPassword.err)
+	}
+
+	if _, err := s.hasher.Verify(password, s.dummyPassword.hash); err != nil {
+		return fmt.Errorf("failed to verify password: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/utils"
+)
+
+// countingHasher counts the passwords it verifies
+type countingHasher struct {
+	utils.PasswordHasher
+	verified int
+}
+
+func (h *countingHasher) Verify(password, encoded string) (bool, error) {
+	h.verified++
+	return h.PasswordHasher.Verify(password, encoded)
+}
+
+func TestLogin(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("verifies a password for unknown users too", func(t *testing.T) {
+		ts := newTestService(t)
+		hasher := &countingHasher{PasswordHasher: ts.hasher}
+		ts.hasher = hasher
+
+		_, _, err := ts.Login(ctx, &models.LoginInput{Username: "nobody", Password: testPassword}, "192.0.2.1")
+		expectKind(t, err, ErrUnauthorized)
+		if hasher.verified != 1 {
+			t.Errorf("verified %d passwords, want 1", hasher.verified)
+		}
+	})
+
+	t.Run("upgrades outdated hashes", func(t *testing.T) {
+		ts := newTestService(t)
+		ts.hasher = &utils.Argon2idHasher{Memory: 1024, Time: 1, Parallelism: 1}
+
+		ts.login(t, "admin")
+		user, err := ts.repo.GetUserByID(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ts.hasher.NeedsRehash(user.PasswordHash) {
+			t.Errorf("stored hash %q was not upgraded", user.PasswordHash)
+		}
+		ts.login(t, "admin")
+	})
+}
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("rotates the refresh token", func(t *testing.T) {
+		ts := newTestService(t)
+		first := ts.login(t, "admin")
+
+		second, err := ts.Refresh(ctx, first.RefreshToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if second.RefreshToken == first.RefreshToken || second.Token == first.Token {
+			t.Error("refresh returned the same tokens")
+		}
+		if _, err := ts.ValidateToken(ctx, second.Token); err != nil {
+			t.Errorf("new access token: %v", err)
+		}
+
+		third, err := ts.Refresh(ctx, second.RefreshToken)
+		if err != nil {
+			t.Fatalf("refresh with the rotated token: %v", err)
+		}
+		if third.RefreshToken == second.RefreshToken {
+			t.Error("refresh returned the same refresh token")
+		}
+	})
+
+	t.Run("reuse revokes the family", func(t *testing.T) {
+		ts := newTestService(t)
+		first := ts.login(t, "admin")
+		other := ts.login(t, "admin")
+
+		second, err := ts.Refresh(ctx, first.RefreshToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = ts.Refresh(ctx, first.RefreshToken)
+		if !errors.Is(err, ErrRefreshTokenReused) {
+			t.Fatalf("replay: error = %v, want ErrRefreshTokenReused", err)
+		}
+		expectKind(t, err, ErrUnauthorized)
+
+		// The token rotated in before the replay went with its family
+		_, err = ts.Refresh(ctx, second.RefreshToken)
+		expectKind(t, err, ErrUnauthorized)
+
+		// Other logins have families of their own
+		if _, err := ts.Refresh(ctx, other.RefreshToken); err != nil {
+			t.Errorf("refresh of another login: %v", err)
+		}
+	})
+
+	t.Run("rejects unknown, expired and revoked tokens", func(t *testing.T) {
+		ts := newTestService(t)
+
+		_, err := ts.Refresh(ctx, "unknown")
+		expectKind(t, err, ErrUnauthorized)
+
+		expired, err := utils.GenerateRandomToken(32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ts.repo.CreateRefreshToken(ctx, &models.RefreshToken{
+			UserID:    1,
+			FamilyID:  "expired",
+			TokenHash: utils.HashToken(expired),
+			ExpiresAt: time.Now().Add(-time.Minute),
+		}); err != nil {
+			t.Fatal(err)
+		}
+		_, err = ts.Refresh(ctx, expired)
+		expectKind(t, err, ErrUnauthorized)
+
+		tokens := ts.login(t, "admin")
+		claims, err := ts.ValidateToken(ctx, tokens.Token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ts.Logout(ctx, claims, tokens.RefreshToken); err != nil {
+			t.Fatal(err)
+		}
+		_, err = ts.Refresh(ctx, tokens.RefreshToken)
+		expectKind(t, err, ErrUnauthorized)
+	})
+
+	t.Run("picks up role changes", func(t *testing.T) {
+		ts := newTestService(t)
+		ts.createUser(t, "alice", models.RoleUser)
+		tokens := ts.login(t, "alice")
+
+		if _, err := ts.repo.UpdateUser(ctx, 2, &models.UpdateUserInput{Role: models.RoleAdmin}); err != nil {
+			t.Fatal(err)
+		}
+
+		refreshed, err := ts.Refresh(ctx, tokens.RefreshToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := ts.ValidateToken(ctx, refreshed.Token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claims.Role != models.RoleAdmin {
+			t.Errorf("role = %q, want %q", claims.Role, models.RoleAdmin)
+		}
+	})
+
+	t.Run("fails for deleted users", func(t *testing.T) {
+		ts := newTestService(t)
+		user := ts.createUser(t, "bob", models.RoleUser)
+		tokens := ts.login(t, "bob")
+
+		if _, err := ts.repo.DeleteUser(ctx, user.ID); err != nil {
+			t.Fatal(err)
+		}
+		_, err := ts.Refresh(ctx, tokens.RefreshToken)
+		expectKind(t, err, ErrUnauthorized)
+	})
+}
+
+func TestLogout(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+	tokens := ts.login(t, "admin")
+	other := ts.login(t, "admin")
+
+	claims, err := ts.ValidateToken(ctx, tokens.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.Logout(ctx, claims, tokens.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ts.ValidateToken(ctx, tokens.Token)
+	expectKind(t, err, ErrUnauthorized)
+	_, err = ts.Refresh(ctx, tokens.RefreshToken)
+	expectKind(t, err, ErrUnauthorized)
+
+	// Only the session that logged out ends
+	if _, err := ts.ValidateToken(ctx, other.Token); err != nil {
+		t.Errorf("token of another session: %v", err)
+	}
+
+	// Other replicas go by the database
+	_, err = ts.replica().ValidateToken(ctx, tokens.Token)
+	expectKind(t, err, ErrUnauthorized)
+}
+
+func TestRevokeUserTokens(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+	user := ts.createUser(t, "alice", models.RoleUser)
+	admin := ts.login(t, "admin")
+
+	// Tokens issued in the same second as the revocation are revoked too
+	before := ts.login(t, "alice")
+	if err := ts.RevokeUserTokens(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := ts.ValidateToken(ctx, before.Token)
+	expectKind(t, err, ErrUnauthorized)
+	_, err = ts.Refresh(ctx, before.RefreshToken)
+	expectKind(t, err, ErrUnauthorized)
+
+	replica := ts.replica()
+	_, err = replica.ValidateToken(ctx, before.Token)
+	expectKind(t, err, ErrUnauthorized)
+
+	// Logging in again right away works, with a token that was not issued
+	// in the future, as some verifiers would reject it
+	after := ts.login(t, "alice")
+	for _, s := range []*Service{ts.Service, replica} {
+		claims, err := s.ValidateToken(ctx, after.Token)
+		if err != nil {
+			t.Errorf("token issued after the revocation: %v", err)
+		} else if claims.IssuedAt.Time.After(time.Now()) {
+			t.Errorf("token issued at %v, in the future", claims.IssuedAt.Time)
+		}
+	}
+	if _, err := ts.Refresh(ctx, after.RefreshToken); err != nil {
+		t.Errorf("refresh after the revocation: %v", err)
+	}
+
+	// Other users are not affected
+	if _, err := ts.ValidateToken(ctx, admin.Token); err != nil {
+		t.Errorf("admin token: %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"go-backend-starter/internal/repository"
+)
+
+// Error kinds. Use errors.Is to check which kind an error is, e.g.
+// errors.Is(err, service.ErrNotFound).
+var (
+	ErrNotFound        = errors.New("not found")
+	ErrConflict        = errors.New("conflict")
+	ErrValidation      = errors.New("validation failed")
+	ErrUnauthorized    = errors.New("unauthorized")
+	ErrForbidden       = errors.New("forbidden")
+	ErrTooManyRequests = errors.New("too many requests")
+)
+
+// Error is a domain error. Message is safe to return to clients; Err holds
+// the underlying cause, which is only meant for logs.
+type Error struct {
+	Kind    error
+	Message string
+	Err     error
+
+	// RetryAfter tells the client how long to wait before trying again
+	RetryAfter time.Duration
+
+	// Fields lists the input fields that broke a business rule
+	Fields []FieldError
+}
+
+// FieldError describes why a single input field was rejected
+type FieldError struct {
+	Field   string
+	Rule    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap exposes both the kind and the cause to errors.Is and errors.As
+func (e *Error) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Kind}
+}
+
+// NotFound creates an error for a missing resource
+func NotFound(message string) error {
+	return &Error{Kind: ErrNotFound, Message: message}
+}
+
+// Conflict creates an error for a write that clashes with existing state
+func Conflict(message string) error {
+	return &Error{Kind: ErrConflict, Message: message}
+}
+
+// Validation creates an error for input that breaks a business rule
+func Validation(message string) error {
+	return &Error{Kind: ErrValidation, Message: message}
+}
+
+// InvalidFields creates a validation error listing the offending fields
+func InvalidFields(message string, fields ...FieldError) error {
+	return &Error{Kind: ErrValidation, Message: message, Fields: fields}
+}
+
+// Unauthorized creates an error for missing or invalid credentials
+func Unauthorized(message string) error {
+	return &Error{Kind: ErrUnauthorized, Message: message}
+}
+
+// Forbidden creates an error for an authenticated caller lacking access
+func Forbidden(message string) error {
+	return &Error{Kind: ErrForbidden, Message: message}
+}
+
+// TooManyRequests creates an error for a caller that has to back off
+func TooManyRequests(message string, retryAfter time.Duration) error {
+	return &Error{Kind: ErrTooManyRequests, Message: message, RetryAfter: retryAfter}
+}
+
+// translateRepoError maps repository errors onto the domain error taxonomy
+func translateRepoError(err error) error {
+	var dup *repository.DuplicateError
+	if errors.As(err, &dup) {
+		switch dup.Constraint {
+		case "users_username_key":
+			return &Error{Kind: ErrConflict, Message: "username already exists", Err: err}
+		case "users_email_key":
+			return &Error{Kind: ErrConflict, Message: "email already exists", Err: err}
+		case "roles_pkey":
+			return &Error{Kind: ErrConflict, Message: "role already exists", Err: err}
+		case "organizations_slug_key":
+			return &Error{Kind: ErrConflict, Message: "organization slug already exists", Err: err}
+		case "organization_members_pkey":
+			return &Error{Kind: ErrConflict, Message: "user is already a member of the organization", Err: err}
+		default:
+			return &Error{Kind: ErrConflict, Message: "resource already exists", Err: err}
+		}
+	}
+
+	var ref *repository.ReferenceError
+	if errors.As(err, &ref) {
+		switch ref.Constraint {
+		case "users_role_fkey", "organization_members_role_fkey", "organization_invitations_role_fkey":
+			// Either a user was given a role that does not exist, or a
+			// role that users still have was deleted
+			return &Error{Kind: ErrConflict, Message: "role does not exist or is still assigned to users", Err: err}
+		case "role_permissions_permission_fkey":
+			return &Error{Kind: ErrValidation, Message: "unknown permission", Err: err}
+		default:
+			return &Error{Kind: ErrConflict, Message: "resource is still referenced", Err: err}
+		}
+	}
+	return err
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"go-backend-starter/internal/repository"
+)
+
+func TestErrorUnwrap(t *testing.T) {
+	cause := errors.New("connection reset")
+	err := fmt.Errorf("create user: %w", &Error{Kind: ErrConflict, Message: "username already exists", Err: cause})
+
+	if !errors.Is(err, ErrConflict) || !errors.Is(err, cause) {
+		t.Errorf("errors.Is does not see both the kind and the cause of %v", err)
+	}
+	if errors.Is(err, ErrNotFound) {
+		t.Error("conflict is also not found")
+	}
+
+	var domainErr *Error
+	if !errors.As(err, &domainErr) || domainErr.Message != "username already exists" {
+		t.Errorf("errors.As = %+v", domainErr)
+	}
+	if got, want := domainErr.Error(), "username already exists: connection reset"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestTranslateRepoError(t *testing.T) {
+	for _, tt := range []struct {
+		err     error
+		kind    error
+		message string
+	}{
+		{&repository.DuplicateError{Constraint: "users_username_key"}, ErrConflict, "username already exists"},
+		{&repository.DuplicateError{Constraint: "users_email_key"}, ErrConflict, "email already exists"},
+		{&repository.DuplicateError{Constraint: "other"}, ErrConflict, "resource already exists"},
+		{&repository.ReferenceError{Constraint: "users_role_fkey"}, ErrConflict, "role does not exist or is still assigned to users"},
+		{&repository.ReferenceError{Constraint: "role_permissions_permission_fkey"}, ErrValidation, "unknown permission"},
+		{&repository.ReferenceError{Constraint: "other"}, ErrConflict, "resource is still referenced"},
+	} {
+		err := translateRepoError(fmt.Errorf("wrapped: %w", tt.err))
+
+		var domainErr *Error
+		if !errors.As(err, &domainErr) || !errors.Is(err, tt.kind) || domainErr.Message != tt.message {
+			t.Errorf("translateRepoError(%v) = %v, want %v %q", tt.err, err, tt.kind, tt.message)
+		}
+	}
+
+	// Anything else passes through untouched
+	other := errors.New("boom")
+	if err := translateRepoError(other); err != other {
+		t.Errorf("translateRepoError(%v) = %v", other, err)
+	}
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/tenant"
+	"go-backend-starter/internal/utils"
+)
+
+// Impersonate issues a short-lived access token for acting as another user.
+// The token names the actor in its act claim, cannot be refreshed and is
+// bound to the organization the actor impersonated from.
+func (s *Service) Impersonate(ctx context.Context, actor *utils.JWTClaims, targetID int) (*models.ImpersonationToken, error) {
+	if actor.Act != nil {
+		return nil, Forbidden("cannot impersonate while impersonating")
+	}
+	if targetID == actor.UserID {
+		return nil, Validation("cannot impersonate yourself")
+	}
+
+	// Inside an organization the role here is the target's role in it
+	target, err := s.GetUserByID(ctx, targetID)
+	if err != nil {
+		return nil, err
+	}
+	global, err := s.repo.GetUserByID(tenant.WithOrganization(ctx, 0), targetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	// Admins, and anyone who could impersonate in turn, are off limits
+	for _, role := range []string{target.Role, global.Role} {
+		privileged, err := s.isPrivilegedRole(ctx, role)
+		if err != nil {
+			return nil, err
+		}
+		if privileged {
+			return nil, Forbidden("admins cannot be impersonated")
+		}
+	}
+
+	orgID, ok := tenant.OrganizationID(ctx)
+	if !ok {
+		if orgID, err = s.defaultOrganizationID(ctx, target.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	// The token must not let the actor do more than they can themselves, with
+	// the role the target has in the organization the token acts in
+	roles := []string{global.Role}
+	if orgID != 0 {
+		member, err := s.GetMembership(ctx, orgID, target.ID)
+		if err != nil {
+			return nil, err
+		}
+		if member != nil {
+			roles = append(roles, member.Role)
+		}
+	}
+	if err := s.checkImpersonatable(ctx, actor.UserID, roles); err != nil {
+		return nil, err
+	}
+
+	issuedAt, err := s.tokenIssuedAt(ctx, target.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The actor authenticated, so their authentication methods carry over
+	token, err := utils.GenerateJWTIssuedAt(utils.JWTClaims{
+		UserID:   target.ID,
+		Username: target.Username,
+		Role:     global.Role,
+		OrgID:    orgID,
+		AMR:      actor.AMR,
+		Act:      &utils.Actor{UserID: actor.UserID, Username: actor.Username},
+	}, s.jwtKeys, s.auth.ImpersonationExpiration, issuedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	// Record the start in the organization the token acts in
+	if err := s.repo.CreateAuditEvent(tenant.WithOrganization(ctx, orgID), &models.AuditEvent{
+		Action:     models.AuditUserImpersonate,
+		TargetType: models.AuditTargetUser,
+		TargetID:   &target.ID,
+	}); err != nil {
+		return nil, err
+	}
+
+	return &models.ImpersonationToken{
+		Token:     token,
+		ExpiresIn: s.auth.ImpersonationExpiration * 60,
+	}, nil
+}
+
+// EndImpersonation revokes the impersonation token described by claims
+func (s *Service) EndImpersonation(ctx context.Context, claims *utils.JWTClaims) error {
+	if claims.Act == nil {
+		return Validation("not impersonating")
+	}
+	return s.Logout(ctx, claims, "")
+}
+
+// isPrivilegedRole reports whether a role is admin or may impersonate
+func (s *Service) isPrivilegedRole(ctx context.Context, role string) (bool, error) {
+	if role == models.RoleAdmin {
+		return true, nil
+	}
+	permissions, err := s.RolePermissions(ctx, role)
+	if err != nil {
+		return false, err
+	}
+	return permissions.Has(models.PermissionUsersImpersonate), nil
+}
+
+// checkImpersonatable rejects impersonating a user whose roles have a
+// permission the actor lacks in the organization the request acts in
+func (s *Service) checkImpersonatable(ctx context.Context, actorID int, roles []string) error {
+	actor, err := s.repo.GetUserByID(ctx, actorID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if actor == nil {
+		return Forbidden("you cannot impersonate users")
+	}
+	held, err := s.RolePermissions(ctx, actor.Role)
+	if err != nil {
+		return err
+	}
+
+	for _, role := range roles {
+		permissions, err := s.RolePermissions(ctx, role)
+		if err != nil {
+			return err
+		}
+		for permission := range permissions {
+			if !held.Has(permission) {
+				return Forbidden(fmt.Sprintf("the user has the %s permission, which you do not have", permission))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/tenant"
+	"go-backend-starter/internal/utils"
+)
+
+// claimsOf returns the claims of a session of a user
+func claimsOf(user *models.User) *utils.JWTClaims {
+	return &utils.JWTClaims{UserID: user.ID, Username: user.Username, Role: user.Role, AMR: []string{"pwd"}}
+}
+
+func TestImpersonate(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+	ts.createRole(t, "support", models.PermissionUsersRead, models.PermissionUsersImpersonate)
+	sam := ts.createUser(t, "sam", "support")
+	alice := ts.createUser(t, "alice", models.RoleUser)
+
+	impersonation, err := ts.Impersonate(asActor(ctx, sam.ID), claimsOf(sam), alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := ts.ValidateToken(ctx, impersonation.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != alice.ID || claims.Act == nil || claims.Act.UserID != sam.ID || claims.OrgID != 0 {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	_, err = ts.Impersonate(ctx, claims, sam.ID)
+	expectKind(t, err, ErrForbidden)
+	_, err = ts.Impersonate(ctx, claimsOf(sam), sam.ID)
+	expectKind(t, err, ErrValidation)
+
+	if err := ts.EndImpersonation(ctx, claims); err != nil {
+		t.Fatal(err)
+	}
+	_, err = ts.ValidateToken(ctx, impersonation.Token)
+	expectKind(t, err, ErrUnauthorized)
+}
+
+func TestImpersonationIsLimitedToTheActorsPermissions(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+	ts.createRole(t, "support", models.PermissionUsersRead, models.PermissionUsersImpersonate)
+	ts.createRole(t, "helpdesk", models.PermissionUsersRead, models.PermissionUsersWrite)
+	sam := ts.createUser(t, "sam", "support")
+	impersonate := func(ctx context.Context, targetID int) error {
+		_, err := ts.Impersonate(asActor(ctx, sam.ID), claimsOf(sam), targetID)
+		return err
+	}
+
+	// Admins and other impersonators are off limits
+	expectKind(t, impersonate(ctx, 1), ErrForbidden)
+	expectKind(t, impersonate(ctx, ts.createUser(t, "simon", "support").ID), ErrForbidden)
+
+	// So is anyone with a permission the actor lacks
+	expectKind(t, impersonate(ctx, ts.createUser(t, "helen", "helpdesk").ID), ErrForbidden)
+
+	t.Run("role in the default organization of the target", func(t *testing.T) {
+		acme := ts.createOrganization(t, "acme")
+		alice := ts.createUser(t, "alice", models.RoleUser)
+		ts.join(t, acme, alice, "helpdesk")
+
+		// A token for alice would act in Acme, where alice can do more than sam
+		expectKind(t, impersonate(ctx, alice.ID), ErrForbidden)
+
+		// Acting from Acme, where sam can do as much, is allowed
+		ts.createRole(t, "acme-support", models.PermissionUsersRead, models.PermissionUsersWrite, models.PermissionUsersImpersonate)
+		ts.join(t, acme, sam, "acme-support")
+		impersonation, err := ts.Impersonate(asActor(acme, sam.ID), claimsOf(sam), alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := ts.ValidateToken(ctx, impersonation.Token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if orgID, _ := tenant.OrganizationID(acme); claims.OrgID != orgID {
+			t.Errorf("token acts in organization %d, want %d", claims.OrgID, orgID)
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go-backend-starter/internal/models"
+)
+
+// chargeLoginAttempt counts a login attempt against the username, unless it
+// is empty, and the client IP before the credentials are checked, and
+// rejects it while either is locked out. Counting and checking are one unit
+// of work, so concurrent attempts cannot all pass the check before any of
+// them is counted; attempts that are turned away are not counted. The
+// account is locked for its backoff delay up front, and a successful login
+// lifts the lock again.
+func (s *Service) chargeLoginAttempt(ctx context.Context, username, ip string) error {
+	window := time.Duration(s.auth.LockoutDuration) * time.Minute
+
+	return s.inTx(ctx, func(tx *Service) error {
+		if username != "" {
+			attempt, err := tx.repo.RecordLoginFailure(ctx, models.LoginScopeUser, username, window)
+			if err != nil {
+				return err
+			}
+			if err := checkLockout(attempt); err != nil {
+				return err
+			}
+			if delay := tx.loginDelay(attempt.Failures); delay > 0 {
+				if err := tx.repo.LockLogin(ctx, models.LoginScopeUser, username, time.Now().Add(delay)); err != nil {
+					return err
+				}
+			}
+		}
+
+		attempt, err := tx.repo.RecordLoginFailure(ctx, models.LoginScopeIP, ip, window)
+		if err != nil {
+			return err
+		}
+		if err := checkLockout(attempt); err != nil {
+			return err
+		}
+		// IPs are only locked once an attempt has failed, but no more
+		// attempts than the threshold allows may be under way
+		if tx.auth.IPLockoutThreshold > 0 && attempt.Failures > tx.auth.IPLockoutThreshold {
+			return TooManyRequests("too many failed login attempts, try again later", window)
+		}
+		return nil
+	})
+}
+
+// checkLockout rejects an attempt while its counter is locked
+func checkLockout(attempt *models.LoginAttempt) error {
+	if attempt.LockedUntil == nil {
+		return nil
+	}
+	if wait := time.Until(*attempt.LockedUntil); wait > 0 {
+		return TooManyRequests("too many failed login attempts, try again later", wait)
+	}
+	return nil
+}
+
+// loginFailed locks the client IP out once its failures reach the threshold.
+// The failure itself was already counted by chargeLoginAttempt. Accounts
+// back off exponentially from the second failure on; IPs, which may be shared
+// by many users, are only locked once they reach their threshold.
+func (s *Service) loginFailed(ctx context.Context, ip string) error {
+	if s.auth.IPLockoutThreshold <= 0 {
+		return nil
+	}
+
+	attempt, err := s.repo.GetLoginAttempt(ctx, models.LoginScopeIP, ip)
+	if err != nil {
+		return fmt.Errorf("failed to get login attempt: %w", err)
+	}
+	if attempt != nil && attempt.Failures >= s.auth.IPLockoutThreshold {
+		window := time.Duration(s.auth.LockoutDuration) * time.Minute
+		if err := s.repo.LockLogin(ctx, models.LoginScopeIP, ip, time.Now().Add(window)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loginDelay returns how long an account is locked after its nth consecutive failure
+func (s *Service) loginDelay(failures int) time.Duration {
+	lockout := time.Duration(s.auth.LockoutDuration) * time.Minute
+	if s.auth.LockoutThreshold > 0 && failures >= s.auth.LockoutThreshold {
+		return lockout
+	}
+	if s.auth.LoginBackoffBase <= 0 || failures < 2 {
+		return 0
+	}
+
+	delay := time.Duration(s.auth.LoginBackoffBase) * time.Second
+	for i := 2; i < failures && delay < lockout; i++ {
+		delay *= 2
+	}
+	return min(delay, lockout)
+}
+
+// forgiveLoginAttempt takes back the attempt charged against the client IP
+// once the credentials it checked turned out to be right
+func (s *Service) forgiveLoginAttempt(ctx context.Context, ip string) error {
+	return s.repo.ForgiveLoginFailure(ctx, models.LoginScopeIP, ip)
+}
+
+// clearLoginFailures resets the account counter, and with it any lockout,
+// after a completed login and drops counters that have expired
+func (s *Service) clearLoginFailures(ctx context.Context, username string) error {
+	if err := s.repo.ClearLoginFailures(ctx, models.LoginScopeUser, username); err != nil {
+		return err
+	}
+
+	// Housekeeping, like purging expired revocations on logout
+	return s.repo.DeleteStaleLoginAttempts(ctx, time.Duration(s.auth.LockoutDuration)*time.Minute)
+}
+
+// UnlockUser lifts a user's login lockout and resets their failure count
+func (s *Service) UnlockUser(ctx context.Context, id int) error {
+	return s.inTx(ctx, func(tx *Service) error {
+		user, err := tx.GetUserByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := tx.checkAccountOwned(ctx, id); err != nil {
+			return err
+		}
+
+		if err := tx.repo.ClearLoginFailures(ctx, models.LoginScopeUser, user.Username); err != nil {
+			return fmt.Errorf("failed to unlock user: %w", err)
+		}
+		return tx.recordEvent(ctx, models.AuditUserUnlock, models.AuditTargetUser, &id, nil, nil)
+	})
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"go-backend-starter/internal/config"
+	"go-backend-starter/internal/models"
+)
+
+// throttle configures the login throttle
+func throttle(backoffBase, ipThreshold int) func(cfg *config.Config) {
+	return func(cfg *config.Config) {
+		cfg.Auth.LoginBackoffBase = backoffBase
+		cfg.Auth.LockoutThreshold = 5
+		cfg.Auth.IPLockoutThreshold = ipThreshold
+	}
+}
+
+func TestLoginDelay(t *testing.T) {
+	ts := newTestService(t, throttle(1, 0))
+
+	for failures, want := range map[int]time.Duration{
+		1: 0,
+		2: time.Second,
+		3: 2 * time.Second,
+		4: 4 * time.Second,
+		5: 15 * time.Minute,
+	} {
+		if got := ts.loginDelay(failures); got != want {
+			t.Errorf("loginDelay(%d) = %v, want %v", failures, got, want)
+		}
+	}
+}
+
+func TestLoginBackoff(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t, throttle(60, 0))
+	user := ts.createUser(t, "alice", models.RoleUser)
+
+	wrong := &models.LoginInput{Username: "alice", Password: "wrong password"}
+	for i := 0; i < 2; i++ {
+		_, _, err := ts.Login(ctx, wrong, "192.0.2.1")
+		expectKind(t, err, ErrUnauthorized)
+	}
+
+	// The second failure locks the account, even for the right password and from another IP
+	_, _, err := ts.Login(ctx, &models.LoginInput{Username: "alice", Password: testPassword}, "192.0.2.2")
+	expectKind(t, err, ErrTooManyRequests)
+
+	if err := ts.UnlockUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	ts.login(t, "alice")
+
+	// A successful login resets the count
+	_, _, err = ts.Login(ctx, wrong, "192.0.2.1")
+	expectKind(t, err, ErrUnauthorized)
+	ts.login(t, "alice")
+}
+
+func TestIPLockout(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t, throttle(0, 3))
+	ts.createUser(t, "alice", models.RoleUser)
+
+	// Successful logins do not count against the IP
+	for i := 0; i < 5; i++ {
+		ts.login(t, "alice")
+	}
+
+	for i := 0; i < 3; i++ {
+		_, _, err := ts.Login(ctx, &models.LoginInput{Username: fmt.Sprintf("user%d", i), Password: "wrong password"}, "192.0.2.1")
+		expectKind(t, err, ErrUnauthorized)
+	}
+	_, _, err := ts.Login(ctx, &models.LoginInput{Username: "alice", Password: testPassword}, "192.0.2.1")
+	expectKind(t, err, ErrTooManyRequests)
+
+	if _, _, err := ts.Login(ctx, &models.LoginInput{Username: "alice", Password: testPassword}, "192.0.2.2"); err != nil {
+		t.Errorf("login from another IP: %v", err)
+	}
+}
+
+func TestConcurrentLoginsAreCountedBeforeTheyAreChecked(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t, throttle(0, 3))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	checked := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _, err := ts.Login(ctx, &models.LoginInput{Username: fmt.Sprintf("user%d", i), Password: "wrong password"}, "192.0.2.1")
+			if errors.Is(err, ErrUnauthorized) {
+				mu.Lock()
+				checked++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if checked > 3 {
+		t.Errorf("%d passwords were checked, want at most 3", checked)
+	}
+}
+
+func TestLoginMFAThrottle(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("counts failures against the IP", func(t *testing.T) {
+		ts := newTestService(t, throttle(0, 3))
+		user := ts.createUser(t, "alice", models.RoleUser)
+		secret, _ := ts.enableMFA(t, user.ID)
+
+		_, challenge, err := ts.Login(ctx, &models.LoginInput{Username: "alice", Password: testPassword}, "192.0.2.2")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 3; i++ {
+			_, err := ts.LoginMFA(ctx, &models.MFALoginInput{MFAToken: fmt.Sprintf("guess%d", i), Code: "000000"}, "192.0.2.1")
+			expectKind(t, err, ErrUnauthorized)
+		}
+		_, err = ts.LoginMFA(ctx, &models.MFALoginInput{MFAToken: challenge.MFAToken, Code: totpCode(t, secret, time.Now())}, "192.0.2.1")
+		expectKind(t, err, ErrTooManyRequests)
+
+		if _, err := ts.LoginMFA(ctx, &models.MFALoginInput{MFAToken: challenge.MFAToken, Code: totpCode(t, secret, time.Now())}, "192.0.2.2"); err != nil {
+			t.Errorf("login from another IP: %v", err)
+		}
+	})
+
+	t.Run("counts failures against the account", func(t *testing.T) {
+		ts := newTestService(t, throttle(0, 0))
+		user := ts.createUser(t, "alice", models.RoleUser)
+		secret, _ := ts.enableMFA(t, user.ID)
+
+		// Knowing the password does not reset the count, so new challenges
+		// bring no new guesses
+		challenge := func(ip string) string {
+			t.Helper()
+			_, challenge, err := ts.Login(ctx, &models.LoginInput{Username: "alice", Password: testPassword}, ip)
+			if err != nil {
+				t.Fatalf("login from %s: %v", ip, err)
+			}
+			return challenge.MFAToken
+		}
+		for i := 0; i < 4; i++ {
+			ip := fmt.Sprintf("192.0.2.%d", i)
+			_, err := ts.LoginMFA(ctx, &models.MFALoginInput{MFAToken: challenge(ip), Code: "000000"}, ip)
+			expectKind(t, err, ErrUnauthorized)
+		}
+		_, err := ts.LoginMFA(ctx, &models.MFALoginInput{MFAToken: challenge("192.0.2.100"), Code: totpCode(t, secret, time.Now())}, "192.0.2.100")
+		expectKind(t, err, ErrTooManyRequests)
+		_, _, err = ts.Login(ctx, &models.LoginInput{Username: "alice", Password: testPassword}, "192.0.2.101")
+		expectKind(t, err, ErrTooManyRequests)
+
+		// Passing the second factor resets it
+		if err := ts.UnlockUser(ctx, user.ID); err != nil {
+			t.Fatal(err)
+		}
+		_, err = ts.loginMFA(t, "alice", models.MFALoginInput{Code: "000000"})
+		expectKind(t, err, ErrUnauthorized)
+		if _, err := ts.loginMFA(t, "alice", models.MFALoginInput{Code: totpCode(t, secret, time.Now())}); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 4; i++ {
+			_, err = ts.loginMFA(t, "alice", models.MFALoginInput{Code: "000000"})
+			expectKind(t, err, ErrUnauthorized)
+		}
+	})
+
+	t.Run("limits concurrent attempts on a challenge", func(t *testing.T) {
+		ts := newTestService(t)
+		user := ts.createUser(t, "alice", models.RoleUser)
+		ts.enableMFA(t, user.ID)
+
+		_, challenge, err := ts.Login(ctx, &models.LoginInput{Username: "alice", Password: testPassword}, "192.0.2.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		checked := 0
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, err := ts.LoginMFA(ctx, &models.MFALoginInput{MFAToken: challenge.MFAToken, Code: "000000"}, fmt.Sprintf("192.0.2.%d", i))
+				var e *Error
+				if errors.As(err, &e) && e.Message == "invalid code" {
+					mu.Lock()
+					checked++
+					mu.Unlock()
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		if checked > maxMFAAttempts {
+			t.Errorf("%d codes were checked, want at most %d", checked, maxMFAAttempts)
+		}
+	})
+}
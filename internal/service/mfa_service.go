@@ -0,0 +1,304 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-backend-starter/internal/metrics"
+	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/utils"
+)
+
+const (
+	// recoveryCodeCount is the number of recovery codes issued on enrollment
+	recoveryCodeCount = 10
+
+	// maxMFAAttempts is the number of codes that may be tried for a challenge
+	// before the user has to start over with their password
+	maxMFAAttempts = 5
+)
+
+// EnrollTOTP starts a TOTP enrollment for a user. The returned secret only
+// takes effect once a code generated from it is confirmed with ConfirmTOTP.
+func (s *Service) EnrollTOTP(ctx context.Context, userID int) (*models.TOTPEnrollment, error) {
+	user, err := s.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.MFAEnabledAt != nil {
+		return nil, Conflict("multi-factor authentication is already enabled")
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate totp secret: %w", err)
+	}
+
+	ok, err := s.repo.SetUserMFASecret(ctx, userID, secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store totp secret: %w", err)
+	}
+	if !ok {
+		return nil, Conflict("multi-factor authentication is already enabled")
+	}
+
+	return &models.TOTPEnrollment{
+		Secret:     secret,
+		OTPAuthURI: utils.TOTPURI(s.auth.MFAIssuer, user.Username, secret),
+	}, nil
+}
+
+// ConfirmTOTP completes a TOTP enrollment with a code from the user's
+// authenticator app and returns a fresh set of recovery codes
+func (s *Service) ConfirmTOTP(ctx context.Context, userID int, code string) (*models.RecoveryCodes, error) {
+	user, err := s.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.MFAEnabledAt != nil {
+		return nil, Conflict("multi-factor authentication is already enabled")
+	}
+	if user.MFASecret == nil {
+		return nil, Conflict("no multi-factor enrollment in progress")
+	}
+
+	step, ok := utils.ValidateTOTP(*user.MFASecret, code, time.Now())
+	if !ok {
+		return nil, Validation("invalid code")
+	}
+
+	// Store the recovery codes first so MFA is never enabled without them
+	codes, err := s.replaceRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	enabled, err := s.repo.EnableUserMFA(ctx, userID, step)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable mfa: %w", err)
+	}
+	if !enabled {
+		return nil, Conflict("no multi-factor enrollment in progress")
+	}
+
+	return codes, nil
+}
+
+// LoginMFA completes a login that returned an MFA challenge. Every attempt
+// counts against the challenge and, until it succeeds, against the account
+// and the client IP, so codes cannot be guessed faster than a password, nor
+// with fresh guesses from every new challenge.
+func (s *Service) LoginMFA(ctx context.Context, input *models.MFALoginInput, ip string) (*models.AuthTokens, error) {
+	username, err := s.mfaChallengeUsername(ctx, input.MFAToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.chargeLoginAttempt(ctx, username, ip); err != nil {
+		if errors.Is(err, ErrTooManyRequests) {
+			metrics.Logins.WithLabelValues(metrics.LoginLocked).Inc()
+		}
+		return nil, err
+	}
+
+	user, err := s.checkMFALogin(ctx, input)
+	if err != nil {
+		if errors.Is(err, ErrUnauthorized) {
+			metrics.Logins.WithLabelValues(metrics.LoginMFAFailure).Inc()
+			if err := s.loginFailed(ctx, ip); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+
+	if err := s.forgiveLoginAttempt(ctx, ip); err != nil {
+		return nil, err
+	}
+	if err := s.clearLoginFailures(ctx, user.Username); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.startSession(ctx, user, true)
+	if err != nil {
+		return nil, err
+	}
+	metrics.Logins.WithLabelValues(metrics.LoginSuccess).Inc()
+
+	return tokens, nil
+}
+
+// mfaChallengeUsername returns the username of the user an MFA challenge is
+// for, or "" when there is no such challenge
+func (s *Service) mfaChallengeUsername(ctx context.Context, token string) (string, error) {
+	challenge, err := s.repo.GetMFAChallengeByHash(ctx, utils.HashToken(token))
+	if err != nil {
+		return "", fmt.Errorf("failed to get mfa challenge: %w", err)
+	}
+	if challenge == nil {
+		return "", nil
+	}
+
+	user, err := s.repo.GetUserByID(ctx, challenge.UserID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return "", nil
+	}
+	return user.Username, nil
+}
+
+// checkMFALogin checks the second factor for a challenge and consumes the
+// challenge once it has been passed
+func (s *Service) checkMFALogin(ctx context.Context, input *models.MFALoginInput) (*models.User, error) {
+	challenge, err := s.repo.GetMFAChallengeByHash(ctx, utils.HashToken(input.MFAToken))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mfa challenge: %w", err)
+	}
+	if challenge == nil || challenge.UsedAt != nil || challenge.Attempts >= maxMFAAttempts ||
+		time.Now().After(challenge.ExpiresAt) {
+		return nil, Unauthorized("invalid or expired mfa token")
+	}
+
+	// Count the attempt before checking it, so concurrent attempts cannot
+	// exceed the limit
+	attempts, err := s.repo.RecordMFAChallengeAttempt(ctx, challenge.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record mfa attempt: %w", err)
+	}
+	if attempts == 0 || attempts > maxMFAAttempts {
+		return nil, Unauthorized("invalid or expired mfa token")
+	}
+
+	user, err := s.repo.GetUserByID(ctx, challenge.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil || user.MFAEnabledAt == nil || user.MFASecret == nil {
+		return nil, Unauthorized("invalid or expired mfa token")
+	}
+
+	verified, err := s.verifySecondFactor(ctx, user, input)
+	if err != nil {
+		return nil, err
+	}
+	if !verified {
+		return nil, Unauthorized("invalid code")
+	}
+
+	consumed, err := s.repo.ConsumeMFAChallenge(ctx, challenge.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume mfa challenge: %w", err)
+	}
+	if !consumed {
+		return nil, Unauthorized("invalid or expired mfa token")
+	}
+
+	return user, nil
+}
+
+// ResetMFA turns MFA off for a user, e.g. when they have lost their device
+// and their recovery codes. Their sessions end, since whoever holds one may
+// be the reason for the reset.
+func (s *Service) ResetMFA(ctx context.Context, userID int) error {
+	if err := s.checkAccountOwned(ctx, userID); err != nil {
+		return err
+	}
+
+	err := s.inTx(ctx, func(tx *Service) error {
+		found, err := tx.repo.ResetUserMFA(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("failed to reset mfa: %w", err)
+		}
+		if !found {
+			return NotFound("user not found")
+		}
+		return tx.recordEvent(ctx, models.AuditUserMFAReset, models.AuditTargetUser, &userID, nil, nil)
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.RevokeUserTokens(ctx, userID)
+}
+
+// MFARequired reports whether the holder of a token still has to set up MFA
+// before they may use the API
+func (s *Service) MFARequired(claims *utils.JWTClaims) bool {
+	if claims.HasAMR("mfa") {
+		return false
+	}
+	for _, role := range s.auth.MFARequiredRoles {
+		if role == claims.Role {
+			return true
+		}
+	}
+	return false
+}
+
+// verifySecondFactor checks a TOTP code or consumes a recovery code
+func (s *Service) verifySecondFactor(ctx context.Context, user *models.User, input *models.MFALoginInput) (bool, error) {
+	if input.Code != "" {
+		step, ok := utils.ValidateTOTP(*user.MFASecret, input.Code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		// A code that was already used is rejected, even within its time window
+		fresh, err := s.repo.UseMFAStep(ctx, user.ID, step)
+		if err != nil {
+			return false, fmt.Errorf("failed to record mfa step: %w", err)
+		}
+		return fresh, nil
+	}
+
+	consumed, err := s.repo.ConsumeMFARecoveryCode(ctx, user.ID, utils.HashToken(utils.NormalizeRecoveryCode(input.RecoveryCode)))
+	if err != nil {
+		return false, fmt.Errorf("failed to consume recovery code: %w", err)
+	}
+	return consumed, nil
+}
+
+// createMFAChallenge issues the token that LoginMFA exchanges for a session
+func (s *Service) createMFAChallenge(ctx context.Context, user *models.User) (*models.MFAChallengeResponse, error) {
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate mfa token: %w", err)
+	}
+
+	_, err = s.repo.CreateMFAChallenge(ctx, &models.MFAChallenge{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(time.Duration(s.auth.MFAChallengeExpiration) * time.Minute),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store mfa challenge: %w", err)
+	}
+
+	return &models.MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    token,
+		ExpiresIn:   s.auth.MFAChallengeExpiration * 60,
+	}, nil
+}
+
+// replaceRecoveryCodes generates new recovery codes, invalidating old ones
+func (s *Service) replaceRecoveryCodes(ctx context.Context, userID int) (*models.RecoveryCodes, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := utils.GenerateRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		codes[i] = code
+		hashes[i] = utils.HashToken(utils.NormalizeRecoveryCode(code))
+	}
+
+	if err := s.repo.ReplaceMFARecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, fmt.Errorf("failed to store recovery codes: %w", err)
+	}
+
+	return &models.RecoveryCodes{RecoveryCodes: codes}, nil
+}
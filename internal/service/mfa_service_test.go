@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-backend-starter/internal/config"
+	"go-backend-starter/internal/metrics"
+	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/utils"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// claimsMFA reports whether an access token claims a second factor
+func claimsMFA(t *testing.T, ts *testService, token string) bool {
+	t.Helper()
+
+	claims, err := ts.ValidateToken(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return claims.HasAMR("mfa")
+}
+
+func TestLoginMFA(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+	user := ts.createUser(t, "alice", models.RoleUser)
+	secret, recovery := ts.enableMFA(t, user.ID)
+
+	code := totpCode(t, secret, time.Now())
+	tokens, err := ts.loginMFA(t, "alice", models.MFALoginInput{Code: code})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claimsMFA(t, ts, tokens.Token) {
+		t.Error("access token does not claim mfa")
+	}
+	refreshed, err := ts.Refresh(ctx, tokens.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claimsMFA(t, ts, refreshed.Token) {
+		t.Error("refreshed access token does not claim mfa")
+	}
+
+	// Codes cannot be replayed, recovery codes work once
+	_, err = ts.loginMFA(t, "alice", models.MFALoginInput{Code: code})
+	expectKind(t, err, ErrUnauthorized)
+	if _, err := ts.loginMFA(t, "alice", models.MFALoginInput{RecoveryCode: recovery[0]}); err != nil {
+		t.Errorf("recovery code: %v", err)
+	}
+	_, err = ts.loginMFA(t, "alice", models.MFALoginInput{RecoveryCode: recovery[0]})
+	expectKind(t, err, ErrUnauthorized)
+}
+
+func TestLoginMFAMetrics(t *testing.T) {
+	ts := newTestService(t)
+	user := ts.createUser(t, "alice", models.RoleUser)
+	secret, _ := ts.enableMFA(t, user.ID)
+
+	results := []string{metrics.LoginSuccess, metrics.LoginMFAFailure}
+	before := make([]float64, len(results))
+	for i, result := range results {
+		before[i] = testutil.ToFloat64(metrics.Logins.WithLabelValues(result))
+	}
+
+	// A login counts once its second factor is checked, not when the password is
+	if _, err := ts.loginMFA(t, "alice", models.MFALoginInput{Code: "000000"}); err == nil {
+		t.Fatal("wrong code accepted")
+	}
+	if _, err := ts.loginMFA(t, "alice", models.MFALoginInput{Code: totpCode(t, secret, time.Now())}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, result := range results {
+		if got := testutil.ToFloat64(metrics.Logins.WithLabelValues(result)) - before[i]; got != 1 {
+			t.Errorf("%s logins increased by %v, want 1", result, got)
+		}
+	}
+}
+
+func TestLoginMFAChallengeLimits(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+	user := ts.createUser(t, "alice", models.RoleUser)
+	secret, _ := ts.enableMFA(t, user.ID)
+
+	_, challenge, err := ts.Login(ctx, &models.LoginInput{Username: "alice", Password: testPassword}, "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The challenge dies after too many wrong codes, even for a right one
+	for i := 0; i < maxMFAAttempts; i++ {
+		_, err := ts.LoginMFA(ctx, &models.MFALoginInput{MFAToken: challenge.MFAToken, Code: "000000"}, "192.0.2.1")
+		expectKind(t, err, ErrUnauthorized)
+	}
+	_, err = ts.LoginMFA(ctx, &models.MFALoginInput{MFAToken: challenge.MFAToken, Code: totpCode(t, secret, time.Now())}, "192.0.2.1")
+	expectKind(t, err, ErrUnauthorized)
+
+	// A challenge is single-use
+	tokens, err := ts.loginMFA(t, "alice", models.MFALoginInput{Code: totpCode(t, secret, time.Now())})
+	if err != nil || tokens == nil {
+		t.Fatalf("login with a new challenge: %v", err)
+	}
+}
+
+func TestRefreshClaimsOnlyTheFactorsOfTheLogin(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+	user := ts.createUser(t, "alice", models.RoleUser)
+
+	// MFA enabled after a password login does not upgrade that session
+	tokens := ts.login(t, "alice")
+	ts.enableMFA(t, user.ID)
+
+	refreshed, err := ts.Refresh(ctx, tokens.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimsMFA(t, ts, refreshed.Token) {
+		t.Error("refreshed password session claims mfa")
+	}
+}
+
+func TestResetMFA(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+	user := ts.createUser(t, "alice", models.RoleUser)
+	secret, _ := ts.enableMFA(t, user.ID)
+
+	tokens, err := ts.loginMFA(t, "alice", models.MFALoginInput{Code: totpCode(t, secret, time.Now())})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ts.ResetMFA(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Sessions started with the old factor end
+	_, err = ts.ValidateToken(ctx, tokens.Token)
+	expectKind(t, err, ErrUnauthorized)
+	_, err = ts.Refresh(ctx, tokens.RefreshToken)
+	expectKind(t, err, ErrUnauthorized)
+
+	// The password alone is enough again, and claims no second factor
+	if claimsMFA(t, ts, ts.login(t, "alice").Token) {
+		t.Error("password login after the reset claims mfa")
+	}
+
+	expectKind(t, ts.ResetMFA(ctx, 1<<30), ErrNotFound)
+}
+
+func TestMFARequired(t *testing.T) {
+	ts := newTestService(t, func(cfg *config.Config) {
+		cfg.Auth.MFARequiredRoles = []string{models.RoleAdmin}
+	})
+
+	for _, tt := range []struct {
+		role string
+		amr  []string
+		want bool
+	}{
+		{models.RoleAdmin, []string{"pwd"}, true},
+		{models.RoleAdmin, []string{"pwd", "mfa"}, false},
+		{models.RoleUser, []string{"pwd"}, false},
+	} {
+		if got := ts.MFARequired(&utils.JWTClaims{Role: tt.role, AMR: tt.amr}); got != tt.want {
+			t.Errorf("MFARequired(%s, %v) = %v, want %v", tt.role, tt.amr, got, tt.want)
+		}
+	}
+}
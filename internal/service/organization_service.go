@@ -0,0 +1,348 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"go-backend-starter/internal/audit"
+	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/tenant"
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// invitationExpiration is how long an invitation to an organization can be accepted
+const invitationExpiration = 7 * 24 * time.Hour
+
+// CreateOrganization creates an organization with the user as its first admin
+func (s *Service) CreateOrganization(ctx context.Context, userID int, input *models.CreateOrganizationInput) (*models.Organization, error) {
+	if !slugPattern.MatchString(input.Slug) {
+		return nil, InvalidFields("invalid organization slug", FieldError{
+			Field:   "slug",
+			Rule:    "pattern",
+			Message: "must contain only lowercase letters, digits and -",
+		})
+	}
+
+	org, err := s.repo.CreateOrganization(ctx, &models.Organization{Name: input.Name, Slug: input.Slug}, userID, models.RoleAdmin)
+	if err != nil {
+		return nil, translateRepoError(err)
+	}
+
+	return org, nil
+}
+
+// ListUserOrganizations returns the organizations a user belongs to
+func (s *Service) ListUserOrganizations(ctx context.Context, userID int) ([]*models.Membership, error) {
+	memberships, err := s.repo.ListUserOrganizations(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if memberships == nil {
+		memberships = []*models.Membership{}
+	}
+	return memberships, nil
+}
+
+// GetMembership returns a user's membership in an organization, or nil if
+// they are not a member
+func (s *Service) GetMembership(ctx context.Context, orgID, userID int) (*models.OrganizationMember, error) {
+	member, err := s.repo.GetOrganizationMember(ctx, orgID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get membership: %w", err)
+	}
+	return member, nil
+}
+
+// InviteOrganizationMember invites an existing user to the organization of
+// the context with a role. They become a member once they accept, so an
+// organization cannot take in users or their accounts on its own.
+func (s *Service) InviteOrganizationMember(ctx context.Context, input *models.InviteMemberInput) (*models.Invitation, error) {
+	orgID, ok := tenant.OrganizationID(ctx)
+	if !ok {
+		return nil, Validation("no organization selected")
+	}
+
+	if err := s.checkRoleExists(ctx, input.Role); err != nil {
+		return nil, err
+	}
+	if err := s.checkRoleAssignable(ctx, input.Role); err != nil {
+		return nil, err
+	}
+
+	// The user is not a member yet, so look them up across organizations
+	user, err := s.repo.GetUserByEmail(tenant.WithOrganization(ctx, 0), input.Email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, NotFound("user not found")
+	}
+
+	member, err := s.GetMembership(ctx, orgID, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if member != nil {
+		return nil, Conflict("user is already a member of the organization")
+	}
+
+	var invitation *models.Invitation
+	err = s.inTx(ctx, func(tx *Service) error {
+		var err error
+		invitation, err = tx.repo.CreateInvitation(ctx, &models.Invitation{
+			OrganizationID: orgID,
+			UserID:         user.ID,
+			Role:           input.Role,
+			InvitedBy:      audit.SourceFrom(ctx).ActorID,
+			ExpiresAt:      time.Now().Add(invitationExpiration),
+		})
+		if err != nil {
+			return translateRepoError(err)
+		}
+		return tx.recordEvent(ctx, models.AuditInvitationCreate, models.AuditTargetInvitation, &invitation.ID, nil, invitationSnapshot(invitation))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+// ListOrganizationInvitations returns the pending invitations to the
+// organization of the context
+func (s *Service) ListOrganizationInvitations(ctx context.Context) ([]*models.Invitation, error) {
+	orgID, ok := tenant.OrganizationID(ctx)
+	if !ok {
+		return nil, Validation("no organization selected")
+	}
+
+	invitations, err := s.repo.ListOrganizationInvitations(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if invitations == nil {
+		invitations = []*models.Invitation{}
+	}
+	return invitations, nil
+}
+
+// CancelInvitation withdraws an invitation to the organization of the context
+func (s *Service) CancelInvitation(ctx context.Context, id int) error {
+	orgID, ok := tenant.OrganizationID(ctx)
+	if !ok {
+		return Validation("no organization selected")
+	}
+
+	return s.inTx(ctx, func(tx *Service) error {
+		invitation, err := tx.repo.GetInvitation(ctx, id)
+		if err != nil {
+			return fmt.Errorf("failed to get invitation: %w", err)
+		}
+		if invitation == nil || invitation.OrganizationID != orgID {
+			return NotFound("invitation not found")
+		}
+
+		if _, err := tx.repo.DeleteInvitation(ctx, id); err != nil {
+			return err
+		}
+		return tx.recordEvent(ctx, models.AuditInvitationCancel, models.AuditTargetInvitation, &id, invitationSnapshot(invitation), nil)
+	})
+}
+
+// ListUserInvitations returns the pending invitations of a user
+func (s *Service) ListUserInvitations(ctx context.Context, userID int) ([]*models.Invitation, error) {
+	invitations, err := s.repo.ListUserInvitations(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if invitations == nil {
+		invitations = []*models.Invitation{}
+	}
+	return invitations, nil
+}
+
+// AcceptInvitation makes a user a member of the organization they were
+// invited to, with the role of the invitation
+func (s *Service) AcceptInvitation(ctx context.Context, userID, id int) (*models.Membership, error) {
+	var invitation *models.Invitation
+	err := s.inTx(ctx, func(tx *Service) error {
+		var err error
+		invitation, err = tx.userInvitation(ctx, userID, id)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.repo.AddOrganizationMember(ctx, invitation.OrganizationID, userID, invitation.Role); err != nil {
+			return translateRepoError(err)
+		}
+		if _, err := tx.repo.DeleteInvitation(ctx, id); err != nil {
+			return err
+		}
+
+		// The user acts outside the organization; record it there all the same
+		octx := tenant.WithOrganization(ctx, invitation.OrganizationID)
+		return tx.recordEvent(octx, models.AuditMemberAdd, models.AuditTargetMember, &userID, nil, map[string]any{"role": invitation.Role})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	memberships, err := s.ListUserOrganizations(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, membership := range memberships {
+		if membership.ID == invitation.OrganizationID {
+			return membership, nil
+		}
+	}
+	return nil, NotFound("organization not found")
+}
+
+// DeclineInvitation deletes an invitation of a user without joining
+func (s *Service) DeclineInvitation(ctx context.Context, userID, id int) error {
+	return s.inTx(ctx, func(tx *Service) error {
+		invitation, err := tx.userInvitation(ctx, userID, id)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.repo.DeleteInvitation(ctx, id); err != nil {
+			return err
+		}
+		octx := tenant.WithOrganization(ctx, invitation.OrganizationID)
+		return tx.recordEvent(octx, models.AuditInvitationDecline, models.AuditTargetInvitation, &id, invitationSnapshot(invitation), nil)
+	})
+}
+
+// userInvitation returns an unexpired invitation of a user. Invitations of
+// others are reported as not found.
+func (s *Service) userInvitation(ctx context.Context, userID, id int) (*models.Invitation, error) {
+	invitation, err := s.repo.GetInvitation(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invitation: %w", err)
+	}
+	if invitation == nil || invitation.UserID != userID {
+		return nil, NotFound("invitation not found")
+	}
+	if !invitation.ExpiresAt.After(time.Now()) {
+		return nil, Validation("invitation has expired")
+	}
+	return invitation, nil
+}
+
+// RemoveOrganizationMember removes a user from the organization of the
+// context. Their account is left untouched.
+func (s *Service) RemoveOrganizationMember(ctx context.Context, userID int) error {
+	orgID, ok := tenant.OrganizationID(ctx)
+	if !ok {
+		return Validation("no organization selected")
+	}
+
+	return s.inTx(ctx, func(tx *Service) error {
+		member, err := tx.GetMembership(ctx, orgID, userID)
+		if err != nil {
+			return err
+		}
+		if member == nil {
+			return NotFound("member not found")
+		}
+
+		if _, err := tx.repo.RemoveOrganizationMember(ctx, orgID, userID); err != nil {
+			return err
+		}
+		return tx.recordEvent(ctx, models.AuditMemberRemove, models.AuditTargetMember, &userID, map[string]any{"role": member.Role}, nil)
+	})
+}
+
+// defaultOrganizationID returns the organization a user acts in unless a
+// request names another: the first one they joined, or 0 if they have none
+func (s *Service) defaultOrganizationID(ctx context.Context, userID int) (int, error) {
+	memberships, err := s.repo.ListUserOrganizations(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list organizations: %w", err)
+	}
+	if len(memberships) == 0 {
+		return 0, nil
+	}
+	return memberships[0].ID, nil
+}
+
+// checkAccountOwned rejects changes to a user's account, as opposed to their
+// membership, from an organization unless the organization created the
+// account, the account has no global role beyond user and it belongs to no
+// other organization. Users may always change their own account.
+func (s *Service) checkAccountOwned(ctx context.Context, userID int) error {
+	orgID, ok := tenant.OrganizationID(ctx)
+	if !ok {
+		return nil
+	}
+	if source := audit.SourceFrom(ctx); source.ActorID != nil && *source.ActorID == userID && source.ImpersonatorID == nil {
+		return nil
+	}
+
+	// Users outside the organization are reported as not found by the caller
+	member, err := s.GetMembership(ctx, orgID, userID)
+	if err != nil || member == nil {
+		return err
+	}
+	if !member.CreatedAccount {
+		return Forbidden("the user's account was not created in this organization; remove them from this organization instead")
+	}
+	if member.AccountRole != models.RoleUser {
+		// Unless the actor has at least as much outside the organization
+		outranks, err := s.actorHoldsGlobally(ctx, member.AccountRole)
+		if err != nil {
+			return err
+		}
+		if !outranks {
+			return Forbidden("the user's account has a global role; remove them from this organization instead")
+		}
+	}
+
+	count, err := s.repo.CountUserOrganizations(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if count > 1 {
+		return Conflict("user belongs to other organizations; remove them from this organization instead")
+	}
+
+	return nil
+}
+
+// actorHoldsGlobally reports whether the actor of the request has every
+// permission of a role through their global role. Requests without an actor
+// are not limited.
+func (s *Service) actorHoldsGlobally(ctx context.Context, role string) (bool, error) {
+	actorID := audit.SourceFrom(ctx).ActorID
+	if actorID == nil {
+		return true, nil
+	}
+
+	actor, err := s.repo.GetUserByID(tenant.WithOrganization(ctx, 0), *actorID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get user: %w", err)
+	}
+	if actor == nil {
+		return false, nil
+	}
+
+	held, err := s.RolePermissions(ctx, actor.Role)
+	if err != nil {
+		return false, err
+	}
+	needed, err := s.RolePermissions(ctx, role)
+	if err != nil {
+		return false, err
+	}
+	for permission := range needed {
+		if !held.Has(permission) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/tenant"
+)
+
+// createOrganization creates an organization owned by the seeded admin and
+// returns a context acting in it
+func (ts *testService) createOrganization(t *testing.T, slug string) context.Context {
+	t.Helper()
+
+	org, err := ts.CreateOrganization(context.Background(), 1, &models.CreateOrganizationInput{Name: slug, Slug: slug})
+	if err != nil {
+		t.Fatalf("create organization %s: %v", slug, err)
+	}
+	return tenant.WithOrganization(context.Background(), org.ID)
+}
+
+// join invites a user to the organization of octx and accepts for them
+func (ts *testService) join(t *testing.T, octx context.Context, user *models.User, role string) {
+	t.Helper()
+
+	invitation, err := ts.InviteOrganizationMember(octx, &models.InviteMemberInput{Email: user.Email, Role: role})
+	if err != nil {
+		t.Fatalf("invite %s: %v", user.Username, err)
+	}
+	if _, err := ts.AcceptInvitation(context.Background(), user.ID, invitation.ID); err != nil {
+		t.Fatalf("accept invitation of %s: %v", user.Username, err)
+	}
+}
+
+func TestInvitations(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+	acme := ts.createOrganization(t, "acme")
+	globex := ts.createOrganization(t, "globex")
+	alice := ts.createUser(t, "alice", models.RoleUser)
+	bob := ts.createUser(t, "bob", models.RoleUser)
+
+	invitation, err := ts.InviteOrganizationMember(asActor(acme, 1), &models.InviteMemberInput{Email: alice.Email, Role: models.RoleUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invitation.UserID != alice.ID || invitation.OrganizationName != "acme" || invitation.InvitedBy == nil || *invitation.InvitedBy != 1 {
+		t.Errorf("invitation = %+v", invitation)
+	}
+
+	// Inviting is not joining
+	if member, err := ts.GetMembership(ctx, invitation.OrganizationID, alice.ID); err != nil || member != nil {
+		t.Fatalf("membership before accepting = %+v, %v", member, err)
+	}
+	if invitations, err := ts.ListUserInvitations(ctx, alice.ID); err != nil || len(invitations) != 1 {
+		t.Errorf("ListUserInvitations = %+v, %v", invitations, err)
+	}
+	if invitations, err := ts.ListOrganizationInvitations(acme); err != nil || len(invitations) != 1 {
+		t.Errorf("ListOrganizationInvitations = %+v, %v", invitations, err)
+	}
+	if invitations, err := ts.ListOrganizationInvitations(globex); err != nil || len(invitations) != 0 {
+		t.Errorf("ListOrganizationInvitations of another organization = %+v, %v", invitations, err)
+	}
+
+	// Only the invited user can accept or decline, and only the inviting
+	// organization can cancel
+	_, err = ts.AcceptInvitation(ctx, bob.ID, invitation.ID)
+	expectKind(t, err, ErrNotFound)
+	expectKind(t, ts.DeclineInvitation(ctx, bob.ID, invitation.ID), ErrNotFound)
+	expectKind(t, ts.CancelInvitation(globex, invitation.ID), ErrNotFound)
+
+	membership, err := ts.AcceptInvitation(ctx, alice.ID, invitation.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if membership.Slug != "acme" || membership.Role != models.RoleUser {
+		t.Errorf("membership = %+v", membership)
+	}
+	_, err = ts.AcceptInvitation(ctx, alice.ID, invitation.ID)
+	expectKind(t, err, ErrNotFound)
+	_, err = ts.InviteOrganizationMember(acme, &models.InviteMemberInput{Email: alice.Email, Role: models.RoleUser})
+	expectKind(t, err, ErrConflict)
+	_, err = ts.InviteOrganizationMember(acme, &models.InviteMemberInput{Email: "nobody@example.com", Role: models.RoleUser})
+	expectKind(t, err, ErrNotFound)
+
+	t.Run("decline and cancel", func(t *testing.T) {
+		declined, err := ts.InviteOrganizationMember(globex, &models.InviteMemberInput{Email: bob.Email, Role: models.RoleUser})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ts.DeclineInvitation(ctx, bob.ID, declined.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		cancelled, err := ts.InviteOrganizationMember(globex, &models.InviteMemberInput{Email: bob.Email, Role: models.RoleUser})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ts.CancelInvitation(globex, cancelled.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = ts.AcceptInvitation(ctx, bob.ID, cancelled.ID)
+		expectKind(t, err, ErrNotFound)
+		if memberships, err := ts.ListUserOrganizations(ctx, bob.ID); err != nil || len(memberships) != 0 {
+			t.Errorf("organizations of bob = %+v, %v", memberships, err)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		orgID, _ := tenant.OrganizationID(globex)
+		expired, err := ts.repo.CreateInvitation(ctx, &models.Invitation{
+			OrganizationID: orgID, UserID: bob.ID, Role: models.RoleUser, ExpiresAt: time.Now().Add(-time.Minute),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = ts.AcceptInvitation(ctx, bob.ID, expired.ID)
+		expectKind(t, err, ErrValidation)
+		if invitations, err := ts.ListUserInvitations(ctx, bob.ID); err != nil || len(invitations) != 0 {
+			t.Errorf("ListUserInvitations = %+v, %v; want expired invitations left out", invitations, err)
+		}
+	})
+}
+
+func TestTenantScoping(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+	acme := ts.createOrganization(t, "acme")
+	globex := ts.createOrganization(t, "globex")
+
+	carol, err := ts.CreateUser(acme, &models.CreateUserInput{
+		Username: "carol", Password: testPassword, Email: "carol@example.com", Role: models.RoleAdmin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Users created in an organization are admins there only
+	if carol.Role != models.RoleAdmin {
+		t.Errorf("role in acme = %q, want admin", carol.Role)
+	}
+	if global, err := ts.GetUserByID(ctx, carol.ID); err != nil || global.Role != models.RoleUser {
+		t.Errorf("global user = %+v, %v; want the user role", global, err)
+	}
+
+	// Other organizations do not see them
+	_, err = ts.GetUserByID(globex, carol.ID)
+	expectKind(t, err, ErrNotFound)
+	_, err = ts.UpdateUser(globex, carol.ID, &models.UpdateUserInput{Role: models.RoleUser})
+	expectKind(t, err, ErrNotFound)
+	expectKind(t, ts.DeleteUser(globex, carol.ID), ErrNotFound)
+	expectKind(t, ts.PurgeUser(globex, carol.ID), ErrNotFound)
+	expectKind(t, ts.ResetMFA(globex, carol.ID), ErrNotFound)
+
+	for octx, want := range map[context.Context]int{acme: 2, globex: 1} {
+		page, err := ts.ListUsers(octx, &models.ListUsersInput{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Data) != want {
+			t.Errorf("ListUsers = %d users, want %d", len(page.Data), want)
+		}
+	}
+
+	// A role change in an organization applies to the membership
+	if _, err := ts.UpdateUser(acme, carol.ID, &models.UpdateUserInput{Role: models.RoleUser}); err != nil {
+		t.Fatal(err)
+	}
+	orgID, _ := tenant.OrganizationID(acme)
+	if member, err := ts.GetMembership(ctx, orgID, carol.ID); err != nil || member.Role != models.RoleUser {
+		t.Errorf("membership = %+v, %v; want the user role", member, err)
+	}
+}
+
+func TestOrganizationsOnlyChangeAccountsTheyCreated(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+	ts.createRole(t, "manager", models.PermissionUsersRead, models.PermissionUsersWrite, models.PermissionUsersDelete, models.PermissionOrgsWrite)
+	acme := ts.createOrganization(t, "acme")
+
+	// Helen manages Acme with a regular account
+	helen := ts.createUser(t, "helen", models.RoleUser)
+	ts.join(t, acme, helen, "manager")
+	actx := asActor(acme, helen.ID)
+
+	newUser := func(username string) *models.User {
+		t.Helper()
+		user, err := ts.CreateUser(acme, &models.CreateUserInput{
+			Username: username, Password: testPassword, Email: username + "@example.com", Role: models.RoleUser,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user
+	}
+	setPassword := func(ctx context.Context, userID int) error {
+		_, err := ts.UpdateUser(ctx, userID, &models.UpdateUserInput{Password: "another password"})
+		return err
+	}
+
+	t.Run("created in the organization", func(t *testing.T) {
+		carol := newUser("carol")
+		if err := setPassword(actx, carol.ID); err != nil {
+			t.Errorf("set password: %v", err)
+		}
+		if err := ts.UnlockUser(actx, carol.ID); err != nil {
+			t.Errorf("unlock: %v", err)
+		}
+		if err := ts.DeleteUser(actx, carol.ID); err != nil {
+			t.Errorf("delete: %v", err)
+		}
+		if _, err := ts.RestoreUser(actx, carol.ID); err != nil {
+			t.Errorf("restore: %v", err)
+		}
+		if err := ts.PurgeUser(actx, carol.ID); err != nil {
+			t.Errorf("purge: %v", err)
+		}
+	})
+
+	t.Run("joined the organization", func(t *testing.T) {
+		dave := ts.createUser(t, "dave", models.RoleUser)
+		ts.join(t, acme, dave, models.RoleUser)
+
+		expectKind(t, setPassword(actx, dave.ID), ErrForbidden)
+		_, err := ts.UpdateUser(actx, dave.ID, &models.UpdateUserInput{Email: "mallory@example.com"})
+		expectKind(t, err, ErrForbidden)
+		expectKind(t, ts.ResetMFA(actx, dave.ID), ErrForbidden)
+		expectKind(t, ts.UnlockUser(actx, dave.ID), ErrForbidden)
+		expectKind(t, ts.DeleteUser(actx, dave.ID), ErrForbidden)
+		expectKind(t, ts.PurgeUser(actx, dave.ID), ErrForbidden)
+		if err := ts.DeleteUser(ctx, dave.ID); err != nil {
+			t.Fatal(err)
+		}
+		_, err = ts.RestoreUser(actx, dave.ID)
+		expectKind(t, err, ErrForbidden)
+		if _, err := ts.RestoreUser(ctx, dave.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		// Their membership is the organization's to change
+		if _, err := ts.UpdateUser(actx, dave.ID, &models.UpdateUserInput{Role: "manager"}); err != nil {
+			t.Errorf("change role: %v", err)
+		}
+		if err := ts.RemoveOrganizationMember(actx, dave.ID); err != nil {
+			t.Errorf("remove member: %v", err)
+		}
+
+		// They may still change their own account
+		if err := setPassword(asActor(acme, helen.ID), helen.ID); err != nil {
+			t.Errorf("set own password: %v", err)
+		}
+	})
+
+	t.Run("with a global role", func(t *testing.T) {
+		erin := newUser("erin")
+		if _, err := ts.UpdateUser(ctx, erin.ID, &models.UpdateUserInput{Role: models.RoleAdmin}); err != nil {
+			t.Fatal(err)
+		}
+
+		expectKind(t, setPassword(actx, erin.ID), ErrForbidden)
+		expectKind(t, ts.UnlockUser(actx, erin.ID), ErrForbidden)
+		expectKind(t, ts.PurgeUser(actx, erin.ID), ErrForbidden)
+
+		// A global admin may, as they could outside the organization
+		if err := setPassword(asActor(acme, 1), erin.ID); err != nil {
+			t.Errorf("set password as a global admin: %v", err)
+		}
+	})
+
+	t.Run("in other organizations", func(t *testing.T) {
+		frank := newUser("frank")
+		ts.join(t, ts.createOrganization(t, "globex"), frank, models.RoleUser)
+
+		expectKind(t, setPassword(actx, frank.ID), ErrConflict)
+		expectKind(t, ts.UnlockUser(actx, frank.ID), ErrConflict)
+		expectKind(t, ts.PurgeUser(actx, frank.ID), ErrConflict)
+		if err := ts.DeleteUser(ctx, frank.ID); err != nil {
+			t.Fatal(err)
+		}
+		_, err := ts.RestoreUser(actx, frank.ID)
+		expectKind(t, err, ErrConflict)
+	})
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"go-backend-starter/internal/models"
+)
+
+const (
+	defaultPageSize = 10
+	maxPageSize     = 100
+)
+
+// cursor is the decoded form of an opaque page cursor. It remembers the sort
+// it was created for so it cannot be replayed against a different ordering.
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v,omitempty"`
+	ID    int    `json:"id"`
+	Prev  bool   `json:"p,omitempty"` // page backwards from the key
+}
+
+func encodeCursor(c cursor) *string {
+	data, _ := json.Marshal(c)
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	return &encoded
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, Validation("invalid cursor")
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, Validation("invalid cursor")
+	}
+
+	return &c, nil
+}
+
+// parseSort splits a sort parameter such as "-created_at" into field and direction
+func parseSort(sort string) (field string, descending bool) {
+	if sort == "" {
+		return "id", false
+	}
+	return strings.TrimPrefix(sort, "-"), strings.HasPrefix(sort, "-")
+}
+
+// userSortValue returns the value of the sort field for a user, as stored in a cursor
+func userSortValue(user *models.User, field string) string {
+	switch field {
+	case "username":
+		return user.Username
+	case "email":
+		return user.Email
+	case "created_at":
+		return user.CreatedAt.Format(time.RFC3339Nano)
+	default:
+		return ""
+	}
+}
+
+// cursorKey converts a cursor back into a typed keyset position
+func cursorKey(c *cursor, field string) (*models.UserKey, error) {
+	key := &models.UserKey{ID: c.ID}
+
+	switch field {
+	case "username", "email":
+		key.Value = c.Value
+	case "created_at":
+		t, err := time.Parse(time.RFC3339Nano, c.Value)
+		if err != nil {
+			return nil, Validation("invalid cursor")
+		}
+		key.Value = t
+	}
+
+	return key, nil
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"go-backend-starter/internal/models"
+)
+
+// listAll walks every page of a listing forwards and then back again, and
+// returns the usernames in the order of the forward walk
+func listAll(t *testing.T, ts *testService, input models.ListUsersInput) []string {
+	t.Helper()
+	ctx := context.Background()
+
+	var all []string
+	var pages []*models.UserPage
+	for {
+		page, err := ts.ListUsers(ctx, &input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, page)
+		all = append(all, usernames(page.Data)...)
+		if page.NextCursor == nil {
+			break
+		}
+		input.Cursor = *page.NextCursor
+	}
+
+	if pages[0].PrevCursor != nil {
+		t.Error("first page has a previous cursor")
+	}
+	// Previous cursors lead back through the same pages
+	for i := len(pages) - 1; i > 0; i-- {
+		input.Cursor = *pages[i].PrevCursor
+		page, err := ts.ListUsers(ctx, &input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := usernames(page.Data), usernames(pages[i-1].Data); !slices.Equal(got, want) {
+			t.Errorf("page %d walking back = %v, want %v", i-1, got, want)
+		}
+	}
+
+	return all
+}
+
+func usernames(users []*models.User) []string {
+	names := make([]string, len(users))
+	for i, u := range users {
+		names[i] = u.Username
+	}
+	return names
+}
+
+func TestListUsers(t *testing.T) {
+	ts := newTestService(t)
+	for _, name := range []string{"dave", "carol", "erin", "bob", "alice"} {
+		ts.createUser(t, name, models.RoleUser)
+	}
+
+	for _, tt := range []struct {
+		sort string
+		want []string
+	}{
+		{"", []string{"admin", "dave", "carol", "erin", "bob", "alice"}},
+		{"-id", []string{"alice", "bob", "erin", "carol", "dave", "admin"}},
+		{"username", []string{"admin", "alice", "bob", "carol", "dave", "erin"}},
+		{"-username", []string{"erin", "dave", "carol", "bob", "alice", "admin"}},
+		{"-created_at", []string{"alice", "bob", "erin", "carol", "dave", "admin"}},
+	} {
+		t.Run("sort "+tt.sort, func(t *testing.T) {
+			got := listAll(t, ts, models.ListUsersInput{Sort: tt.sort, Limit: 2})
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("users = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("filters and counts", func(t *testing.T) {
+		page, err := ts.ListUsers(context.Background(), &models.ListUsersInput{
+			Search:       "r",
+			Role:         models.RoleUser,
+			Sort:         "username",
+			IncludeTotal: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := usernames(page.Data), []string{"carol", "erin"}; !slices.Equal(got, want) {
+			t.Errorf("users = %v, want %v", got, want)
+		}
+		if page.Total == nil || *page.Total != 2 {
+			t.Errorf("total = %v, want 2", page.Total)
+		}
+	})
+
+	t.Run("caps the page size", func(t *testing.T) {
+		page, err := ts.ListUsers(context.Background(), &models.ListUsersInput{Limit: maxPageSize + 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Data) != 6 || page.NextCursor != nil || page.Total != nil {
+			t.Errorf("page = %d users, next %v, total %v", len(page.Data), page.NextCursor, page.Total)
+		}
+	})
+}
+
+func TestListUsersRejectsBadCursors(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+	ts.createUser(t, "alice", models.RoleUser)
+	ts.createUser(t, "bob", models.RoleUser)
+
+	page, err := ts.ListUsers(ctx, &models.ListUsersInput{Sort: "username", Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A cursor only works with the sort it was created for
+	_, err = ts.ListUsers(ctx, &models.ListUsersInput{Sort: "-username", Cursor: *page.NextCursor})
+	expectKind(t, err, ErrValidation)
+
+	for _, c := range []string{
+		"not base64!",
+		"bm90IGpzb24",
+		*encodeCursor(cursor{Sort: "created_at", Value: "yesterday", ID: 1}),
+	} {
+		_, err := ts.ListUsers(ctx, &models.ListUsersInput{Sort: "created_at", Cursor: c})
+		expectKind(t, err, ErrValidation)
+	}
+}
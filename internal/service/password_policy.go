@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go-backend-starter/internal/config"
+	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/utils"
+)
+
+// PasswordPolicy holds the rules new passwords must follow
+type PasswordPolicy struct {
+	cfg       config.PasswordConfig
+	blocklist *utils.PasswordBlocklist
+}
+
+// minPasswordLength is the shortest minimum length a policy may set. It is
+// the minimum when none is configured.
+const minPasswordLength = 8
+
+// NewPasswordPolicy creates a password policy, loading the blocklist file if
+// one is configured
+func NewPasswordPolicy(cfg *config.PasswordConfig) (*PasswordPolicy, error) {
+	policy := &PasswordPolicy{cfg: *cfg}
+
+	if policy.cfg.MinLength == 0 {
+		policy.cfg.MinLength = minPasswordLength
+	}
+	if policy.cfg.MinLength < minPasswordLength {
+		return nil, fmt.Errorf("password min length must be at least %d", minPasswordLength)
+	}
+	if policy.cfg.MaxLength > 0 && policy.cfg.MaxLength < policy.cfg.MinLength {
+		return nil, fmt.Errorf("password max length must not be less than the min length")
+	}
+
+	if cfg.BlocklistFile != "" {
+		blocklist, err := utils.LoadPasswordBlocklist(cfg.BlocklistFile)
+		if err != nil {
+			return nil, err
+		}
+		policy.blocklist = blocklist
+	}
+
+	return policy, nil
+}
+
+// Check returns every rule the password breaks. username and email belong
+// to the account the password is for.
+func (p *PasswordPolicy) Check(password, username, email string) []FieldError {
+	var violations []FieldError
+	add := func(rule, message string) {
+		violations = append(violations, FieldError{Field: "password", Rule: rule, Message: message})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if p.cfg.MinLength > 0 && length < p.cfg.MinLength {
+		add("min_length", fmt.Sprintf("must be at least %d characters long", p.cfg.MinLength))
+	}
+	if p.cfg.MaxLength > 0 && length > p.cfg.MaxLength {
+		add("max_length", fmt.Sprintf("must be at most %d characters long", p.cfg.MaxLength))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsLetter(r) && !unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.cfg.RequireUppercase && !upper {
+		add("uppercase", "must contain an uppercase letter")
+	}
+	if p.cfg.RequireLowercase && !lower {
+		add("lowercase", "must contain a lowercase letter")
+	}
+	if p.cfg.RequireDigit && !digit {
+		add("digit", "must contain a digit")
+	}
+	if p.cfg.RequireSymbol && !symbol {
+		add("symbol", "must contain a symbol")
+	}
+
+	if p.cfg.DisallowUserInfo {
+		lowered := strings.ToLower(password)
+		localPart, _, _ := strings.Cut(email, "@")
+		if containsFold(lowered, username) {
+			add("username", "must not contain the username")
+		} else if containsFold(lowered, localPart) {
+			add("email", "must not contain the email address")
+		}
+	}
+
+	if p.blocklist != nil && p.blocklist.Contains(password) {
+		add("blocklist", "is too common or has appeared in a data breach")
+	}
+
+	return violations
+}
+
+// containsFold reports whether s contains part, ignoring case. Parts shorter
+// than three characters are ignored since they would match too often.
+func containsFold(lowered, part string) bool {
+	return utf8.RuneCountInString(part) >= 3 && strings.Contains(lowered, strings.ToLower(part))
+}
+
+// checkNewPassword applies the password policy. For an existing user it
+// also rejects their recent passwords.
+func (s *Service) checkNewPassword(ctx context.Context, password, username, email string, user *models.User) error {
+	violations := s.passwordPolicy.Check(password, username, email)
+
+	if user != nil && s.passwordPolicy.cfg.History > 0 {
+		reused, err := s.isRecentPassword(ctx, user, password)
+		if err != nil {
+			return err
+		}
+		if reused {
+			violations = append(violations, FieldError{
+				Field:   "password",
+				Rule:    "history",
+				Message: fmt.Sprintf("must not match any of the last %d passwords", s.passwordPolicy.cfg.History),
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		return InvalidFields("the password does not meet the password policy", violations...)
+	}
+	return nil
+}
+
+// isRecentPassword checks a password against the user's current password and
+// their previous ones, up to the configured history length
+func (s *Service) isRecentPassword(ctx context.Context, user *models.User, password string) (bool, error) {
+	hashes := []string{user.PasswordHash}
+	if s.passwordPolicy.cfg.History > 1 {
+		previous, err := s.repo.GetPasswordHistory(ctx, user.ID, s.passwordPolicy.cfg.History-1)
+		if err != nil {
+			return false, fmt.Errorf("failed to get password history: %w", err)
+		}
+		hashes = append(hashes, previous...)
+	}
+
+	for _, hash := range hashes {
+		match, err := s.hasher.Verify(password, hash)
+		if err != nil {
+			return false, fmt.Errorf("failed to check password history: %w", err)
+		}
+		if match {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// rememberPassword adds a password hash that was just replaced to the user's history
+func (s *Service) rememberPassword(ctx context.Context, userID int, passwordHash string) error {
+	if s.passwordPolicy.cfg.History <= 1 {
+		return nil
+	}
+	if err := s.repo.AddPasswordHistory(ctx, userID, passwordHash, s.passwordPolicy.cfg.History-1); err != nil {
+		return fmt.Errorf("failed to update password history: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"go-backend-starter/internal/config"
+	"go-backend-starter/internal/models"
+)
+
+// rules returns the rules a password policy error reports as broken
+func rules(t *testing.T, err error) []string {
+	t.Helper()
+
+	var e *Error
+	if !errors.As(err, &e) || !errors.Is(err, ErrValidation) {
+		t.Fatalf("error = %v, want a validation error", err)
+	}
+	var broken []string
+	for _, field := range e.Fields {
+		broken = append(broken, field.Rule)
+	}
+	return broken
+}
+
+func TestNewPasswordPolicy(t *testing.T) {
+	policy, err := NewPasswordPolicy(&config.PasswordConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if violations := policy.Check("short", "", ""); len(violations) != 1 || violations[0].Rule != "min_length" {
+		t.Errorf("Check without a configured min length = %+v, want min_length", violations)
+	}
+
+	for _, cfg := range []config.PasswordConfig{
+		{MinLength: 6},
+		{MinLength: 12, MaxLength: 10},
+		{BlocklistFile: filepath.Join(t.TempDir(), "missing.txt")},
+	} {
+		if _, err := NewPasswordPolicy(&cfg); err == nil {
+			t.Errorf("NewPasswordPolicy(%+v) succeeded, want an error", cfg)
+		}
+	}
+}
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	policy, err := NewPasswordPolicy(&config.PasswordConfig{
+		MinLength:        10,
+		MaxLength:        20,
+		RequireUppercase: true,
+		RequireLowercase: true,
+		RequireDigit:     true,
+		RequireSymbol:    true,
+		DisallowUserInfo: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for password, want := range map[string][]string{
+		"Tr0ub4dor&3x":          nil,
+		"Tr0ub&3":               {"min_length"},
+		"Tr0ub4dor&3xTr0ub4dor": {"max_length"},
+		"tr0ub4dor&3x":          {"uppercase"},
+		"TR0UB4DOR&3X":          {"lowercase"},
+		"Troubador&&x":          {"digit"},
+		"Tr0ub4dor33x":          {"symbol"},
+		"Alice-Tr0ub4dor":       {"username"},
+		"Tr0ub4dor&ali.ce":      {"email"},
+	} {
+		var got []string
+		for _, violation := range policy.Check(password, "alice", "ali.ce@example.com") {
+			got = append(got, violation.Rule)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("Check(%q) = %v, want %v", password, got, want)
+		}
+	}
+}
+
+func TestPasswordBlocklist(t *testing.T) {
+	sum := sha1.Sum([]byte("correct horse battery"))
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	content := "# common passwords\n\n" + hex.EncodeToString(sum[:]) + ":42\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newTestService(t, func(cfg *config.Config) { cfg.Password.BlocklistFile = path })
+
+	_, err := ts.CreateUser(context.Background(), &models.CreateUserInput{
+		Username: "alice", Password: "correct horse battery", Email: "alice@example.com", Role: models.RoleUser,
+	})
+	if got := rules(t, err); !slices.Equal(got, []string{"blocklist"}) {
+		t.Errorf("broken rules = %v, want blocklist", got)
+	}
+	if violations := ts.passwordPolicy.Check("correct horse staple", "", ""); len(violations) != 0 {
+		t.Errorf("Check(unlisted password) = %+v", violations)
+	}
+}
+
+func TestPasswordHistory(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t, func(cfg *config.Config) { cfg.Password.History = 3 })
+	user := ts.createUser(t, "alice", models.RoleUser)
+
+	setPassword := func(password string) error {
+		_, err := ts.UpdateUser(ctx, user.ID, &models.UpdateUserInput{Password: password})
+		return err
+	}
+
+	if got := rules(t, setPassword(testPassword)); !slices.Equal(got, []string{"history"}) {
+		t.Errorf("reusing the current password broke %v, want history", got)
+	}
+
+	for _, password := range []string{"second password", "third password"} {
+		if err := setPassword(password); err != nil {
+			t.Fatalf("set %q: %v", password, err)
+		}
+	}
+	if got := rules(t, setPassword(testPassword)); !slices.Equal(got, []string{"history"}) {
+		t.Errorf("reusing the third to last password broke %v, want history", got)
+	}
+
+	// Older passwords may be used again
+	if err := setPassword("fourth password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := setPassword(testPassword); err != nil {
+		t.Errorf("reusing the fourth to last password: %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go-backend-starter/internal/mailer"
+	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/utils"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ForgotPassword mails a password reset link to the user with the given
+// email address. Unknown addresses are silently ignored so the caller cannot
+// tell which addresses have an account: only the lookup can fail, and the
+// email is queued rather than sent while the caller waits. Failures past the
+// lookup are logged instead of returned for the same reason.
+func (s *Service) ForgotPassword(ctx context.Context, email string) error {
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil
+	}
+
+	msg, err := s.passwordResetEmail(ctx, user)
+	if err != nil {
+		log.Error().Err(err).Int("user_id", user.ID).Msg("Failed to create password reset email")
+		return nil
+	}
+
+	s.sendEmail(ctx, msg)
+	return nil
+}
+
+// passwordResetEmail stores a new reset token for the user and returns the
+// email that delivers it to them
+func (s *Service) passwordResetEmail(ctx context.Context, user *models.User) (*mailer.Message, error) {
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate reset token: %w", err)
+	}
+
+	expiresAt := time.Now().Add(time.Duration(s.auth.PasswordResetTokenExpiration) * time.Minute)
+	if _, err := s.repo.CreatePasswordResetToken(ctx, &models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: expiresAt,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to store reset token: %w", err)
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your account. You can choose a new password %s\n\n"+
+		"This expires at %s. If you did not ask for a reset, you can ignore this email.\n",
+		user.Username, tokenInstructions(s.auth.ResetPasswordURL, token), expiresAt.UTC().Format(time.RFC1123))
+
+	return &mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    body,
+	}, nil
+}
+
+// ResetPassword redeems a password reset token, sets the new password and
+// signs the user out everywhere, as one unit of work
+func (s *Service) ResetPassword(ctx context.Context, input *models.ResetPasswordInput) error {
+	tokenHash := utils.HashToken(input.Token)
+
+	// Look the token up without using it, so a password the policy rejects
+	// does not cost the user their reset link
+	stored, err := s.repo.GetPasswordResetToken(ctx, tokenHash)
+	if err != nil {
+		return fmt.Errorf("failed to get reset token: %w", err)
+	}
+	if stored == nil {
+		return Validation("invalid or expired reset token")
+	}
+
+	// The account may have been soft deleted after the email was sent
+	user, err := s.repo.GetUserByID(ctx, stored.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return Validation("invalid or expired reset token")
+	}
+
+	if err := s.checkNewPassword(ctx, input.Password, user.Username, user.Email, user); err != nil {
+		return err
+	}
+
+	passwordHash, err := s.hashPassword(input.Password)
+	if err != nil {
+		return err
+	}
+
+	// The password is hashed first so the unit of work stays short. Within
+	// it, a failure leaves the reset link usable and nothing half applied.
+	var revokedBefore time.Time
+	err = s.inTx(ctx, func(tx *Service) error {
+		// Consuming is what guards against the same token being redeemed twice
+		consumed, err := tx.repo.ConsumePasswordResetToken(ctx, tokenHash)
+		if err != nil {
+			return fmt.Errorf("failed to consume reset token: %w", err)
+		}
+		if consumed == nil {
+			return Validation("invalid or expired reset token")
+		}
+
+		updated, err := tx.repo.UpdateUser(ctx, user.ID, &models.UpdateUserInput{PasswordHash: passwordHash})
+		if err != nil {
+			return fmt.Errorf("failed to update password: %w", err)
+		}
+		if updated == nil {
+			return Validation("invalid or expired reset token")
+		}
+
+		if err := tx.rememberPassword(ctx, user.ID, user.PasswordHash); err != nil {
+			return err
+		}
+
+		// The reset link was delivered to the user's address, which proves they own it
+		if err := tx.repo.MarkEmailVerified(ctx, user.ID); err != nil {
+			return fmt.Errorf("failed to verify email: %w", err)
+		}
+
+		// Any other outstanding reset links are no longer needed
+		if err := tx.repo.DeleteUserPasswordResetTokens(ctx, user.ID); err != nil {
+			return fmt.Errorf("failed to delete reset tokens: %w", err)
+		}
+
+		// Whoever was locked out of the account has just proven they own it
+		if err := tx.repo.ClearLoginFailures(ctx, models.LoginScopeUser, user.Username); err != nil {
+			return fmt.Errorf("failed to clear login failures: %w", err)
+		}
+
+		revokedBefore, err = tx.revokeUserTokens(ctx, user.ID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	s.revocations.setUser(user.ID, &revokedBefore)
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go-backend-starter/internal/config"
+	"go-backend-starter/internal/models"
+)
+
+func resetTokens(cfg *config.Config) {
+	cfg.Auth.PasswordResetTokenExpiration = 60
+}
+
+func TestForgotPassword(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t, resetTokens)
+	ts.createUser(t, "alice", models.RoleUser)
+	session := ts.login(t, "alice")
+
+	if err := ts.ForgotPassword(ctx, "alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	sent := ts.mail.sent()
+	if len(sent) != 1 || sent[0].To != "alice@example.com" {
+		t.Fatalf("sent = %+v", sent)
+	}
+	token := mailedToken(t, sent[0])
+
+	// A password the policy rejects does not use up the token
+	err := ts.ResetPassword(ctx, &models.ResetPasswordInput{Token: token, Password: "short"})
+	expectKind(t, err, ErrValidation)
+
+	const newPassword = "a brand new passphrase"
+	if err := ts.ResetPassword(ctx, &models.ResetPasswordInput{Token: token, Password: newPassword}); err != nil {
+		t.Fatal(err)
+	}
+	err = ts.ResetPassword(ctx, &models.ResetPasswordInput{Token: token, Password: "another new passphrase"})
+	expectKind(t, err, ErrValidation)
+
+	// Existing sessions end and only the new password works
+	_, err = ts.ValidateToken(ctx, session.Token)
+	expectKind(t, err, ErrUnauthorized)
+	_, _, err = ts.Login(ctx, &models.LoginInput{Username: "alice", Password: testPassword}, "192.0.2.1")
+	expectKind(t, err, ErrUnauthorized)
+	if _, _, err := ts.Login(ctx, &models.LoginInput{Username: "alice", Password: newPassword}, "192.0.2.1"); err != nil {
+		t.Errorf("login with the new password: %v", err)
+	}
+}
+
+func TestForgotPasswordRevealsNothing(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t, resetTokens)
+	ts.createUser(t, "alice", models.RoleUser)
+
+	if err := ts.ForgotPassword(ctx, "nobody@example.com"); err != nil {
+		t.Errorf("unknown address: %v", err)
+	}
+	if sent := ts.mail.sent(); len(sent) != 0 {
+		t.Errorf("unknown address was sent %+v", sent)
+	}
+
+	// Nor does a known address whose email cannot be sent
+	ts.mail.err = errors.New("connection refused")
+	if err := ts.ForgotPassword(ctx, "alice@example.com"); err != nil {
+		t.Errorf("known address with failing mail: %v", err)
+	}
+}
+
+func TestResetPasswordOfDeletedUser(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t, resetTokens)
+	user := ts.createUser(t, "alice", models.RoleUser)
+
+	if err := ts.ForgotPassword(ctx, "alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.DeleteUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	err := ts.ResetPassword(ctx, &models.ResetPasswordInput{Token: mailedToken(t, ts.mail.sent()[0]), Password: "a brand new passphrase"})
+	expectKind(t, err, ErrValidation)
+}
+
+func TestResetPasswordIsOneUnitOfWork(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t, resetTokens)
+	ts.createUser(t, "alice", models.RoleUser)
+	session := ts.login(t, "alice")
+	if err := ts.ForgotPassword(ctx, "alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	token := mailedToken(t, ts.mail.sent()[0])
+
+	// Revoking the sessions comes last, and failing it undoes the rest
+	failing := NewService(&failingAPIKeyRepo{Repository: ts.repo}, ts.cfg, ts.jwtKeys, ts.hasher, ts.passwordPolicy, ts.mail)
+	const newPassword = "a brand new passphrase"
+	if err := failing.ResetPassword(ctx, &models.ResetPasswordInput{Token: token, Password: newPassword}); err == nil {
+		t.Fatal("reset succeeded without revoking the sessions")
+	}
+	if _, err := ts.ValidateToken(ctx, session.Token); err != nil {
+		t.Errorf("session after a failed reset: %v", err)
+	}
+	ts.login(t, "alice")
+
+	// The link still works
+	if err := ts.ResetPassword(ctx, &models.ResetPasswordInput{Token: token, Password: newPassword}); err != nil {
+		t.Fatal(err)
+	}
+}
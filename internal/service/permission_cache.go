@@ -0,0 +1,65 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"go-backend-starter/internal/models"
+)
+
+// permissionCache keeps the permissions of each role in memory so that
+// permission checks do not hit the database on every request. Role changes
+// made by this process are visible immediately; changes made by other
+// replicas become visible once the cached entry expires.
+type permissionCache struct {
+	ttl   time.Duration
+	mu    sync.Mutex
+	roles map[string]cachedRolePermissions
+}
+
+type cachedRolePermissions struct {
+	permissions models.PermissionSet
+	expires     time.Time
+}
+
+func newPermissionCache(ttl time.Duration) *permissionCache {
+	return &permissionCache{
+		ttl:   ttl,
+		roles: make(map[string]cachedRolePermissions),
+	}
+}
+
+// role returns the cached permissions of a role
+func (c *permissionCache) role(name string) (permissions models.PermissionSet, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, found := c.roles[name]
+	if !found || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.permissions, true
+}
+
+// setRole caches the permissions of a role. The number of roles is small,
+// so entries are simply overwritten rather than swept.
+func (c *permissionCache) setRole(name string, permissions []string) models.PermissionSet {
+	set := make(models.PermissionSet, len(permissions))
+	for _, p := range permissions {
+		set[p] = struct{}{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.roles[name] = cachedRolePermissions{permissions: set, expires: time.Now().Add(c.ttl)}
+	return set
+}
+
+// forget drops a role after it was changed or deleted
+func (c *permissionCache) forget(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.roles, name)
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-backend-starter/internal/mailer"
+	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/repository"
+	"go-backend-starter/internal/utils"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Register creates an account with the user role and sends a verification
+// email to the given address. The account and its verification token are
+// one unit of work; the email is sent once they are stored, and can be
+// requested again with ResendVerificationEmail if it does not arrive. An
+// address that already has an account is sent a notice instead, and the
+// caller gets the same answer, so registering does not reveal which
+// addresses have an account.
+func (s *Service) Register(ctx context.Context, input *models.RegisterInput) error {
+	if !s.auth.RegistrationEnabled {
+		return Forbidden("registration is disabled")
+	}
+
+	create := &models.CreateUserInput{
+		Username: input.Username,
+		Password: input.Password,
+		Email:    input.Email,
+		Role:     models.RoleUser,
+	}
+
+	if err := s.prepareNewUserPassword(ctx, create); err != nil {
+		return err
+	}
+
+	var msg *mailer.Message
+	err := s.inTx(ctx, func(tx *Service) error {
+		existing, err := tx.repo.GetUserByEmail(ctx, input.Email)
+		if err != nil {
+			return fmt.Errorf("failed to check email: %w", err)
+		}
+		if existing != nil {
+			msg = existingAccountEmail(existing)
+			return nil
+		}
+
+		user, err := tx.createUser(ctx, create)
+		if err != nil {
+			return err
+		}
+		msg, err = tx.verificationEmail(ctx, user)
+		return err
+	})
+	// Deleted accounts keep their address until they are purged, and their
+	// owners are not to be mailed
+	var dup *repository.DuplicateError
+	if errors.As(err, &dup) && dup.Constraint == "users_email_key" {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	s.sendEmail(ctx, msg)
+	return nil
+}
+
+// existingAccountEmail returns the notice sent to the owner of an account
+// when someone registers with its address
+func existingAccountEmail(user *models.User) *mailer.Message {
+	body := fmt.Sprintf("Hi %s,\n\nSomeone tried to create an account with this email address, which already has one. "+
+		"If that was you, sign in as %s or reset your password. Otherwise you can ignore this email.\n", user.Username, user.Username)
+
+	return &mailer.Message{
+		To:      user.Email,
+		Subject: "You already have an account",
+		Body:    body,
+	}
+}
+
+// ResendVerificationEmail sends a new verification email to the unverified
+// account with the given address. Unknown and verified addresses are
+// silently ignored so the caller cannot tell which addresses have an account.
+func (s *Service) ResendVerificationEmail(ctx context.Context, email string) error {
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil || user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	// Failing only for known addresses would reveal them, so log instead
+	msg, err := s.verificationEmail(ctx, user)
+	if err != nil {
+		log.Error().Err(err).Int("user_id", user.ID).Msg("Failed to create verification email")
+		return nil
+	}
+
+	s.sendEmail(ctx, msg)
+	return nil
+}
+
+// VerifyEmail redeems an email verification token
+func (s *Service) VerifyEmail(ctx context.Context, token string) error {
+	stored, err := s.repo.ConsumeEmailVerificationToken(ctx, utils.HashToken(token))
+	if err != nil {
+		return fmt.Errorf("failed to consume verification token: %w", err)
+	}
+	if stored == nil {
+		return Validation("invalid or expired verification token")
+	}
+
+	if err := s.repo.MarkEmailVerified(ctx, stored.UserID); err != nil {
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+
+	return nil
+}
+
+// verificationEmail stores a new verification token for the user and
+// returns the email that delivers it to them
+func (s *Service) verificationEmail(ctx context.Context, user *models.User) (*mailer.Message, error) {
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate verification token: %w", err)
+	}
+
+	expiresAt := time.Now().Add(time.Duration(s.auth.VerificationTokenExpiration) * time.Minute)
+	if _, err := s.repo.CreateEmailVerificationToken(ctx, &models.EmailVerificationToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: expiresAt,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to store verification token: %w", err)
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nPlease confirm your email address %s\n\nThis expires at %s.\n",
+		user.Username, tokenInstructions(s.auth.VerifyEmailURL, token), expiresAt.UTC().Format(time.RFC1123))
+
+	return &mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body:    body,
+	}, nil
+}
+
+// sendEmail hands a message to the mailer. Failures are logged rather than
+// returned: the work the message reports on is done, and whether it was
+// sent must not show in the response.
+func (s *Service) sendEmail(ctx context.Context, msg *mailer.Message) {
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		log.Error().Err(err).Str("subject", msg.Subject).Msg("Failed to send email")
+	}
+}
+
+// tokenInstructions completes a sentence telling the recipient how to use a
+// token: a link when a URL template is configured, the raw token otherwise
+func tokenInstructions(urlTemplate, token string) string {
+	if urlTemplate == "" {
+		return "with this code:\n\n" + token
+	}
+	return "by opening this link:\n\n" + strings.ReplaceAll(urlTemplate, "{token}", token)
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"go-backend-starter/internal/config"
+	"go-backend-starter/internal/mailer"
+	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/repository"
+)
+
+func enableRegistration(cfg *config.Config) {
+	cfg.Auth.RegistrationEnabled = true
+	cfg.Auth.RequireEmailVerification = true
+	cfg.Auth.VerificationTokenExpiration = 60
+}
+
+// failingVerificationRepo is a repository that cannot store email
+// verification tokens, which Register does last
+type failingVerificationRepo struct {
+	repository.Repository
+}
+
+func (r *failingVerificationRepo) WithTx(ctx context.Context, opts repository.TxOptions, fn func(repo repository.Repository) error) error {
+	return r.Repository.WithTx(ctx, opts, func(repo repository.Repository) error {
+		return fn(&failingVerificationRepo{Repository: repo})
+	})
+}
+
+func (r *failingVerificationRepo) CreateEmailVerificationToken(ctx context.Context, token *models.EmailVerificationToken) (*models.EmailVerificationToken, error) {
+	return nil, errors.New("verification tokens unavailable")
+}
+
+// mailedToken returns the token a message tells its recipient to use
+func mailedToken(t *testing.T, msg *mailer.Message) string {
+	t.Helper()
+
+	_, rest, ok := strings.Cut(msg.Body, "with this code:\n\n")
+	if !ok {
+		t.Fatalf("no token in %q", msg.Body)
+	}
+	token, _, _ := strings.Cut(rest, "\n")
+	return token
+}
+
+func TestRegister(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t, enableRegistration)
+
+	if err := ts.Register(ctx, &models.RegisterInput{Username: "alice", Password: testPassword, Email: "alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	user, err := ts.repo.GetUserByUsername(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Role != models.RoleUser || user.EmailVerifiedAt != nil {
+		t.Errorf("user = %+v, want an unverified user", user)
+	}
+
+	_, _, err = ts.Login(ctx, &models.LoginInput{Username: "alice", Password: testPassword}, "192.0.2.1")
+	expectKind(t, err, ErrForbidden)
+
+	sent := ts.mail.sent()
+	if len(sent) != 1 || sent[0].To != "alice@example.com" {
+		t.Fatalf("sent = %+v", sent)
+	}
+	token := mailedToken(t, sent[0])
+	if err := ts.VerifyEmail(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+	ts.login(t, "alice")
+
+	// Tokens are single-use
+	expectKind(t, ts.VerifyEmail(ctx, token), ErrValidation)
+}
+
+func TestRegisterDisabled(t *testing.T) {
+	ts := newTestService(t)
+
+	err := ts.Register(context.Background(), &models.RegisterInput{Username: "alice", Password: testPassword, Email: "alice@example.com"})
+	expectKind(t, err, ErrForbidden)
+}
+
+func TestRegisterWhenMailFails(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t, enableRegistration)
+	ts.mail.err = errors.New("connection refused")
+
+	// The account is created and the failure only logged
+	if err := ts.Register(ctx, &models.RegisterInput{Username: "alice", Password: testPassword, Email: "alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once mail works again a new link can be requested
+	ts.mail.err = nil
+	if err := ts.ResendVerificationEmail(ctx, "alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	sent := ts.mail.sent()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(sent))
+	}
+	if err := ts.VerifyEmail(ctx, mailedToken(t, sent[0])); err != nil {
+		t.Fatal(err)
+	}
+	ts.login(t, "alice")
+}
+
+func TestRegisterIsOneUnitOfWork(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t, enableRegistration)
+	failing := NewService(&failingVerificationRepo{Repository: ts.repo}, ts.cfg, ts.jwtKeys, ts.hasher, ts.passwordPolicy, ts.mail)
+
+	if err := failing.Register(ctx, &models.RegisterInput{Username: "alice", Password: testPassword, Email: "alice@example.com"}); err == nil {
+		t.Fatal("registration succeeded without a verification token")
+	}
+
+	if user, err := ts.repo.GetUserByUsername(ctx, "alice"); err != nil || user != nil {
+		t.Errorf("failed registration left user %+v, %v", user, err)
+	}
+	if sent := ts.mail.sent(); len(sent) != 0 {
+		t.Errorf("failed registration sent %+v", sent)
+	}
+}
+
+func TestRegisterRevealsNothing(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t, enableRegistration)
+	ts.createUser(t, "bob", models.RoleUser)
+	carol := ts.createUser(t, "carol", models.RoleUser)
+	if err := ts.DeleteUser(ctx, carol.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Taken addresses get the same answer as new ones
+	for _, email := range []string{"bob@example.com", "carol@example.com"} {
+		if err := ts.Register(ctx, &models.RegisterInput{Username: "mallory", Password: testPassword, Email: email}); err != nil {
+			t.Errorf("%s: %v", email, err)
+		}
+	}
+	if user, err := ts.repo.GetUserByUsername(ctx, "mallory"); err != nil || user != nil {
+		t.Errorf("registration with a taken address created %+v, %v", user, err)
+	}
+
+	// The owner of the account is told, unless it was deleted
+	sent := ts.mail.sent()
+	if len(sent) != 1 || sent[0].To != "bob@example.com" || !strings.Contains(sent[0].Body, "already has one") {
+		t.Fatalf("sent = %+v, want a notice to bob", sent)
+	}
+
+	// Usernames are public, so taken ones are still refused
+	err := ts.Register(ctx, &models.RegisterInput{Username: "bob", Password: testPassword, Email: "robert@example.com"})
+	expectKind(t, err, ErrConflict)
+}
+
+func TestResendVerificationEmail(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t, enableRegistration)
+	ts.createUser(t, "bob", models.RoleUser)
+
+	// Unknown and verified addresses get no mail and no error
+	for _, email := range []string{"nobody@example.com", "bob@example.com"} {
+		if err := ts.ResendVerificationEmail(ctx, email); err != nil {
+			t.Errorf("%s: %v", email, err)
+		}
+	}
+	if sent := ts.mail.sent(); len(sent) != 0 {
+		t.Errorf("sent %+v", sent)
+	}
+}
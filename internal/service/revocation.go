@@ -0,0 +1,105 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// revocationCache keeps recent revocation lookups in memory so that
+// ValidateToken does not hit the database on every request. Revocations made
+// by this process are visible immediately; revocations made by other replicas
+// become visible once the cached entry expires.
+type revocationCache struct {
+	ttl       time.Duration
+	mu        sync.Mutex
+	tokens    map[string]cachedTokenRevocation
+	users     map[int]cachedUserRevocation
+	lastSweep time.Time
+}
+
+type cachedTokenRevocation struct {
+	revoked bool
+	expires time.Time
+}
+
+type cachedUserRevocation struct {
+	before  *time.Time
+	expires time.Time
+}
+
+func newRevocationCache(ttl time.Duration) *revocationCache {
+	return &revocationCache{
+		ttl:       ttl,
+		tokens:    make(map[string]cachedTokenRevocation),
+		users:     make(map[int]cachedUserRevocation),
+		lastSweep: time.Now(),
+	}
+}
+
+// token returns the cached revocation state of a jti
+func (c *revocationCache) token(jti string) (revoked, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, found := c.tokens[jti]
+	if !found || time.Now().After(entry.expires) {
+		return false, false
+	}
+	return entry.revoked, true
+}
+
+// setToken caches the revocation state of a jti. A revoked token stays
+// revoked, so it is cached until the token itself expires.
+func (c *revocationCache) setToken(jti string, revoked bool, tokenExpiresAt time.Time) {
+	expires := time.Now().Add(c.ttl)
+	if revoked {
+		expires = tokenExpiresAt
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sweep()
+	c.tokens[jti] = cachedTokenRevocation{revoked: revoked, expires: expires}
+}
+
+// user returns the cached token cut-off time of a user
+func (c *revocationCache) user(userID int) (before *time.Time, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, found := c.users[userID]
+	if !found || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.before, true
+}
+
+// setUser caches the token cut-off time of a user
+func (c *revocationCache) setUser(userID int, before *time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sweep()
+	c.users[userID] = cachedUserRevocation{before: before, expires: time.Now().Add(c.ttl)}
+}
+
+// sweep drops expired entries at most once per TTL. Callers must hold mu.
+func (c *revocationCache) sweep() {
+	now := time.Now()
+	if now.Sub(c.lastSweep) < c.ttl {
+		return
+	}
+	c.lastSweep = now
+
+	for jti, entry := range c.tokens {
+		if now.After(entry.expires) {
+			delete(c.tokens, jti)
+		}
+	}
+	for userID, entry := range c.users {
+		if now.After(entry.expires) {
+			delete(c.users, userID)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRevocationCache(t *testing.T) {
+	c := newRevocationCache(time.Minute)
+
+	if _, ok := c.token("jti"); ok {
+		t.Error("empty cache has an entry")
+	}
+
+	c.setToken("valid", false, time.Now().Add(time.Hour))
+	if revoked, ok := c.token("valid"); !ok || revoked {
+		t.Errorf("valid token = %v, %v; want cached as not revoked", revoked, ok)
+	}
+
+	// A revoked token is cached until it expires, however long the TTL
+	c.setToken("revoked", true, time.Now().Add(time.Hour))
+	if revoked, ok := c.token("revoked"); !ok || !revoked {
+		t.Errorf("revoked token = %v, %v; want cached as revoked", revoked, ok)
+	}
+	c.setToken("expired", true, time.Now().Add(-time.Second))
+	if _, ok := c.token("expired"); ok {
+		t.Error("expired token is still cached")
+	}
+
+	before := time.Now()
+	c.setUser(1, &before)
+	c.setUser(2, nil)
+	if got, ok := c.user(1); !ok || got == nil || !got.Equal(before) {
+		t.Errorf("user 1 = %v, %v; want %v", got, ok, before)
+	}
+	if got, ok := c.user(2); !ok || got != nil {
+		t.Errorf("user 2 = %v, %v; want cached without a cut-off", got, ok)
+	}
+
+	// Entries that are not revocations expire with the TTL
+	c.users[1] = cachedUserRevocation{before: &before, expires: time.Now().Add(-time.Second)}
+	if _, ok := c.user(1); ok {
+		t.Error("expired user entry is still cached")
+	}
+}
@@ -0,0 +1,285 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"go-backend-starter/internal/audit"
+	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/tenant"
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// ListRoles returns every role with its permissions
+func (s *Service) ListRoles(ctx context.Context) ([]*models.Role, error) {
+	roles, err := s.repo.ListRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if roles == nil {
+		roles = []*models.Role{}
+	}
+	return roles, nil
+}
+
+// GetRole returns a role with its permissions
+func (s *Service) GetRole(ctx context.Context, name string) (*models.Role, error) {
+	role, err := s.repo.GetRole(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, NotFound("role not found")
+	}
+	return role, nil
+}
+
+// ListPermissions returns every permission a role can grant
+func (s *Service) ListPermissions(ctx context.Context) ([]*models.Permission, error) {
+	permissions, err := s.repo.ListPermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if permissions == nil {
+		permissions = []*models.Permission{}
+	}
+	return permissions, nil
+}
+
+// CreateRole creates a custom role
+func (s *Service) CreateRole(ctx context.Context, input *models.CreateRoleInput) (*models.Role, error) {
+	if !roleNamePattern.MatchString(input.Name) {
+		return nil, InvalidFields("invalid role name", FieldError{
+			Field:   "name",
+			Rule:    "pattern",
+			Message: "must start with a lowercase letter and contain only lowercase letters, digits, - and _",
+		})
+	}
+	if err := s.checkPermissions(ctx, input.Permissions); err != nil {
+		return nil, err
+	}
+	if err := s.checkManagesRoles(ctx); err != nil {
+		return nil, err
+	}
+	if err := s.checkGrantable(tenant.WithOrganization(ctx, 0), input.Permissions); err != nil {
+		return nil, err
+	}
+
+	var role *models.Role
+	err := s.inTx(ctx, func(tx *Service) error {
+		var err error
+		role, err = tx.repo.CreateRole(ctx, &models.Role{
+			Name:        input.Name,
+			Description: input.Description,
+			Permissions: input.Permissions,
+		})
+		if err != nil {
+			return translateRepoError(err)
+		}
+		return tx.recordEvent(ctx, models.AuditRoleCreate, models.AuditTargetRole, nil, nil, roleSnapshot(role))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return role, nil
+}
+
+// UpdateRole replaces a role's description and permissions. The change
+// applies to every user with the role on their next request.
+func (s *Service) UpdateRole(ctx context.Context, name string, input *models.UpdateRoleInput) (*models.Role, error) {
+	// Taking permissions away from admin could lock everyone out
+	if name == models.RoleAdmin {
+		return nil, Forbidden("the admin role cannot be changed")
+	}
+	if err := s.checkPermissions(ctx, input.Permissions); err != nil {
+		return nil, err
+	}
+	if err := s.checkManagesRoles(ctx); err != nil {
+		return nil, err
+	}
+	if err := s.checkGrantable(tenant.WithOrganization(ctx, 0), input.Permissions); err != nil {
+		return nil, err
+	}
+
+	var role *models.Role
+	err := s.inTx(ctx, func(tx *Service) error {
+		before, err := tx.repo.GetRole(ctx, name)
+		if err != nil {
+			return err
+		}
+		role, err = tx.repo.UpdateRole(ctx, name, input)
+		if err != nil {
+			return translateRepoError(err)
+		}
+		if before == nil || role == nil {
+			return NotFound("role not found")
+		}
+		return tx.recordEvent(ctx, models.AuditRoleUpdate, models.AuditTargetRole, nil, roleSnapshot(before), roleSnapshot(role))
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.permissions.forget(name)
+
+	return role, nil
+}
+
+// DeleteRole deletes a custom role that is no longer assigned to any user
+func (s *Service) DeleteRole(ctx context.Context, name string) error {
+	if err := s.checkManagesRoles(ctx); err != nil {
+		return err
+	}
+
+	err := s.inTx(ctx, func(tx *Service) error {
+		role, err := tx.GetRole(ctx, name)
+		if err != nil {
+			return err
+		}
+		if role.Builtin {
+			return Forbidden("built-in roles cannot be deleted")
+		}
+
+		deleted, err := tx.repo.DeleteRole(ctx, name)
+		if err != nil {
+			return translateRepoError(err)
+		}
+		if !deleted {
+			return NotFound("role not found")
+		}
+		return tx.recordEvent(ctx, models.AuditRoleDelete, models.AuditTargetRole, nil, roleSnapshot(role), nil)
+	})
+	if err != nil {
+		return err
+	}
+	s.permissions.forget(name)
+
+	return nil
+}
+
+// RolePermissions returns the permissions a role grants, consulting the cache first
+func (s *Service) RolePermissions(ctx context.Context, role string) (models.PermissionSet, error) {
+	if permissions, ok := s.permissions.role(role); ok {
+		return permissions, nil
+	}
+
+	names, err := s.repo.GetRolePermissions(ctx, role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve permissions: %w", err)
+	}
+	return s.permissions.setRole(role, names), nil
+}
+
+// checkPermissions rejects permission names that do not exist
+func (s *Service) checkPermissions(ctx context.Context, names []string) error {
+	known, err := s.repo.ListPermissions(ctx)
+	if err != nil {
+		return err
+	}
+
+	valid := make(map[string]struct{}, len(known))
+	for _, p := range known {
+		valid[p.Name] = struct{}{}
+	}
+
+	var unknown []FieldError
+	for _, name := range names {
+		if _, ok := valid[name]; !ok {
+			unknown = append(unknown, FieldError{
+				Field:   "permissions",
+				Rule:    "exists",
+				Message: fmt.Sprintf("unknown permission %q", name),
+			})
+		}
+	}
+	if len(unknown) > 0 {
+		return InvalidFields("unknown permissions", unknown...)
+	}
+
+	return nil
+}
+
+// checkManagesRoles rejects changes to roles by actors whose global role does
+// not grant roles:write. Roles apply in every organization, so a role held in
+// one of them is not enough.
+func (s *Service) checkManagesRoles(ctx context.Context) error {
+	actorID := audit.SourceFrom(ctx).ActorID
+	if actorID == nil {
+		return nil
+	}
+
+	actor, err := s.repo.GetUserByID(tenant.WithOrganization(ctx, 0), *actorID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if actor == nil {
+		return Forbidden("roles can only be changed with a global role that grants roles:write")
+	}
+	held, err := s.RolePermissions(ctx, actor.Role)
+	if err != nil {
+		return err
+	}
+	if !held.Has(models.PermissionRolesWrite) {
+		return Forbidden("roles can only be changed with a global role that grants roles:write")
+	}
+	return nil
+}
+
+// checkRoleExists rejects roles that do not exist, before they are assigned to a user
+func (s *Service) checkRoleExists(ctx context.Context, name string) error {
+	role, err := s.repo.GetRole(ctx, name)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return InvalidFields("unknown role", FieldError{Field: "role", Rule: "exists", Message: "must be an existing role"})
+	}
+	return nil
+}
+
+// checkRoleAssignable rejects assigning a role that grants permissions the
+// actor of the request does not have
+func (s *Service) checkRoleAssignable(ctx context.Context, name string) error {
+	permissions, err := s.RolePermissions(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(permissions))
+	for permission := range permissions {
+		names = append(names, permission)
+	}
+	return s.checkGrantable(ctx, names)
+}
+
+// checkGrantable rejects granting permissions the actor of the request does
+// not have themselves, in the organization the request acts in. Requests
+// without an actor, such as self-registration, are not limited.
+func (s *Service) checkGrantable(ctx context.Context, permissions []string) error {
+	actorID := audit.SourceFrom(ctx).ActorID
+	if actorID == nil {
+		return nil
+	}
+
+	// Inside an organization the actor has their role there
+	actor, err := s.repo.GetUserByID(ctx, *actorID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if actor == nil {
+		return Forbidden("you cannot grant permissions you do not have")
+	}
+	held, err := s.RolePermissions(ctx, actor.Role)
+	if err != nil {
+		return err
+	}
+
+	for _, permission := range permissions {
+		if !held.Has(permission) {
+			return Forbidden(fmt.Sprintf("you cannot grant the %s permission, which you do not have", permission))
+		}
+	}
+	return nil
+}
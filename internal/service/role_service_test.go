@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"go-backend-starter/internal/audit"
+	"go-backend-starter/internal/config"
+	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/tenant"
+)
+
+// asActor returns a context for a request made by a user
+func asActor(ctx context.Context, userID int) context.Context {
+	return audit.WithSource(ctx, audit.Source{ActorID: &userID})
+}
+
+// createRole creates a custom role with the given permissions
+func (ts *testService) createRole(t *testing.T, name string, permissions ...string) {
+	t.Helper()
+
+	if _, err := ts.CreateRole(context.Background(), &models.CreateRoleInput{Name: name, Permissions: permissions}); err != nil {
+		t.Fatalf("create role %s: %v", name, err)
+	}
+}
+
+func TestRoleAssignmentsAreLimitedToTheActorsPermissions(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+	ts.createRole(t, "helpdesk", models.PermissionUsersRead, models.PermissionUsersWrite)
+	helen := ts.createUser(t, "helen", "helpdesk")
+	bob := ts.createUser(t, "bob", models.RoleUser)
+	actx := asActor(ctx, helen.ID)
+
+	newUser := func(username, role string) error {
+		_, err := ts.CreateUser(actx, &models.CreateUserInput{
+			Username: username, Password: testPassword, Email: username + "@example.com", Role: role,
+		})
+		return err
+	}
+
+	expectKind(t, newUser("mallory", models.RoleAdmin), ErrForbidden)
+	if err := newUser("carol", "helpdesk"); err != nil {
+		t.Errorf("create user with the actor's own role: %v", err)
+	}
+	if err := newUser("dave", models.RoleUser); err != nil {
+		t.Errorf("create user with a lesser role: %v", err)
+	}
+
+	_, err := ts.UpdateUser(actx, bob.ID, &models.UpdateUserInput{Role: models.RoleAdmin})
+	expectKind(t, err, ErrForbidden)
+	_, err = ts.UpdateUser(actx, helen.ID, &models.UpdateUserInput{Role: models.RoleAdmin})
+	expectKind(t, err, ErrForbidden)
+	if _, err := ts.UpdateUser(actx, bob.ID, &models.UpdateUserInput{Role: "helpdesk"}); err != nil {
+		t.Errorf("update user to the actor's own role: %v", err)
+	}
+
+	// Roles cannot be used to grant more either
+	_, err = ts.CreateRole(actx, &models.CreateRoleInput{Name: "auditor", Permissions: []string{models.PermissionAuditRead}})
+	expectKind(t, err, ErrForbidden)
+	_, err = ts.UpdateRole(actx, "helpdesk", &models.UpdateRoleInput{
+		Permissions: []string{models.PermissionUsersRead, models.PermissionUsersWrite, models.PermissionUsersDelete},
+	})
+	expectKind(t, err, ErrForbidden)
+
+	// Without an actor, as for self-registration, nothing is limited
+	if _, err := ts.UpdateUser(ctx, bob.ID, &models.UpdateUserInput{Role: models.RoleAdmin}); err != nil {
+		t.Errorf("update without an actor: %v", err)
+	}
+}
+
+func TestRoleAssignmentsInOrganizationsUseTheActorsRoleThere(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+	ts.createRole(t, "manager", models.PermissionUsersRead, models.PermissionUsersWrite, models.PermissionOrgsWrite)
+	org, err := ts.CreateOrganization(ctx, 1, &models.CreateOrganizationInput{Name: "Acme", Slug: "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	octx := tenant.WithOrganization(ctx, org.ID)
+
+	// Helen is a regular user, but manages Acme
+	helen := ts.createUser(t, "helen", models.RoleUser)
+	ts.createUser(t, "bob", models.RoleUser)
+	ts.join(t, octx, helen, "manager")
+
+	_, err = ts.InviteOrganizationMember(asActor(octx, helen.ID), &models.InviteMemberInput{Email: "bob@example.com", Role: models.RoleAdmin})
+	expectKind(t, err, ErrForbidden)
+	if _, err := ts.InviteOrganizationMember(asActor(octx, helen.ID), &models.InviteMemberInput{Email: "bob@example.com", Role: "manager"}); err != nil {
+		t.Errorf("invite member with the actor's role there: %v", err)
+	}
+
+	// Outside Acme she has her global role
+	_, err = ts.CreateUser(asActor(ctx, helen.ID), &models.CreateUserInput{
+		Username: "carol", Password: testPassword, Email: "carol@example.com", Role: "manager",
+	})
+	expectKind(t, err, ErrForbidden)
+}
+
+func TestRolePermissionsCache(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t, func(cfg *config.Config) { cfg.Auth.PermissionCacheTTL = 60 })
+	ts.createRole(t, "helpdesk", models.PermissionUsersRead)
+	replica := ts.replica()
+
+	for _, s := range []*Service{ts.Service, replica} {
+		permissions, err := s.RolePermissions(ctx, "helpdesk")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !permissions.Has(models.PermissionUsersRead) || permissions.Has(models.PermissionUsersWrite) {
+			t.Fatalf("RolePermissions = %v, want users:read", permissions)
+		}
+	}
+
+	if _, err := ts.UpdateRole(ctx, "helpdesk", &models.UpdateRoleInput{
+		Permissions: []string{models.PermissionUsersRead, models.PermissionUsersWrite},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The process that made the change sees it at once, others once their entry expires
+	if permissions, err := ts.RolePermissions(ctx, "helpdesk"); err != nil || !permissions.Has(models.PermissionUsersWrite) {
+		t.Errorf("RolePermissions after the update = %v, %v; want users:write", permissions, err)
+	}
+	if permissions, err := replica.RolePermissions(ctx, "helpdesk"); err != nil || permissions.Has(models.PermissionUsersWrite) {
+		t.Errorf("replica RolePermissions = %v, %v; want the cached permissions", permissions, err)
+	}
+
+	if err := ts.DeleteRole(ctx, "helpdesk"); err != nil {
+		t.Fatal(err)
+	}
+	if permissions, err := ts.RolePermissions(ctx, "helpdesk"); err != nil || len(permissions) != 0 {
+		t.Errorf("RolePermissions after the delete = %v, %v; want none", permissions, err)
+	}
+}
+
+func TestRolesCannotBeChangedFromAnOrganization(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+	acme := ts.createOrganization(t, "acme")
+
+	// Olivia administers Acme only
+	olivia := ts.createUser(t, "olivia", models.RoleUser)
+	ts.join(t, acme, olivia, models.RoleAdmin)
+	actx := asActor(acme, olivia.ID)
+
+	// The user role applies in every organization, and to users in none
+	_, err := ts.UpdateRole(actx, models.RoleUser, &models.UpdateRoleInput{Permissions: []string{models.PermissionUsersWrite}})
+	expectKind(t, err, ErrForbidden)
+	_, err = ts.CreateRole(actx, &models.CreateRoleInput{Name: "helpdesk", Permissions: []string{models.PermissionUsersRead}})
+	expectKind(t, err, ErrForbidden)
+	ts.createRole(t, "auditor", models.PermissionAuditRead)
+	expectKind(t, ts.DeleteRole(actx, "auditor"), ErrForbidden)
+
+	if permissions, err := ts.RolePermissions(ctx, models.RoleUser); err != nil || permissions.Has(models.PermissionUsersWrite) {
+		t.Errorf("user role permissions = %v, %v; want them unchanged", permissions, err)
+	}
+
+	// A global admin acting in Acme still may
+	if _, err := ts.CreateRole(asActor(acme, 1), &models.CreateRoleInput{Name: "helpdesk", Permissions: []string{models.PermissionUsersRead}}); err != nil {
+		t.Errorf("create role as a global admin: %v", err)
+	}
+}
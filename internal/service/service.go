@@ -1,21 +1,59 @@
 package service
 
 import (
+	"context"
+	"time"
+
+	"go-backend-starter/internal/config"
+	"go-backend-starter/internal/mailer"
 	"go-backend-starter/internal/repository"
+	"go-backend-starter/internal/utils"
 )
 
 // Service handles all business logic
 type Service struct {
-	repo          repository.Repository
-	jwtSecret     string
-	jwtExpiration int
+	repo              repository.Repository
+	jwtKeys           *utils.KeySet
+	hasher            utils.PasswordHasher
+	dummyPassword     *dummyPassword
+	passwordPolicy    *PasswordPolicy
+	jwtExpiration     int
+	refreshExpiration int
+	revocations       *revocationCache
+	permissions       *permissionCache
+	auth              config.AuthConfig
+	mailer            mailer.Mailer
+	txOptions         repository.TxOptions
 }
 
 // NewService creates a new service
-func NewService(repo repository.Repository, jwtSecret string, jwtExpiration int) *Service {
+func NewService(repo repository.Repository, cfg *config.Config, jwtKeys *utils.KeySet, hasher utils.PasswordHasher, passwordPolicy *PasswordPolicy, mailer mailer.Mailer) *Service {
 	return &Service{
-		repo:          repo,
-		jwtSecret:     jwtSecret,
-		jwtExpiration: jwtExpiration,
+		repo:              repo,
+		jwtKeys:           jwtKeys,
+		hasher:            hasher,
+		dummyPassword:     &dummyPassword{},
+		passwordPolicy:    passwordPolicy,
+		jwtExpiration:     cfg.JWT.Expiration,
+		refreshExpiration: cfg.JWT.RefreshExpiration,
+		revocations:       newRevocationCache(time.Duration(cfg.JWT.RevocationCacheTTL) * time.Second),
+		permissions:       newPermissionCache(time.Duration(cfg.Auth.PermissionCacheTTL) * time.Second),
+		auth:              cfg.Auth,
+		mailer:            mailer,
+		txOptions: repository.TxOptions{
+			Isolation:  repository.IsolationLevel(cfg.Database.IsolationLevel),
+			MaxRetries: cfg.Database.TxMaxRetries,
+		},
 	}
 }
+
+// inTx runs fn as a unit of work. The service passed to fn uses a repository
+// bound to the transaction, so every repository call it makes, including
+// those of helpers, is part of it. fn may run more than once.
+func (s *Service) inTx(ctx context.Context, fn func(tx *Service) error) error {
+	return s.repo.WithTx(ctx, s.txOptions, func(repo repository.Repository) error {
+		tx := *s
+		tx.repo = repo
+		return fn(&tx)
+	})
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"go-backend-starter/internal/config"
+	"go-backend-starter/internal/mailer"
+	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/repository"
+	"go-backend-starter/internal/utils"
+
+	"github.com/rs/zerolog"
+)
+
+const testPassword = "correct horse battery"
+
+func TestMain(m *testing.M) {
+	// Failed logins and mail delivery are logged; keep test output readable
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	os.Exit(m.Run())
+}
+
+// mailbox is a mailer that keeps the messages it is given
+type mailbox struct {
+	mu       sync.Mutex
+	messages []*mailer.Message
+	err      error // returned by Send when set
+}
+
+func (m *mailbox) Send(ctx context.Context, msg *mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return m.err
+	}
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// sent returns the messages delivered so far
+func (m *mailbox) sent() []*mailer.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]*mailer.Message(nil), m.messages...)
+}
+
+// testService is a service over an in-memory repository
+type testService struct {
+	*Service
+	cfg  *config.Config
+	repo *repository.MemoryRepository
+	mail *mailbox
+}
+
+// newTestService creates a service with a test configuration, which
+// configure may adjust. The seeded admin has the password testPassword.
+func newTestService(t *testing.T, configure ...func(cfg *config.Config)) *testService {
+	t.Helper()
+
+	cfg := &config.Config{
+		JWT:      config.JWTConfig{Expiration: 60, RefreshExpiration: 60},
+		Auth:     config.AuthConfig{ImpersonationExpiration: 15, MFAChallengeExpiration: 5, LockoutDuration: 15},
+		Password: config.PasswordConfig{MinLength: 8, MaxLength: 128},
+	}
+	for _, fn := range configure {
+		fn(cfg)
+	}
+
+	policy, err := NewPasswordPolicy(&cfg.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := &testService{cfg: cfg, repo: repository.NewMemoryRepository(), mail: &mailbox{}}
+	hasher := &utils.BcryptHasher{Cost: 4}
+	ts.Service = NewService(ts.repo, cfg, utils.NewHMACKeySet("test-secret"), hasher, policy, ts.mail)
+
+	hash, err := hasher.Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.repo.UpdateUserPasswordHash(context.Background(), 1, hash); err != nil {
+		t.Fatal(err)
+	}
+
+	return ts
+}
+
+// replica returns another service over the same repository, like a second
+// server process: it shares no caches with ts
+func (ts *testService) replica() *Service {
+	return NewService(ts.repo, ts.cfg, ts.jwtKeys, ts.hasher, ts.passwordPolicy, ts.mail)
+}
+
+// createUser creates a user with the test password and a verified address
+func (ts *testService) createUser(t *testing.T, username, role string) *models.User {
+	t.Helper()
+
+	user, err := ts.CreateUser(context.Background(), &models.CreateUserInput{
+		Username: username,
+		Password: testPassword,
+		Email:    username + "@example.com",
+		Role:     role,
+	})
+	if err != nil {
+		t.Fatalf("create user %s: %v", username, err)
+	}
+	return user
+}
+
+// login logs in with the test password and fails on an MFA challenge
+func (ts *testService) login(t *testing.T, username string) *models.AuthTokens {
+	t.Helper()
+
+	tokens, challenge, err := ts.Login(context.Background(), &models.LoginInput{Username: username, Password: testPassword}, "192.0.2.1")
+	if err != nil {
+		t.Fatalf("login as %s: %v", username, err)
+	}
+	if challenge != nil {
+		t.Fatalf("login as %s: unexpected MFA challenge", username)
+	}
+	return tokens
+}
+
+// expectKind fails unless err is of the given kind, such as ErrNotFound
+func expectKind(t *testing.T, err, kind error) {
+	t.Helper()
+
+	if !errors.Is(err, kind) {
+		t.Fatalf("error = %v, want %v", err, kind)
+	}
+}
+
+// totpCode computes the TOTP code of a secret at a time, as an authenticator
+// app would
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(at.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1000000)
+}
+
+// enableMFA enrolls a user in TOTP with a code of the previous time step, so
+// that codes of the current and next steps are still unused. It returns the
+// secret and the recovery codes.
+func (ts *testService) enableMFA(t *testing.T, userID int) (string, []string) {
+	t.Helper()
+	ctx := context.Background()
+
+	enrollment, err := ts.EnrollTOTP(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := ts.ConfirmTOTP(ctx, userID, totpCode(t, enrollment.Secret, time.Now().Add(-30*time.Second)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enrollment.Secret, codes.RecoveryCodes
+}
+
+// loginMFA logs in with the test password and completes the MFA challenge
+// with the given input
+func (ts *testService) loginMFA(t *testing.T, username string, input models.MFALoginInput) (*models.AuthTokens, error) {
+	t.Helper()
+	ctx := context.Background()
+
+	_, challenge, err := ts.Login(ctx, &models.LoginInput{Username: username, Password: testPassword}, "192.0.2.1")
+	if err != nil {
+		t.Fatalf("login as %s: %v", username, err)
+	}
+	if challenge == nil {
+		t.Fatalf("login as %s: no MFA challenge", username)
+	}
+
+	input.MFAToken = challenge.MFAToken
+	return ts.LoginMFA(ctx, &input, "192.0.2.1")
+}
@@ -5,55 +5,126 @@ import (
 	"errors"
 	"fmt"
 	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/utils"
+	"time"
 )
 
 // GetUserByID retrieves a user by ID
 func (s *Service) GetUserByID(ctx context.Context, id int) (*models.User, error) {
-	return s.repo.GetUserByID(ctx, id)
+	user, err := s.repo.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, NotFound("user not found")
+	}
+
+	return user, nil
 }
 
-// CreateUser creates a new user with validation
+// CreateUser creates a new user with validation. Accounts created by an
+// admin do not need to verify their email address.
 func (s *Service) CreateUser(ctx context.Context, input *models.CreateUserInput) (*models.User, error) {
-	// Check if username already exists
-	existingUser, err := s.repo.GetUserByUsername(ctx, input.Username)
+	input.EmailVerified = true
+	return s.createUser(ctx, input)
+}
+
+// createUser checks for duplicates and stores the user. The checks and the
+// insert are one unit of work, so two requests for the same username or
+// email cannot both pass the checks.
+func (s *Service) createUser(ctx context.Context, input *models.CreateUserInput) (*models.User, error) {
+	if err := s.prepareNewUserPassword(ctx, input); err != nil {
+		return nil, err
+	}
+
+	var user *models.User
+	err := s.inTx(ctx, func(tx *Service) error {
+		// Check if username already exists
+		existingUser, err := tx.repo.GetUserByUsername(ctx, input.Username)
+		if err != nil {
+			return fmt.Errorf("failed to check username: %w", err)
+		}
+		if existingUser != nil {
+			return Conflict("username already exists")
+		}
+
+		// Check if email already exists
+		existingUser, err = tx.repo.GetUserByEmail(ctx, input.Email)
+		if err != nil {
+			return fmt.Errorf("failed to check email: %w", err)
+		}
+		if existingUser != nil {
+			return Conflict("email already exists")
+		}
+
+		if err := tx.checkRoleExists(ctx, input.Role); err != nil {
+			return err
+		}
+		if err := tx.checkRoleAssignable(ctx, input.Role); err != nil {
+			return err
+		}
+
+		// The unique constraints still back up the checks above
+		user, err = tx.repo.CreateUser(ctx, input)
+		if err != nil {
+			return translateRepoError(err)
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to check username: %w", err)
+		return nil, err
 	}
-	if existingUser != nil {
-		return nil, errors.New("username already exists")
+
+	return user, nil
+}
+
+// UpdateUser updates an existing user with validation. The checks, the update
+// and the password history are one unit of work.
+func (s *Service) UpdateUser(ctx context.Context, id int, input *models.UpdateUserInput) (*models.User, error) {
+	if err := s.prepareUpdatedPassword(ctx, id, input); err != nil {
+		return nil, err
 	}
 
-	// Check if email already exists
-	existingUser, err = s.repo.GetUserByEmail(ctx, input.Email)
+	var user, updatedUser *models.User
+	err := s.inTx(ctx, func(tx *Service) error {
+		var err error
+		user, updatedUser, err = tx.updateUser(ctx, id, input)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to check email: %w", err)
+		return nil, err
 	}
-	if existingUser != nil {
-		return nil, errors.New("email already exists")
+
+	// Tokens carry the role, and a password change should end other sessions
+	if updatedUser.Role != user.Role || input.Password != "" {
+		if err := s.RevokeUserTokens(ctx, id); err != nil {
+			return nil, err
+		}
 	}
 
-	return s.repo.CreateUser(ctx, input)
+	return updatedUser, nil
 }
 
-// UpdateUser updates an existing user with validation
-func (s *Service) UpdateUser(ctx context.Context, id int, input *models.UpdateUserInput) (*models.User, error) {
+// updateUser does the work of UpdateUser and returns the user before and
+// after the update
+func (s *Service) updateUser(ctx context.Context, id int, input *models.UpdateUserInput) (*models.User, *models.User, error) {
 	// Check if user exists
 	user, err := s.repo.GetUserByID(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user: %w", err)
+		return nil, nil, fmt.Errorf("failed to get user: %w", err)
 	}
 	if user == nil {
-		return nil, errors.New("user not found")
+		return nil, nil, NotFound("user not found")
 	}
 
 	// Validate username uniqueness if changed
 	if input.Username != "" && input.Username != user.Username {
 		existingUser, err := s.repo.GetUserByUsername(ctx, input.Username)
 		if err != nil {
-			return nil, fmt.Errorf("failed to check username: %w", err)
+			return nil, nil, fmt.Errorf("failed to check username: %w", err)
 		}
 		if existingUser != nil {
-			return nil, errors.New("username already exists")
+			return nil, nil, Conflict("username already exists")
 		}
 	}
 
@@ -61,22 +132,286 @@ func (s *Service) UpdateUser(ctx context.Context, id int, input *models.UpdateUs
 	if input.Email != "" && input.Email != user.Email {
 		existingUser, err := s.repo.GetUserByEmail(ctx, input.Email)
 		if err != nil {
-			return nil, fmt.Errorf("failed to check email: %w", err)
+			return nil, nil, fmt.Errorf("failed to check email: %w", err)
 		}
 		if existingUser != nil {
-			return nil, errors.New("email already exists")
+			return nil, nil, Conflict("email already exists")
 		}
 	}
 
-	return s.repo.UpdateUser(ctx, id, input)
+	if input.Role != "" && input.Role != user.Role {
+		if err := s.checkRoleExists(ctx, input.Role); err != nil {
+			return nil, nil, err
+		}
+		if err := s.checkRoleAssignable(ctx, input.Role); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Account fields are shared by every organization the user belongs to
+	if input.Username != "" || input.Email != "" || input.Password != "" {
+		if err := s.checkAccountOwned(ctx, id); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	updatedUser, err := s.repo.UpdateUser(ctx, id, input)
+	if err != nil {
+		return nil, nil, translateRepoError(err)
+	}
+	if updatedUser == nil {
+		return nil, nil, NotFound("user not found")
+	}
+
+	if input.Password != "" {
+		if err := s.rememberPassword(ctx, id, user.PasswordHash); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return user, updatedUser, nil
 }
 
-// DeleteUser deletes a user
+// DeleteUser soft deletes a user and revokes their tokens, as one unit of
+// work. The user can be brought back with RestoreUser until it is purged.
 func (s *Service) DeleteUser(ctx context.Context, id int) error {
-	return s.repo.DeleteUser(ctx, id)
+	var revokedBefore time.Time
+	err := s.inTx(ctx, func(tx *Service) error {
+		if err := tx.checkAccountOwned(ctx, id); err != nil {
+			return err
+		}
+
+		deleted, err := tx.repo.DeleteUser(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			return NotFound("user not found")
+		}
+
+		revokedBefore, err = tx.revokeUserTokens(ctx, id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	s.revocations.setUser(id, &revokedBefore)
+
+	return nil
 }
 
-// ListUsers retrieves a list of users with pagination
-func (s *Service) ListUsers(ctx context.Context, offset, limit int) ([]*models.User, error) {
-	return s.repo.ListUsers(ctx, offset, limit)
+// RestoreUser brings back a soft deleted user
+func (s *Service) RestoreUser(ctx context.Context, id int) (*models.User, error) {
+	var user *models.User
+	err := s.inTx(ctx, func(tx *Service) error {
+		if err := tx.checkAccountOwned(ctx, id); err != nil {
+			return err
+		}
+
+		var err error
+		user, err = tx.repo.RestoreUser(ctx, id)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return NotFound("deleted user not found")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// PurgeUser permanently deletes a user, active or soft deleted, and revokes
+// their tokens as one unit of work
+func (s *Service) PurgeUser(ctx context.Context, id int) error {
+	var revokedBefore time.Time
+	err := s.inTx(ctx, func(tx *Service) error {
+		if err := tx.checkAccountOwned(ctx, id); err != nil {
+			return err
+		}
+
+		purged, err := tx.repo.PurgeUser(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !purged {
+			return NotFound("user not found")
+		}
+
+		revokedBefore, err = tx.revokeUserTokens(ctx, id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	s.revocations.setUser(id, &revokedBefore)
+
+	return nil
+}
+
+// ListUsers retrieves a page of users. Pages are addressed with opaque
+// cursors rather than offsets, so deep pages stay cheap and stable while
+// users are being added.
+func (s *Service) ListUsers(ctx context.Context, input *models.ListUsersInput) (*models.UserPage, error) {
+	return s.listUsers(ctx, input, false)
+}
+
+// ListDeletedUsers retrieves a page of soft deleted users
+func (s *Service) ListDeletedUsers(ctx context.Context, input *models.ListUsersInput) (*models.UserPage, error) {
+	return s.listUsers(ctx, input, true)
+}
+
+func (s *Service) listUsers(ctx context.Context, input *models.ListUsersInput, deleted bool) (*models.UserPage, error) {
+	field, descending := parseSort(input.Sort)
+
+	limit := input.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	filter := models.UserFilter{
+		Role:          input.Role,
+		CreatedAfter:  input.CreatedAfter,
+		CreatedBefore: input.CreatedBefore,
+		Search:        input.Search,
+		Deleted:       deleted,
+	}
+
+	query := &models.UserListQuery{
+		UserFilter: filter,
+		SortField:  field,
+		Descending: descending,
+		Limit:      limit + 1, // one extra row tells whether another page follows
+	}
+
+	backwards := false
+	if input.Cursor != "" {
+		c, err := decodeCursor(input.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if c.Sort != input.Sort {
+			return nil, Validation("cursor does not match the requested sort")
+		}
+		if query.After, err = cursorKey(c, field); err != nil {
+			return nil, err
+		}
+
+		// Walking backwards is walking forwards in the reverse order
+		backwards = c.Prev
+		if backwards {
+			query.Descending = !query.Descending
+		}
+	}
+
+	users, err := s.repo.ListUsers(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	hasMore := len(users) > limit
+	if hasMore {
+		users = users[:limit]
+	}
+	if backwards {
+		for i, j := 0, len(users)-1; i < j; i, j = i+1, j-1 {
+			users[i], users[j] = users[j], users[i]
+		}
+	}
+
+	page := &models.UserPage{Data: users}
+	if page.Data == nil {
+		page.Data = []*models.User{}
+	}
+
+	if len(users) > 0 {
+		first, last := users[0], users[len(users)-1]
+		// Going forward there is a previous page if we came from a cursor, and
+		// a next page if the extra row was found; going backward it is the
+		// other way around
+		if (!backwards && hasMore) || (backwards && input.Cursor != "") {
+			page.NextCursor = encodeCursor(cursor{Sort: input.Sort, Value: userSortValue(last, field), ID: last.ID})
+		}
+		if (backwards && hasMore) || (!backwards && input.Cursor != "") {
+			page.PrevCursor = encodeCursor(cursor{Sort: input.Sort, Value: userSortValue(first, field), ID: first.ID, Prev: true})
+		}
+	}
+
+	if input.IncludeTotal {
+		total, err := s.repo.CountUsers(ctx, &filter)
+		if err != nil {
+			return nil, err
+		}
+		page.Total = &total
+	}
+
+	return page, nil
+}
+
+// prepareNewUserPassword checks the password of a new user against the
+// policy and hashes it. It runs before the unit of work, which then neither
+// holds a transaction open during the slow hash nor hashes again on a retry.
+func (s *Service) prepareNewUserPassword(ctx context.Context, input *models.CreateUserInput) error {
+	if input.PasswordHash != "" {
+		return nil
+	}
+	if err := s.checkNewPassword(ctx, input.Password, input.Username, input.Email, nil); err != nil {
+		return err
+	}
+
+	passwordHash, err := s.hashPassword(input.Password)
+	if err != nil {
+		return err
+	}
+	input.PasswordHash = passwordHash
+	return nil
+}
+
+// prepareUpdatedPassword is prepareNewUserPassword for a password change,
+// which is also checked against the user's password history
+func (s *Service) prepareUpdatedPassword(ctx context.Context, id int, input *models.UpdateUserInput) error {
+	if input.Password == "" || input.PasswordHash != "" {
+		return nil
+	}
+
+	user, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	username, email := user.Username, user.Email
+	if input.Username != "" {
+		username = input.Username
+	}
+	if input.Email != "" {
+		email = input.Email
+	}
+	if err := s.checkNewPassword(ctx, input.Password, username, email, user); err != nil {
+		return err
+	}
+
+	passwordHash, err := s.hashPassword(input.Password)
+	if err != nil {
+		return err
+	}
+	input.PasswordHash = passwordHash
+	return nil
+}
+
+// hashPassword hashes a password with the configured algorithm
+func (s *Service) hashPassword(password string) (string, error) {
+	passwordHash, err := s.hasher.Hash(password)
+	if errors.Is(err, utils.ErrPasswordTooLong) {
+		return "", Validation("password is too long")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return passwordHash, nil
 }
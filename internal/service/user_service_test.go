@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go-backend-starter/internal/config"
+	"go-backend-starter/internal/models"
+	"go-backend-starter/internal/repository"
+	"go-backend-starter/internal/utils"
+)
+
+// failingAPIKeyRepo is a repository that cannot delete API keys, which
+// RevokeUserTokens does last
+type failingAPIKeyRepo struct {
+	repository.Repository
+}
+
+func (r *failingAPIKeyRepo) WithTx(ctx context.Context, opts repository.TxOptions, fn func(repo repository.Repository) error) error {
+	return r.Repository.WithTx(ctx, opts, func(repo repository.Repository) error {
+		return fn(&failingAPIKeyRepo{Repository: repo})
+	})
+}
+
+func (r *failingAPIKeyRepo) DeleteUserAPIKeys(ctx context.Context, userID int) error {
+	return errors.New("api keys unavailable")
+}
+
+// txTrackingRepo is a repository that knows whether a unit of work is under way
+type txTrackingRepo struct {
+	repository.Repository
+	inTx bool
+}
+
+func (r *txTrackingRepo) WithTx(ctx context.Context, opts repository.TxOptions, fn func(repo repository.Repository) error) error {
+	r.inTx = true
+	defer func() { r.inTx = false }()
+	return r.Repository.WithTx(ctx, opts, fn)
+}
+
+// txDetectingHasher notes whether it hashed while a unit of work was under way
+type txDetectingHasher struct {
+	utils.PasswordHasher
+	repo       *txTrackingRepo
+	hashedInTx bool
+}
+
+func (h *txDetectingHasher) Hash(password string) (string, error) {
+	if h.repo.inTx {
+		h.hashedInTx = true
+	}
+	return h.PasswordHasher.Hash(password)
+}
+
+func TestDeleteUser(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+	user := ts.createUser(t, "alice", models.RoleUser)
+	tokens := ts.login(t, "alice")
+
+	if err := ts.DeleteUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := ts.GetUserByID(ctx, user.ID)
+	expectKind(t, err, ErrNotFound)
+	_, err = ts.ValidateToken(ctx, tokens.Token)
+	expectKind(t, err, ErrUnauthorized)
+	_, _, err = ts.Login(ctx, &models.LoginInput{Username: "alice", Password: testPassword}, "192.0.2.1")
+	expectKind(t, err, ErrUnauthorized)
+	expectKind(t, ts.DeleteUser(ctx, user.ID), ErrNotFound)
+
+	// The username stays taken while the user can be restored
+	_, err = ts.CreateUser(ctx, &models.CreateUserInput{Username: "alice", Password: testPassword, Email: "other@example.com", Role: models.RoleUser})
+	expectKind(t, err, ErrConflict)
+
+	page, err := ts.ListDeletedUsers(ctx, &models.ListUsersInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Data) != 1 || page.Data[0].ID != user.ID || page.Data[0].DeletedAt == nil {
+		t.Errorf("deleted users = %+v", page.Data)
+	}
+}
+
+func TestRestoreUser(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+	user := ts.createUser(t, "alice", models.RoleUser)
+
+	_, err := ts.RestoreUser(ctx, user.ID)
+	expectKind(t, err, ErrNotFound)
+
+	if err := ts.DeleteUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := ts.RestoreUser(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.DeletedAt != nil {
+		t.Errorf("restored user has deleted_at %v", restored.DeletedAt)
+	}
+
+	// Tokens revoked by the deletion stay revoked, but logging in works again
+	ts.login(t, "alice")
+}
+
+func TestPurgeUser(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+	active := ts.createUser(t, "alice", models.RoleUser)
+	deleted := ts.createUser(t, "bob", models.RoleUser)
+	if err := ts.DeleteUser(ctx, deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, user := range []*models.User{active, deleted} {
+		if err := ts.PurgeUser(ctx, user.ID); err != nil {
+			t.Fatalf("purge %s: %v", user.Username, err)
+		}
+		_, err := ts.RestoreUser(ctx, user.ID)
+		expectKind(t, err, ErrNotFound)
+		expectKind(t, ts.PurgeUser(ctx, user.ID), ErrNotFound)
+	}
+
+	// Purging frees the username
+	ts.createUser(t, "alice", models.RoleUser)
+}
+
+func TestDeleteAndPurgeAreOneUnitOfWork(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t, func(cfg *config.Config) { cfg.JWT.RevocationCacheTTL = 60 })
+	user := ts.createUser(t, "alice", models.RoleUser)
+	tokens := ts.login(t, "alice")
+	failing := NewService(&failingAPIKeyRepo{Repository: ts.repo}, ts.cfg, ts.jwtKeys, ts.hasher, ts.passwordPolicy, ts.mail)
+
+	for name, remove := range map[string]func(ctx context.Context, id int) error{
+		"delete": failing.DeleteUser,
+		"purge":  failing.PurgeUser,
+	} {
+		if err := remove(ctx, user.ID); err == nil {
+			t.Fatalf("%s succeeded without revoking the tokens", name)
+		}
+		if _, err := ts.GetUserByID(ctx, user.ID); err != nil {
+			t.Errorf("user after a failed %s: %v", name, err)
+		}
+		// Nor does the revocation cache of the process that tried
+		if _, err := failing.ValidateToken(ctx, tokens.Token); err != nil {
+			t.Errorf("token after a failed %s: %v", name, err)
+		}
+	}
+}
+
+func TestPasswordsAreHashedOutsideTheUnitOfWork(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t, enableRegistration)
+	repo := &txTrackingRepo{Repository: ts.repo}
+	hasher := &txDetectingHasher{PasswordHasher: ts.hasher, repo: repo}
+	s := NewService(repo, ts.cfg, ts.jwtKeys, hasher, ts.passwordPolicy, ts.mail)
+
+	user, err := s.CreateUser(ctx, &models.CreateUserInput{
+		Username: "alice", Password: testPassword, Email: "alice@example.com", Role: models.RoleUser,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UpdateUser(ctx, user.ID, &models.UpdateUserInput{Password: "another password"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register(ctx, &models.RegisterInput{Username: "bob", Password: testPassword, Email: "bob@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if hasher.hashedInTx {
+		t.Error("a password was hashed inside a unit of work")
+	}
+}
@@ -0,0 +1,19 @@
+// Package tenant carries the organization a request acts in. The repository
+// scopes user queries to the organization found in the context.
+package tenant
+
+import "context"
+
+type contextKey struct{}
+
+// WithOrganization returns a context scoped to an organization. An ID of 0
+// returns an unscoped context, for lookups that must see every user.
+func WithOrganization(ctx context.Context, organizationID int) context.Context {
+	return context.WithValue(ctx, contextKey{}, organizationID)
+}
+
+// OrganizationID returns the organization a context is scoped to
+func OrganizationID(ctx context.Context) (int, bool) {
+	id, ok := ctx.Value(contextKey{}).(int)
+	return id, ok && id != 0
+}
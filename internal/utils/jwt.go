@@ -9,25 +9,58 @@ import (
 )
 
 type JWTClaims struct {
+	UserID   int      `json:"user_id"`
+	Username string   `json:"username"`
+	Role     string   `json:"role"`
+	OrgID    int      `json:"org_id,omitempty"` // default organization, 0 for users without one
+	AMR      []string `json:"amr,omitempty"`    // authentication methods (RFC 8176): "pwd", plus "mfa" after a second factor; "apikey" for API key requests
+	Act      *Actor   `json:"act,omitempty"`    // set when another user is impersonating this one (RFC 8693)
+	jwt.RegisteredClaims
+}
+
+// Actor identifies the user acting on behalf of the token's subject
+type Actor struct {
 	UserID   int    `json:"user_id"`
 	Username string `json:"username"`
-	Role     string `json:"role"`
-	jwt.RegisteredClaims
 }
 
-func GenerateJWT(userID int, username, role, secret string, expMinutes int) (string, error) {
-	claims := JWTClaims{
-		UserID:   userID,
-		Username: username,
-		Role:     role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(expMinutes) * time.Minute)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+// HasAMR reports whether the token was issued after the given authentication method
+func (c *JWTClaims) HasAMR(method string) bool {
+	for _, m := range c.AMR {
+		if m == method {
+			return true
+		}
 	}
+	return false
+}
+
+// GenerateJWT signs an access token with the given claims. The expiry, issue
+// time and token ID are filled in.
+func GenerateJWT(claims JWTClaims, keys *KeySet, expMinutes int) (string, error) {
+	return GenerateJWTIssuedAt(claims, keys, expMinutes, time.Now())
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(secret))
+// GenerateJWTIssuedAt is GenerateJWT with the issue time given, for tokens
+// that must not predate a revocation cut-off
+func GenerateJWTIssuedAt(claims JWTClaims, keys *KeySet, expMinutes int, issuedAt time.Time) (string, error) {
+	// A unique token ID lets individual tokens be revoked
+	jti, err := GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(expMinutes) * time.Minute)),
+		IssuedAt:  jwt.NewNumericDate(issuedAt),
+		ID:        jti,
+	}
+
+	token := jwt.NewWithClaims(keys.signing.Method, claims)
+	if keys.signing.ID != "" {
+		token.Header["kid"] = keys.signing.ID
+	}
+
+	tokenString, err := token.SignedString(keys.signing.PrivateKey)
 	if err != nil {
 		return "", err
 	}
@@ -35,12 +68,18 @@ func GenerateJWT(userID int, username, role, secret string, expMinutes int) (str
 	return tokenString, nil
 }
 
-func ValidateJWT(tokenString, secret string) (*JWTClaims, error) {
+func ValidateJWT(tokenString string, keys *KeySet) (*JWTClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keys.Lookup(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown key id: %q", kid)
+		}
+		// The algorithm is pinned by the key, never taken from the token
+		if token.Method.Alg() != key.Method.Alg() {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(secret), nil
+		return key.PublicKey, nil
 	})
 
 	if err != nil {
@@ -0,0 +1,244 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-backend-starter/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writeKeyPair writes a private key and its public key as PEM files and
+// returns their paths
+func writeKeyPair(t *testing.T, name string, key crypto.Signer) (string, string) {
+	t.Helper()
+
+	private, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	privatePath := filepath.Join(dir, name+".pem")
+	publicPath := filepath.Join(dir, name+".pub.pem")
+	if err := os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: private}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return privatePath, publicPath
+}
+
+func TestAsymmetricKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		algorithm string
+		key       crypto.Signer
+		kty       string
+	}{
+		{"RS256", rsaKey, "RSA"},
+		{"ES256", ecKey, "EC"},
+		{"EdDSA", edKey, "OKP"},
+	} {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			private, _ := writeKeyPair(t, tt.algorithm, tt.key)
+			keys, err := LoadKeySet(&config.JWTConfig{
+				SigningKeyID: "current",
+				Keys:         []config.JWTKeyConfig{{ID: "current", Algorithm: tt.algorithm, PrivateKeyFile: private}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := GenerateJWT(JWTClaims{UserID: 7, Username: "alice", Role: "user"}, keys, 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &JWTClaims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Header["kid"] != "current" || parsed.Header["alg"] != tt.algorithm {
+				t.Errorf("header = %v, want kid current and alg %s", parsed.Header, tt.algorithm)
+			}
+
+			claims, err := ValidateJWT(token, keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.UserID != 7 || claims.Username != "alice" || claims.ID == "" {
+				t.Errorf("claims = %+v", claims)
+			}
+
+			jwks := keys.JWKS()
+			if len(jwks.Keys) != 1 || jwks.Keys[0].Kid != "current" || jwks.Keys[0].Kty != tt.kty || jwks.Keys[0].Alg != tt.algorithm {
+				t.Errorf("JWKS = %+v", jwks)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, newKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldPrivate, oldPublic := writeKeyPair(t, "old", oldKey)
+	newPrivate, _ := writeKeyPair(t, "new", newKey)
+
+	before, err := LoadKeySet(&config.JWTConfig{
+		SigningKeyID: "old",
+		Keys:         []config.JWTKeyConfig{{ID: "old", Algorithm: "ES256", PrivateKeyFile: oldPrivate}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := GenerateJWT(JWTClaims{UserID: 1}, before, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sign with the new key while still accepting the old one
+	after, err := LoadKeySet(&config.JWTConfig{
+		SigningKeyID: "new",
+		Keys: []config.JWTKeyConfig{
+			{ID: "new", Algorithm: "EdDSA", PrivateKeyFile: newPrivate},
+			{ID: "old", Algorithm: "ES256", PublicKeyFile: oldPublic},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateJWT(oldToken, after); err != nil {
+		t.Errorf("token signed with the old key: %v", err)
+	}
+	newToken, err := GenerateJWT(JWTClaims{UserID: 1}, after, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateJWT(newToken, after); err != nil {
+		t.Errorf("token signed with the new key: %v", err)
+	}
+	if _, err := ValidateJWT(newToken, before); err == nil {
+		t.Error("key set without the new key accepted its token")
+	}
+	if n := len(after.JWKS().Keys); n != 2 {
+		t.Errorf("JWKS has %d keys, want 2", n)
+	}
+}
+
+func TestValidateJWTRejectsAlgorithmSwitch(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, public := writeKeyPair(t, "rsa", key)
+	keys, err := LoadKeySet(&config.JWTConfig{
+		SigningKeyID: "rsa",
+		Keys:         []config.JWTKeyConfig{{ID: "rsa", Algorithm: "RS256", PrivateKeyFile: private}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// HS256 signed with the public key, which verifiers that trust the
+	// token's alg header would accept
+	publicPEM, err := os.ReadFile(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, JWTClaims{UserID: 1})
+	forged.Header["kid"] = "rsa"
+	token, err := forged.SignedString(publicPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateJWT(token, keys); err == nil {
+		t.Error("token with a switched algorithm was accepted")
+	}
+
+	unknown := jwt.NewWithClaims(jwt.SigningMethodRS256, JWTClaims{UserID: 1})
+	unknown.Header["kid"] = "other"
+	token, err = unknown.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateJWT(token, keys); err == nil || !strings.Contains(err.Error(), "unknown key id") {
+		t.Errorf("token with an unknown kid: error = %v", err)
+	}
+}
+
+func TestLoadKeySetErrors(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPrivate, rsaPublic := writeKeyPair(t, "rsa", rsaKey)
+	ecPrivate, _ := writeKeyPair(t, "ec", ecKey)
+
+	for _, tt := range []struct {
+		name string
+		cfg  config.JWTConfig
+	}{
+		{"no secret and no keys", config.JWTConfig{}},
+		{"unknown algorithm", config.JWTConfig{SigningKeyID: "a", Keys: []config.JWTKeyConfig{{ID: "a", Algorithm: "HS256", PrivateKeyFile: rsaPrivate}}}},
+		{"wrong key type", config.JWTConfig{SigningKeyID: "a", Keys: []config.JWTKeyConfig{{ID: "a", Algorithm: "EdDSA", PrivateKeyFile: rsaPrivate}}}},
+		{"wrong curve", config.JWTConfig{SigningKeyID: "a", Keys: []config.JWTKeyConfig{{ID: "a", Algorithm: "ES256", PrivateKeyFile: ecPrivate}}}},
+		{"missing key id", config.JWTConfig{Keys: []config.JWTKeyConfig{{Algorithm: "RS256", PrivateKeyFile: rsaPrivate}}}},
+		{"duplicate key id", config.JWTConfig{SigningKeyID: "a", Keys: []config.JWTKeyConfig{
+			{ID: "a", Algorithm: "RS256", PrivateKeyFile: rsaPrivate},
+			{ID: "a", Algorithm: "RS256", PublicKeyFile: rsaPublic},
+		}}},
+		{"signing key not configured", config.JWTConfig{SigningKeyID: "b", Keys: []config.JWTKeyConfig{{ID: "a", Algorithm: "RS256", PrivateKeyFile: rsaPrivate}}}},
+		{"signing key without private key", config.JWTConfig{SigningKeyID: "a", Keys: []config.JWTKeyConfig{{ID: "a", Algorithm: "RS256", PublicKeyFile: rsaPublic}}}},
+		{"missing file", config.JWTConfig{SigningKeyID: "a", Keys: []config.JWTKeyConfig{{ID: "a", Algorithm: "RS256", PrivateKeyFile: filepath.Join(t.TempDir(), "missing.pem")}}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadKeySet(&tt.cfg); err == nil {
+				t.Error("LoadKeySet succeeded")
+			}
+		})
+	}
+}
+
+func TestHMACKeysAreNotPublished(t *testing.T) {
+	if keys := NewHMACKeySet("secret").JWKS().Keys; len(keys) != 0 {
+		t.Errorf("JWKS = %+v, want no keys", keys)
+	}
+}
@@ -1,18 +1,191 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-backend-starter/internal/config"
+	"go-backend-starter/internal/metrics"
+
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func HashPassword(password string) (string, error) {
-	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// ErrPasswordTooLong is returned when hashing a password longer than the
+// algorithm can handle without truncating it
+var ErrPasswordTooLong = errors.New("password too long")
+
+// PasswordHasher hashes passwords with one algorithm. Every hasher verifies
+// hashes of all supported algorithms, so the algorithm can be changed without
+// locking existing users out; NeedsRehash tells when a stored hash should be
+// replaced.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, encoded string) (bool, error)
+	NeedsRehash(encoded string) bool
+}
+
+// NewPasswordHasher creates the hasher selected by the configuration
+func NewPasswordHasher(cfg *config.PasswordConfig) (PasswordHasher, error) {
+	switch cfg.Algorithm {
+	case "", "argon2id":
+		if cfg.Argon2Memory == 0 || cfg.Argon2Time == 0 || cfg.Argon2Parallelism == 0 {
+			return nil, fmt.Errorf("argon2id requires memory, time and parallelism")
+		}
+		return &Argon2idHasher{
+			Memory:      cfg.Argon2Memory,
+			Time:        cfg.Argon2Time,
+			Parallelism: cfg.Argon2Parallelism,
+		}, nil
+	case "bcrypt":
+		if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return &BcryptHasher{Cost: cfg.BcryptCost}, nil
+	default:
+		return nil, fmt.Errorf("unknown password hashing algorithm %q", cfg.Algorithm)
+	}
+}
+
+// observeHash records how long a password hashing operation took
+func observeHash(algorithm, operation string, start time.Time) {
+	metrics.PasswordHashDuration.WithLabelValues(algorithm, operation).Observe(time.Since(start).Seconds())
+}
+
+// verifyPassword checks a password against a hash of any supported algorithm
+func verifyPassword(password, encoded string) (bool, error) {
+	start := time.Now()
+
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		defer observeHash("argon2id", "verify", start)
+		params, salt, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return false, err
+		}
+		other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Parallelism, uint32(len(key)))
+		return subtle.ConstantTimeCompare(key, other) == 1, nil
+	case isBcryptHash(encoded):
+		defer observeHash("bcrypt", "verify", start)
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	default:
+		return false, errors.New("unsupported password hash format")
+	}
+}
+
+func isBcryptHash(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+// Argon2idHasher hashes passwords with argon2id (RFC 9106) and encodes them
+// in the PHC string format: $argon2id$v=19$m=<KiB>,t=<passes>,p=<lanes>$<salt>$<hash>
+type Argon2idHasher struct {
+	Memory      uint32 // in KiB
+	Time        uint32 // number of passes
+	Parallelism uint8
+}
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	defer observeHash("argon2id", "hash", time.Now())
+
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Parallelism, argon2KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Time, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *Argon2idHasher) Verify(password, encoded string) (bool, error) {
+	return verifyPassword(password, encoded)
+}
+
+// NeedsRehash reports whether a hash uses another algorithm or other parameters
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, _, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return params != *h || len(key) != argon2KeyLength
+}
+
+// decodeArgon2id parses an argon2id PHC string
+func decodeArgon2id(encoded string) (Argon2idHasher, []byte, []byte, error) {
+	var params Argon2idHasher
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, errors.New("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errors.New("unsupported argon2 version")
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id hash: %w", err)
+	}
+
+	return params, salt, key, nil
+}
+
+// BcryptHasher hashes passwords with bcrypt. bcrypt only looks at the first
+// 72 bytes of a password, so longer passwords are rejected.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	defer observeHash("bcrypt", "hash", time.Now())
+
+	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return "", ErrPasswordTooLong
+	}
 	if err != nil {
 		return "", err
 	}
 	return string(hashedBytes), nil
 }
 
-func CheckPasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+func (h *BcryptHasher) Verify(password, encoded string) (bool, error) {
+	return verifyPassword(password, encoded)
+}
+
+// NeedsRehash reports whether a hash uses another algorithm or another cost
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	if !isBcryptHash(encoded) {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.Cost
 }
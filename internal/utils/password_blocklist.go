@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// PasswordBlocklist holds the SHA-1 hashes of passwords that must not be
+// used. Hashes are indexed by their first five hex digits like the Pwned
+// Passwords range API, so lookups follow the same k-anonymity scheme and a
+// remote range lookup could replace the local file.
+type PasswordBlocklist struct {
+	ranges map[string]map[string]struct{}
+}
+
+// LoadPasswordBlocklist reads a file with one uppercase or lowercase SHA-1
+// hash per line, optionally followed by ":count" as in the Pwned Passwords
+// downloads. Empty lines and lines starting with # are ignored.
+func LoadPasswordBlocklist(path string) (*PasswordBlocklist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open password blocklist: %w", err)
+	}
+	defer f.Close()
+
+	list := &PasswordBlocklist{ranges: make(map[string]map[string]struct{})}
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		hash, _, _ := strings.Cut(line, ":")
+		hash = strings.ToUpper(hash)
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("invalid SHA-1 hash on line %d of password blocklist", lineNo)
+		}
+
+		prefix, suffix := hash[:5], hash[5:]
+		if list.ranges[prefix] == nil {
+			list.ranges[prefix] = make(map[string]struct{})
+		}
+		list.ranges[prefix][suffix] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read password blocklist: %w", err)
+	}
+
+	return list, nil
+}
+
+// Contains reports whether a password is on the blocklist
+func (l *PasswordBlocklist) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	_, found := l.ranges[hash[:5]][hash[5:]]
+	return found
+}
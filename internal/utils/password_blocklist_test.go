@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeBlocklist writes a blocklist file and returns its path
+func writeBlocklist(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPasswordBlocklist(t *testing.T) {
+	// SHA-1 of "password" in uppercase and of "123456" in lowercase with a count
+	list, err := LoadPasswordBlocklist(writeBlocklist(t, "# common\n\n"+
+		"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8\n"+
+		"7c4a8d09ca3762af61e59520943dc26494f8941b:37359195\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for password, want := range map[string]bool{"password": true, "123456": true, "Password": false, "": false} {
+		if got := list.Contains(password); got != want {
+			t.Errorf("Contains(%q) = %v, want %v", password, got, want)
+		}
+	}
+
+	for _, content := range []string{"not a hash\n", "5BAA61E4C9B93F3F0682250B6CF8331B7EE68F\n"} {
+		if _, err := LoadPasswordBlocklist(writeBlocklist(t, content)); err == nil {
+			t.Errorf("LoadPasswordBlocklist(%q) succeeded, want an error", content)
+		}
+	}
+	if _, err := LoadPasswordBlocklist(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("LoadPasswordBlocklist(missing file) succeeded, want an error")
+	}
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go-backend-starter/internal/config"
+)
+
+func TestPasswordHashers(t *testing.T) {
+	argon := &Argon2idHasher{Memory: 1024, Time: 1, Parallelism: 1}
+	bcrypt := &BcryptHasher{Cost: 4}
+
+	for name, hasher := range map[string]PasswordHasher{"argon2id": argon, "bcrypt": bcrypt} {
+		t.Run(name, func(t *testing.T) {
+			encoded, err := hasher.Hash("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if other, err := hasher.Hash("correct horse"); err != nil || other == encoded {
+				t.Errorf("hashing twice gave %q, %v; want another salt", other, err)
+			}
+
+			if ok, err := hasher.Verify("correct horse", encoded); !ok || err != nil {
+				t.Errorf("Verify(right password) = %v, %v", ok, err)
+			}
+			if ok, err := hasher.Verify("wrong horse", encoded); ok || err != nil {
+				t.Errorf("Verify(wrong password) = %v, %v", ok, err)
+			}
+			if hasher.NeedsRehash(encoded) {
+				t.Error("NeedsRehash of a fresh hash")
+			}
+		})
+	}
+
+	t.Run("verifies hashes of the other algorithm", func(t *testing.T) {
+		encoded, err := bcrypt.Hash("correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := argon.Verify("correct horse", encoded); !ok || err != nil {
+			t.Errorf("Verify(bcrypt hash) = %v, %v", ok, err)
+		}
+		if !argon.NeedsRehash(encoded) {
+			t.Error("argon2id hasher does not rehash bcrypt hashes")
+		}
+	})
+
+	t.Run("rehashes on changed parameters", func(t *testing.T) {
+		encoded, err := argon.Hash("correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !(&Argon2idHasher{Memory: 2048, Time: 1, Parallelism: 1}).NeedsRehash(encoded) {
+			t.Error("no rehash after raising the memory")
+		}
+
+		encoded, err = bcrypt.Hash("correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !(&BcryptHasher{Cost: 5}).NeedsRehash(encoded) {
+			t.Error("no rehash after raising the cost")
+		}
+	})
+
+	t.Run("rejects unknown and malformed hashes", func(t *testing.T) {
+		for _, encoded := range []string{"", "plain", "$argon2id$v=19$m=1024$salt$key", "$argon2id$v=18$m=1024,t=1,p=1$c2FsdA$a2V5"} {
+			if ok, err := argon.Verify("correct horse", encoded); ok || err == nil {
+				t.Errorf("Verify(%q) = %v, %v; want an error", encoded, ok, err)
+			}
+		}
+	})
+
+	t.Run("bcrypt rejects passwords it would truncate", func(t *testing.T) {
+		if _, err := bcrypt.Hash(strings.Repeat("a", 73)); !errors.Is(err, ErrPasswordTooLong) {
+			t.Errorf("Hash(73 bytes) error = %v, want ErrPasswordTooLong", err)
+		}
+		if _, err := bcrypt.Hash(strings.Repeat("a", 72)); err != nil {
+			t.Errorf("Hash(72 bytes): %v", err)
+		}
+	})
+}
+
+func TestNewPasswordHasher(t *testing.T) {
+	for _, cfg := range []config.PasswordConfig{
+		{Algorithm: "argon2id"},
+		{Algorithm: "bcrypt", BcryptCost: 3},
+		{Algorithm: "scrypt"},
+	} {
+		if _, err := NewPasswordHasher(&cfg); err == nil {
+			t.Errorf("NewPasswordHasher(%+v) succeeded, want an error", cfg)
+		}
+	}
+
+	hasher, err := NewPasswordHasher(&config.PasswordConfig{Argon2Memory: 1024, Argon2Time: 1, Argon2Parallelism: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := hasher.(*Argon2idHasher); !ok {
+		t.Errorf("default hasher is %T, want argon2id", hasher)
+	}
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors, base32 encoded
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTP(t *testing.T) {
+	// The RFC vectors have 8 digits; 6 digit codes are their last 6
+	for _, tt := range []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	} {
+		at := time.Unix(tt.unix, 0)
+		step, ok := ValidateTOTP(rfc6238Secret, tt.code, at)
+		if !ok || step != tt.unix/totpPeriod {
+			t.Errorf("code %s at %d: step %d, %v; want step %d", tt.code, tt.unix, step, ok, tt.unix/totpPeriod)
+		}
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	at := time.Unix(1234567890, 0)
+	code := "005924"
+
+	// One step of clock drift either way is tolerated, two are not
+	for _, drift := range []time.Duration{-totpPeriod * time.Second, totpPeriod * time.Second} {
+		if _, ok := ValidateTOTP(rfc6238Secret, code, at.Add(drift)); !ok {
+			t.Errorf("rejected with %v drift", drift)
+		}
+	}
+	for _, drift := range []time.Duration{-2 * totpPeriod * time.Second, 2 * totpPeriod * time.Second} {
+		if _, ok := ValidateTOTP(rfc6238Secret, code, at.Add(drift)); ok {
+			t.Errorf("accepted with %v drift", drift)
+		}
+	}
+
+	// Lower case secrets are accepted; malformed input is not
+	if _, ok := ValidateTOTP(strings.ToLower(rfc6238Secret), code, at); !ok {
+		t.Error("rejected a lower case secret")
+	}
+	for _, c := range []string{"", "05924", "0059240", "abcdef"} {
+		if _, ok := ValidateTOTP(rfc6238Secret, c, at); ok {
+			t.Errorf("accepted code %q", c)
+		}
+	}
+	if _, ok := ValidateTOTP("not base32!", code, at); ok {
+		t.Error("accepted an invalid secret")
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Errorf("secret %q decodes to %d bytes, %v; want 20", secret, len(key), err)
+	}
+	if other, _ := GenerateTOTPSecret(); other == secret {
+		t.Error("two secrets are equal")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri, err := url.Parse(TOTPURI("My App", "alice", "SECRET"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/My App:alice" {
+		t.Errorf("uri = %s", uri)
+	}
+	q := uri.Query()
+	if q.Get("secret") != "SECRET" || q.Get("issuer") != "My App" || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Errorf("query = %v", q)
+	}
+	if strings.Contains(uri.RawQuery, "+") {
+		t.Errorf("query %q encodes spaces as +", uri.RawQuery)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	code, err := GenerateRecoveryCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code) != 11 || code[5] != '-' {
+		t.Errorf("code = %q, want xxxxx-xxxxx", code)
+	}
+
+	normalized := NormalizeRecoveryCode(code)
+	for _, typed := range []string{strings.ToUpper(code), strings.ReplaceAll(code, "-", ""), code[:5] + " " + code[6:]} {
+		if got := NormalizeRecoveryCode(typed); got != normalized {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q, want %q", typed, got, normalized)
+		}
+	}
+}